@@ -0,0 +1,137 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/urfave/cli.v2"
+
+	"go.cryptoscope.co/ssb/restful/params"
+)
+
+var configCmd = &cli.Command{
+	Name:  "config",
+	Usage: "inspect the configuration of the metalife services",
+	Subcommands: []*cli.Command{
+		configCheckCmd,
+		configDumpCmd,
+	},
+}
+
+var configCheckCmd = &cli.Command{
+	Name:  "check",
+	Usage: "validate the config file, the METALIFE_ environment and the flags",
+	Action: func(ctx *cli.Context) error {
+		if _, err := loadConfig(ctx); err != nil {
+			return err
+		}
+		fmt.Println("config ok")
+		return nil
+	},
+}
+
+var configDumpCmd = &cli.Command{
+	Name:  "dump",
+	Usage: "print the effective configuration as toml",
+	Action: func(ctx *cli.Context) error {
+		cfg, err := loadConfig(ctx)
+		if err != nil {
+			return err
+		}
+		return cfg.Dump(os.Stdout)
+	},
+}
+
+// loadConfig the defaults, overridden by the --config file, then by the METALIFE_ environment and then by the flags that are set
+func loadConfig(ctx *cli.Context) (*params.Config, error) {
+	cfg := params.DefaultConfig()
+	if path := ctx.String("config"); path != "" {
+		var err error
+		cfg, err = params.LoadConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.ApplyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	if err := applyFlags(ctx, cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyFlags the flags of the command line that were set explicitly
+func applyFlags(ctx *cli.Context, cfg *params.Config) error {
+	setString := func(name string, v *string) {
+		if ctx.IsSet(name) {
+			*v = ctx.String(name)
+		}
+	}
+	setInt := func(name string, v *int) {
+		if ctx.IsSet(name) {
+			*v = ctx.Int(name)
+		}
+	}
+	setBool := func(name string, v *bool) {
+		if ctx.IsSet(name) {
+			*v = ctx.Bool(name)
+		}
+	}
+	setDuration := func(name string, v *params.Duration) {
+		if ctx.IsSet(name) {
+			v.Duration = ctx.Duration(name)
+		}
+	}
+
+	setString("shscap", &cfg.Pub.SHSCap)
+	setString("addr", &cfg.Pub.Addr)
+	setString("remoteKey", &cfg.Pub.RemoteKey)
+	setString("key", &cfg.Pub.Key)
+	setString("unixsock", &cfg.Pub.UnixSock)
+	setString("datadir", &cfg.Pub.DataDir)
+	setString("pub-eth-address", &cfg.Pub.EthAddress)
+
+	setInt("service-port", &cfg.API.Port)
+	setDuration("shutdown-timeout", &cfg.API.ShutdownTimeout)
+
+	setString("token-address", &cfg.Photon.TokenAddress)
+	setString("photon-host", &cfg.Photon.Host)
+	setInt("settle-timeout", &cfg.Photon.SettleTimeout)
+	setInt("min-balance-inchannel", &cfg.Photon.MinBalanceInchannel)
+
+	if ctx.IsSet("message-scan-interval") {
+		cfg.Analysis.MessageScanInterval.Duration = time.Second * time.Duration(ctx.Int("message-scan-interval"))
+	}
+	setString("sensitive-words-file", &cfg.Analysis.SensitiveWordsFile)
+
+	setInt("report-rewarding", &cfg.Rewards.ReportProblematicPost)
+	setInt("registration-rewarding-mlt", &cfg.Rewards.Signup)
+	setInt("registration-rewarding-smt", &cfg.Rewards.SignupSMT)
+
+	setBool("moderation-publish", &cfg.Moderation.Publish)
+	if ctx.IsSet("moderation-trusted-pubs") {
+		cfg.Moderation.TrustedPubs = ctx.StringSlice("moderation-trusted-pubs")
+	}
+	setBool("moderation-auto-apply", &cfg.Moderation.AutoApply)
+
+	for _, limit := range ctx.StringSlice("rate-limit") {
+		path, rule, err := params.ParseRateLimitRule(limit)
+		if err != nil {
+			return err
+		}
+		cfg.RateLimit[path] = rule
+	}
+
+	setBool("attestation-required", &cfg.Attestation.Required)
+	setDuration("attestation-window", &cfg.Attestation.Window)
+	return nil
+}
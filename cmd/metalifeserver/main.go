@@ -77,7 +77,6 @@ func init() {
 	//unixSockFlag.Value = filepath.Join(u.HomeDir, ".ssb-go", "socket")
 	dataDir.Value = filepath.Join(u.HomeDir, ".ssb-go", "pubdata")
 	sensitiveWordsFlag.Value = filepath.Join(u.HomeDir, ".ssb-go", "sensitive.txt")
-	params.Ip2LocationLiteDbPath = filepath.Join(u.HomeDir, ".ssb-go", "IP2LOCATION-LITE-DB11.IPV6.BIN")
 
 	log = term.NewColorLogger(os.Stderr, kitlog.NewLogfmtLogger, colorFn)
 }
@@ -88,6 +87,7 @@ var app = cli.App{
 	Version: "beta1",
 
 	Flags: []cli.Flag{
+		&cli.StringFlag{Name: "config", EnvVars: []string{"METALIFE_CONFIG"}, Usage: "toml file with the configuration of the metalife services, the flags that are set override it"},
 		&cli.StringFlag{Name: "shscap", Value: "1KHLiKZvAvjbY1ziZEHMXawbCEIM6qwjCDm3VYRan/s=", Usage: "shs key"},
 		&cli.StringFlag{Name: "addr", Value: params.PubTcpHostAddress, Usage: "tcp address of the sbot to connect to (or listen on)"},
 		&cli.StringFlag{Name: "remoteKey", Value: "", Usage: "the remote pubkey you are connecting to (by default the local key)"},
@@ -103,6 +103,13 @@ var app = cli.App{
 		&cli.IntFlag{Name: "registration-rewarding-mlt", Value: 0, Usage: "pub will reward the person who provides ethereum address for his ssb client. (unit: 1e15 wei)"},
 		&cli.IntFlag{Name: "registration-rewarding-smt", Value: 0, Usage: "pub will reward the person who provides ethereum address for his ssb client. (unit: 1e15 wei)"},
 		&sensitiveWordsFlag,
+		&cli.BoolFlag{Name: "moderation-publish", Value: true, Usage: "publish the administrator's decisions on reports as 'metalife/moderation' messages."},
+		&cli.StringSliceFlag{Name: "moderation-trusted-pubs", Usage: "feed ids of other metalife pubs whose 'metalife/moderation' decisions are imported for review."},
+		&cli.BoolFlag{Name: "moderation-auto-apply", Usage: "block the defendants of imported decisions at once, without review."},
+		&cli.StringSliceFlag{Name: "rate-limit", Usage: "rate limit of a restful route, path=ip-rate:ip-burst:feed-rate:feed-burst (rate unit: calls/second, 0 disables the bucket)."},
+		&cli.BoolFlag{Name: "attestation-required", Value: true, Usage: "reject unsigned notify-login and notify-created-nft requests."},
+		&cli.DurationFlag{Name: "attestation-window", Value: 5 * time.Minute, Usage: "how far the timestamp of a signed request may be off, a signature is accepted once within this window."},
+		&cli.DurationFlag{Name: "shutdown-timeout", Value: 30 * time.Second, Usage: "how long the restful api waits for running requests when the pub stops (SIGTERM)."},
 		&keyFileFlag,
 		&unixSockFlag,
 		&cli.BoolFlag{Name: "verbose,vv", Usage: "print muxrpc packets"},
@@ -111,7 +118,11 @@ var app = cli.App{
 	},
 
 	Before: initClient,
+	Action: runServices,
 	Commands: []*cli.Command{
+		configCmd,
+		reindexCmd,
+		simulateRewardsCmd,
 		aliasCmd,
 		blobsCmd,
 		blockCmd,
@@ -165,73 +176,6 @@ func todo(ctx *cli.Context) error {
 }
 
 func initClient(ctx *cli.Context) error {
-	//init usr config
-	tokenaddressStr := ctx.String("token-address")
-	if tokenaddressStr == "" {
-		return fmt.Errorf("Program startup parameters [token-address] must be set")
-	}
-	params.TokenAddress = tokenaddressStr
-
-	apihost, apiport, err := net.SplitHostPort(ctx.String("photon-host"))
-	if err != nil {
-		return err
-	}
-	params.PhotonHost = apihost + ":" + apiport
-
-	pubethaddressStr := ctx.String("pub-eth-address")
-	if len(pubethaddressStr) != 42 || pubethaddressStr[0:2] != "0x" {
-		return fmt.Errorf("Program startup parameters [pub-eth-address] must be set")
-	}
-	params.PhotonAddress = pubethaddressStr
-
-	settletimeoutInt := ctx.Int("settle-timeout")
-	if settletimeoutInt <= 0 {
-		return fmt.Errorf("settle timeout should > 0")
-	}
-	params.SettleTime = settletimeoutInt
-
-	serveportInt := ctx.Int("service-port")
-	if serveportInt <= 0 {
-		return fmt.Errorf("service-port %v error", serveportInt)
-	}
-	params.ServePort = serveportInt
-
-	messagescanintervalInt := ctx.Int("message-scan-interval")
-	if messagescanintervalInt <= 0 {
-		return fmt.Errorf("service-port %v error", messagescanintervalInt)
-	}
-	params.MsgScanInterval = time.Second * time.Duration(messagescanintervalInt)
-
-	minbalance := ctx.Int("min-balance-inchannel")
-	if minbalance <= 0 {
-		return fmt.Errorf("min-balance-inchannel %v error", minbalance)
-	}
-	params.MinBalanceInchannel = minbalance
-
-	reportrewarding := ctx.Int("report-rewarding")
-	if reportrewarding < 0 {
-		return fmt.Errorf("report-rewarding %v error", reportrewarding)
-	}
-	params.RewardOfReportProblematicPost = reportrewarding
-
-	registrationawarding := ctx.Int("registration-rewarding-mlt")
-	if registrationawarding < 0 {
-		return fmt.Errorf("registration-rewarding-mlt %v error", registrationawarding)
-	}
-	params.RewardOfSignup = registrationawarding
-
-	registrationawardSMT := ctx.Int("registration-rewarding-smt")
-	if registrationawardSMT < 0 {
-		return fmt.Errorf("registration-rewarding-smt %v error", registrationawardSMT)
-	}
-	params.RewardOfSignupSMT = registrationawardSMT
-
-	sensitivewordsfilepath := ctx.String("sensitive-words-file")
-	if sensitivewordsfilepath == "" {
-		return fmt.Errorf("Program startup parameters [sensitive-words-file] must be set")
-	}
-	params.SensitiveWordsFilePath = sensitivewordsfilepath
-
 	dstr := ctx.String("timeout")
 	if dstr != "" {
 		d, err := time.ParseDuration(dstr)
@@ -242,22 +186,38 @@ func initClient(ctx *cli.Context) error {
 	} else {
 		longctx, shutdownFunc = context.WithCancel(context.Background())
 	}
+	return nil
+}
 
-	signalc := make(chan os.Signal)
+// runServices runs the restful api and the message analysis until the process gets a signal
+func runServices(ctx *cli.Context) error {
+	cfg, err := loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	//the first signal stops the services, a second one exits at once
+	runCtx, stopServices := context.WithCancel(context.Background())
+	defer stopServices()
+	signalc := make(chan os.Signal, 2)
 	signal.Notify(signalc, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		s := <-signalc
 		level.Warn(log).Log("event", "shutting down", "sig", s)
+		stopServices()
 		shutdownFunc()
-		time.Sleep(1 * time.Second)
-		os.Exit(0)
+		s = <-signalc
+		level.Warn(log).Log("event", "forced exit", "sig", s)
+		os.Exit(1)
 	}()
 
-	fmt.Println(fmt.Sprintf("\n******os.args=%q", os.Args))
+	level.Debug(log).Log("event", "starting", "args", fmt.Sprintf("%q", os.Args))
 
 	//start pub message analysis service
-	restful.Start(ctx)
-
+	if err := restful.Start(runCtx, cfg, kitlog.With(log, "ts", kitlog.DefaultTimestamp)); err != nil {
+		return err
+	}
+	level.Info(log).Log("event", "services stopped")
 	return nil
 }
 
@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	kitlog "go.mindeco.de/log"
+	"gopkg.in/urfave/cli.v2"
+
+	"go.cryptoscope.co/ssb/restful"
+)
+
+var reindexCmd = &cli.Command{
+	Name:  "reindex",
+	Usage: "replay the receive log into a fresh metalife database without paying rewards and compare it with the existing one",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{Name: "swap", Usage: "replace the existing database with the fresh one, keeping it as a backup (stop the services first)"},
+	},
+	Action: func(ctx *cli.Context) error {
+		cfg, err := loadConfig(ctx)
+		if err != nil {
+			return err
+		}
+		rr, err := restful.Reindex(longctx, cfg, ctx.Bool("swap"), kitlog.With(log, "ts", kitlog.DefaultTimestamp))
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "table\texisting\treindexed\tonly existing\tonly reindexed")
+		for _, d := range rr.Tables {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\n", d.Table, d.Existing, d.Reindexed, d.OnlyExisting, d.OnlyReindex)
+		}
+		if err = tw.Flush(); err != nil {
+			return err
+		}
+		fmt.Printf("%d messages replayed into %s\n", rr.Messages, rr.Path)
+		if rr.Backup != "" {
+			fmt.Printf("the existing database was kept as %s\n", rr.Backup)
+		}
+		if !rr.Equal() {
+			fmt.Println("the databases differ")
+		}
+		return nil
+	},
+}
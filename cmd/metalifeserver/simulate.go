@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	kitlog "go.mindeco.de/log"
+	"gopkg.in/urfave/cli.v2"
+
+	"go.cryptoscope.co/ssb/restful"
+	"go.cryptoscope.co/ssb/restful/params"
+)
+
+var simulateRewardsCmd = &cli.Command{
+	Name:  "simulate-rewards",
+	Usage: "replay a time range of the log with a candidate reward policy and report its token spend, nothing is paid",
+	Flags: []cli.Flag{
+		&cli.StringFlag{Name: "policy", Usage: "toml file with a [rewards] table like the config, the keys it leaves out keep the value of the config"},
+		&cli.StringFlag{Name: "from", Usage: "first day of the range, 2006-01-02 (pub local time), the start of the log without it"},
+		&cli.StringFlag{Name: "to", Usage: "day after the range, 2006-01-02 (pub local time), now without it"},
+		&cli.IntFlag{Name: "users", Value: 20, Usage: "how many of the feeds with the most tokens are listed, 0 for all"},
+		&cli.BoolFlag{Name: "json", Usage: "print the whole report as json"},
+	},
+	Action: func(ctx *cli.Context) error {
+		cfg, err := loadConfig(ctx)
+		if err != nil {
+			return err
+		}
+		policy := cfg.Rewards
+		if path := ctx.String("policy"); path != "" {
+			if policy, err = params.LoadRewardPolicy(path, cfg.Rewards); err != nil {
+				return err
+			}
+		}
+		from, to := int64(0), time.Now().UnixNano()/1e6
+		if day := ctx.String("from"); day != "" {
+			if from, err = parseDay(day); err != nil {
+				return fmt.Errorf("from: %w", err)
+			}
+		}
+		if day := ctx.String("to"); day != "" {
+			if to, err = parseDay(day); err != nil {
+				return fmt.Errorf("to: %w", err)
+			}
+		}
+
+		sim, err := restful.SimulateRewards(longctx, cfg, policy, from, to, kitlog.With(log, "ts", kitlog.DefaultTimestamp))
+		if err != nil {
+			return err
+		}
+		if ctx.Bool("json") {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(sim)
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		current := make(map[string]*restful.SimulatedRewards)
+		for _, r := range sim.Current.Reasons {
+			current[r.Reason] = r
+		}
+		fmt.Fprintln(tw, "reason\trewards\ttokens\trejected\tno address\tcurrent tokens")
+		for _, r := range sim.Candidate.Reasons {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\n", r.Reason, r.Rewards, r.Tokens, r.Rejected, r.NoAddress, current[r.Reason].Tokens)
+		}
+		fmt.Fprintf(tw, "total\t%d\t%d\t\t\t%d\n\n", sim.Candidate.Rewards, sim.Candidate.Tokens, sim.Current.Tokens)
+
+		users := sim.Candidate.Users
+		if n := ctx.Int("users"); n > 0 && n < len(users) {
+			users = users[:n]
+		}
+		fmt.Fprintln(tw, "feed\teth address\trewards\ttokens\trejected")
+		for _, u := range users {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\n", u.ClientID, u.EthAddress, u.Rewards, u.Tokens, u.Rejected)
+		}
+		return tw.Flush()
+	},
+}
+
+// parseDay the start of day, 2006-01-02 in local time, in unix milliseconds
+func parseDay(day string) (int64, error) {
+	t, err := time.ParseInLocation("2006-01-02", day, time.Local)
+	if err != nil {
+		return 0, err
+	}
+	return t.UnixNano() / 1e6, nil
+}
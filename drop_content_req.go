@@ -49,6 +49,15 @@ func (dcr DropContentRequest) Valid(log margaret.Log) bool {
 		return false
 	}
 
+	return dcr.ValidFor(msg)
+}
+
+// ValidFor checks if the request is valid for msg, the message at its sequence of the feed of its author
+func (dcr DropContentRequest) ValidFor(msg refs.Message) bool {
+	if dcr.Sequence < 1 || msg.Seq() != int64(dcr.Sequence) {
+		return false
+	}
+
 	if msg.Author().Algo() != refs.RefAlgoFeedGabby {
 		return false
 	}
@@ -26,3 +26,20 @@ func (e ErrWrongSequence) Error() string {
 		e.Stored,
 		e.Logical)
 }
+
+// ErrInvalidMessage is returned if a stored message of a feed does not pass the verification of its feed format again,
+// the signature, the previous hash or the sequence against the message before it
+type ErrInvalidMessage struct {
+	Ref      refs.FeedRef
+	Sequence int64
+	Reason   error
+}
+
+func (e ErrInvalidMessage) Error() string {
+	return fmt.Sprintf("ssb/consistency error: message %d of feed %s is invalid: %s",
+		e.Sequence,
+		e.Ref.String(),
+		e.Reason)
+}
+
+func (e ErrInvalidMessage) Unwrap() error { return e.Reason }
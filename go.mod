@@ -12,6 +12,7 @@ replace github.com/ant0ine/go-json-rest@v3.3.2+incompatible/rest => ../ant0ine/g
 
 require (
 	filippo.io/edwards25519 v1.0.0-rc.1
+	github.com/BurntSushi/toml v0.3.1
 	github.com/RoaringBitmap/roaring v0.6.1
 	github.com/VividCortex/gohistogram v1.0.0
 	github.com/ant0ine/go-json-rest v3.3.2+incompatible // indirect
@@ -0,0 +1,243 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package indexes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/margaret"
+)
+
+// fanOutBuffer is how many messages an index can lag behind the reader before the reader waits for it
+const fanOutBuffer = 256
+
+// errNotFannable is returned by FanOut.Add for query specs that don't just say where an index starts
+var errNotFannable = errors.New("fanout: query spec is more than a start position")
+
+// FanOut fills many indexes from a single read of a log.
+// Each message is read and decoded once and poured into every index that didn't see it yet,
+// through a bounded queue per index. The indexes keep their own position, like when they read the log on their own.
+type FanOut struct {
+	workers chan struct{}
+
+	mu      sync.Mutex
+	running bool
+	sinks   []*fanOutSink
+}
+
+type fanOutSink struct {
+	name string
+	from int64 // the last sequence the index has seen
+
+	snk  luigi.Sink
+	done func(error)
+
+	queue chan margaret.SeqWrapper
+}
+
+// NewFanOut returns a FanOut that lets at most workers indexes process messages at the same time.
+// A count of zero or less uses the number of CPUs.
+func NewFanOut(workers int) *FanOut {
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	return &FanOut{
+		workers: make(chan struct{}, workers),
+	}
+}
+
+// Add registers an index that wants the messages spec asks for, poured into snk.
+// The spec may only say where the index starts and that it wants sequence wrapped messages,
+// other specs and indexes that are added after Run started return an error and have to read the log on their own.
+// done is called once the index saw the end of the log as it was when Run started, or with the error that stopped it.
+func (fo *FanOut) Add(name string, spec margaret.QuerySpec, snk luigi.Sink, done func(error)) error {
+	var start startQuery
+	start.gt = margaret.SeqEmpty
+	if err := spec(&start); err != nil {
+		return err
+	}
+
+	fo.mu.Lock()
+	defer fo.mu.Unlock()
+	if fo.running {
+		return fmt.Errorf("fanout: %s was added after the log was read", name)
+	}
+
+	fo.sinks = append(fo.sinks, &fanOutSink{
+		name: name,
+		from: start.gt,
+		snk:  snk,
+		done: done,
+
+		queue: make(chan margaret.SeqWrapper, fanOutBuffer),
+	})
+	return nil
+}
+
+// Run reads rxlog once, from the lowest position of the indexes up to its current end, and fills the indexes.
+// It returns after the done functions of all the indexes were called.
+func (fo *FanOut) Run(ctx context.Context, rxlog margaret.Log) {
+	fo.mu.Lock()
+	fo.running = true
+	sinks := fo.sinks
+	fo.sinks = nil
+	fo.mu.Unlock()
+
+	if len(sinks) == 0 {
+		return
+	}
+
+	from := sinks[0].from
+	for _, s := range sinks[1:] {
+		if s.from < from {
+			from = s.from
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, len(sinks))
+	)
+	wg.Add(len(sinks))
+	for i, s := range sinks {
+		go func(i int, s *fanOutSink) {
+			defer wg.Done()
+			errs[i] = fo.pour(ctx, s)
+		}(i, s)
+	}
+
+	readErr := fo.read(ctx, rxlog, from, sinks)
+	for _, s := range sinks {
+		close(s.queue)
+	}
+	if readErr != nil {
+		cancel()
+	}
+	wg.Wait()
+
+	for i, s := range sinks {
+		err := errs[i]
+		if err == nil {
+			err = readErr
+		}
+		s.done(err)
+	}
+}
+
+// read pours the messages after from into the queues of the indexes that need them
+func (fo *FanOut) read(ctx context.Context, rxlog margaret.Log, from int64, sinks []*fanOutSink) error {
+	src, err := rxlog.Query(margaret.Gt(from), margaret.SeqWrap(true), margaret.Live(false))
+	if err != nil {
+		return fmt.Errorf("fanout: failed to query log: %w", err)
+	}
+
+	for {
+		v, err := src.Next(ctx)
+		if err != nil {
+			if luigi.IsEOS(err) {
+				return nil
+			}
+			return err
+		}
+
+		sw, ok := v.(margaret.SeqWrapper)
+		if !ok {
+			return fmt.Errorf("fanout: expected a sequence wrapped value but got %T", v)
+		}
+		seq := sw.Seq()
+
+		for _, s := range sinks {
+			if seq <= s.from {
+				continue
+			}
+			select {
+			case s.queue <- sw:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// pour empties the queue of an index into its sink, holding a worker while there is something to do.
+// After an error the rest of the queue is dropped, the index reads it again when it is served the next time.
+func (fo *FanOut) pour(ctx context.Context, s *fanOutSink) error {
+	var err error
+	for v := range s.queue {
+		if err != nil {
+			continue
+		}
+
+		select {
+		case fo.workers <- struct{}{}:
+		case <-ctx.Done():
+			err = ctx.Err()
+			continue
+		}
+
+		err = s.snk.Pour(ctx, v)
+	drain:
+		for err == nil {
+			select {
+			case next, ok := <-s.queue:
+				if !ok {
+					break drain
+				}
+				err = s.snk.Pour(ctx, next)
+			default:
+				break drain
+			}
+		}
+
+		<-fo.workers
+
+		if err != nil {
+			err = fmt.Errorf("fanout: index %s failed: %w", s.name, err)
+		}
+	}
+	return err
+}
+
+// startQuery is a margaret.Query that records where a query spec starts
+type startQuery struct {
+	gt int64
+}
+
+func (q *startQuery) Gt(s int64) error {
+	if s > q.gt {
+		q.gt = s
+	}
+	return nil
+}
+
+func (q *startQuery) Gte(s int64) error { return q.Gt(s - 1) }
+
+func (q *startQuery) Lt(int64) error  { return errNotFannable }
+func (q *startQuery) Lte(int64) error { return errNotFannable }
+func (q *startQuery) Limit(int) error { return errNotFannable }
+
+func (q *startQuery) Reverse(yes bool) error {
+	if yes {
+		return errNotFannable
+	}
+	return nil
+}
+
+func (q *startQuery) Live(bool) error { return nil }
+
+func (q *startQuery) SeqWrap(wrap bool) error {
+	if !wrap {
+		return errNotFannable
+	}
+	return nil
+}
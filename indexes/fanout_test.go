@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package indexes_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/mem"
+
+	"go.cryptoscope.co/ssb/indexes"
+)
+
+// seqSink records the sequences it sees and fails at failAt
+type seqSink struct {
+	seqs   []int64
+	failAt int64
+}
+
+func (ss *seqSink) sink() luigi.Sink {
+	return luigi.FuncSink(func(ctx context.Context, v interface{}, err error) error {
+		if err != nil {
+			return nil
+		}
+		seq := v.(margaret.SeqWrapper).Seq()
+		if ss.failAt > 0 && seq == ss.failAt {
+			return errors.New("broken index")
+		}
+		ss.seqs = append(ss.seqs, seq)
+		return nil
+	})
+}
+
+func TestFanOut(t *testing.T) {
+	r := require.New(t)
+
+	rxlog := mem.New()
+	const n = 1000
+	for i := 0; i < n; i++ {
+		_, err := rxlog.Append(i)
+		r.NoError(err)
+	}
+
+	var (
+		fresh, behind, broken seqSink
+		errs                  = make(map[string]error)
+	)
+	broken.failAt = 500
+
+	done := func(name string) func(error) {
+		return func(err error) { errs[name] = err }
+	}
+
+	fo := indexes.NewFanOut(2)
+	r.NoError(fo.Add("fresh", margaret.SeqWrap(true), fresh.sink(), done("fresh")))
+	r.NoError(fo.Add("behind", margaret.MergeQuerySpec(margaret.Gt(n-11), margaret.SeqWrap(true)), behind.sink(), done("behind")))
+	r.NoError(fo.Add("broken", margaret.SeqWrap(true), broken.sink(), done("broken")))
+
+	// only the start of the log can be shared
+	err := fo.Add("limited", margaret.Limit(10), luigi.FuncSink(nil), done("limited"))
+	r.Error(err)
+	err = fo.Add("reversed", margaret.Reverse(true), luigi.FuncSink(nil), done("reversed"))
+	r.Error(err)
+
+	fo.Run(context.TODO(), rxlog)
+
+	r.Len(errs, 3)
+	r.NoError(errs["fresh"])
+	r.NoError(errs["behind"])
+	r.Error(errs["broken"])
+
+	r.Len(fresh.seqs, n)
+	for i, seq := range fresh.seqs {
+		r.EqualValues(i, seq)
+	}
+	r.Equal([]int64{990, 991, 992, 993, 994, 995, 996, 997, 998, 999}, behind.seqs)
+	r.Len(broken.seqs, 500)
+
+	// indexes that come later read the log on their own
+	r.Error(fo.Add("late", margaret.SeqWrap(true), luigi.FuncSink(nil), done("late")))
+}
@@ -7,6 +7,7 @@ package storedrefs
 
 import (
 	"fmt"
+	"strings"
 
 	"go.cryptoscope.co/margaret/indexes"
 	refs "go.mindeco.de/ssb-refs"
@@ -56,3 +57,31 @@ func TangleV2(name string, r refs.MessageRef) indexes.Addr {
 	r.CopyHashTo(addr[4+len(name):])
 	return indexes.Addr(addr)
 }
+
+// Channel shows how we encode channels for the storage layer, the name is normalized by NormalizeChannel.
+func Channel(name string) indexes.Addr {
+	return indexes.Addr("channel:" + NormalizeChannel(name))
+}
+
+// Mention shows how we encode the messages that mention a feed for the storage layer
+func Mention(r refs.FeedRef) indexes.Addr {
+	return indexes.Addr("mention:") + Feed(r)
+}
+
+// the characters that ssb-ref drops from channel names
+var channelReplacer = strings.NewReplacer(
+	" ", "", "\t", "", "\n", "", "\r", "",
+	",", "", ".", "", "?", "", "!", "",
+	"<", "", ">", "", "(", "", ")", "",
+	"[", "", "]", "", `"`, "", "#", "",
+)
+
+// NormalizeChannel turns a channel name into the form the js stack uses (lower case, without # and punctuation, at most 30 characters).
+// It returns an empty string for names that are empty after that.
+func NormalizeChannel(name string) string {
+	name = channelReplacer.Replace(strings.ToLower(name))
+	if r := []rune(name); len(r) > 30 {
+		name = string(r[:30])
+	}
+	return name
+}
@@ -28,3 +28,19 @@ func TestTangles(t *testing.T) {
 	gotv2 := TangleV2("fooo", msgRef)
 	assert.Equal(t, wantv2, []byte(gotv2))
 }
+
+func TestNormalizeChannel(t *testing.T) {
+	cases := []struct{ in, want string }{
+		{"go", "go"},
+		{"#Go", "go"},
+		{"new-stuff", "new-stuff"},
+		{"what? (no!)", "whatno"},
+		{"#", ""},
+		{"abcdefghijklmnopqrstuvwxyz0123456789", "abcdefghijklmnopqrstuvwxyz0123"},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.want, NormalizeChannel(tc.in), "input: %q", tc.in)
+	}
+
+	assert.Equal(t, "channel:go", string(Channel("#GO")))
+}
@@ -88,6 +88,32 @@ type MessagesByTypeArgs struct {
 	Type string `json:"type"`
 }
 
+// MessagesByChannelArgs defines the query parameters for the messagesByChannel rpc call
+type MessagesByChannelArgs struct {
+	CommonArgs
+	StreamArgs
+
+	Channel string `json:"channel"`
+}
+
+// MentionsArgs defines the query parameters for the mentions rpc call
+type MentionsArgs struct {
+	CommonArgs
+	StreamArgs
+
+	// ID is the feed that was mentioned, the remote feed of the call if it is empty
+	ID *refs.FeedRef `json:"id,omitempty"`
+}
+
+// SearchArgs defines the query parameters for the search.query rpc call
+type SearchArgs struct {
+	CommonArgs
+	StreamArgs
+
+	// Query is the text to search for, all of its terms need to be in a message
+	Query string `json:"query"`
+}
+
 // TanglesArgs specifies the root of the thread to read.
 type TanglesArgs struct {
 	CommonArgs
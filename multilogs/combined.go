@@ -37,9 +37,11 @@ import (
 const (
 	IndexNamePrivates = "privates"
 	IndexNameFeeds    = "userFeeds"
+	IndexNameChannels = "channels"
+	IndexNameMentions = "mentions"
 )
 
-// NewCombinedIndex creates one big index which updates the multilogs users, byType, private and tangles.
+// NewCombinedIndex creates one big index which updates the multilogs users, byType, private, tangles, channels and mentions.
 // Compared to the "old" fatbot approach of just having 4 independant indexes,
 // this one updates all 4 of them, resulting in less read-overhead
 // while also being able to index private massages by tangle and type.
@@ -48,7 +50,7 @@ func NewCombinedIndex(
 	box *private.Manager,
 	self refs.FeedRef,
 	rxlog margaret.Log,
-	u, p, bt, tan *roaring.MultiLog,
+	u, p, bt, tan, ch, men *roaring.MultiLog,
 	oh multilog.MultiLog,
 	sm *statematrix.StateMatrix,
 ) (*CombinedIndex, error) {
@@ -69,10 +71,12 @@ func NewCombinedIndex(
 		boxer: box,
 
 		// application multilogs
-		users:   u,
-		private: p,
-		byType:  bt,
-		tangles: tan,
+		users:    u,
+		private:  p,
+		byType:   bt,
+		tangles:  tan,
+		channels: ch,
+		mentions: men,
 
 		ebtState: sm,
 
@@ -96,10 +100,12 @@ type CombinedIndex struct {
 
 	rxlog margaret.Log
 
-	users   *roaring.MultiLog
-	private *roaring.MultiLog
-	byType  *roaring.MultiLog
-	tangles *roaring.MultiLog
+	users    *roaring.MultiLog
+	private  *roaring.MultiLog
+	byType   *roaring.MultiLog
+	tangles  *roaring.MultiLog
+	channels *roaring.MultiLog
+	mentions *roaring.MultiLog
 
 	orderdHelper multilog.MultiLog
 
@@ -245,8 +251,9 @@ func (idx *CombinedIndex) update(rxSeq int64, msg refs.Message) error {
 
 	// decrypt box 1 & 2
 	content := msg.ContentBytes()
+	boxed := content[0] != '{'
 	// TODO: gabby grove
-	if content[0] != '{' { // assuming all other content is json objects
+	if boxed { // assuming all other content is json objects
 		cleartext, err := idx.tryDecrypt(msg, rxSeq)
 		if err != nil {
 			if err == errSkip {
@@ -264,7 +271,6 @@ func (idx *CombinedIndex) update(rxSeq int64, msg refs.Message) error {
 		Type    string
 		Root    *refs.MessageRef
 		Tangles refs.Tangles
-		// Mentions [] TODO channels and mentions
 	}
 	err = json.Unmarshal(content, &jsonContent)
 	if err != nil {
@@ -341,6 +347,54 @@ func (idx *CombinedIndex) update(rxSeq int64, msg refs.Message) error {
 		}
 	}
 
+	// only public posts, the sublogs are served to anyone
+	if typeStr == "post" && !boxed {
+		return idx.updateChannelsAndMentions(rxSeq, content)
+	}
+
+	return nil
+}
+
+// updateChannelsAndMentions adds a post to the channel:<name> and mention:<feed> sublogs
+func (idx *CombinedIndex) updateChannelsAndMentions(rxSeq int64, content []byte) error {
+	// the fields are checked one by one, a broken one shouldn't hide the others
+	var post struct {
+		Channel  json.RawMessage
+		Mentions json.RawMessage
+		Text     json.RawMessage
+	}
+	err := json.Unmarshal(content, &post)
+	if err != nil {
+		return nil
+	}
+	var channel, text string
+	json.Unmarshal(post.Channel, &channel)
+	json.Unmarshal(post.Text, &text)
+
+	channels, mentioned := postChannelsAndMentions(channel, post.Mentions, text)
+
+	for _, name := range channels {
+		chanLog, err := idx.channels.Get(storedrefs.Channel(name))
+		if err != nil {
+			return fmt.Errorf("error opening sublog: %w", err)
+		}
+		_, err = chanLog.Append(rxSeq)
+		if err != nil {
+			return fmt.Errorf("error updating channel sublog: %w", err)
+		}
+	}
+
+	for _, fr := range mentioned {
+		mentionLog, err := idx.mentions.Get(storedrefs.Mention(fr))
+		if err != nil {
+			return fmt.Errorf("error opening sublog: %w", err)
+		}
+		_, err = mentionLog.Append(rxSeq)
+		if err != nil {
+			return fmt.Errorf("error updating mention sublog: %w", err)
+		}
+	}
+
 	return nil
 }
 
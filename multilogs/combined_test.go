@@ -107,6 +107,8 @@ func setupCombinedIndex(t testing.TB, rxlog margaret.Log, mkMlog makeMultilog) (
 	private := mkMlog(t, testRepo, "private", &mc)
 	byType := mkMlog(t, testRepo, "byType", &mc)
 	groupMembers := mkMlog(t, testRepo, "groupMembers", &mc)
+	channels := mkMlog(t, testRepo, "channels", &mc)
+	mentions := mkMlog(t, testRepo, "mentions", &mc)
 
 	snk, err := NewCombinedIndex(filepath.Join(testPath, "combined"),
 		gm,
@@ -117,6 +119,8 @@ func setupCombinedIndex(t testing.TB, rxlog margaret.Log, mkMlog makeMultilog) (
 		private,
 		byType,
 		tangles,
+		channels,
+		mentions,
 		groupMembers,
 
 		sm,
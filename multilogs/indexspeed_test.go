@@ -7,6 +7,7 @@ package multilogs
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"math/rand"
 	"os"
 	"os/exec"
@@ -21,6 +22,7 @@ import (
 	librarian "go.cryptoscope.co/margaret/indexes"
 	"go.cryptoscope.co/margaret/multilog"
 
+	"go.cryptoscope.co/ssb/indexes"
 	"go.cryptoscope.co/ssb/internal/testutils"
 	"go.cryptoscope.co/ssb/repo"
 	refs "go.mindeco.de/ssb-refs"
@@ -74,6 +76,99 @@ func BenchmarkIndexFixturesUserFeeds(b *testing.B) {
 	}
 }
 
+// BenchmarkIndexFixturesFanOut fills a couple of indexes from the fixture log,
+// one after the other like the indexes used to be served and from a single read that is fanned out to them
+func BenchmarkIndexFixturesFanOut(b *testing.B) {
+	r := require.New(b)
+
+	testRepo := filepath.Join("testrun", b.Name())
+
+	fetchFixture := exec.Command("bash", "./integration_prep.bash", filepath.Join(testRepo, "log"))
+	out, err := fetchFixture.CombinedOutput()
+	if err != nil {
+		b.Log(string(out))
+		r.NoError(err)
+	}
+
+	tr := repo.New(testRepo)
+
+	testLog, err := repo.OpenLog(tr)
+	r.NoError(err, "case %s failed to open", b.Name())
+
+	r.EqualValues(100000, testLog.Seq()+1, "testLog has wrong number of messages")
+
+	// openSinks opens empty indexes and returns a function that closes and removes them again
+	openSinks := func(r *require.Assertions) (map[string]librarian.SinkIndex, func()) {
+		_, badgerSnk, err := repo.OpenStandaloneMultiLog(tr, "benchbadger", UserFeedsUpdate)
+		r.NoError(err)
+
+		_, fsSnk, err := repo.OpenFileSystemMultiLog(tr, "benchfs", UserFeedsUpdate)
+		r.NoError(err)
+
+		getDB, err := repo.OpenBadgerDB(tr.GetPath(repo.PrefixIndex, "benchget"))
+		r.NoError(err)
+		_, getSnk := indexes.OpenGet(getDB)
+
+		sinks := map[string]librarian.SinkIndex{
+			"badger":    badgerSnk,
+			"fs-bitmap": fsSnk,
+			"get":       getSnk,
+		}
+		return sinks, func() {
+			for _, snk := range sinks {
+				r.NoError(snk.Close())
+			}
+			r.NoError(getDB.Close())
+			os.RemoveAll(tr.GetPath(repo.PrefixMultiLog))
+			os.RemoveAll(tr.GetPath(repo.PrefixIndex))
+		}
+	}
+
+	b.Run("serial", func(b *testing.B) {
+		r := require.New(b)
+		for n := 0; n < b.N; n++ {
+			b.StopTimer()
+			sinks, cleanup := openSinks(r)
+			b.StartTimer()
+
+			for _, snk := range sinks {
+				src, err := testLog.Query(margaret.SeqWrap(true), snk.QuerySpec())
+				r.NoError(err)
+
+				err = luigi.Pump(context.TODO(), snk, src)
+				r.NoError(err)
+			}
+
+			b.StopTimer()
+			cleanup()
+		}
+	})
+
+	for _, workers := range []int{1, 2, 4} {
+		b.Run(fmt.Sprintf("fanout-%d", workers), func(b *testing.B) {
+			r := require.New(b)
+			for n := 0; n < b.N; n++ {
+				b.StopTimer()
+				sinks, cleanup := openSinks(r)
+
+				fo := indexes.NewFanOut(workers)
+				for name, snk := range sinks {
+					err := fo.Add(name, snk.QuerySpec(), snk, func(err error) {
+						r.NoError(err)
+					})
+					r.NoError(err)
+				}
+				b.StartTimer()
+
+				fo.Run(context.TODO(), testLog)
+
+				b.StopTimer()
+				cleanup()
+			}
+		})
+	}
+}
+
 func TestIndexFixtures(t *testing.T) {
 	r := require.New(t)
 	a := assert.New(t)
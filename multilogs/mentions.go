@@ -0,0 +1,106 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package multilogs
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb/internal/storedrefs"
+)
+
+// inline feed links in the text of a post, like @AAA...=.ed25519 or in markdown [@name](@AAA...=.ed25519)
+var inlineFeedLink = regexp.MustCompile(`@[A-Za-z0-9+/]{43}=\.[a-z0-9-]+`)
+
+// postChannelsAndMentions returns the normalized channels and the feeds that the post content mentions.
+// Channels come from the channel field and #links in the mentions array,
+// feeds from @links in the mentions array and from inline links in the text.
+func postChannelsAndMentions(channel string, mentions json.RawMessage, text string) ([]string, []refs.FeedRef) {
+	var (
+		channels []string
+		feeds    []refs.FeedRef
+
+		seenChannels = make(map[string]struct{})
+		seenFeeds    = make(map[string]struct{})
+	)
+
+	addChannel := func(name string) {
+		name = storedrefs.NormalizeChannel(name)
+		if name == "" {
+			return
+		}
+		if _, has := seenChannels[name]; has {
+			return
+		}
+		seenChannels[name] = struct{}{}
+		channels = append(channels, name)
+	}
+
+	addFeed := func(link string) {
+		fr, err := refs.ParseFeedRef(link)
+		if err != nil {
+			return
+		}
+		if _, has := seenFeeds[fr.String()]; has {
+			return
+		}
+		seenFeeds[fr.String()] = struct{}{}
+		feeds = append(feeds, fr)
+	}
+
+	addChannel(channel)
+
+	for _, link := range mentionLinks(mentions) {
+		switch {
+		case strings.HasPrefix(link, "#"):
+			addChannel(link)
+		case strings.HasPrefix(link, "@"):
+			addFeed(link)
+		}
+	}
+
+	for _, link := range inlineFeedLink.FindAllString(text, -1) {
+		addFeed(link)
+	}
+
+	return channels, feeds
+}
+
+// mentionLinks returns the links of a mentions field.
+// Clients send an array of {link, name} objects but single objects and plain strings are also out there.
+func mentionLinks(mentions json.RawMessage) []string {
+	if len(mentions) == 0 {
+		return nil
+	}
+
+	type mention struct {
+		Link string `json:"link"`
+	}
+
+	var list []json.RawMessage
+	if err := json.Unmarshal(mentions, &list); err != nil {
+		list = []json.RawMessage{mentions}
+	}
+
+	var links []string
+	for _, raw := range list {
+		var m mention
+		if err := json.Unmarshal(raw, &m); err == nil {
+			if m.Link != "" {
+				links = append(links, m.Link)
+			}
+			continue
+		}
+
+		var link string
+		if err := json.Unmarshal(raw, &link); err == nil && link != "" {
+			links = append(links, link)
+		}
+	}
+	return links
+}
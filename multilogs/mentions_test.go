@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package multilogs
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	refs "go.mindeco.de/ssb-refs"
+)
+
+func TestPostChannelsAndMentions(t *testing.T) {
+	r := require.New(t)
+
+	arny, err := refs.NewFeedRefFromBytes(bytes.Repeat([]byte{1}, 32), refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	bert, err := refs.NewFeedRefFromBytes(bytes.Repeat([]byte{2}, 32), refs.RefAlgoFeedGabby)
+	r.NoError(err)
+
+	mentions, err := json.Marshal([]interface{}{
+		map[string]interface{}{"link": arny.String(), "name": "arny"},
+		map[string]interface{}{"link": "#Go"},
+		map[string]interface{}{"link": "&AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=.sha256"},
+		bert.String(),
+		42,
+	})
+	r.NoError(err)
+
+	text := "hey [@bert](" + bert.String() + ") and @" + "broken.ed25519"
+	channels, feeds := postChannelsAndMentions("go", mentions, text)
+	r.Equal([]string{"go"}, channels)
+	r.Len(feeds, 2)
+	r.True(feeds[0].Equal(arny))
+	r.True(feeds[1].Equal(bert))
+
+	// a single object instead of an array
+	channels, feeds = postChannelsAndMentions("", json.RawMessage(`{"link":"#ssb"}`), "")
+	r.Equal([]string{"ssb"}, channels)
+	r.Len(feeds, 0)
+
+	// nothing to index
+	channels, feeds = postChannelsAndMentions("#", json.RawMessage(`"nope"`), "just text")
+	r.Len(channels, 0)
+	r.Len(feeds, 0)
+}
@@ -38,7 +38,7 @@ func (p plugin) Handler() muxrpc.Handler {
 
 func New(log logging.Interface,
 	fm *gossip.FeedManager,
-	feeds, bytype, roots *roaring.MultiLog,
+	feeds, bytype, roots, channels, mentions *roaring.MultiLog,
 	rxlog margaret.Log,
 	get ssb.Getter,
 ) ssb.Plugin {
@@ -51,7 +51,7 @@ func New(log logging.Interface,
 	})
 
 	rootHdlr.RegisterSource(muxrpc.Method{name, "getSubset"}, getSubsetHandler{
-		queryPlaner: query.NewSubsetPlaner(feeds, bytype),
+		queryPlaner: query.NewSubsetPlanerWithIndexes(feeds, bytype, channels, mentions),
 		rxLog:       rxlog,
 	})
 
@@ -0,0 +1,247 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package rawread
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/margaret"
+	librarian "go.cryptoscope.co/margaret/indexes"
+	"go.cryptoscope.co/margaret/multilog/roaring"
+	"go.cryptoscope.co/muxrpc/v2"
+	"go.mindeco.de/log"
+	"go.mindeco.de/log/level"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/muxrpc/v2/typemux"
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/internal/mutil"
+	"go.cryptoscope.co/ssb/internal/storedrefs"
+	"go.cryptoscope.co/ssb/internal/transform"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+// sublogPlug streams the posts of one sublog of the channels or mentions multilog, sorted by their claimed timestamp
+type sublogPlug struct {
+	method string
+
+	rxlog margaret.Log
+	mlog  *roaring.MultiLog
+	res   *repo.SequenceResolver
+
+	// parse returns the sublog and the stream arguments of a request
+	parse func(req *muxrpc.Request) (librarian.Addr, message.CommonArgs, message.StreamArgs, error)
+
+	h muxrpc.Handler
+
+	info log.Logger
+}
+
+// NewByChannelPlugin returns the messagesByChannel source, which streams the public posts of a channel.
+// It takes {channel: name} or just the name of the channel as argument.
+func NewByChannelPlugin(log log.Logger, rootLog margaret.Log, channels *roaring.MultiLog, res *repo.SequenceResolver) ssb.Plugin {
+	parse := func(req *muxrpc.Request) (librarian.Addr, message.CommonArgs, message.StreamArgs, error) {
+		var qry message.MessagesByChannelArgs
+		err := parseSublogArgs(req.RawArgs, &qry, func(arg string) {
+			qry.Channel = arg
+			qry.Keys = true
+			qry.Limit = -1
+		})
+		if err != nil {
+			return "", qry.CommonArgs, qry.StreamArgs, fmt.Errorf("byChannel: %w", err)
+		}
+		if storedrefs.NormalizeChannel(qry.Channel) == "" {
+			return "", qry.CommonArgs, qry.StreamArgs, fmt.Errorf("byChannel: channel can't be empty")
+		}
+		return storedrefs.Channel(qry.Channel), qry.CommonArgs, qry.StreamArgs, nil
+	}
+	return newSublogPlug("messagesByChannel", log, rootLog, channels, res, parse)
+}
+
+// NewMentionsPlugin returns the mentions source, which streams the public posts that mention a feed.
+// It takes {id: @feed} or just the feed as argument, without a feed it streams the mentions of the remote.
+func NewMentionsPlugin(log log.Logger, rootLog margaret.Log, mentions *roaring.MultiLog, res *repo.SequenceResolver) ssb.Plugin {
+	parse := func(req *muxrpc.Request) (librarian.Addr, message.CommonArgs, message.StreamArgs, error) {
+		var (
+			qry      message.MentionsArgs
+			parseErr error
+		)
+		err := parseSublogArgs(req.RawArgs, &qry, func(arg string) {
+			fr, err := refs.ParseFeedRef(arg)
+			if err != nil {
+				parseErr = err
+				return
+			}
+			qry.ID = &fr
+			qry.Keys = true
+			qry.Limit = -1
+		})
+		if err == nil {
+			err = parseErr
+		}
+		if err != nil {
+			return "", qry.CommonArgs, qry.StreamArgs, fmt.Errorf("mentions: %w", err)
+		}
+
+		if qry.ID == nil {
+			remote, err := ssb.GetFeedRefFromAddr(req.RemoteAddr())
+			if err != nil {
+				return "", qry.CommonArgs, qry.StreamArgs, fmt.Errorf("mentions: failed to establish remote: %w", err)
+			}
+			qry.ID = &remote
+		}
+		return storedrefs.Mention(*qry.ID), qry.CommonArgs, qry.StreamArgs, nil
+	}
+	return newSublogPlug("mentions", log, rootLog, mentions, res, parse)
+}
+
+func newSublogPlug(
+	method string,
+	logger log.Logger,
+	rootLog margaret.Log,
+	mlog *roaring.MultiLog,
+	res *repo.SequenceResolver,
+	parse func(req *muxrpc.Request) (librarian.Addr, message.CommonArgs, message.StreamArgs, error),
+) ssb.Plugin {
+	plug := &sublogPlug{
+		method: method,
+
+		rxlog: rootLog,
+		mlog:  mlog,
+		res:   res,
+
+		parse: parse,
+
+		info: logger,
+	}
+
+	h := typemux.New(logger)
+	h.RegisterSource(muxrpc.Method{method}, plug)
+
+	plug.h = &h
+	return plug
+}
+
+// parseSublogArgs unmarshals the single argument object of a request into qry.
+// If the argument is a plain string setDefaults is called with it instead.
+func parseSublogArgs(rawArgs json.RawMessage, qry interface{}, setDefaults func(string)) error {
+	var args []json.RawMessage
+	err := json.Unmarshal(rawArgs, &args)
+	if err != nil {
+		return fmt.Errorf("bad request data: %w", err)
+	}
+	if n := len(args); n != 1 {
+		return fmt.Errorf("bad request data: assumed one argument but got %d", n)
+	}
+
+	var str string
+	if err := json.Unmarshal(args[0], &str); err == nil {
+		setDefaults(str)
+		return nil
+	}
+
+	err = json.Unmarshal(args[0], qry)
+	if err != nil {
+		return fmt.Errorf("bad request data: %w", err)
+	}
+	return nil
+}
+
+func (sp sublogPlug) Name() string            { return sp.method }
+func (sp sublogPlug) Method() muxrpc.Method   { return muxrpc.Method{sp.method} }
+func (sp sublogPlug) Handler() muxrpc.Handler { return sp.h }
+
+func (sp sublogPlug) HandleSource(ctx context.Context, req *muxrpc.Request, w *muxrpc.ByteSink) error {
+	var (
+		start  = time.Now()
+		logger = log.With(sp.info, "method", sp.method)
+	)
+
+	addr, common, qry, err := sp.parse(req)
+	if err != nil {
+		return err
+	}
+
+	// only public posts are in these indexes
+	if common.Private {
+		return fmt.Errorf("%s: private messages are not indexed", sp.method)
+	}
+
+	snk := transform.NewKeyValueWrapper(w, common.Keys)
+
+	var cnt int
+	snk = newSinkCounter(&cnt, snk)
+
+	if common.Live {
+		sublog, err := sp.mlog.Get(addr)
+		if err != nil {
+			return fmt.Errorf("%s: failed to load sublog: %w", sp.method, err)
+		}
+
+		src, err := mutil.Indirect(sp.rxlog, sublog).Query(
+			margaret.Limit(int(qry.Limit)),
+			margaret.Live(true))
+		if err != nil {
+			return fmt.Errorf("%s: failed to query sublog: %w", sp.method, err)
+		}
+
+		err = luigi.Pump(ctx, snk, src)
+		if err != nil {
+			return fmt.Errorf("%s: failed to pump msgs: %w", sp.method, err)
+		}
+		return snk.Close()
+	}
+
+	seqs, err := sp.mlog.LoadInternalBitmap(addr)
+	if err != nil {
+		level.Debug(logger).Log("event", "no such sublog", "err", err)
+		return snk.Close()
+	}
+
+	if qry.Lt == 0 {
+		qry.Lt = math.MaxInt64
+	}
+
+	var filter = func(ts int64) bool {
+		return ts > int64(qry.Gt) && ts < int64(qry.Lt)
+	}
+
+	sorted, err := sp.res.SortAndFilterBitmap(seqs, repo.SortByClaimed, filter, qry.Reverse)
+	if err != nil {
+		return fmt.Errorf("%s: failed to filter bitmap: %w", sp.method, err)
+	}
+
+	for _, res := range sorted {
+		v, err := sp.rxlog.Get(res.Seq)
+		if err != nil {
+			if margaret.IsErrNulled(err) {
+				continue
+			}
+			level.Warn(logger).Log("event", "failed to get seq", "seq", res.Seq, "err", err)
+			continue
+		}
+
+		if err := snk.Pour(ctx, v); err != nil {
+			level.Warn(logger).Log("event", "failed to send", "seq", res.Seq, "err", err)
+			break
+		}
+
+		if qry.Limit >= 0 {
+			qry.Limit--
+			if qry.Limit == 0 {
+				break
+			}
+		}
+	}
+
+	level.Debug(logger).Log("event", "messages streamed", "cnt", cnt, "took", time.Since(start))
+	return snk.Close()
+}
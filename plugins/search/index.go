@@ -0,0 +1,296 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+// Package search is a full-text index over the text of posts and the names and descriptions of abouts.
+// Each term is a sublog of receive log sequences, a query is the intersection of the sublogs of its terms.
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/dgraph-io/sroar"
+	"go.cryptoscope.co/margaret"
+	librarian "go.cryptoscope.co/margaret/indexes"
+	"go.cryptoscope.co/margaret/multilog"
+	"go.cryptoscope.co/margaret/multilog/roaring"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/private/box2"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+// IndexName is the name the index is served and stored under
+const IndexName = "search"
+
+// the sequences of the messages that were indexed from box2 content
+const privateAddr = librarian.Addr("meta:private")
+
+func termAddr(term string) librarian.Addr {
+	return librarian.Addr("term:" + term)
+}
+
+// Decrypter opens box2 content the bot can read, like the private.Manager does
+type Decrypter interface {
+	DecryptBox2(ctxt []byte, author refs.FeedRef, prev refs.MessageRef) ([]byte, error)
+}
+
+// Index maps the terms of messages to their receive log sequences
+type Index struct {
+	terms *roaring.MultiLog
+	dec   Decrypter
+}
+
+// NewIndex returns an index that stores its terms in the passed multilog.
+// Without a Decrypter box2 messages are not indexed.
+func NewIndex(terms *roaring.MultiLog, dec Decrypter) *Index {
+	return &Index{
+		terms: terms,
+		dec:   dec,
+	}
+}
+
+// OpenSinkIndex returns the sink that fills the index and keeps its position in db
+func (idx *Index) OpenSinkIndex(db *badger.DB) (librarian.Index, librarian.SinkIndex, error) {
+	return repo.OpenIndex(db, IndexName, idx.sinkIndex)
+}
+
+func (idx *Index) sinkIndex(seqIdx librarian.SeqSetterIndex) librarian.SinkIndex {
+	return librarian.NewSinkIndex(func(ctx context.Context, seq int64, val interface{}, _ librarian.SetterIndex) error {
+		if nulled, ok := val.(error); ok {
+			if margaret.IsErrNulled(nulled) {
+				return nil
+			}
+			return nulled
+		}
+
+		msg, ok := val.(refs.Message)
+		if !ok {
+			return fmt.Errorf("search: unexpected message type: %T", val)
+		}
+
+		return idx.update(seq, msg)
+	}, seqIdx)
+}
+
+func (idx *Index) update(rxSeq int64, msg refs.Message) error {
+	content := msg.ContentBytes()
+	if len(content) == 0 { // dropped content
+		return nil
+	}
+
+	var private bool
+	if content[0] != '{' {
+		cleartext, ok := idx.decrypt(msg)
+		if !ok {
+			return nil
+		}
+		content = cleartext
+		private = true
+	}
+
+	text := searchableText(content)
+	if text == "" {
+		return nil
+	}
+
+	terms := Tokenize(text)
+	for _, term := range terms {
+		termLog, err := idx.terms.Get(termAddr(term))
+		if err != nil {
+			return fmt.Errorf("search: error opening sublog: %w", err)
+		}
+		_, err = termLog.Append(rxSeq)
+		if err != nil {
+			return fmt.Errorf("search: error updating term sublog: %w", err)
+		}
+	}
+
+	if private && len(terms) > 0 {
+		privLog, err := idx.terms.Get(privateAddr)
+		if err != nil {
+			return fmt.Errorf("search: error opening sublog: %w", err)
+		}
+		_, err = privLog.Append(rxSeq)
+		if err != nil {
+			return fmt.Errorf("search: error updating private sublog: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// decrypt returns the cleartext of box2 messages the bot can read
+func (idx *Index) decrypt(msg refs.Message) ([]byte, bool) {
+	if idx.dec == nil {
+		return nil, false
+	}
+
+	ctxt, err := box2.GetCiphertextFromMessage(msg)
+	if err != nil {
+		return nil, false
+	}
+
+	var prev refs.MessageRef
+	if p := msg.Previous(); p != nil {
+		prev = *p
+	}
+
+	cleartext, err := idx.dec.DecryptBox2(ctxt, msg.Author(), prev)
+	if err != nil || len(cleartext) == 0 || cleartext[0] != '{' {
+		return nil, false
+	}
+	return cleartext, true
+}
+
+// searchableText returns the text of a post or the name and description of an about
+func searchableText(content []byte) string {
+	// the fields are checked one by one, a broken one shouldn't hide the others
+	var fields struct {
+		Type        string
+		Text        json.RawMessage
+		Name        json.RawMessage
+		Description json.RawMessage
+	}
+	if err := json.Unmarshal(content, &fields); err != nil {
+		return ""
+	}
+
+	var raw []json.RawMessage
+	switch fields.Type {
+	case "post":
+		raw = []json.RawMessage{fields.Text}
+	case "about":
+		raw = []json.RawMessage{fields.Name, fields.Description}
+	default:
+		return ""
+	}
+
+	var parts []string
+	for _, r := range raw {
+		var s string
+		if err := json.Unmarshal(r, &s); err == nil && s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// ErrEmptyQuery is returned for queries without any terms
+var ErrEmptyQuery = errors.New("search: query has no terms")
+
+// Query returns the receive log sequences of the messages that contain all the terms of text.
+// Messages that were indexed from box2 content are left out unless withPrivate is set.
+func (idx *Index) Query(text string, withPrivate bool) (*sroar.Bitmap, error) {
+	terms := Tokenize(text)
+	if len(terms) == 0 {
+		return nil, ErrEmptyQuery
+	}
+
+	var result *sroar.Bitmap
+	for _, term := range terms {
+		bmap, err := idx.load(termAddr(term))
+		if err != nil {
+			return nil, err
+		}
+
+		if result == nil {
+			result = bmap
+		} else {
+			result.And(bmap)
+		}
+
+		if result.GetCardinality() == 0 {
+			return result, nil
+		}
+	}
+
+	if !withPrivate {
+		private, err := idx.load(privateAddr)
+		if err != nil {
+			return nil, err
+		}
+		it := private.NewIterator()
+		for it.HasNext() {
+			v := it.Next()
+			if result.Contains(v) {
+				result.Remove(v)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// the page size of a query without a limit
+const defaultLimit = 20
+
+// Find returns a page of the messages that match qry, sorted by their claimed timestamp.
+// Newest first, unless qry.Reverse is set. A limit of 0 is the default page size and -1 returns every match.
+// The terms of messages stay in the index when their entry or content is dropped later, those messages are left out here.
+func (idx *Index) Find(rxlog margaret.Log, res *repo.SequenceResolver, qry message.SearchArgs) ([]refs.Message, error) {
+	found, err := idx.Query(qry.Query, qry.Private)
+	if err != nil {
+		return nil, err
+	}
+
+	if qry.Lt == 0 {
+		qry.Lt = math.MaxInt64
+	}
+	var filter = func(ts int64) bool {
+		return ts > int64(qry.Gt) && ts < int64(qry.Lt)
+	}
+
+	sorted, err := res.SortAndFilterBitmap(found, repo.SortByClaimed, filter, !qry.Reverse)
+	if err != nil {
+		return nil, fmt.Errorf("search: failed to sort results: %w", err)
+	}
+
+	limit := qry.Limit
+	if limit == 0 {
+		limit = defaultLimit
+	}
+
+	var msgs []refs.Message
+	for _, r := range sorted {
+		if limit > 0 && int64(len(msgs)) >= limit {
+			break
+		}
+
+		v, err := rxlog.Get(r.Seq)
+		if err != nil {
+			if margaret.IsErrNulled(err) {
+				continue
+			}
+			return nil, fmt.Errorf("search: failed to load message: %w", err)
+		}
+
+		msg, ok := v.(refs.Message)
+		if !ok {
+			return nil, fmt.Errorf("search: wrong message type in storage: %T", v)
+		}
+		if len(msg.ContentBytes()) == 0 { // dropped content
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+func (idx *Index) load(addr librarian.Addr) (*sroar.Bitmap, error) {
+	bmap, err := idx.terms.LoadInternalBitmap(addr)
+	if err != nil {
+		if errors.Is(err, multilog.ErrSublogNotFound) {
+			return sroar.NewBitmap(), nil
+		}
+		return nil, fmt.Errorf("search: failed to load %q: %w", addr, err)
+	}
+	return bmap, nil
+}
@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/muxrpc/v2"
+	"go.cryptoscope.co/muxrpc/v2/typemux"
+	"go.mindeco.de/log"
+	"go.mindeco.de/log/level"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/internal/transform"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/private"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+type plugin struct {
+	h muxrpc.Handler
+}
+
+func (plugin) Name() string              { return "search" }
+func (plugin) Method() muxrpc.Method     { return muxrpc.Method{"search"} }
+func (p plugin) Handler() muxrpc.Handler { return p.h }
+
+// NewPlugin returns the search.query source.
+// It streams the messages that contain all the terms of the query, newest first by their claimed timestamp.
+// The next page is the same query with lt set to the timestamp of the last message of the page (gt with reverse).
+// Private messages are only streamed, as cleartext, to the bot itself.
+func NewPlugin(
+	logger log.Logger,
+	rxlog margaret.Log,
+	idx *Index,
+	res *repo.SequenceResolver,
+	unboxer *private.Manager,
+	isSelf ssb.Authorizer,
+) ssb.Plugin {
+	h := typemux.New(logger)
+	h.RegisterSource(muxrpc.Method{"search", "query"}, queryHandler{
+		info:    logger,
+		rxlog:   rxlog,
+		idx:     idx,
+		res:     res,
+		unboxer: unboxer,
+		isSelf:  isSelf,
+	})
+	return plugin{h: &h}
+}
+
+type queryHandler struct {
+	info log.Logger
+
+	rxlog   margaret.Log
+	idx     *Index
+	res     *repo.SequenceResolver
+	unboxer *private.Manager
+	isSelf  ssb.Authorizer
+}
+
+func (h queryHandler) HandleSource(ctx context.Context, req *muxrpc.Request, w *muxrpc.ByteSink) error {
+	var (
+		start = time.Now()
+		qry   message.SearchArgs
+		args  []json.RawMessage
+	)
+
+	err := json.Unmarshal(req.RawArgs, &args)
+	if err != nil {
+		return fmt.Errorf("search: bad request data: %w", err)
+	}
+	if n := len(args); n != 1 {
+		return fmt.Errorf("search: bad request data: assumed one argument but got %d", n)
+	}
+	if err := json.Unmarshal(args[0], &qry.Query); err == nil {
+		qry.Keys = true
+	} else if err := json.Unmarshal(args[0], &qry); err != nil {
+		return fmt.Errorf("search: bad request data: %w", err)
+	}
+
+	if qry.Live {
+		return fmt.Errorf("search: live queries are not supported")
+	}
+
+	if qry.Private {
+		remote, err := ssb.GetFeedRefFromAddr(req.RemoteAddr())
+		if err != nil {
+			return fmt.Errorf("search: failed to establish remote: %w", err)
+		}
+		if h.isSelf.Authorize(remote) != nil {
+			return fmt.Errorf("search: not authorized")
+		}
+	}
+
+	found, err := h.idx.Find(h.rxlog, h.res, qry)
+	if err != nil {
+		return err
+	}
+
+	snk := transform.NewKeyValueWrapper(w, qry.Keys)
+	if qry.Private {
+		snk = h.unboxer.WrappedUnboxingSink(snk)
+	}
+
+	var cnt int
+	for _, msg := range found {
+		if err := snk.Pour(ctx, msg); err != nil {
+			level.Warn(h.info).Log("event", "search failed to send", "msg", msg.Key().String(), "err", err)
+			break
+		}
+		cnt++
+	}
+
+	level.Debug(h.info).Log("event", "search results streamed", "found", len(found), "sent", cnt, "took", time.Since(start))
+	return snk.Close()
+}
@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package search
+
+import (
+	"unicode"
+)
+
+const (
+	// longer words are cut to this many runes
+	maxTermLength = 64
+
+	// the terms of one message after which the rest of the text is ignored
+	maxTerms = 1024
+)
+
+// Tokenize splits text into the lower case terms of the index.
+// Words are runs of letters and digits with at least two runes.
+// Chinese, Japanese and Korean text has no spaces between the words, it is split into overlapping pairs of runes instead,
+// a run of a single rune is kept as it is.
+// Every term is returned once, in the order of its first appearance.
+func Tokenize(text string) []string {
+	var (
+		terms []string
+		seen  = make(map[string]struct{})
+
+		word []rune
+		cjk  []rune
+	)
+
+	add := func(term []rune) {
+		if len(terms) >= maxTerms {
+			return
+		}
+		if len(term) > maxTermLength {
+			term = term[:maxTermLength]
+		}
+		t := string(term)
+		if _, has := seen[t]; has {
+			return
+		}
+		seen[t] = struct{}{}
+		terms = append(terms, t)
+	}
+
+	flushWord := func() {
+		if len(word) > 1 {
+			add(word)
+		}
+		word = word[:0]
+	}
+
+	flushCJK := func() {
+		switch n := len(cjk); {
+		case n == 1:
+			add(cjk)
+		case n > 1:
+			for i := 0; i < n-1; i++ {
+				add(cjk[i : i+2])
+			}
+		}
+		cjk = cjk[:0]
+	}
+
+	for _, r := range text {
+		r = unicode.ToLower(r)
+		switch {
+		case isCJK(r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+
+	return terms
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
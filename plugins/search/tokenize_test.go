@@ -0,0 +1,37 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package search
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenize(t *testing.T) {
+	r := require.New(t)
+
+	r.Equal([]string{"hello", "world", "42"}, Tokenize("Hello, WORLD! hello a 42 #"))
+	r.Equal([]string{"über", "die", "straße"}, Tokenize("Über die Straße"))
+
+	// pairs of runes for text without spaces, a single rune is kept
+	r.Equal([]string{"元宇", "宇宙", "ssb", "好"}, Tokenize("元宇宙ssb 好"))
+	r.Equal([]string{"こん", "んに", "にち", "ちは"}, Tokenize("こんにちは"))
+
+	r.Len(Tokenize(""), 0)
+	r.Len(Tokenize("- ! ?"), 0)
+
+	long := Tokenize(strings.Repeat("x", 2*maxTermLength))
+	r.Len(long, 1)
+	r.Len([]rune(long[0]), maxTermLength)
+
+	var many []string
+	for i := 0; i < 2*maxTerms; i++ {
+		many = append(many, "t"+strconv.Itoa(i))
+	}
+	r.Len(Tokenize(strings.Join(many, " ")), maxTerms)
+}
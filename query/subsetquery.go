@@ -3,7 +3,7 @@
 // SPDX-License-Identifier: MIT
 
 // Package query holds the first version of a generic query engine for go-ssb.
-// The Subset operations are able to combine arbitrary boolen combinations of type:xzy and author:@foo filters into one result.
+// The Subset operations are able to combine arbitrary boolen combinations of type:xzy, author:@foo, channel:xyz and mention:@foo filters into one result.
 package query
 
 import (
@@ -11,6 +11,7 @@ import (
 	"fmt"
 
 	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/internal/storedrefs"
 	refs "go.mindeco.de/ssb-refs"
 )
 
@@ -40,6 +41,16 @@ func NewSubsetOpByAuthor(a refs.FeedRef) SubsetOperation {
 	return SubsetOperation{operation: "author", feed: &a}
 }
 
+// NewSubsetOpByChannel returns a single operation which filters posts by channel
+func NewSubsetOpByChannel(name string) SubsetOperation {
+	return SubsetOperation{operation: "channel", string: name}
+}
+
+// NewSubsetOpByMention returns a single operation which filters posts that mention a feed
+func NewSubsetOpByMention(a refs.FeedRef) SubsetOperation {
+	return SubsetOperation{operation: "mention", feed: &a}
+}
+
 // NewSubsetAndCombination turns the list of passed operations into a logical combination where all of them need to apply
 func NewSubsetAndCombination(ops ...SubsetOperation) SubsetOperation {
 	return SubsetOperation{operation: "and", args: ops}
@@ -80,12 +91,17 @@ func (so *SubsetOperation) UnmarshalJSON(input []byte) error {
 		so.args = m.Args
 	case "type":
 		so.string = m.String
-	case "author":
+	case "channel":
+		if storedrefs.NormalizeChannel(m.String) == "" {
+			return fmt.Errorf("subset: channel can't be empty")
+		}
+		so.string = m.String
+	case "author", "mention":
 		if m.Feed == nil {
-			return fmt.Errorf("subset: author can't be empty")
+			return fmt.Errorf("subset: %s can't be empty", m.Operation)
 		}
 		if err := ssb.IsValidFeedFormat(m.Feed.Algo()); err != nil {
-			return fmt.Errorf("subset: author is invalid feed format: %w", err)
+			return fmt.Errorf("subset: %s is invalid feed format: %w", m.Operation, err)
 		}
 		so.feed = m.Feed
 	default:
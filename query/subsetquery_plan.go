@@ -18,10 +18,11 @@ import (
 
 // SubsetPlaner can do query planing for the GetSubset method
 type SubsetPlaner struct {
-	authors, bytype *roaring.MultiLog
+	authors, bytype, channels, mentions *roaring.MultiLog
 }
 
-// NewSubsetPlaner returns a new subset query planer, with two backing multilogs
+// NewSubsetPlaner returns a new subset query planer, with two backing multilogs.
+// It can't answer channel and mention operations, see NewSubsetPlanerWithIndexes for those.
 func NewSubsetPlaner(authors, bytype *roaring.MultiLog) *SubsetPlaner {
 	return &SubsetPlaner{
 		authors: authors,
@@ -29,6 +30,16 @@ func NewSubsetPlaner(authors, bytype *roaring.MultiLog) *SubsetPlaner {
 	}
 }
 
+// NewSubsetPlanerWithIndexes returns a new subset query planer, with the channels and mentions multilogs as well
+func NewSubsetPlanerWithIndexes(authors, bytype, channels, mentions *roaring.MultiLog) *SubsetPlaner {
+	return &SubsetPlaner{
+		authors:  authors,
+		bytype:   bytype,
+		channels: channels,
+		mentions: mentions,
+	}
+}
+
 // QuerySubsetBitmap evaluates the passed SubsetOperation and returns a bitmap which maps to messages in the receive log.
 func (sp *SubsetPlaner) QuerySubsetBitmap(qry SubsetOperation) (*sroar.Bitmap, error) {
 	return combineBitmaps(sp, qry)
@@ -78,6 +89,18 @@ func combineBitmaps(sp *SubsetPlaner, qry SubsetOperation) (*sroar.Bitmap, error
 	case "type":
 		return sp.bytype.LoadInternalBitmap(indexes.Addr("string:" + qry.string))
 
+	case "channel":
+		if sp.channels == nil {
+			return nil, fmt.Errorf("subset planer has no channels index")
+		}
+		return sp.channels.LoadInternalBitmap(storedrefs.Channel(qry.string))
+
+	case "mention":
+		if sp.mentions == nil {
+			return nil, fmt.Errorf("subset planer has no mentions index")
+		}
+		return sp.mentions.LoadInternalBitmap(storedrefs.Mention(*qry.feed))
+
 	case "or", "and":
 		if len(qry.args) == 0 {
 			return nil, nil
@@ -72,6 +72,27 @@ func TestSubsetQuerySerializing(t *testing.T) {
 			jsonInput: `{"op":"and","args":[{"op":"author","feed":"@AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=.ed25519"},{"op":"or","args":[{"op":"type","string":"foo"},{"op":"type","string":"bar"}]}]}`,
 		},
 
+		{
+			name: "channel or mention",
+			query: query.NewSubsetOrCombination(
+				query.NewSubsetOpByChannel("foo"),
+				query.NewSubsetOpByMention(testRef),
+			),
+			jsonInput: `{"op":"or","args":[{"op":"channel","string":"foo"},{"op":"mention","feed":"@AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=.ed25519"}]}`,
+		},
+
+		{
+			name:      "empty channel",
+			jsonInput: `{"op":"channel","string":"#"}`,
+			invalid:   true,
+		},
+
+		{
+			name:      "empty mention",
+			jsonInput: `{"op":"mention"}`,
+			invalid:   true,
+		},
+
 		{
 			name:      "invalid operation",
 			jsonInput: `{"op":"stuff","times":"over 9000"}`,
@@ -193,7 +214,7 @@ func TestSubsetQueryPlanExecution(t *testing.T) {
 
 	r.EqualValues(len(testMsgs)-1, mainbot.ReceiveLog.Seq(), "did not get all the messages")
 
-	sp := query.NewSubsetPlaner(mainbot.Users, mainbot.ByType)
+	sp := query.NewSubsetPlanerWithIndexes(mainbot.Users, mainbot.ByType, mainbot.Channels, mainbot.Mentions)
 
 	t.Run("by author", func(t *testing.T) {
 		r := require.New(t)
@@ -237,6 +258,58 @@ func TestSubsetQueryPlanExecution(t *testing.T) {
 		r.True(testRefs[6].Equal(msgRefs[2]))
 	})
 
+	t.Run("channels and mentions", func(t *testing.T) {
+		r := require.New(t)
+
+		posts := []struct {
+			as string
+			c  map[string]interface{}
+		}{
+			{"arny", map[string]interface{}{"type": "post", "text": "hello", "channel": "#Go"}},
+			{"bert", map[string]interface{}{"type": "post", "text": "hey [@cloe](" + kpCloe.ID().String() + ")"}},
+			{"cloe", map[string]interface{}{"type": "post", "text": "thanks", "mentions": []interface{}{
+				map[string]interface{}{"link": kpArny.ID().String(), "name": "arny"},
+				map[string]interface{}{"link": "#go"},
+			}}},
+			{"arny", map[string]interface{}{"type": "about", "about": kpArny.ID().String(), "channel": "go"}},
+		}
+		var postRefs []refs.MessageRef
+		for idx, p := range posts {
+			msg, err := mainbot.PublishAs(p.as, p.c)
+			r.NoError(err, "publish %d failed", idx)
+			postRefs = append(postRefs, msg.Key())
+		}
+		mainbot.WaitUntilIndexesAreSynced()
+
+		msgs, err := sp.QuerySubsetMessages(mainbot.ReceiveLog, query.NewSubsetOpByChannel("go"))
+		r.NoError(err)
+		r.Len(msgs, 2, "only posts are in channels")
+		msgRefs := messagesToRefs(msgs)
+		r.True(postRefs[0].Equal(msgRefs[0]))
+		r.True(postRefs[2].Equal(msgRefs[1]))
+
+		msgs, err = sp.QuerySubsetMessages(mainbot.ReceiveLog, query.NewSubsetOpByMention(kpCloe.ID()))
+		r.NoError(err)
+		r.Len(msgs, 1)
+		r.True(postRefs[1].Equal(msgs[0].Key()))
+
+		qry := query.NewSubsetAndCombination(
+			query.NewSubsetOpByMention(kpArny.ID()),
+			query.NewSubsetOpByAuthor(kpCloe.ID()),
+		)
+		msgs, err = sp.QuerySubsetMessages(mainbot.ReceiveLog, qry)
+		r.NoError(err)
+		r.Len(msgs, 1)
+		r.True(postRefs[2].Equal(msgs[0].Key()))
+
+		// a planer without the channels and mentions indexes refuses those operations
+		plain := query.NewSubsetPlaner(mainbot.Users, mainbot.ByType)
+		_, err = plain.QuerySubsetMessages(mainbot.ReceiveLog, query.NewSubsetOpByChannel("go"))
+		r.Error(err)
+		_, err = plain.QuerySubsetMessages(mainbot.ReceiveLog, query.NewSubsetOpByMention(kpCloe.ID()))
+		r.Error(err)
+	})
+
 	// shutdown bot
 	mainbot.Shutdown()
 	r.NoError(mainbot.Close())
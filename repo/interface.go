@@ -30,3 +30,11 @@ type MultiLogMaker interface {
 
 // MakeMultiLogIndex is the "functional" version of a MultiLogMaker
 type MakeMultiLogIndex func(db *badger.DB) (multilog.MultiLog, librarian.SinkIndex, error)
+
+// VersionedIndex is implemented by the index makers of plugins whose stored data changes between releases.
+// The sbot records the version an index was built with, when IndexVersion returns another one
+// ResetIndex is called before the index is opened and the index is filled again from the start of the receive log.
+type VersionedIndex interface {
+	IndexVersion() int
+	ResetIndex(db *badger.DB) error
+}
@@ -13,6 +13,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"sync"
 	"time"
 
 	bmap "github.com/dgraph-io/sroar"
@@ -89,6 +90,9 @@ type SequenceResolver struct {
 	seq2received []int64
 	seq2feedseq  []int64
 
+	// the timestamps index appends while queries read
+	mu sync.RWMutex
+
 	dirty bool      // has not been written to disk yet
 	repo  Interface // where to store the arrays
 }
@@ -165,7 +169,7 @@ const (
 // TODO: maybe some utilities, OTOH it's just generating the seq array
 // func (sr SequenceResolver) SortByRange(from, to, by, ok) ...
 
-func (sr SequenceResolver) prepare(by SortDomain) ([]int64, int64, error) {
+func (sr *SequenceResolver) prepare(by SortDomain) ([]int64, int64, error) {
 	err := sr.checkConsistency()
 	if err != nil {
 		return nil, -2, err
@@ -189,7 +193,10 @@ func (sr SequenceResolver) prepare(by SortDomain) ([]int64, int64, error) {
 
 // SortAndFilterAll goes through all values and passes the value in the SortDomain to the ResolverFilter, which decides a value should be copied and then sorted.
 // desc controls ascending (false) or descending (true) order of values.
-func (sr SequenceResolver) SortAndFilterAll(by SortDomain, ok ResolverFilter, desc bool) (SortedSeqSlice, error) {
+func (sr *SequenceResolver) SortAndFilterAll(by SortDomain, ok ResolverFilter, desc bool) (SortedSeqSlice, error) {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+
 	domain, _, err := sr.prepare(by)
 	if err != nil {
 		return nil, err
@@ -219,7 +226,10 @@ func (sr SequenceResolver) SortAndFilterAll(by SortDomain, ok ResolverFilter, de
 
 // SortAndFilter goes through seqs in the passed domain using the filter function to include wanted elements.
 // desc: true means descending, desc: false means ascending.
-func (sr SequenceResolver) SortAndFilter(seqs []int64, by SortDomain, ok ResolverFilter, desc bool) (SortedSeqSlice, error) {
+func (sr *SequenceResolver) SortAndFilter(seqs []int64, by SortDomain, ok ResolverFilter, desc bool) (SortedSeqSlice, error) {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+
 	domain, max, err := sr.prepare(by)
 	if err != nil {
 		return nil, err
@@ -253,7 +263,10 @@ func (sr SequenceResolver) SortAndFilter(seqs []int64, by SortDomain, ok Resolve
 
 // SortAndFilterBitmap is similar to SortAndFilter but it takes a bitmap instead of an array of values to go through.
 // desc controls ascending (false) or descending (true) order of values.
-func (sr SequenceResolver) SortAndFilterBitmap(seqs *bmap.Bitmap, by SortDomain, ok ResolverFilter, desc bool) (SortedSeqSlice, error) {
+func (sr *SequenceResolver) SortAndFilterBitmap(seqs *bmap.Bitmap, by SortDomain, ok ResolverFilter, desc bool) (SortedSeqSlice, error) {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+
 	domain, max, err := sr.prepare(by)
 	if err != nil {
 		return nil, err
@@ -307,6 +320,9 @@ func (sr *SequenceResolver) checkConsistency() error {
 
 // Append adds all three domains to the resolver.
 func (sr *SequenceResolver) Append(seq int64, feed int64, claimed, received time.Time) error {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
 	if err := sr.checkConsistency(); err != nil {
 		return err
 	}
@@ -330,12 +346,17 @@ func (sr *SequenceResolver) Append(seq int64, feed int64, claimed, received time
 	return nil
 }
 
-func (sr SequenceResolver) String() string {
+func (sr *SequenceResolver) String() string {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
 	return fmt.Sprintf("seq resolver: %d elements", len(sr.seq2claimed))
 }
 
 // Load reads the files from repo and deserializes them.
 func (sr *SequenceResolver) Load() (int64, error) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
 	if sr.repo == nil {
 		return -1, fmt.Errorf("seq resolver: not initialized with repo to read from")
 	}
@@ -389,6 +410,9 @@ func (sr *SequenceResolver) indexPath(name string) string {
 
 // Serialize does the reverse from Load. It saves the three domains to disk.
 func (sr *SequenceResolver) Serialize() error {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
 	if err := sr.checkConsistency(); err != nil {
 		return err
 	}
@@ -430,7 +454,10 @@ func (sr *SequenceResolver) Serialize() error {
 }
 
 // Seq returns the number of entries held by the resolver.
-func (sr SequenceResolver) Seq() int64 {
+func (sr *SequenceResolver) Seq() int64 {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+
 	err := sr.checkConsistency()
 	if err != nil {
 		panic(err)
@@ -440,7 +467,7 @@ func (sr SequenceResolver) Seq() int64 {
 }
 
 // Close serialzes the resolver to disk.
-func (sr SequenceResolver) Close() error {
+func (sr *SequenceResolver) Close() error {
 	return sr.Serialize()
 }
 
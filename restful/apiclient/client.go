@@ -0,0 +1,194 @@
+// Package apiclient is a typed client of the metalife pub restful api.
+//
+// The types and methods in client_gen.go are generated from restful/openapi.json,
+// run go generate in this directory after changing the spec.
+package apiclient
+
+//go:generate go run ./gen -spec ../openapi.json -out client_gen.go
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// Client calls the restful api of one pub
+type Client struct {
+	// BaseURL e.g. http://127.0.0.1:10008
+	BaseURL    string
+	HTTPClient *http.Client
+
+	// SignKey is the key of the client_id feed of the requests that need an attestation
+	// (notify-login, notify-created-nft), PubID the feed id of the pub they are sent to
+	SignKey ed25519.PrivateKey
+	PubID   string
+
+	now func() time.Time
+}
+
+// NewClient creates a client of the pub at baseURL
+func NewClient(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: http.DefaultClient,
+		now:        time.Now,
+	}
+}
+
+// APIError a response with a non-zero error_code or a non-2xx status
+type APIError struct {
+	StatusCode int
+	ErrorCode  int
+	ErrorMsg   string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("metalife api: status %d, errorCode: %d, errorMsg %s", e.StatusCode, e.ErrorCode, e.ErrorMsg)
+}
+
+// envelope the APIResponse every route answers with
+type envelope struct {
+	ErrorCode int             `json:"error_code"`
+	ErrorMsg  string          `json:"error_message"`
+	Data      json.RawMessage `json:"data"`
+	// Error is set instead by the framework for malformed requests
+	Error string `json:"Error"`
+}
+
+// attestationPayload the bytes signed for a request, the same as restful.AttestationPayload
+func attestationPayload(route string, body []byte, timestamp int64, pubID string) []byte {
+	sum := sha256.Sum256(body)
+	return []byte(strings.Join([]string{
+		"metalife-attestation",
+		route,
+		hex.EncodeToString(sum[:]),
+		strconv.FormatInt(timestamp, 10),
+		pubID,
+	}, "\n"))
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, query url.Values, body interface{}, signed bool) (*http.Request, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if signed {
+		if c.SignKey == nil {
+			return nil, fmt.Errorf("metalife api: %s needs an attestation, SignKey is not set", path)
+		}
+		ts := c.now().UnixNano() / 1e6
+		sig := ed25519.Sign(c.SignKey, attestationPayload(path, payload, ts, c.PubID))
+		req.Header.Set("X-Metalife-Timestamp", strconv.FormatInt(ts, 10))
+		req.Header.Set("X-Metalife-Signature", base64.StdEncoding.EncodeToString(sig)+".sig.ed25519")
+	}
+	return req, nil
+}
+
+// do sends a request and decodes the data of the envelope into data
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body interface{}, signed bool, data interface{}) error {
+	req, err := c.newRequest(ctx, method, path, query, body, signed)
+	if err != nil {
+		return err
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var env envelope
+	if err = json.Unmarshal(b, &env); err != nil {
+		if resp.StatusCode/100 != 2 {
+			return &APIError{StatusCode: resp.StatusCode, ErrorCode: -1, ErrorMsg: strings.TrimSpace(string(b))}
+		}
+		return fmt.Errorf("metalife api: decode response of %s: %w", path, err)
+	}
+	if env.Error != "" {
+		return &APIError{StatusCode: resp.StatusCode, ErrorCode: -1, ErrorMsg: env.Error}
+	}
+	if env.ErrorCode != 0 || resp.StatusCode/100 != 2 {
+		return &APIError{StatusCode: resp.StatusCode, ErrorCode: env.ErrorCode, ErrorMsg: env.ErrorMsg}
+	}
+	if len(env.Data) == 0 || data == nil {
+		return nil
+	}
+	if err = json.Unmarshal(env.Data, data); err != nil {
+		return fmt.Errorf("metalife api: decode data of %s: %w", path, err)
+	}
+	return nil
+}
+
+// StreamList reads a GET list route with format=ndjson, each row is passed to fn.
+// next is the cursor of the following page if query has a limit.
+func (c *Client) StreamList(ctx context.Context, path string, query url.Values, fn func(row json.RawMessage) error) (next string, err error) {
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	q.Set("format", "ndjson")
+	req, err := c.newRequest(ctx, http.MethodGet, path, q, nil, false)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "application/x-ndjson" {
+		b, _ := ioutil.ReadAll(resp.Body)
+		var env envelope
+		if json.Unmarshal(b, &env) == nil && env.ErrorCode != 0 {
+			return "", &APIError{StatusCode: resp.StatusCode, ErrorCode: env.ErrorCode, ErrorMsg: env.ErrorMsg}
+		}
+		return "", &APIError{StatusCode: resp.StatusCode, ErrorCode: -1, ErrorMsg: strings.TrimSpace(string(b))}
+	}
+
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if err = fn(append(json.RawMessage(nil), line...)); err != nil {
+			return "", err
+		}
+	}
+	if err = sc.Err(); err != nil {
+		return "", err
+	}
+	return resp.Header.Get("X-Next-Cursor"), nil
+}
@@ -0,0 +1,115 @@
+package apiclient
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/ssb/restful/apiclient/internal/codegen"
+	"golang.org/x/crypto/ed25519"
+)
+
+// TestGeneratedClientUpToDate fails if openapi.json was changed without running go generate
+func TestGeneratedClientUpToDate(t *testing.T) {
+	r := require.New(t)
+	spec, err := ioutil.ReadFile("../openapi.json")
+	r.NoError(err)
+	want, err := codegen.Generate(spec, "apiclient")
+	r.NoError(err)
+	got, err := ioutil.ReadFile("client_gen.go")
+	r.NoError(err)
+	r.Equal(string(want), string(got), "client_gen.go is stale, run go generate in restful/apiclient")
+}
+
+func TestClientRoundTrip(t *testing.T) {
+	r := require.New(t)
+
+	const pubID = "@HZnU6wM+F17J0RSLXP05x3Lag2jGv3F3LzHMjh72coE=.ed25519"
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	r.NoError(err)
+	feed := "@" + base64.StdEncoding.EncodeToString(pub) + ".ed25519"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ssb/api/notify-login", func(w http.ResponseWriter, req *http.Request) {
+		body, err := ioutil.ReadAll(req.Body)
+		r.NoError(err)
+		ts, err := strconv.ParseInt(req.Header.Get("X-Metalife-Timestamp"), 10, 64)
+		r.NoError(err)
+		sig, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(req.Header.Get("X-Metalife-Signature"), ".sig.ed25519"))
+		r.NoError(err)
+		r.True(ed25519.Verify(pub, attestationPayload(req.URL.Path, body, ts, pubID), sig))
+		w.Write([]byte(`{"error_code":0,"error_message":"SUCCESS","data":"Success"}`))
+	})
+	mux.HandleFunc("/ssb/api/tippedoff-info", func(w http.ResponseWriter, req *http.Request) {
+		r.Equal(http.MethodGet, req.Method)
+		r.Equal("desc", req.URL.Query().Get("order"))
+		r.Equal("100", req.URL.Query().Get("limit"), "the default limit is always sent")
+		w.Write([]byte(`{"error_code":0,"error_message":"SUCCESS","data":{"items":[{"defendant":"@x","recordtime":5}],"next_cursor":"abc"}}`))
+	})
+	mux.HandleFunc("/ssb/api/get-reward-info", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"error_code":7000,"error_message":"TooManyRequests"}`))
+	})
+	mux.HandleFunc("/ssb/api/likes", func(w http.ResponseWriter, req *http.Request) {
+		r.Equal("ndjson", req.URL.Query().Get("format"))
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Write([]byte("{\"client_id\":\"@a\"}\n{\"client_id\":\"@b\"}\n"))
+	})
+	mux.HandleFunc("/ssb/api/search", func(w http.ResponseWriter, req *http.Request) {
+		r.Equal("hello", req.URL.Query().Get("q"))
+		w.Write([]byte(`{"error_code":0,"error_message":"SUCCESS","data":{"messages":[{"key":"%m.sha256","value":{"previous":null,"sequence":2,"author":"@x","timestamp":1000,"content":{"type":"post","text":"hello"}},"timestamp":1001}],"next_before":1000}}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := NewClient(srv.URL + "/")
+
+	_, err = c.NotifyLogin(ctx, &LoginNotification{ClientID: feed, LoginTime: time.Now().Unix() * 1000})
+	r.Error(err, "not signed without a key")
+
+	c.SignKey, c.PubID = priv, pubID
+	res, err := c.NotifyLogin(ctx, &LoginNotification{ClientID: feed, LoginTime: time.Now().Unix() * 1000})
+	r.NoError(err)
+	r.Equal("Success", res)
+
+	page, err := c.ListTippedOffInfo(ctx, &ListTippedOffInfoParams{Order: "desc"})
+	r.NoError(err)
+	r.Len(page.Items, 1)
+	r.Equal("@x", page.Items[0].Defendant)
+	r.EqualValues(5, page.Items[0].Recordtime)
+	r.Equal("abc", page.NextCursor)
+
+	_, err = c.GetRewardInfo(ctx, &RewardRequest{})
+	apiErr, ok := err.(*APIError)
+	r.True(ok, "%T", err)
+	r.Equal(7000, apiErr.ErrorCode)
+
+	found, err := c.Search(ctx, &SearchParams{Q: "hello"})
+	r.NoError(err)
+	r.Len(found.Messages, 1)
+	r.Equal("@x", found.Messages[0].Value.Author)
+	r.EqualValues(2, found.Messages[0].Value.Sequence)
+	r.JSONEq(`{"type":"post","text":"hello"}`, string(found.Messages[0].Value.Content))
+	r.EqualValues(1000, found.NextBefore)
+
+	var ids []string
+	_, err = c.StreamList(ctx, "/ssb/api/likes", nil, func(row json.RawMessage) error {
+		var like LikeSum
+		if err := json.Unmarshal(row, &like); err != nil {
+			return err
+		}
+		ids = append(ids, like.ClientID)
+		return nil
+	})
+	r.NoError(err)
+	r.Equal([]string{"@a", "@b"}, ids)
+}
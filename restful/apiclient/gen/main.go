@@ -0,0 +1,33 @@
+// gen writes the client of package apiclient from restful/openapi.json, it is run by go generate in restful/apiclient
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"go.cryptoscope.co/ssb/restful/apiclient/internal/codegen"
+)
+
+func main() {
+	spec := flag.String("spec", "../openapi.json", "the OpenAPI document")
+	out := flag.String("out", "client_gen.go", "the generated file")
+	pkg := flag.String("pkg", "apiclient", "package name of the generated file")
+	flag.Parse()
+
+	b, err := ioutil.ReadFile(*spec)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	src, err := codegen.Generate(b, *pkg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err = ioutil.WriteFile(*out, src, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,390 @@
+// Package codegen turns restful/openapi.json into the typed client of package apiclient.
+// It understands the subset of OpenAPI 3 the spec uses: object schemas, arrays, maps, $ref,
+// query parameters, json request bodies and responses wrapped in the APIResponse envelope.
+package codegen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+)
+
+// Schema the parts of an OpenAPI schema object the generator reads
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Description          string             `json:"description"`
+	Properties           map[string]*Schema `json:"properties"`
+	Items                *Schema            `json:"items"`
+	AdditionalProperties *Schema            `json:"additionalProperties"`
+	AllOf                []*Schema          `json:"allOf"`
+	Default              interface{}        `json:"default"`
+	GoType               string             `json:"x-go-type"`
+	GoSkip               bool               `json:"x-go-skip"`
+}
+
+// Parameter a query parameter, or a $ref to one
+type Parameter struct {
+	Ref         string  `json:"$ref"`
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description"`
+	Schema      *Schema `json:"schema"`
+	GoSkip      bool    `json:"x-go-skip"`
+}
+
+type mediaTypes struct {
+	JSON *struct {
+		Schema *Schema `json:"schema"`
+	} `json:"application/json"`
+}
+
+// Operation a method of a path
+type Operation struct {
+	OperationID string       `json:"operationId"`
+	Summary     string       `json:"summary"`
+	Parameters  []*Parameter `json:"parameters"`
+	RequestBody *struct {
+		Content mediaTypes `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]struct {
+		Content mediaTypes `json:"content"`
+	} `json:"responses"`
+	Attestation bool `json:"x-attestation"`
+}
+
+// Spec the parts of an OpenAPI document the generator reads
+type Spec struct {
+	OpenAPI    string                           `json:"openapi"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components struct {
+		Schemas    map[string]*Schema    `json:"schemas"`
+		Parameters map[string]*Parameter `json:"parameters"`
+	} `json:"components"`
+}
+
+// initialisms are written in upper case in Go names
+var initialisms = map[string]bool{"id": true, "ip": true, "url": true, "nft": true, "api": true}
+
+// GoName converts a json or operation name to an exported Go name, e.g. client_eth_address -> ClientEthAddress
+func GoName(name string) string {
+	var b strings.Builder
+	for _, word := range strings.FieldsFunc(name, func(r rune) bool { return r == '_' || r == '-' }) {
+		if initialisms[strings.ToLower(word)] {
+			b.WriteString(strings.ToUpper(word))
+			continue
+		}
+		b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return b.String()
+}
+
+// refName the schema or parameter name of a local $ref
+func refName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+type generator struct {
+	spec    *Spec
+	buf     bytes.Buffer
+	imports map[string]bool
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// goType the Go type of a schema, references to component schemas are pointers
+func (g *generator) goType(s *Schema) (string, error) {
+	if s == nil {
+		g.imports["encoding/json"] = true
+		return "json.RawMessage", nil
+	}
+	if s.GoType != "" {
+		if strings.Contains(s.GoType, "big.") {
+			g.imports["math/big"] = true
+		}
+		return s.GoType, nil
+	}
+	if s.Ref != "" {
+		name := refName(s.Ref)
+		if _, ok := g.spec.Components.Schemas[name]; !ok {
+			return "", fmt.Errorf("unknown schema %s", s.Ref)
+		}
+		return "*" + name, nil
+	}
+	switch s.Type {
+	case "string":
+		return "string", nil
+	case "boolean":
+		return "bool", nil
+	case "number":
+		return "float64", nil
+	case "integer":
+		if s.Format == "int64" {
+			return "int64", nil
+		}
+		return "int", nil
+	case "array":
+		item, err := g.goType(s.Items)
+		return "[]" + item, err
+	case "object":
+		if s.AdditionalProperties != nil {
+			value, err := g.goType(s.AdditionalProperties)
+			return "map[string]" + value, err
+		}
+	case "":
+		g.imports["encoding/json"] = true
+		return "json.RawMessage", nil
+	}
+	return "", fmt.Errorf("unsupported schema type %q", s.Type)
+}
+
+func comment(name, text string) string {
+	if text == "" {
+		return "// " + name + "\n"
+	}
+	return "// " + name + " " + text + "\n"
+}
+
+func sortedKeys(m map[string]*Schema) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (g *generator) schemas() error {
+	for _, name := range sortedKeys(g.spec.Components.Schemas) {
+		s := g.spec.Components.Schemas[name]
+		if s.GoSkip {
+			continue
+		}
+		if s.Type != "object" || s.Properties == nil {
+			return fmt.Errorf("schema %s: only objects with properties are generated", name)
+		}
+		g.printf("\n%stype %s struct {\n", comment(name, s.Description), name)
+		fields := make(map[string]string)
+		for _, prop := range sortedKeys(s.Properties) {
+			field := GoName(prop)
+			if other, dup := fields[field]; dup {
+				return fmt.Errorf("schema %s: %s and %s are both %s", name, other, prop, field)
+			}
+			fields[field] = prop
+			typ, err := g.goType(s.Properties[prop])
+			if err != nil {
+				return fmt.Errorf("schema %s.%s: %w", name, prop, err)
+			}
+			if d := s.Properties[prop].Description; d != "" {
+				g.printf("\t// %s %s\n", field, d)
+			}
+			g.printf("\t%s %s `json:\"%s,omitempty\"`\n", field, typ, prop)
+		}
+		g.printf("}\n")
+	}
+	return nil
+}
+
+// params resolves the query parameters of an operation
+func (g *generator) params(op *Operation) ([]*Parameter, error) {
+	var params []*Parameter
+	for _, p := range op.Parameters {
+		if p.Ref != "" {
+			resolved, ok := g.spec.Components.Parameters[refName(p.Ref)]
+			if !ok {
+				return nil, fmt.Errorf("unknown parameter %s", p.Ref)
+			}
+			p = resolved
+		}
+		if p.In != "query" {
+			return nil, fmt.Errorf("parameter %s: only query parameters are supported", p.Name)
+		}
+		if p.GoSkip {
+			continue
+		}
+		params = append(params, p)
+	}
+	return params, nil
+}
+
+// paramsType writes the struct of the query parameters of an operation and its values method
+func (g *generator) paramsType(method string, params []*Parameter) error {
+	typeName := method + "Params"
+	g.printf("\n// %s query parameters of %s\ntype %s struct {\n", typeName, method, typeName)
+	for _, p := range params {
+		typ, err := g.goType(p.Schema)
+		if err != nil {
+			return fmt.Errorf("parameter %s: %w", p.Name, err)
+		}
+		if p.Description != "" {
+			g.printf("\t// %s %s\n", GoName(p.Name), p.Description)
+		}
+		g.printf("\t%s %s\n", GoName(p.Name), typ)
+	}
+	g.printf("}\n\n")
+
+	g.imports["net/url"] = true
+	g.printf("func (p *%s) values() url.Values {\n\tq := url.Values{}\n\tif p == nil {\n\t\tp = &%s{}\n\t}\n", typeName, typeName)
+	for _, p := range params {
+		field := "p." + GoName(p.Name)
+		typ, _ := g.goType(p.Schema)
+		var zero, encode string
+		switch typ {
+		case "string":
+			zero, encode = `""`, "%s"
+		case "int":
+			g.imports["strconv"] = true
+			zero, encode = "0", "strconv.Itoa(%s)"
+		case "int64":
+			g.imports["strconv"] = true
+			zero, encode = "0", "strconv.FormatInt(%s, 10)"
+		default:
+			return fmt.Errorf("parameter %s: unsupported type %s", p.Name, typ)
+		}
+		value := fmt.Sprintf(encode, field)
+		if p.Schema.Default != nil {
+			// parameters with a default are always sent, the server answers differently without them
+			g.printf("\tif %s == %s {\n\t\tq.Set(%q, %q)\n\t} else {\n\t\tq.Set(%q, %s)\n\t}\n", field, zero, p.Name, fmt.Sprint(p.Schema.Default), p.Name, value)
+			continue
+		}
+		g.printf("\tif %s != %s {\n\t\tq.Set(%q, %s)\n\t}\n", field, zero, p.Name, value)
+	}
+	g.printf("\treturn q\n}\n")
+	return nil
+}
+
+// dataSchema the schema of the data of the APIResponse envelope of the 200 response
+func dataSchema(op *Operation) (*Schema, error) {
+	resp, ok := op.Responses["200"]
+	if !ok || resp.Content.JSON == nil || resp.Content.JSON.Schema == nil {
+		return nil, fmt.Errorf("no json 200 response")
+	}
+	for _, s := range resp.Content.JSON.Schema.AllOf {
+		if data, ok := s.Properties["data"]; ok {
+			return data, nil
+		}
+	}
+	return nil, fmt.Errorf("200 response has no data property")
+}
+
+func (g *generator) operations() error {
+	var paths []string
+	for path := range g.spec.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		var methods []string
+		for m := range g.spec.Paths[path] {
+			methods = append(methods, m)
+		}
+		sort.Strings(methods)
+		for _, m := range methods {
+			op := g.spec.Paths[path][m]
+			if err := g.operation(strings.ToUpper(m), path, op); err != nil {
+				return fmt.Errorf("%s %s: %w", strings.ToUpper(m), path, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (g *generator) operation(httpMethod, path string, op *Operation) error {
+	if op.OperationID == "" {
+		return fmt.Errorf("no operationId")
+	}
+	method := GoName(op.OperationID)
+
+	params, err := g.params(op)
+	if err != nil {
+		return err
+	}
+	if len(params) > 0 {
+		if err = g.paramsType(method, params); err != nil {
+			return err
+		}
+	}
+
+	data, err := dataSchema(op)
+	if err != nil {
+		return err
+	}
+	dataType, err := g.goType(data)
+	if err != nil {
+		return err
+	}
+
+	args := "ctx context.Context"
+	query, body := "nil", "nil"
+	if len(params) > 0 {
+		args += ", params *" + method + "Params"
+		query = "params.values()"
+	}
+	if op.RequestBody != nil {
+		if op.RequestBody.Content.JSON == nil || op.RequestBody.Content.JSON.Schema == nil {
+			return fmt.Errorf("request body is not json")
+		}
+		bodyType, err := g.goType(op.RequestBody.Content.JSON.Schema)
+		if err != nil {
+			return err
+		}
+		args += ", body " + bodyType
+		body = "body"
+	}
+
+	g.printf("\n%s//\n// %s %s", comment(method, op.Summary), httpMethod, path)
+	if op.Attestation {
+		g.printf(", signed with SignKey")
+	}
+	g.printf("\nfunc (c *Client) %s(%s) (%s, error) {\n", method, args, dataType)
+	g.printf("\tvar data %s\n", dataType)
+	g.printf("\terr := c.do(ctx, %q, %q, %s, %s, %t, &data)\n", httpMethod, path, query, body, op.Attestation)
+	g.printf("\treturn data, err\n}\n")
+	return nil
+}
+
+// Generate returns the gofmt-ed source of the client for an OpenAPI document
+func Generate(specJSON []byte, pkg string) ([]byte, error) {
+	var spec Spec
+	if err := json.Unmarshal(specJSON, &spec); err != nil {
+		return nil, fmt.Errorf("codegen: parse spec: %w", err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		return nil, fmt.Errorf("codegen: openapi %q is not supported", spec.OpenAPI)
+	}
+
+	g := &generator{spec: &spec, imports: map[string]bool{"context": true}}
+	if err := g.schemas(); err != nil {
+		return nil, fmt.Errorf("codegen: %w", err)
+	}
+	if err := g.operations(); err != nil {
+		return nil, fmt.Errorf("codegen: %w", err)
+	}
+
+	var imports []string
+	for imp := range g.imports {
+		imports = append(imports, imp)
+	}
+	sort.Strings(imports)
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by apiclient/gen from restful/openapi.json. DO NOT EDIT.\n\npackage %s\n\nimport (\n", pkg)
+	for _, imp := range imports {
+		fmt.Fprintf(&out, "\t%q\n", imp)
+	}
+	out.WriteString(")\n")
+	out.Write(g.buf.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("codegen: format: %w\n%s", err, out.Bytes())
+	}
+	return src, nil
+}
@@ -3,6 +3,7 @@ package restful
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"strings"
@@ -11,29 +12,90 @@ import (
 
 	"github.com/ant0ine/go-json-rest/rest"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ip2location/ip2location-go/v9"
-	"go.cryptoscope.co/ssb/restful/params"
+	"go.cryptoscope.co/ssb/restful/rerr"
+	"go.mindeco.de/log/level"
 )
 
-// clientPublicIP
-func clientPublicIP(r *http.Request) string {
-	var ip string
-	for _, ip = range strings.Split(r.Header.Get("X-Forwarded-For"), ",") {
-		ip = strings.TrimSpace(ip)
-		if ip != "" && !HasLocalIPddr(ip) {
-			return ip
+// trustedProxies the reverse proxies in front of the api (api.trusted_proxies),
+// the X-Forwarded-For and X-Real-Ip headers are only believed on their connections
+type trustedProxies []*net.IPNet
+
+// parseTrustedProxies the ips and cidrs of the config
+func parseTrustedProxies(list []string) (trustedProxies, error) {
+	var tp trustedProxies
+	for _, p := range list {
+		if strings.Contains(p, "/") {
+			_, n, err := net.ParseCIDR(p)
+			if err != nil {
+				return nil, fmt.Errorf("trusted proxy %q: %w", p, err)
+			}
+			tp = append(tp, n)
+			continue
+		}
+		ip := net.ParseIP(p)
+		if ip == nil {
+			return nil, fmt.Errorf("trusted proxy %q is no ip or cidr", p)
+		}
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		tp = append(tp, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return tp, nil
+}
+
+func (tp trustedProxies) contains(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range tp {
+		if n.Contains(parsed) {
+			return true
 		}
 	}
-	ip = strings.TrimSpace(r.Header.Get("X-Real-Ip"))
-	if ip != "" && !HasLocalIPddr(ip) {
+	return false
+}
+
+// clientIP the address of the caller, the peer of the connection unless that is a trusted proxy.
+// X-Forwarded-For is read from the right, the first address that is no trusted proxy is the caller.
+func (tp trustedProxies) clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(strings.TrimSpace(r.RemoteAddr))
+	if err != nil {
+		ip = strings.TrimSpace(r.RemoteAddr)
+	}
+	if !tp.contains(ip) {
 		return ip
 	}
-	if ip, _, err := net.SplitHostPort(strings.TrimSpace(r.RemoteAddr)); err == nil {
-		if !HasLocalIPddr(ip) {
-			return ip
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		hops := strings.Split(xff, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				// the proxy did not write this, the last good hop is all we know
+				break
+			}
+			ip = hop
+			if !tp.contains(hop) {
+				break
+			}
 		}
+		return ip
+	}
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-Ip")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+	return ip
+}
+
+// clientPublicIP the address of the caller, "" if it is local
+func clientPublicIP(r *http.Request, tp trustedProxies) string {
+	ip := tp.clientIP(r)
+	if net.ParseIP(ip) == nil || HasLocalIPddr(ip) {
+		return ""
 	}
-	return ""
+	return ip
 }
 
 // HasLocalIPddr
@@ -63,64 +125,79 @@ func HasLocalIP(ip net.IP) bool {
 		(ip4[0] == 192 && ip4[1] == 168) // 192.168.0.0/16
 }
 
-// GetPublicIPLocation
-func GetPublicIPLocation(w rest.ResponseWriter, r *rest.Request) {
-	clientpublicip := clientPublicIP(r.Request)
+// GetPublicIPLocation the pubs of the directory ranked for the location of the caller, n (default directory.candidates) of them
+func (s *Service) GetPublicIPLocation(w rest.ResponseWriter, r *rest.Request) {
+	clientpublicip := clientPublicIP(r.Request, s.proxies)
 	var resp *APIResponse
 	defer func() {
-		fmt.Println(fmt.Sprintf(PrintTime()+"Restful Api Call ----> GetPublicIpLocation ,err=%s", resp.ErrorMsg))
 		writejson(w, resp)
 	}()
-	/*var req IPLoacation
-	err := r.DecodeJsonPayload(&req)
-	if err != nil {
-		rest.Error(w, err.Error(), http.StatusBadRequest)
-		return
+	n := s.cfg.Directory.Candidates
+	if v := r.URL.Query().Get("n"); v != "" {
+		var err error
+		n, err = strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			resp = NewAPIResponse(rerr.ErrArgumentError.Errorf("n %q should > 0", v), nil)
+			return
+		}
 	}
-	var ip = req.PublicIp*/
-	if clientpublicip == "" {
-		clientpublicip = strings.Split(params.InviteCodeOfPub2, ":")[0]
+
+	pbi := &PubInfoByIP{}
+	pbi.ReqPublicIP = clientpublicip
+	// 没有公网ip或者ip库不可用时,只按负载和存活排序
+	var client *geoLocation
+	if clientpublicip != "" {
+		var err error
+		client, err = s.geoip.lookup(clientpublicip)
+		if err != nil {
+			level.Debug(s.logger(logDirectory)).Log("event", "geoip lookup failed", "ip", clientpublicip, "err", err)
+		} else {
+			pbi.ContryShort = client.CountryShort
+			pbi.ContryLong = client.CountryLong
+			pbi.Region = client.Region
+			pbi.City = client.City
+		}
 	}
-	var ip = clientpublicip
 
-	db, err := ip2location.OpenDB(params.Ip2LocationLiteDbPath)
-	if err != nil {
-		rest.Error(w, err.Error(), http.StatusNotImplemented)
+	pbi.Candidates = rankPubs(s.pubs.list(), client, n, s.cfg.Directory.LoadPenaltyKm)
+	if len(pbi.Candidates) == 0 {
+		resp = NewAPIResponse(rerr.ErrNoPubAvailable, nil)
 		return
 	}
-	result, err := db.Get_all(ip)
-	if err != nil {
-		rest.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	first, second := pbi.Candidates[0], pbi.Candidates[0]
+	if len(pbi.Candidates) > 1 {
+		second = pbi.Candidates[1]
 	}
-	countryLong := result.Country_long
+	pbi.FirstChoicePubHost = s.apiHost(first)
+	pbi.FirstChoicePubInviteCode = first.InviteCode
+	pbi.SecondChoicePubHost = s.apiHost(second)
+	pbi.SecondChoicePubInviteCode = second.InviteCode
+	resp = NewAPIResponse(nil, pbi)
+}
 
-	pbi := &PubInfoByIP{}
-	pbi.ReqPublicIP = clientpublicip
-	pbi.ContryShort = result.Country_short
-	pbi.ContryLong = countryLong
-	pbi.Region = result.Region
-	pbi.City = result.City
+// GetPubStatus the load of this pub, the pub directories of the other pubs probe it
+func (s *Service) GetPubStatus(w rest.ResponseWriter, r *rest.Request) {
+	var resp *APIResponse
+	defer func() {
+		writejson(w, resp)
+	}()
+	status, err := s.status(r.Context())
+	resp = NewAPIResponse(err, status)
+}
 
-	if countryLong == "China" {
-		pbi.FirstChoicePubHost = fmt.Sprintf("%s:%d", strings.Split(params.InviteCodeOfPub1, ":")[0], params.ServePort)
-		pbi.FirstChoicePubInviteCode = params.InviteCodeOfPub1
-		pbi.SecondChoicePubHost = fmt.Sprintf("%s:%d", strings.Split(params.InviteCodeOfPub2, ":")[0], params.ServePort)
-		pbi.SecondChoicePubInviteCode = params.InviteCodeOfPub2
-	} else {
-		pbi.FirstChoicePubHost = fmt.Sprintf("%s:%d", strings.Split(params.InviteCodeOfPub2, ":")[0], params.ServePort)
-		pbi.FirstChoicePubInviteCode = params.InviteCodeOfPub2
-		pbi.SecondChoicePubHost = fmt.Sprintf("%s:%d", strings.Split(params.InviteCodeOfPub1, ":")[0], params.ServePort)
-		pbi.SecondChoicePubInviteCode = params.InviteCodeOfPub1
-	}
-	resp = NewAPIResponse(err, pbi)
+// GetPubs the pubs of the directory with the results of their last probe
+func (s *Service) GetPubs(w rest.ResponseWriter, r *rest.Request) {
+	var resp *APIResponse
+	defer func() {
+		writejson(w, resp)
+	}()
+	resp = NewAPIResponse(nil, s.pubs.list())
 }
 
 // GetSomeoneLike
-func GetRewardInfo(w rest.ResponseWriter, r *rest.Request) {
+func (s *Service) GetRewardInfo(w rest.ResponseWriter, r *rest.Request) {
 	var resp *APIResponse
 	defer func() {
-		fmt.Println(fmt.Sprintf(PrintTime()+"Restful Api Call ----> GetRewardInfo ,err=%s", resp.ErrorMsg))
 		writejson(w, resp)
 	}()
 	var req RewardingReq
@@ -136,14 +213,13 @@ func GetRewardInfo(w rest.ResponseWriter, r *rest.Request) {
 	var timefrom = req.TimeFrom
 	var timeTo = req.TimeTo
 
-	rresult, err := likeDB.SelectRewardResult(clientid, timefrom, timeTo)
+	rresult, err := s.db.SelectRewardResult(clientid, timefrom, timeTo)
 	resp = NewAPIResponse(err, rresult)
 }
 
-func GetRewardSubtotals(w rest.ResponseWriter, r *rest.Request) {
+func (s *Service) GetRewardSubtotals(w rest.ResponseWriter, r *rest.Request) {
 	var resp *APIResponse
 	defer func() {
-		fmt.Println(fmt.Sprintf(PrintTime()+"Restful Api Call ----> GetRewardSubtotals ,err=%s", resp.ErrorMsg))
 		writejson(w, resp)
 	}()
 	var req RewardingReq
@@ -159,28 +235,30 @@ func GetRewardSubtotals(w rest.ResponseWriter, r *rest.Request) {
 	var timefrom = req.TimeFrom
 	var timeTo = req.TimeTo
 
-	rresult, err := likeDB.SelectRewardSum(clientid, grandsuccess, timefrom, timeTo)
+	rresult, err := s.db.SelectRewardSum(clientid, grandsuccess, timefrom, timeTo)
 
 	resp = NewAPIResponse(err, rresult)
 }
 
 // GetAllSetLikes
-func GetAllSetLikes(w rest.ResponseWriter, r *rest.Request) {
+func (s *Service) GetAllSetLikes(w rest.ResponseWriter, r *rest.Request) {
+	if isListQuery(r.Request) {
+		s.serveList(w, r, "GetAllSetLikes", nil, s.listSetLikes)
+		return
+	}
 	var resp *APIResponse
 	defer func() {
-		fmt.Println(fmt.Sprintf(PrintTime()+"Restful Api Call ----> GetAllSetLikes ,err=%s", resp.ErrorMsg))
 		writejson(w, resp)
 	}()
 
-	setlikes, err := likeDB.SelectUserSetLikeInfo("")
+	setlikes, err := s.db.SelectUserSetLikeInfo("")
 	resp = NewAPIResponse(err, setlikes)
 }
 
 // GetSomeoneLike
-func GetSomeoneSetLikes(w rest.ResponseWriter, r *rest.Request) {
+func (s *Service) GetSomeoneSetLikes(w rest.ResponseWriter, r *rest.Request) {
 	var resp *APIResponse
 	defer func() {
-		fmt.Println(fmt.Sprintf(PrintTime()+"Restful Api Call ----> GetSomeoneSetLikes ,err=%s", resp.ErrorMsg))
 		writejson(w, resp)
 	}()
 	var req Name2ProfileReponse
@@ -191,15 +269,14 @@ func GetSomeoneSetLikes(w rest.ResponseWriter, r *rest.Request) {
 	}
 
 	var cid = req.ID
-	setlikes, err := likeDB.SelectUserSetLikeInfo(cid)
+	setlikes, err := s.db.SelectUserSetLikeInfo(cid)
 	resp = NewAPIResponse(err, setlikes)
 }
 
 // NotifyCreatedNFT
-func NotifyCreatedNFT(w rest.ResponseWriter, r *rest.Request) {
+func (s *Service) NotifyCreatedNFT(w rest.ResponseWriter, r *rest.Request) {
 	var resp *APIResponse
 	defer func() {
-		fmt.Println(fmt.Sprintf(PrintTime()+"Restful Api Call ----> NotifyCreatedNFT ,err=%s", resp.ErrorMsg))
 		writejson(w, resp)
 	}()
 	var req ReqCreatedNFT
@@ -214,30 +291,22 @@ func NotifyCreatedNFT(w rest.ResponseWriter, r *rest.Request) {
 	var tx = req.NfttxHash
 	var tokenid = req.NftTokenId
 	var storeurl = req.NftStoredUrl
-	_, err = likeDB.InsertUserTaskCollect(params.PubID, cid, "", "4", "", ctime, tx, tokenid, storeurl)
+	_, err = s.db.InsertUserTaskCollect(s.pubID, cid, "", "4", "", ctime, tx, tokenid, storeurl)
 	if err != nil {
 		rest.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	{ //发送激励
-		name2addr, err := GetNodeProfile(cid)
-		if err != nil || len(name2addr) != 1 {
-			fmt.Println(fmt.Errorf(MintNft+" Reward %s ethereum address failed, err= not found or %s", cid, err))
-		} else {
-			ehtAddr := name2addr[0].EthAddress
-			go PubRewardToken(ehtAddr, int64(params.RewardOfMintNft), cid, MintNft, "", time.Now().UnixNano()/1e6)
-		}
-	}
+	//发送激励
+	s.rewardFeed(cid, MintNft, "", time.Now().UnixNano()/1e6)
 
 	resp = NewAPIResponse(err, "Success")
 }
 
 // NotifyUserLogin
-func NotifyUserLogin(w rest.ResponseWriter, r *rest.Request) {
+func (s *Service) NotifyUserLogin(w rest.ResponseWriter, r *rest.Request) {
 	var resp *APIResponse
 	defer func() {
-		fmt.Println(fmt.Sprintf(PrintTime()+"Restful Api Call ----> NotifyUserLogin ,err=%s", resp.ErrorMsg))
 		writejson(w, resp)
 	}()
 	var req ReqUserLoginApp
@@ -249,29 +318,51 @@ func NotifyUserLogin(w rest.ResponseWriter, r *rest.Request) {
 
 	var cid = req.ClientID
 	var logintime = req.LoginTime
-	_, err = likeDB.InsertUserTaskCollect(params.PubID, cid, "", "1", "", logintime, "", "", "")
+	err = s.collectDailyLogin(cid, logintime)
+	if err == rerr.ErrAlreadyLoggedInToday {
+		resp = NewAPIResponse(err, nil)
+		return
+	}
 	if err != nil {
 		rest.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	{ //发送激励
-		name2addr, err := GetNodeProfile(cid)
-		if err != nil || len(name2addr) != 1 {
-			fmt.Println(fmt.Errorf(DailyLogin+" Reward %s ethereum address failed, err= not found or %s", cid, err))
-		} else {
-			ehtAddr := name2addr[0].EthAddress
-			go PubRewardToken(ehtAddr, int64(params.RewardOfDailyLogin), cid, DailyLogin, "", time.Now().UnixNano()/1e6)
+	//发送激励
+	s.rewardFeed(cid, DailyLogin, "", time.Now().UnixNano()/1e6)
+	resp = NewAPIResponse(err, "Success")
+}
+
+// collectDailyLogin records the login of cid, only the first login of a day (pub local time) is recorded,
+// a logintime outside of today is replaced by the time of the pub
+func (s *Service) collectDailyLogin(cid string, logintime int64) error {
+	s.dailyLoginLock.Lock()
+	defer s.dailyLoginLock.Unlock()
+
+	now := time.Now()
+	daystart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).UnixNano() / 1e6
+	dayend := daystart + 24*3600*1000 - 1
+	if logintime < daystart || logintime > dayend {
+		logintime = now.UnixNano() / 1e6
+	}
+
+	logins, err := s.db.GetUserTaskCollect(cid, "1", daystart, dayend)
+	if err != nil {
+		return err
+	}
+	for _, login := range logins {
+		if login.Author == cid && login.CollectFromPub == s.pubID {
+			return rerr.ErrAlreadyLoggedInToday
 		}
 	}
-	resp = NewAPIResponse(err, "Success")
+	_, err = s.db.InsertUserTaskCollect(s.pubID, cid, "", "1", "", logintime, "", "", "")
+	return err
 }
 
 // GetUserDailyTasks
-func GetUserDailyTasks(w rest.ResponseWriter, r *rest.Request) {
+func (s *Service) GetUserDailyTasks(w rest.ResponseWriter, r *rest.Request) {
 	var resp *APIResponse
 	defer func() {
-		fmt.Println(fmt.Sprintf(PrintTime()+"Restful Api Call ----> GetUserDailyTasks ,err=%s", resp.ErrorMsg))
 		writejson(w, resp)
 	}()
 	var req ReqUserTask
@@ -286,15 +377,14 @@ func GetUserDailyTasks(w rest.ResponseWriter, r *rest.Request) {
 	var starttime = req.StartTime
 	var endtime = req.EndTime
 
-	taskcollctions, err := likeDB.GetUserTaskCollect(author, msgtype, starttime, endtime)
+	taskcollctions, err := s.db.GetUserTaskCollect(author, msgtype, starttime, endtime)
 	resp = NewAPIResponse(err, taskcollctions)
 }
 
 // GetEventSensitiveWord
-func GetEventSensitiveWord(w rest.ResponseWriter, r *rest.Request) {
+func (s *Service) GetEventSensitiveWord(w rest.ResponseWriter, r *rest.Request) {
 	var resp *APIResponse
 	defer func() {
-		fmt.Println(fmt.Sprintf(PrintTime()+"Restful Api Call ----> GetEventSensitiveWord ,err=%s", resp.ErrorMsg))
 		writejson(w, resp)
 	}()
 	var req EventSensitive
@@ -305,15 +395,14 @@ func GetEventSensitiveWord(w rest.ResponseWriter, r *rest.Request) {
 	}
 
 	var tag = req.DealTag
-	senvents, err := likeDB.SelectSensitiveWordRecord(tag)
+	senvents, err := s.db.SelectSensitiveWordRecord(tag)
 	resp = NewAPIResponse(err, senvents)
 }
 
 // DealSensitiveWord
-func DealSensitiveWord(w rest.ResponseWriter, r *rest.Request) {
+func (s *Service) DealSensitiveWord(w rest.ResponseWriter, r *rest.Request) {
 	var resp *APIResponse
 	defer func() {
-		fmt.Println(fmt.Sprintf(PrintTime()+"Restful Api Call ----> DealSensitiveWord ,err=%s", resp.ToFormatString()))
 		writejson(w, resp)
 	}()
 
@@ -328,28 +417,32 @@ func DealSensitiveWord(w rest.ResponseWriter, r *rest.Request) {
 	var dealtag = req.DealTag
 	var dealtime = time.Now().UnixNano() / 1e6
 	var author = req.MessageAuthor
-	_, err = likeDB.UpdateSensitiveWordRecord(dealtag, dealtime, msgkey)
+	_, err = s.db.UpdateSensitiveWordRecord(dealtag, dealtime, msgkey)
 	if err != nil {
 		rest.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	s.updateModerationMetrics()
 	if req.DealTag == "1" { ////for table sensitivewordrecord, dealtag=0初始化  =1属实 =2否定
 		// block 'the author who publish sensitive word' ONCE
-		err = contactSomeone(nil, author, true, true)
+		err = s.contactSomeone(r.Context(), author, true, true)
 		if err != nil {
 			resp = NewAPIResponse(err, fmt.Sprintf("block %s failed", author))
 			return
 		}
-		fmt.Println(fmt.Sprintf(PrintTime()+"Success to block %s", author))
+		level.Info(s.logger(logModeration)).Log("event", "blocked", "feed", author, "msgkey", msgkey)
 	}
-	resp = NewAPIResponse(err, "success")
+	err = s.publishModeration(r.Context(), author, msgkey, ModerationReasonSensitiveWord, dealtag, dealtime)
+	if err != nil {
+		level.Error(s.logger(logModeration)).Log("event", "publish decision failed", "feed", author, "msgkey", msgkey, "err", err)
+	}
+	resp = NewAPIResponse(nil, "success")
 }
 
 // TippedOff
-func TippedOff(w rest.ResponseWriter, r *rest.Request) {
+func (s *Service) TippedOff(w rest.ResponseWriter, r *rest.Request) {
 	var resp *APIResponse
 	defer func() {
-		fmt.Println(fmt.Sprintf(PrintTime()+"Restful Api Call ----> TippedWhoOff ,err=%s", resp.ToFormatString()))
 		writejson(w, resp)
 	}()
 	var req TippedOffStu
@@ -364,16 +457,17 @@ func TippedOff(w rest.ResponseWriter, r *rest.Request) {
 	var mkey = req.MessageKey
 	var reasons = req.Reasons
 
-	if defendant == params.PubID {
-		resp = NewAPIResponse(err, fmt.Sprintf("Permission denied, from pub : %s", params.PubID))
+	if defendant == s.pubID {
+		resp = NewAPIResponse(err, fmt.Sprintf("Permission denied, from pub : %s", s.pubID))
 		return
 	}
 	var recordtime = time.Now().UnixNano() / 1e6
-	lstid, err := likeDB.InsertViolation(recordtime, plaintiff, defendant, mkey, reasons)
+	lstid, err := s.db.InsertViolation(recordtime, plaintiff, defendant, mkey, reasons)
 	if err != nil {
 		rest.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	s.updateModerationMetrics()
 	if lstid == -1 {
 		resp = NewAPIResponse(err, "You've already reported it, thank your again👍")
 		return
@@ -383,11 +477,9 @@ func TippedOff(w rest.ResponseWriter, r *rest.Request) {
 }
 
 // TippedOffInfo get infos
-func GetTippedOffInfo(w rest.ResponseWriter, r *rest.Request) {
+func (s *Service) GetTippedOffInfo(w rest.ResponseWriter, r *rest.Request) {
 	var resp *APIResponse
 	defer func() {
-		//fmt.Println(fmt.Sprintf("Restful Api Call ----> GetTippedOffInfo ,err=%s", resp.ToFormatString()))
-		fmt.Println(fmt.Sprintf(PrintTime()+"Restful Api Call ----> GetTippedOffInfo ,err=%s", resp.ErrorMsg))
 		writejson(w, resp)
 	}()
 	var req TippedOffStu
@@ -396,16 +488,15 @@ func GetTippedOffInfo(w rest.ResponseWriter, r *rest.Request) {
 		rest.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	datas, err := likeDB.SelectViolationByWhere(req.Plaintiff, req.Defendant, req.MessageKey, req.Reasons, req.DealTag)
+	datas, err := s.db.SelectViolationByWhere(req.Plaintiff, req.Defendant, req.MessageKey, req.Reasons, req.DealTag)
 
 	resp = NewAPIResponse(err, datas)
 }
 
 // DealTippedOff
-func DealTippedOff(w rest.ResponseWriter, r *rest.Request) {
+func (s *Service) DealTippedOff(w rest.ResponseWriter, r *rest.Request) {
 	var resp *APIResponse
 	defer func() {
-		fmt.Println(fmt.Sprintf(PrintTime()+"Restful Api Call ----> DealTippedOff ,err=%s", resp.ToFormatString()))
 		writejson(w, resp)
 	}()
 	var req TippedOffStu
@@ -416,31 +507,47 @@ func DealTippedOff(w rest.ResponseWriter, r *rest.Request) {
 	}
 
 	var dtime = time.Now().UnixNano() / 1e6
-	_, err = likeDB.UpdateViolation(req.DealTag, dtime, req.Dealreward, req.Plaintiff, req.Defendant, req.MessageKey)
+	_, err = s.db.UpdateViolation(req.DealTag, dtime, req.Dealreward, req.Plaintiff, req.Defendant, req.MessageKey)
 	if err != nil {
 		rest.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	s.updateModerationMetrics()
+	//来自受信任pub的处理结果,不再发布,也不发送激励
+	imported := s.IsTrustedModerationPub(req.Plaintiff)
+	if !imported {
+		errm := s.publishModeration(r.Context(), req.Defendant, req.MessageKey, req.Reasons, req.DealTag, dtime)
+		if errm != nil {
+			level.Error(s.logger(logModeration)).Log("event", "publish decision failed", "feed", req.Defendant, "msgkey", req.MessageKey, "err", errm)
+		}
+	}
 	if req.DealTag == "1" { ////for table violationrecord, dealtag=0举报 =1属实 =2事实不清,不予处理
 		//1 unfollow and block 'the defendant' and sign him to blacklist
-		err = contactSomeone(nil, req.Defendant, true, true)
+		err = s.contactSomeone(r.Context(), req.Defendant, true, true)
 		if err != nil {
 			resp = NewAPIResponse(err, fmt.Sprintf("Unfollow and block %s failed, err=%s", req.Defendant, err))
 			return
 		}
-		fmt.Println(fmt.Sprintf(PrintTime()+"Success to Unfollow and block %s", req.Defendant))
+		level.Info(s.logger(logModeration)).Log("event", "blocked", "feed", req.Defendant, "msgkey", req.MessageKey)
+
+		if imported {
+			resp = NewAPIResponse(err, fmt.Sprintf("success, [%s] has been block by [pub administrator]", req.Defendant))
+			return
+		}
 
 		{ //发送激励
-			name2addr, err := GetNodeProfile(req.Plaintiff)
+			name2addr, err := s.GetNodeProfile(req.Plaintiff)
 			if err != nil || len(name2addr) != 1 {
-				fmt.Println(fmt.Errorf(ReportProblematicPost+" Reward %s ethereum address failed, err= not found or %s", req.Plaintiff, err))
+				level.Debug(s.logger(logRewards)).Log("event", "no eth address to reward", "feed", req.Plaintiff, "msgkey", req.MessageKey, "reason", ReportProblematicPost, "err", err)
 			} else {
 				ehtAddr := name2addr[0].EthAddress
-				go PubRewardToken(ehtAddr, int64(params.RewardOfReportProblematicPost), req.Plaintiff, ReportProblematicPost, req.MessageKey, dtime)
+				s.goPayout(func() {
+					s.PubRewardToken(ehtAddr, int64(s.cfg.Rewards.ReportProblematicPost), req.Plaintiff, ReportProblematicPost, req.MessageKey, dtime)
+				})
 			}
 		}
 
-		_, err = likeDB.UpdateViolation(req.DealTag, dtime, fmt.Sprintf("%d%s", params.RewardOfReportProblematicPost, "e18-"), req.Plaintiff, req.Defendant, req.MessageKey)
+		_, err = s.db.UpdateViolation(req.DealTag, dtime, fmt.Sprintf("%d%s", s.cfg.Rewards.ReportProblematicPost, "e18-"), req.Plaintiff, req.Defendant, req.MessageKey)
 		if err != nil {
 			rest.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -453,38 +560,39 @@ func DealTippedOff(w rest.ResponseWriter, r *rest.Request) {
 }
 
 // GetPubWhoami
-func GetPubWhoami(w rest.ResponseWriter, r *rest.Request) {
+func (s *Service) GetPubWhoami(w rest.ResponseWriter, r *rest.Request) {
 	var resp *APIResponse
 	defer func() {
-		fmt.Println(fmt.Sprintf(PrintTime()+"Restful Api Call ----> GetPubWhoami ,err=%s", resp.ToFormatString()))
 		writejson(w, resp)
 	}()
 
 	pinfo := &Whoami{}
-	pinfo.Pub_Id = params.PubID
-	pinfo.Pub_Eth_Address = params.PhotonAddress
+	pinfo.Pub_Id = s.pubID
+	pinfo.Pub_Eth_Address = s.cfg.Pub.EthAddress
 	resp = NewAPIResponse(nil, pinfo)
 	return
 }
 
 // clientid2Profile
-func clientid2Profiles(w rest.ResponseWriter, r *rest.Request) {
+func (s *Service) clientid2Profiles(w rest.ResponseWriter, r *rest.Request) {
+	if isListQuery(r.Request) {
+		s.serveList(w, r, "clientid2Profiles", nil, s.listNodeProfiles)
+		return
+	}
 	var resp *APIResponse
 	defer func() {
-		fmt.Println(fmt.Sprintf(PrintTime()+"Restful Api Call ----> node-infos ,err=%s", resp.ErrorMsg))
 		writejson(w, resp)
 	}()
 
-	name2addr, err := GetAllNodesProfile()
+	name2addr, err := s.GetAllNodesProfile()
 	resp = NewAPIResponse(err, name2addr)
 	return
 }
 
 // clientid2Profile
-func clientid2Profile(w rest.ResponseWriter, r *rest.Request) {
+func (s *Service) clientid2Profile(w rest.ResponseWriter, r *rest.Request) {
 	var resp *APIResponse
 	defer func() {
-		fmt.Println(fmt.Sprintf(PrintTime()+"Restful Api Call ----> node-infos ,err=%s", resp.ErrorMsg))
 		writejson(w, resp)
 	}()
 	var req Name2ProfileReponse
@@ -495,15 +603,14 @@ func clientid2Profile(w rest.ResponseWriter, r *rest.Request) {
 	}
 
 	var cid = req.ID
-	name2addr, err := GetNodeProfile(cid)
+	name2addr, err := s.GetNodeProfile(cid)
 	resp = NewAPIResponse(err, name2addr)
 }
 
 //UpdateEthAddr
-func UpdateEthAddr(w rest.ResponseWriter, r *rest.Request) {
+func (s *Service) UpdateEthAddr(w rest.ResponseWriter, r *rest.Request) {
 	var resp *APIResponse
 	defer func() {
-		fmt.Println(fmt.Sprintf(PrintTime()+"Restful Api Call ----> UpdateEthAddr ,err=%s", resp.ToFormatString()))
 		writejson(w, resp)
 	}()
 	var req = &Name2ProfileReponse{}
@@ -520,7 +627,7 @@ func UpdateEthAddr(w rest.ResponseWriter, r *rest.Request) {
 		return
 	}*/
 	ethAddress := common.HexToAddress(req.EthAddress)
-	_, err = likeDB.UpdateUserProfile(req.ID, req.Name, ethAddress.String())
+	_, err = s.db.UpdateUserProfile(req.ID, req.Name, ethAddress.String())
 	if err != nil {
 		rest.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -533,15 +640,16 @@ func UpdateEthAddr(w rest.ResponseWriter, r *rest.Request) {
 		resp = NewAPIResponse(fmt.Errorf("fail to create a channel to %s, because %s", ethAddress.String(), err), nil)
 		return
 	}*/
-	go NewChannelDeal(ethAddress.String(), req.ID, time.Now().UnixNano()/1e6)
+	s.goPayout(func() {
+		s.NewChannelDeal(ethAddress.String(), req.ID, time.Now().UnixNano()/1e6)
+	})
 	resp = NewAPIResponse(err, "success")
 }
 
 // GetAllNodesProfile
-func GetAllNodesProfile() (datas []*Name2ProfileReponse, err error) {
-	profiles, err := likeDB.SelectUserProfile("")
+func (s *Service) GetAllNodesProfile() (datas []*Name2ProfileReponse, err error) {
+	profiles, err := s.db.SelectUserProfile("")
 	if err != nil {
-		fmt.Println(fmt.Sprintf(PrintTime()+"Failed to db-SelectUserProfileAll", err))
 		return
 	}
 	datas = profiles
@@ -549,10 +657,9 @@ func GetAllNodesProfile() (datas []*Name2ProfileReponse, err error) {
 }
 
 // GetNodeProfile
-func GetNodeProfile(cid string) (datas []*Name2ProfileReponse, err error) {
-	profile, err := likeDB.SelectUserProfile(cid)
+func (s *Service) GetNodeProfile(cid string) (datas []*Name2ProfileReponse, err error) {
+	profile, err := s.db.SelectUserProfile(cid)
 	if err != nil {
-		fmt.Println(fmt.Sprintf(PrintTime()+"Failed to db-SelectUserEthAddrAll", err))
 		return
 	}
 	datas = profile
@@ -560,23 +667,25 @@ func GetNodeProfile(cid string) (datas []*Name2ProfileReponse, err error) {
 }
 
 // GetAllLikes
-func GetAllLikes(w rest.ResponseWriter, r *rest.Request) {
+func (s *Service) GetAllLikes(w rest.ResponseWriter, r *rest.Request) {
+	if isListQuery(r.Request) {
+		s.serveList(w, r, "GetAllLikes", nil, s.listLikes)
+		return
+	}
 	var resp *APIResponse
 	defer func() {
-		fmt.Println(fmt.Sprintf(PrintTime()+"Restful Api Call ----> GetAllLikes ,err=%s", resp.ErrorMsg))
 		writejson(w, resp)
 	}()
 
-	likes, err := CalcGetLikeSum("")
+	likes, err := s.CalcGetLikeSum("")
 
 	resp = NewAPIResponse(err, likes)
 }
 
 // GetSomeoneLike
-func GetSomeoneLike(w rest.ResponseWriter, r *rest.Request) {
+func (s *Service) GetSomeoneLike(w rest.ResponseWriter, r *rest.Request) {
 	var resp *APIResponse
 	defer func() {
-		fmt.Println(fmt.Sprintf(PrintTime()+"Restful Api Call ----> GetSomeoneLike ,err=%s", resp.ErrorMsg))
 		writejson(w, resp)
 	}()
 	var req Name2ProfileReponse
@@ -587,15 +696,14 @@ func GetSomeoneLike(w rest.ResponseWriter, r *rest.Request) {
 	}
 
 	var cid = req.ID
-	like, err := CalcGetLikeSum(cid)
+	like, err := s.CalcGetLikeSum(cid)
 	resp = NewAPIResponse(err, like)
 }
 
 // GetAllNodesProfile
-func CalcGetLikeSum(someoneOrAll string) (datas map[string]*LasterNumLikes, err error) {
-	likes, err := likeDB.SelectLikeSum(someoneOrAll)
+func (s *Service) CalcGetLikeSum(someoneOrAll string) (datas map[string]*LasterNumLikes, err error) {
+	likes, err := s.db.SelectLikeSum(someoneOrAll)
 	if err != nil {
-		fmt.Println(fmt.Sprintf(PrintTime()+"Failed to db-SelectLikeSum", err))
 		return
 	}
 	datas = likes
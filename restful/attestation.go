@@ -0,0 +1,170 @@
+package restful
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"go.cryptoscope.co/ssb/restful/rerr"
+	refs "go.mindeco.de/ssb-refs"
+	"golang.org/x/crypto/ed25519"
+)
+
+const (
+	// AttestationTimestampHeader unix time in milliseconds the client signed the request at
+	AttestationTimestampHeader = "X-Metalife-Timestamp"
+	// AttestationSignatureHeader base64 ed25519 signature of AttestationPayload by the key of the client_id feed,
+	// the ".sig.ed25519" suffix of ssb signatures is accepted
+	AttestationSignatureHeader = "X-Metalife-Signature"
+)
+
+// attestationDomain keeps the signatures of restful requests apart from the signatures of ssb messages
+const attestationDomain = "metalife-attestation"
+
+// attestedFeedEnv the key of the env of a request to an attested route, the feed that signed it or "" for an unsigned request
+const attestedFeedEnv = "ATTESTED_FEED"
+
+// seenPruneEvery expired signatures are dropped after this many signed calls
+const seenPruneEvery = 1024
+
+// AttestationPayload the bytes a client signs for a request:
+// "metalife-attestation\n" + route + "\n" + hex(sha256(body)) + "\n" + timestamp + "\n" + pub id
+func AttestationPayload(route string, body []byte, timestamp int64, pubID string) []byte {
+	sum := sha256.Sum256(body)
+	return []byte(strings.Join([]string{
+		attestationDomain,
+		route,
+		hex.EncodeToString(sum[:]),
+		strconv.FormatInt(timestamp, 10),
+		pubID,
+	}, "\n"))
+}
+
+// AttestationMiddleware verifies that the requests to Routes are signed by the key of the client_id feed of their body
+type AttestationMiddleware struct {
+	Routes   map[string]bool
+	Window   time.Duration
+	Required bool
+	PubID    string
+
+	mu    sync.Mutex
+	seen  map[string]time.Time
+	calls int
+
+	now func() time.Time
+}
+
+// NewAttestationMiddleware creates a verifier for routes, signatures are accepted once within window
+func NewAttestationMiddleware(routes []string, window time.Duration, required bool, pubID string) *AttestationMiddleware {
+	am := &AttestationMiddleware{
+		Routes:   make(map[string]bool, len(routes)),
+		Window:   window,
+		Required: required,
+		PubID:    pubID,
+		seen:     make(map[string]time.Time),
+		now:      time.Now,
+	}
+	for _, route := range routes {
+		am.Routes[route] = true
+	}
+	return am
+}
+
+// MiddlewareFunc makes AttestationMiddleware implement the rest.Middleware interface
+func (am *AttestationMiddleware) MiddlewareFunc(h rest.HandlerFunc) rest.HandlerFunc {
+	return func(w rest.ResponseWriter, r *rest.Request) {
+		path := r.URL.Path
+		if !am.Routes[path] {
+			h(w, r)
+			return
+		}
+		feed, err := am.attest(path, r.Request)
+		if err != nil {
+			// the access log has the rejection
+			w.WriteHeader(http.StatusUnauthorized)
+			writejson(w, NewExceptionAPIResponse(err))
+			return
+		}
+		r.Env[attestedFeedEnv] = feed
+		h(w, r)
+	}
+}
+
+// attest checks the signature headers of a request to route, it returns the feed that signed it.
+// Unsigned requests pass with "" if attestations are not required.
+func (am *AttestationMiddleware) attest(route string, r *http.Request) (string, error) {
+	tsHeader := r.Header.Get(AttestationTimestampHeader)
+	sigHeader := r.Header.Get(AttestationSignatureHeader)
+	if tsHeader == "" && sigHeader == "" {
+		if am.Required {
+			return "", rerr.ErrAttestationMissing.Append("headers " + AttestationTimestampHeader + " and " + AttestationSignatureHeader + " are required")
+		}
+		return "", nil
+	}
+
+	timestamp, err := strconv.ParseInt(tsHeader, 10, 64)
+	if err != nil {
+		return "", rerr.ErrAttestationInvalid.Append("bad timestamp")
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(sigHeader, ".sig.ed25519"))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return "", rerr.ErrAttestationInvalid.Append("bad signature encoding")
+	}
+
+	body, err := peekRequestBody(r)
+	if err != nil {
+		return "", rerr.ErrAttestationInvalid.AppendError(err)
+	}
+	if len(body) >= maxPeekBody {
+		return "", rerr.ErrAttestationInvalid.Append("body too large")
+	}
+	var who struct {
+		ClientID string `json:"client_id"`
+	}
+	if err = json.Unmarshal(body, &who); err != nil {
+		return "", rerr.ErrAttestationInvalid.AppendError(err)
+	}
+	feed, err := refs.ParseFeedRef(who.ClientID)
+	if err != nil {
+		return "", rerr.ErrAttestationInvalid.Append("bad client_id")
+	}
+	if feed.Algo() != refs.RefAlgoFeedSSB1 {
+		return "", rerr.ErrAttestationInvalid.Append("client_id is not an ed25519 feed")
+	}
+
+	now := am.now()
+	signedAt := time.Unix(0, timestamp*int64(time.Millisecond))
+	if signedAt.Before(now.Add(-am.Window)) || signedAt.After(now.Add(am.Window)) {
+		return "", rerr.ErrAttestationExpired.Append(fmt.Sprintf("timestamp %d is more than %s off", timestamp, am.Window))
+	}
+
+	if !ed25519.Verify(feed.PubKey(), AttestationPayload(route, body, timestamp, am.PubID), sig) {
+		return "", rerr.ErrAttestationInvalid.Append("signature does not match " + who.ClientID)
+	}
+
+	// a valid signature expires with its timestamp, it only has to be remembered until then
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.calls++
+	if am.calls%seenPruneEvery == 0 {
+		for key, expires := range am.seen {
+			if expires.Before(now) {
+				delete(am.seen, key)
+			}
+		}
+	}
+	key := string(sig)
+	if _, replayed := am.seen[key]; replayed {
+		return "", rerr.ErrAttestationReplayed
+	}
+	am.seen[key] = signedAt.Add(am.Window)
+	return feed.String(), nil
+}
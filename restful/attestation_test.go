@@ -0,0 +1,142 @@
+package restful
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/ssb/restful/params"
+	"go.cryptoscope.co/ssb/restful/rerr"
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestAttestationVerify(t *testing.T) {
+	r := require.New(t)
+
+	const (
+		path  = "/ssb/api/notify-login"
+		pubID = "@HZnU6wM+F17J0RSLXP05x3Lag2jGv3F3LzHMjh72coE=.ed25519"
+	)
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	r.NoError(err)
+	feed := "@" + base64.StdEncoding.EncodeToString(pub) + ".ed25519"
+
+	clock := time.Unix(1650000000, 0)
+	am := NewAttestationMiddleware([]string{path}, 5*time.Minute, true, pubID)
+	am.now = func() time.Time { return clock }
+
+	signed := func(body []byte, ts int64, route string) *http.Request {
+		req, err := http.NewRequest(http.MethodPost, "http://pub"+path, bytes.NewReader(body))
+		r.NoError(err)
+		sig := ed25519.Sign(priv, AttestationPayload(route, body, ts, pubID))
+		req.Header.Set(AttestationTimestampHeader, strconv.FormatInt(ts, 10))
+		req.Header.Set(AttestationSignatureHeader, base64.StdEncoding.EncodeToString(sig)+".sig.ed25519")
+		return req
+	}
+	body := []byte(`{"client_id":"` + feed + `","login_time":1650000000000}`)
+	now := clock.UnixNano() / 1e6
+
+	req, err := http.NewRequest(http.MethodPost, "http://pub"+path, bytes.NewReader(body))
+	r.NoError(err)
+	_, err = am.attest(path, req)
+	r.Equal(rerr.ErrAttestationMissing.ErrorCode, err.(rerr.StandardError).ErrorCode)
+
+	req = signed(body, now, path)
+	signer, err := am.attest(path, req)
+	r.NoError(err)
+	r.Equal(feed, signer)
+	// the handler still gets the whole body
+	var restored bytes.Buffer
+	_, err = restored.ReadFrom(req.Body)
+	r.NoError(err)
+	r.Equal(body, restored.Bytes())
+
+	_, err = am.attest(path, signed(body, now, path))
+	r.Equal(rerr.ErrAttestationReplayed, err)
+
+	stale := now - (6 * time.Minute).Milliseconds()
+	_, err = am.attest(path, signed(body, stale, path))
+	r.Equal(rerr.ErrAttestationExpired.ErrorCode, err.(rerr.StandardError).ErrorCode)
+
+	// signed for another route, or the body was changed after signing
+	_, err = am.attest(path, signed(body, now+1, "/ssb/api/notify-created-nft"))
+	r.Equal(rerr.ErrAttestationInvalid.ErrorCode, err.(rerr.StandardError).ErrorCode)
+	tampered := signed(body, now+2, path)
+	tampered.Body = http.NoBody
+	_, err = am.attest(path, tampered)
+	r.Equal(rerr.ErrAttestationInvalid.ErrorCode, err.(rerr.StandardError).ErrorCode)
+
+	// signed by another key
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	r.NoError(err)
+	otherBody := []byte(`{"client_id":"@` + base64.StdEncoding.EncodeToString(other) + `.ed25519"}`)
+	_, err = am.attest(path, signed(otherBody, now+3, path))
+	r.Equal(rerr.ErrAttestationInvalid.ErrorCode, err.(rerr.StandardError).ErrorCode)
+
+	am.Required = false
+	req, err = http.NewRequest(http.MethodPost, "http://pub"+path, bytes.NewReader(body))
+	r.NoError(err)
+	signer, err = am.attest(path, req)
+	r.NoError(err)
+	r.Equal("", signer, "unsigned")
+}
+
+// TestAttestationBeforeRateLimit unsigned or forged requests for a feed do not use up the bucket of that feed
+func TestAttestationBeforeRateLimit(t *testing.T) {
+	r := require.New(t)
+	dir, err := ioutil.TempDir("", "attestation")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+
+	const path = "/ssb/api/notify-login"
+	cfg := params.DefaultConfig()
+	cfg.RateLimit = map[string]params.RateLimitRule{path: {PerIPRate: 1, PerIPBurst: 100, PerFeedRate: 0.001, PerFeedBurst: 1}}
+	s := newTestService(t, dir, cfg, idleBackend{})
+	defer s.db.Close()
+	server, err := s.newAPIServer()
+	r.NoError(err)
+
+	victim, victimKey, err := ed25519.GenerateKey(rand.Reader)
+	r.NoError(err)
+	_, attackerKey, err := ed25519.GenerateKey(rand.Reader)
+	r.NoError(err)
+	body := []byte(`{"client_id":"@` + base64.StdEncoding.EncodeToString(victim) + `.ed25519"}`)
+
+	call := func(key ed25519.PrivateKey, ts int64) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != nil {
+			sig := ed25519.Sign(key, AttestationPayload(path, body, ts, s.pubID))
+			req.Header.Set(AttestationTimestampHeader, strconv.FormatInt(ts, 10))
+			req.Header.Set(AttestationSignatureHeader, base64.StdEncoding.EncodeToString(sig)+".sig.ed25519")
+		}
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	now := time.Now().UnixNano() / 1e6
+	for i := int64(0); i < 3; i++ {
+		r.Equal(http.StatusUnauthorized, call(attackerKey, now+i).Code)
+		r.Equal(http.StatusUnauthorized, call(nil, 0).Code)
+	}
+	c := s.rateLimiter.Counters()[path]
+	r.Zero(c.Allowed)
+	r.Zero(c.RejectedByFeed)
+
+	rec := call(victimKey, now)
+	r.Equal(http.StatusOK, rec.Code, rec.Body.String())
+	// the second signed call is the one over the burst of the feed
+	r.Equal(http.StatusTooManyRequests, call(victimKey, now+1).Code)
+	c = s.rateLimiter.Counters()[path]
+	r.EqualValues(1, c.Allowed)
+	r.EqualValues(1, c.RejectedByFeed)
+}
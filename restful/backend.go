@@ -0,0 +1,216 @@
+package restful
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"go.cryptoscope.co/muxrpc/v2"
+	"go.cryptoscope.co/netwrap"
+	"go.cryptoscope.co/secretstream"
+	"go.cryptoscope.co/ssb"
+	ssbClient "go.cryptoscope.co/ssb/client"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/restful/params"
+	kitlog "go.mindeco.de/log"
+	"go.mindeco.de/log/level"
+	"golang.org/x/crypto/ed25519"
+)
+
+// ssbBackend the ssb server the analysis reads from and publishes to,
+// a pub in another process over muxrpc or the sbot this service runs in (see WithMetalifeServices)
+type ssbBackend interface {
+	// logStream the messages of the pub as refs.KeyValueRaw json, in the order they were received.
+	// gt is the time the last round ended, a backend may start there
+	logStream(ctx context.Context, gt int64) (messageSource, error)
+	// publish a new message on the feed of the pub, returns the key of the message
+	publish(ctx context.Context, content interface{}) (string, error)
+	// status of the ssb server, the peers are the load of the pub
+	status(ctx context.Context) (ssb.Status, error)
+	// messageAuthor the author of the message key, from the get index of the ssb server
+	messageAuthor(ctx context.Context, key string) (string, error)
+	// search the public messages of the search index of the ssb server, newest first
+	search(ctx context.Context, qry message.SearchArgs) ([]DeserializedMessageStu, error)
+}
+
+// messageSource a stream of json messages, *muxrpc.ByteSource is one
+type messageSource interface {
+	Next(context.Context) bool
+	Reader(func(io.Reader) error) error
+	Err() error
+}
+
+// muxrpcBackend talks to the pub of cfg, it dials again when the connection is gone
+type muxrpcBackend struct {
+	// ctx the connections live until it is done
+	ctx context.Context
+	cfg *params.PubConfig
+	// log until the service is set up, then the backend module of the service
+	log kitlog.Logger
+
+	mu     sync.Mutex
+	client *ssbClient.Client
+}
+
+// newMuxrpcBackend connects to the pub of cfg and returns the feed of the pub
+func newMuxrpcBackend(ctx context.Context, cfg *params.PubConfig, logger kitlog.Logger) (*muxrpcBackend, string, error) {
+	b := &muxrpcBackend{ctx: ctx, cfg: cfg, log: kitlog.With(logger, "module", logBackend)}
+	client, err := b.newClient()
+	if err != nil {
+		return nil, "", err
+	}
+	b.client = client
+
+	pub, err := client.Whoami()
+	if err != nil {
+		return nil, "", fmt.Errorf("Init: whoami of the pub failed: %w", err)
+	}
+	level.Info(b.log).Log("event", "working on pub", "pub", pub.String())
+	return b, pub.String(), nil
+}
+
+func (b *muxrpcBackend) logStream(ctx context.Context, gt int64) (messageSource, error) {
+	//构建符合条件的message请求
+	var args message.CreateHistArgs
+	args.Gt = message.RoundedInteger(gt)
+	args.Limit = -1
+	args.Seq = 0
+	args.Keys = true
+	args.Values = true
+	args.Private = false
+
+	b.mu.Lock()
+	client := b.client
+	b.mu.Unlock()
+	src, err := client.Source(ctx, muxrpc.TypeJSON, muxrpc.Method{"createLogStream"}, args)
+	if err == nil {
+		return src, nil
+	}
+
+	//client可能失效,则需要重建新的连接,链接资源的释放在ssb-server端
+	level.Warn(b.log).Log("event", "log stream failed, dialing again", "err", err)
+	otherClient, err := b.newClient()
+	if err != nil {
+		return nil, fmt.Errorf("Try set up a ssb client tcp socket failed: %w", err)
+	}
+	b.mu.Lock()
+	b.client = otherClient
+	b.mu.Unlock()
+	time.Sleep(time.Second)
+	return otherClient.Source(ctx, muxrpc.TypeJSON, muxrpc.Method{"createLogStream"}, args)
+}
+
+func (b *muxrpcBackend) publish(ctx context.Context, content interface{}) (string, error) {
+	b.mu.Lock()
+	client := b.client
+	b.mu.Unlock()
+	var v string
+	err := client.Async(ctx, &v, muxrpc.TypeString, muxrpc.Method{"publish"}, content)
+	return v, err
+}
+
+func (b *muxrpcBackend) status(ctx context.Context) (ssb.Status, error) {
+	b.mu.Lock()
+	client := b.client
+	b.mu.Unlock()
+	var st ssb.Status
+	err := client.Async(ctx, &st, muxrpc.TypeJSON, muxrpc.Method{"status"})
+	return st, err
+}
+
+func (b *muxrpcBackend) messageAuthor(ctx context.Context, key string) (string, error) {
+	b.mu.Lock()
+	client := b.client
+	b.mu.Unlock()
+	var kv DeserializedMessageStu
+	err := client.Async(ctx, &kv, muxrpc.TypeJSON, muxrpc.Method{"get"}, key)
+	if err != nil {
+		return "", err
+	}
+	if kv.Value == nil {
+		return "", fmt.Errorf("get %s: no message", key)
+	}
+	return kv.Value.Author.String(), nil
+}
+
+func (b *muxrpcBackend) search(ctx context.Context, qry message.SearchArgs) ([]DeserializedMessageStu, error) {
+	b.mu.Lock()
+	client := b.client
+	b.mu.Unlock()
+	src, err := client.Source(ctx, muxrpc.TypeJSON, muxrpc.Method{"search", "query"}, qry)
+	if err != nil {
+		return nil, err
+	}
+	var msgs []DeserializedMessageStu
+	for src.Next(ctx) {
+		var kv DeserializedMessageStu
+		err = src.Reader(func(rd io.Reader) error {
+			return json.NewDecoder(rd).Decode(&kv)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("search: bad message: %w", err)
+		}
+		msgs = append(msgs, kv)
+	}
+	return msgs, src.Err()
+}
+
+// newClient creat a client link to ssb-server
+func (b *muxrpcBackend) newClient() (*ssbClient.Client, error) {
+	sockPath := b.cfg.UnixSock
+	if sockPath != "" {
+		client, err := ssbClient.NewUnix(sockPath, ssbClient.WithContext(b.ctx))
+		if err != nil {
+			level.Debug(b.log).Log("client", "unix-path based init failed", "err", err)
+			level.Info(b.log).Log("client", "Now try switching to TCP working mode and init it")
+			return b.newTCPClient()
+		}
+		level.Info(b.log).Log("client", "connected", "method", "unix sock")
+		return client, nil
+	}
+
+	// Assume TCP connection
+	return b.newTCPClient()
+}
+
+// newTCPClient create tcp client to support remote applications
+func (b *muxrpcBackend) newTCPClient() (*ssbClient.Client, error) {
+	localKey, err := ssb.LoadKeyPair(b.cfg.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	var remotePubKey = make(ed25519.PublicKey, ed25519.PublicKeySize)
+	copy(remotePubKey, localKey.ID().PubKey())
+	if rk := b.cfg.RemoteKey; rk != "" {
+		rk = strings.TrimSuffix(rk, ".ed25519")
+		rk = strings.TrimPrefix(rk, "@")
+		rpk, err := base64.StdEncoding.DecodeString(rk)
+		if err != nil {
+			return nil, fmt.Errorf("Init: base64 decode of pub.remote_key failed: %w", err)
+		}
+		copy(remotePubKey, rpk)
+	}
+
+	plainAddr, err := net.ResolveTCPAddr("tcp", b.cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("Init: failed to resolve TCP address: %w", err)
+	}
+
+	shsAddr := netwrap.WrapAddr(plainAddr, secretstream.Addr{PubKey: remotePubKey})
+	client, err := ssbClient.NewTCP(localKey, shsAddr,
+		ssbClient.WithSHSAppKey(b.cfg.SHSCap),
+		ssbClient.WithContext(b.ctx))
+	if err != nil {
+		return nil, fmt.Errorf("Init: failed to connect to %s: %w", shsAddr.String(), err)
+	}
+
+	level.Info(b.log).Log("client", "connected", "method", "tcp", "addr", shsAddr.String())
+	return client, nil
+}
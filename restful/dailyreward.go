@@ -4,9 +4,8 @@ import (
 	"math/big"
 	"time"
 
-	"fmt"
-
 	"go.cryptoscope.co/ssb/restful/params"
+	"go.mindeco.de/log/level"
 )
 
 var rewardPeriod = time.Second * 90
@@ -34,27 +33,51 @@ func RewardProcess() {
 	taskcollctions, err := likeDB.GetUserTaskCollect(author, msgtype, starttime, endtime)*/
 }
 
+// rewardAmount the tokens of a reward for reason by rc, in whole tokens
+func rewardAmount(rc params.RewardConfig, reason string) int {
+	switch reason {
+	case SignUp:
+		return rc.Signup
+	case PostMessage:
+		return rc.PostMessage
+	case PostComment:
+		return rc.PostComment
+	case MintNft:
+		return rc.MintNft
+	case DailyLogin:
+		return rc.DailyLogin
+	case LikePost:
+		return rc.LikePost
+	case ReportProblematicPost:
+		return rc.ReportProblematicPost
+	}
+	return 0
+}
+
+// rewardCap the tokens of reason a feed gets at most per day by rc, in wei, max_signup for sign up and max_daily for the others
+func rewardCap(rc params.RewardConfig, reason string) *big.Int {
+	if reason == SignUp {
+		return new(big.Int).Mul(big.NewInt(params.Ether), big.NewInt(int64(rc.MaxSignup)))
+	}
+	return new(big.Int).Mul(big.NewInt(params.Ether), big.NewInt(int64(rc.MaxDaily)))
+}
+
 //func RecordRewarding2Db()
-func ExceedRewardLimit(clientID, rewardType string) bool {
+func (s *Service) ExceedRewardLimit(clientID, rewardType string) bool {
 
 	t := time.Now()
 	todaymorning := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
 	var starttime = todaymorning.UnixNano() / 1e6
 	var endtime = time.Now().UnixNano() / 1e6
 	//如果存在未发送成功的记录,也记为本次比较的数量，因为延后会继续处理未成功的事件
-	num, err := likeDB.SelectHistoryReward(clientID, rewardType, starttime, endtime)
+	num, err := s.db.SelectHistoryReward(clientID, rewardType, starttime, endtime)
 	if err != nil {
-		fmt.Println(fmt.Sprintf("ExceedRewardLimit SelectHistoryReward err =%v", err))
+		level.Error(s.logger(logRewards)).Log("event", "reward history failed", "feed", clientID, "reason", rewardType, "err", err)
 		return true
 	}
 	historyTokens := num
-	maxRewardTokes := big.NewInt(0)
-	if rewardType == SignUp {
-		maxRewardTokes = new(big.Int).Mul(big.NewInt(params.Ether), big.NewInt(int64(params.MaxSignupReward)))
-	} else {
-		maxRewardTokes = new(big.Int).Mul(big.NewInt(params.Ether), big.NewInt(int64(params.MaxDailyRewarding)))
-	}
-	fmt.Println(fmt.Sprintf("ExceedRewardLimit historyTokens=%v, maxRewardTokes=%v", historyTokens, maxRewardTokes))
+	maxRewardTokes := rewardCap(s.cfg.Rewards, rewardType)
+	level.Debug(s.logger(logRewards)).Log("event", "reward limit", "feed", clientID, "reason", rewardType, "amount", historyTokens, "max", maxRewardTokes)
 	if historyTokens.Cmp(maxRewardTokes) == -1 {
 		return false
 	} else {
@@ -0,0 +1,161 @@
+package restful
+
+import (
+	"fmt"
+	"math/big"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+
+	"go.cryptoscope.co/ssb/restful/rerr"
+)
+
+// UserDashboard the activity, the rewards and the moderation status of a feed, GET /ssb/api/dashboard.
+// The window is rounded to whole utc days, the days without activity are left out.
+type UserDashboard struct {
+	ClientID         string `json:"client_id"`
+	ClientEthAddress string `json:"client_eth_address"`
+	FromDay          string `json:"from_day"`
+	ToDay            string `json:"to_day"`
+
+	Totals *DailyActivity   `json:"totals"`
+	Days   []*DailyActivity `json:"days"`
+	// Rewards earned in the window and pending by reason, pending ones are counted whenever they happened
+	Rewards    []*DashboardReward   `json:"rewards"`
+	Moderation *DashboardModeration `json:"moderation"`
+}
+
+// DailyActivity a row of the daily rollup of a feed, likes given and received are net of the unlikes
+type DailyActivity struct {
+	Day           string `json:"day,omitempty"`
+	Posts         int    `json:"posts"`
+	Comments      int    `json:"comments"`
+	LikesGiven    int    `json:"likes_given"`
+	LikesReceived int    `json:"likes_received"`
+}
+
+// DashboardReward the rewards of a reason, amounts in wei
+type DashboardReward struct {
+	RewardReason string   `json:"reward_reason"`
+	Earned       *big.Int `json:"earned"`
+	EarnedCount  int      `json:"earned_count"`
+	Pending      *big.Int `json:"pending"`
+	PendingCount int      `json:"pending_count"`
+}
+
+// DashboardModeration the reports against and by a feed and its posts with sensitive words
+type DashboardModeration struct {
+	Blacklisted    bool             `json:"blacklisted"`
+	ReportsAgainst ModerationCounts `json:"reports_against"`
+	ReportsFiled   ModerationCounts `json:"reports_filed"`
+	SensitiveWords ModerationCounts `json:"sensitive_words"`
+}
+
+// ModerationCounts the cases by dealtag, 0-open 1-confirmed 2-dismissed
+type ModerationCounts struct {
+	Open      int `json:"open"`
+	Confirmed int `json:"confirmed"`
+	Dismissed int `json:"dismissed"`
+}
+
+func (mc *ModerationCounts) add(dealtag string, n int) {
+	switch dealtag {
+	case "0":
+		mc.Open += n
+	case "1":
+		mc.Confirmed += n
+	default:
+		mc.Dismissed += n
+	}
+}
+
+// dashboardWindow the feed and the days of ?author=&from=&to=, from and to are unix milliseconds and to is exclusive, to is now without it
+func dashboardWindow(query url.Values, now time.Time) (author, fromDay, toDay string, err error) {
+	author = query.Get("author")
+	if author == "" {
+		return "", "", "", fmt.Errorf("author is required")
+	}
+	from, to := int64(0), now.UnixNano()/1e6+1
+	if s := query.Get("from"); s != "" {
+		if from, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return "", "", "", fmt.Errorf("from: %w", err)
+		}
+	}
+	if s := query.Get("to"); s != "" {
+		if to, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return "", "", "", fmt.Errorf("to: %w", err)
+		}
+	}
+	if from < 0 || to <= from {
+		return "", "", "", fmt.Errorf("from must be before to")
+	}
+	return author, rollupDay(from), rollupDay(to - 1), nil
+}
+
+// newUserDashboard sums the days up
+func newUserDashboard(author, eth, fromDay, toDay string, days []*DailyActivity, rewards []*DashboardReward, moderation *DashboardModeration) *UserDashboard {
+	d := &UserDashboard{
+		ClientID:         author,
+		ClientEthAddress: eth,
+		FromDay:          fromDay,
+		ToDay:            toDay,
+		Totals:           &DailyActivity{},
+		Days:             days,
+		Rewards:          rewards,
+		Moderation:       moderation,
+	}
+	if d.Days == nil {
+		d.Days = []*DailyActivity{}
+	}
+	if d.Rewards == nil {
+		d.Rewards = []*DashboardReward{}
+	}
+	for _, day := range days {
+		d.Totals.Posts += day.Posts
+		d.Totals.Comments += day.Comments
+		d.Totals.LikesGiven += day.LikesGiven
+		d.Totals.LikesReceived += day.LikesReceived
+	}
+	return d
+}
+
+// GetUserDashboard the dashboard of a feed from the daily rollups of the analysis
+func (s *Service) GetUserDashboard(w rest.ResponseWriter, r *rest.Request) {
+	var resp *APIResponse
+	defer func() {
+		writejson(w, resp)
+	}()
+	author, fromDay, toDay, err := dashboardWindow(r.URL.Query(), time.Now())
+	if err != nil {
+		resp = NewAPIResponse(rerr.ErrArgumentError.AppendError(err), nil)
+		return
+	}
+
+	var eth string
+	profiles, err := s.db.SelectUserProfile(author)
+	if err != nil {
+		resp = NewAPIResponse(err, nil)
+		return
+	}
+	if len(profiles) > 0 {
+		eth = profiles[0].EthAddress
+	}
+	days, err := s.db.SelectDailyActivity(author, fromDay, toDay)
+	if err != nil {
+		resp = NewAPIResponse(err, nil)
+		return
+	}
+	rewards, err := s.db.SelectDashboardRewards(author, fromDay, toDay)
+	if err != nil {
+		resp = NewAPIResponse(err, nil)
+		return
+	}
+	moderation, err := s.db.SelectModerationStatus(author)
+	if err != nil {
+		resp = NewAPIResponse(err, nil)
+		return
+	}
+	resp = NewAPIResponse(nil, newUserDashboard(author, eth, fromDay, toDay, days, rewards, moderation))
+}
@@ -0,0 +1,75 @@
+package restful
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDashboardWindow(t *testing.T) {
+	r := require.New(t)
+	now := time.Date(2022, 3, 4, 15, 0, 0, 0, time.UTC)
+	day := int64(24 * 3600 * 1000)
+	march1 := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC).UnixNano() / 1e6
+
+	author, from, to, err := dashboardWindow(url.Values{"author": {testPubA}}, now)
+	r.NoError(err)
+	r.Equal(testPubA, author)
+	r.Equal("1970-01-01", from)
+	r.Equal("2022-03-04", to)
+
+	// to is exclusive, a window of whole days ends the day before
+	_, from, to, err = dashboardWindow(url.Values{"author": {testPubA}, "from": {strconv.FormatInt(march1, 10)}, "to": {strconv.FormatInt(march1+2*day, 10)}}, now)
+	r.NoError(err)
+	r.Equal("2022-03-01", from)
+	r.Equal("2022-03-02", to)
+
+	_, from, to, err = dashboardWindow(url.Values{"author": {testPubA}, "from": {strconv.FormatInt(march1+day-1, 10)}, "to": {strconv.FormatInt(march1+day+1, 10)}}, now)
+	r.NoError(err)
+	r.Equal("2022-03-01", from)
+	r.Equal("2022-03-02", to)
+
+	for _, q := range []url.Values{
+		{},
+		{"author": {testPubA}, "from": {"yesterday"}},
+		{"author": {testPubA}, "from": {strconv.FormatInt(march1, 10)}, "to": {strconv.FormatInt(march1, 10)}},
+		{"author": {testPubA}, "from": {"-5"}},
+	} {
+		_, _, _, err = dashboardWindow(q, now)
+		r.Error(err, "%v", q)
+	}
+}
+
+func TestUserDashboardTotals(t *testing.T) {
+	r := require.New(t)
+
+	var m DashboardModeration
+	m.ReportsAgainst.add("0", 2)
+	m.ReportsAgainst.add("1", 1)
+	m.ReportsAgainst.add("2", 3)
+	r.Equal(ModerationCounts{Open: 2, Confirmed: 1, Dismissed: 3}, m.ReportsAgainst)
+
+	days := []*DailyActivity{
+		{Day: "2022-03-01", Posts: 2, LikesGiven: 3},
+		{Day: "2022-03-03", Comments: 4, LikesGiven: -1, LikesReceived: 5},
+	}
+	d := newUserDashboard(testPubA, "0xabc", "2022-03-01", "2022-03-04", days, nil, &m)
+	r.Equal(&DailyActivity{Posts: 2, Comments: 4, LikesGiven: 2, LikesReceived: 5}, d.Totals)
+	r.Len(d.Days, 2)
+	r.NotNil(d.Rewards, "no rewards are an empty list")
+	r.Equal("0xabc", d.ClientEthAddress)
+
+	empty := newUserDashboard(testPubA, "", "2022-03-01", "2022-03-04", nil, nil, &DashboardModeration{})
+	r.NotNil(empty.Days)
+	r.Equal(&DailyActivity{}, empty.Totals)
+}
+
+func TestRollupDay(t *testing.T) {
+	r := require.New(t)
+	r.Equal("1970-01-01", rollupDay(0))
+	r.Equal("2022-03-01", rollupDay(time.Date(2022, 3, 1, 23, 59, 59, 0, time.UTC).UnixNano()/1e6))
+	r.Equal("2022-03-02", rollupDay(time.Date(2022, 3, 2, 0, 0, 0, 0, time.UTC).UnixNano()/1e6))
+}
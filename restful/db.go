@@ -1,8 +1,11 @@
 package restful
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"sync"
+	"time"
 
 	"math/big"
 
@@ -16,9 +19,11 @@ type PubDB struct {
 	lock  sync.Mutex
 	mlock sync.Mutex
 	Name  string
+	// pubID the pub the likes are counted on
+	pubID string
 }
 
-func OpenPubDB(pubDataSource string) (DB *PubDB, err error) {
+func OpenPubDB(pubDataSource, pubID string) (DB *PubDB, err error) {
 	db, err := sql.Open("sqlite3", pubDataSource)
 	if err != nil {
 		return nil, err
@@ -96,17 +101,99 @@ CREATE TABLE IF NOT EXISTS "rewardresult" (
    "messagekey" TEXT NULL,
    "messagetime" INTEGER NULL default 0,
    "rewardtime" INTEGER NULL default 0
+);
+CREATE TABLE IF NOT EXISTS "pubannounce" (
+   "pubid" TEXT PRIMARY KEY,
+   "host" TEXT NULL,
+   "port" INTEGER NULL default 0,
+   "invitecode" TEXT NULL default '',
+   "capacity" INTEGER NULL default 0,
+   "api" TEXT NULL default '',
+   "announcetime" INTEGER NULL default 0
+);
+CREATE TABLE IF NOT EXISTS "votes" (
+   "voter" TEXT NOT NULL,
+   "target" TEXT NOT NULL,
+   "value" INTEGER NOT NULL default 0,
+   "seq" INTEGER NOT NULL default 0,
+   "votetime" INTEGER NOT NULL default 0,
+   "targetauthor" TEXT NULL,
+   "resolvetries" INTEGER NOT NULL default 0,
+   "rewarded" INTEGER NOT NULL default 0,
+   PRIMARY KEY ("voter","target")
+);
+CREATE INDEX IF NOT EXISTS "votes_target" ON "votes" ("target");
+CREATE INDEX IF NOT EXISTS "votes_targetauthor" ON "votes" ("targetauthor");
+CREATE TABLE IF NOT EXISTS "analysisstate" (
+   "name" TEXT PRIMARY KEY,
+   "value" INTEGER NOT NULL default 0
+);
+CREATE TABLE IF NOT EXISTS "userdailyactivity" (
+   "clientid" TEXT NOT NULL,
+   "day" TEXT NOT NULL,
+   "posts" INTEGER NOT NULL default 0,
+   "comments" INTEGER NOT NULL default 0,
+   "likesgiven" INTEGER NOT NULL default 0,
+   "likesreceived" INTEGER NOT NULL default 0,
+   PRIMARY KEY ("clientid","day")
+);
+CREATE TABLE IF NOT EXISTS "userdailyreward" (
+   "clientid" TEXT NOT NULL,
+   "day" TEXT NOT NULL,
+   "rewardreason" TEXT NOT NULL,
+   "rewards" INTEGER NOT NULL default 0,
+   "granttoken" BIGINT NOT NULL default 0,
+   PRIMARY KEY ("clientid","day","rewardreason")
 );
    `
 	_, err = db.Exec(sql_table)
 	if err != nil {
 		return nil, err
 	}
-	return &PubDB{db: db}, nil
+	//votes.rewarded是后加的,旧数据库里当前的点赞都已经发过激励
+	var hasRewarded int
+	err = db.QueryRow("SELECT count(*) FROM pragma_table_info('votes') WHERE name='rewarded'").Scan(&hasRewarded)
+	if err != nil {
+		return nil, err
+	}
+	if hasRewarded == 0 {
+		_, err = db.Exec("ALTER TABLE votes ADD COLUMN rewarded INTEGER NOT NULL default 0; UPDATE votes SET rewarded=1 WHERE value=1")
+		if err != nil {
+			return nil, err
+		}
+	}
+	pdb := &PubDB{db: db, pubID: pubID}
+	//汇总表是后加的,旧数据库第一次打开时从明细表生成
+	var rollups int
+	err = db.QueryRow("SELECT (SELECT count(*) FROM userdailyactivity)+(SELECT count(*) FROM userdailyreward)").Scan(&rollups)
+	if err != nil {
+		return nil, err
+	}
+	if rollups == 0 {
+		if err = pdb.RebuildDailyRollups(); err != nil {
+			return nil, err
+		}
+	}
+	return pdb, nil
+}
+
+// Close closes the database, queries that already started are finished first
+func (pdb *PubDB) Close() error {
+	return pdb.db.Close()
 }
 
 // UpdateRewardResult
 func (pdb *PubDB) UpdateRewardResult(cid, partnerAddress, grantSuccess string, msgTime int64) (affectid int64, err error) {
+	if grantSuccess == "success" {
+		//补发成功的激励计入今天
+		_, err = pdb.db.Exec("INSERT INTO userdailyreward(clientid,day,rewardreason,rewards,granttoken) "+
+			"SELECT clientid,?,rewardreason,count(*),sum(granttoken) FROM rewardresult WHERE clientid=? and ethaddress=? and messagetime=? and grantsuccess<>'success' GROUP BY rewardreason "+
+			"ON CONFLICT(clientid,day,rewardreason) DO UPDATE SET rewards=rewards+excluded.rewards,granttoken=granttoken+excluded.granttoken",
+			rollupDay(time.Now().UnixNano()/1e6), cid, partnerAddress, msgTime)
+		if err != nil {
+			return 0, err
+		}
+	}
 	stmt, err := pdb.db.Prepare("update rewardresult set grantsuccess=? where clientid=? and ethaddress=? and messagetime=?")
 	if err != nil {
 		return 0, err
@@ -130,6 +217,11 @@ func (pdb *PubDB) RecordRewardResult(clientId, ethAddress, grantSuccess string,
 		return 0, err
 	}
 	lastid, err = res.LastInsertId()
+	if err == nil && grantSuccess == "success" {
+		_, err = pdb.db.Exec("INSERT INTO userdailyreward(clientid,day,rewardreason,rewards,granttoken) VALUES (?,?,?,1,?) "+
+			"ON CONFLICT(clientid,day,rewardreason) DO UPDATE SET rewards=rewards+1,granttoken=granttoken+excluded.granttoken",
+			clientId, rollupDay(rewardTime), rewardReason, grantToken)
+	}
 	return
 }
 
@@ -144,7 +236,22 @@ func (pdb *PubDB) SelectRewardResult(clientid string, timefrom, timeto int64) (r
 	if err != nil {
 		return nil, err
 	}
-	infos := []*RewardResult{}
+	_, rinfo, err = scanRewardResults(rows)
+	return
+}
+
+// queryRewardResults the rows of a SELECT * FROM rewardresult with their uid
+func (pdb *PubDB) queryRewardResults(query string, args ...interface{}) (uids []int64, rinfo []*RewardResult, err error) {
+	rows, err := pdb.db.Query(query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return scanRewardResults(rows)
+}
+
+// scanRewardResults reads and closes the rows of rewardresult
+func scanRewardResults(rows *sql.Rows) (uids []int64, infos []*RewardResult, err error) {
+	infos = []*RewardResult{}
 	defer rows.Close()
 	for rows.Next() {
 		var uid int64
@@ -158,7 +265,7 @@ func (pdb *PubDB) SelectRewardResult(clientid string, timefrom, timeto int64) (r
 		var rewardtime int64
 		err = rows.Scan(&uid, &cid, &ethaddr, &grantsuccess, &granttoken, &reason, &megkey, &msgtime, &rewardtime)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		var r *RewardResult
 		amount := new(big.Int).Mul(big.NewInt(params.Ether), big.NewInt(granttoken))
@@ -172,10 +279,10 @@ func (pdb *PubDB) SelectRewardResult(clientid string, timefrom, timeto int64) (r
 			MessageTime:      msgtime,
 			RewardTime:       rewardtime,
 		}
+		uids = append(uids, uid)
 		infos = append(infos, r)
 	}
-	rinfo = infos
-	return
+	return uids, infos, rows.Err()
 }
 
 //SelectRewardSum
@@ -230,59 +337,9 @@ func (pdb *PubDB) SelectHistoryReward(clientId, rewardreason string, starttime,
 	return
 }
 
-// InsertUserSetLike liketag=1 or -1
-func (pdb *PubDB) InsertUserSetLikeInfo(messagekey, author string, liketag int, setliketime int64) (lastid int64, err error) {
-	stmt, err := pdb.db.Prepare("INSERT INTO usersetlikeinfo(messagekey,author,liketag,setliketime) VALUES (?,?,?,?)")
-	if err != nil {
-		return 0, err
-	}
-	res, err := stmt.Exec(messagekey, author, liketag, setliketime)
-	if err != nil {
-		return 0, err
-	}
-	lastid, err = res.LastInsertId()
-	return
-}
-
-//SelectLastScanTime
+// SelectUserSetLikeInfo the likes clientid gave, of all voters without clientid, from the vote index
 func (pdb *PubDB) SelectUserSetLikeInfo(clientid string) (likesum map[string]*LasterNumLikes, err error) {
-	var rows *sql.Rows
-	if clientid == "" {
-		rows, err = pdb.db.Query("SELECT usersetlikeinfo.author,usersetlikeinfo.liketag,userprofile.clientname,userprofile.other1 FROM usersetlikeinfo left outer join userprofile on usersetlikeinfo.author=userprofile.clientid")
-	} else {
-		rows, err = pdb.db.Query("SELECT usersetlikeinfo.author,usersetlikeinfo.liketag,userprofile.clientname,userprofile.other1 FROM usersetlikeinfo left outer join userprofile on usersetlikeinfo.author=userprofile.clientid where usersetlikeinfo.author=?", clientid)
-	}
-	if err != nil {
-		return nil, err
-	}
-	likeCountMap := make(map[string]*LasterNumLikes)
-	defer rows.Close()
-	for rows.Next() {
-		var author string
-		var onemsglikes int
-		var cname string
-		var ethaddr string
-		errnil := rows.Scan(&author, &onemsglikes, &cname, &ethaddr)
-		if errnil != nil {
-			continue
-			//return nil, err
-		}
-		var l *LasterNumLikes
-		l = &LasterNumLikes{
-			ClientID:         author,
-			LasterLikeNum:    onemsglikes,
-			Name:             cname,
-			ClientEthAddress: ethaddr,
-			MessageFromPub:   params.PubID,
-		}
-		if _, ok := likeCountMap[author]; ok {
-			likeCountMap[author].LasterLikeNum += onemsglikes
-		} else {
-			likeCountMap[author] = l
-		}
-	}
-	likesum = likeCountMap
-	return
+	return pdb.selectVoteSums("voter", clientid)
 }
 
 //InsertDataCalcTime  Violation record
@@ -425,7 +482,22 @@ func (pdb *PubDB) SelectUserProfile(clientid string) (name2profile []*Name2Profi
 	if err != nil {
 		return nil, err
 	}
-	name2prof := []*Name2ProfileReponse{}
+	_, name2profile, err = scanUserProfiles(rows)
+	return
+}
+
+// queryUserProfiles the rows of a SELECT * FROM userprofile with their uid
+func (pdb *PubDB) queryUserProfiles(query string, args ...interface{}) (uids []int64, name2profile []*Name2ProfileReponse, err error) {
+	rows, err := pdb.db.Query(query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return scanUserProfiles(rows)
+}
+
+// scanUserProfiles reads and closes the rows of userprofile
+func scanUserProfiles(rows *sql.Rows) (uids []int64, name2prof []*Name2ProfileReponse, err error) {
+	name2prof = []*Name2ProfileReponse{}
 	defer rows.Close()
 	for rows.Next() {
 		var uid int64
@@ -436,7 +508,7 @@ func (pdb *PubDB) SelectUserProfile(clientid string) (name2profile []*Name2Profi
 		var other1 string
 		err = rows.Scan(&uid, &cid, &cname, &alias, &bio, &other1)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		var n *Name2ProfileReponse
 		n = &Name2ProfileReponse{
@@ -446,80 +518,53 @@ func (pdb *PubDB) SelectUserProfile(clientid string) (name2profile []*Name2Profi
 			Bio:        bio,
 			EthAddress: other1,
 		}
+		uids = append(uids, uid)
 		name2prof = append(name2prof, n)
 	}
-	name2profile = name2prof
-	return
+	return uids, name2prof, rows.Err()
 }
 
-//InsertLikeDetail
-func (pdb *PubDB) InsertLikeDetail(msgid, author string) (lastid int64, err error) {
-	stmt, err := pdb.db.Prepare("INSERT INTO likedetail(messagekey,author) VALUES (?,?)")
-	if err != nil {
-		return 0, err
-	}
-	res, err := stmt.Exec(msgid, author)
-	if err != nil {
-		return 0, err
-	}
-	lastid, err = res.LastInsertId()
-
-	return
+// SelectLikeSum the likes clientid received, of all authors without clientid, from the vote index
+func (pdb *PubDB) SelectLikeSum(clientid string) (likesum map[string]*LasterNumLikes, err error) {
+	return pdb.selectVoteSums("targetauthor", clientid)
 }
 
-//UpdateLikeDetail
-func (pdb *PubDB) UpdateLikeDetail(liketag int, ts int64, msgid string) (affectid int64, err error) {
-	stmt, err := pdb.db.Prepare("update likedetail set thismsglikesum=thismsglikesum+?,liketime=? where messagekey=?")
+// selectVoteSums sums the current votes up by the voter or the targetauthor column, with the name and the eth address of the profile
+func (pdb *PubDB) selectVoteSums(column, clientid string) (likesum map[string]*LasterNumLikes, err error) {
+	query := "SELECT votes." + column + ",sum(votes.value),ifnull(userprofile.clientname,''),ifnull(userprofile.other1,'') " +
+		"FROM votes left outer join userprofile on votes." + column + "=userprofile.clientid WHERE votes." + column + " IS NOT NULL"
+	args := []interface{}{}
+	if clientid != "" {
+		query += " and votes." + column + "=?"
+		args = append(args, clientid)
+	}
+	likes, err := pdb.queryVoteSums(query+" GROUP BY votes."+column, args...)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	res, err := stmt.Exec(liketag, ts, msgid)
-	if err != nil {
-		return 0, err
+	likesum = make(map[string]*LasterNumLikes)
+	for _, l := range likes {
+		likesum[l.ClientID] = l
 	}
-	affectid, err = res.LastInsertId()
-	return
+	return likesum, nil
 }
 
-//SelectLastScanTime
-func (pdb *PubDB) SelectLikeSum(clientid string) (likesum map[string]*LasterNumLikes, err error) {
-	var rows *sql.Rows
-	if clientid == "" {
-		rows, err = pdb.db.Query("SELECT likedetail.author,likedetail.thismsglikesum,userprofile.clientname,userprofile.other1 FROM likedetail left outer join userprofile on likedetail.author=userprofile.clientid")
-	} else {
-		rows, err = pdb.db.Query("SELECT likedetail.author,likedetail.thismsglikesum,userprofile.clientname,userprofile.other1 FROM likedetail left outer join userprofile on likedetail.author=userprofile.clientid where likedetail.author=?", clientid)
-	}
+// queryVoteSums the rows of a select of the feed, the sum of the votes, the name and the eth address, in their order
+func (pdb *PubDB) queryVoteSums(query string, args ...interface{}) (likes []*LasterNumLikes, err error) {
+	rows, err := pdb.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
-	likeCountMap := make(map[string]*LasterNumLikes)
 	defer rows.Close()
 	for rows.Next() {
-		var cid string
-		var onemsglikes int
-		var cname string
-		var ethaddr string
-		errnil := rows.Scan(&cid, &onemsglikes, &cname, &ethaddr)
-		if errnil != nil {
-			continue
-			//return nil, err
-		}
-		var l *LasterNumLikes
-		l = &LasterNumLikes{
-			ClientID:         cid,
-			LasterLikeNum:    onemsglikes,
-			Name:             cname,
-			ClientEthAddress: ethaddr,
-			MessageFromPub:   params.PubID,
-		}
-		if _, ok := likeCountMap[cid]; ok {
-			likeCountMap[cid].LasterLikeNum += onemsglikes
-		} else {
-			likeCountMap[cid] = l
+		l := &LasterNumLikes{MessageFromPub: pdb.pubID}
+		err = rows.Scan(&l.ClientID, &l.LasterLikeNum, &l.Name, &l.ClientEthAddress)
+		if err != nil {
+			return nil, err
 		}
+		likes = append(likes, l)
 	}
-	likesum = likeCountMap
-	return
+	return likes, rows.Err()
 }
 
 //InsertViolation  Violation record
@@ -578,31 +623,56 @@ func (pdb *PubDB) CountViolationByWhere(lplaintiff, defendant, messagekey string
 	return
 }
 
+// CountOpenModerationCases the reports and the sensitive word records nobody dealt with yet, dealtag '0'
+func (pdb *PubDB) CountOpenModerationCases() (reports, sensitiveWords int, err error) {
+	err = pdb.db.QueryRow("SELECT count(*) FROM violationrecord where dealtag='0'").Scan(&reports)
+	if err != nil {
+		return 0, 0, err
+	}
+	err = pdb.db.QueryRow("SELECT count(*) FROM sensitivewordrecord where dealtag='0'").Scan(&sensitiveWords)
+	if err != nil {
+		return 0, 0, err
+	}
+	return
+}
+
 //SelectLastScanTime
 func (pdb *PubDB) SelectViolationByWhere(plaintiff, defendant, messagekey, reasons, dealtag string) (num []*TippedOffStu, err error) {
 	sqlstr := "SELECT * FROM violationrecord"
+	var args []interface{}
 	if plaintiff != "" || defendant != "" || messagekey != "" || reasons != "" || dealtag != "" {
 		sqlstr += " where uid!=-1"
 		if plaintiff != "" {
-			sqlstr += " and plaintiff='" + plaintiff + "'"
+			sqlstr += " and plaintiff=?"
+			args = append(args, plaintiff)
 		}
 		if defendant != "" {
-			sqlstr += " and defendant='" + defendant + "'"
+			sqlstr += " and defendant=?"
+			args = append(args, defendant)
 		}
 		if messagekey != "" {
-			sqlstr += " and messagekey='" + messagekey + "'"
+			sqlstr += " and messagekey=?"
+			args = append(args, messagekey)
 		}
 		if reasons != "" {
-			sqlstr += " and reasons='" + reasons + "'"
+			sqlstr += " and reasons=?"
+			args = append(args, reasons)
 		}
 		if dealtag != "" {
-			sqlstr += " and dealtag='" + dealtag + "'"
+			sqlstr += " and dealtag=?"
+			args = append(args, dealtag)
 		}
 	}
 	//fmt.Println(sqlstr)
-	rows, err := pdb.db.Query(sqlstr)
+	_, num, err = pdb.queryViolations(sqlstr, args...)
+	return
+}
+
+// queryViolations the rows of a SELECT * FROM violationrecord with their uid, rows that do not scan are left out
+func (pdb *PubDB) queryViolations(query string, args ...interface{}) (uids []int64, num []*TippedOffStu, err error) {
+	rows, err := pdb.db.Query(query, args...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	defer rows.Close()
@@ -632,6 +702,7 @@ func (pdb *PubDB) SelectViolationByWhere(plaintiff, defendant, messagekey, reaso
 			Dealtime:   xdealtime,
 			Dealreward: xdealreward,
 		}
+		uids = append(uids, xuid)
 		num = append(num, l)
 	}
 	return
@@ -714,6 +785,11 @@ func (pdb *PubDB) InsertUserTaskCollect(pubid, author, messagekey, messagetype,
 		return 0, err
 	}
 	lastid, err = res.LastInsertId()
+	if err == nil && messagetype == "2" {
+		err = addDailyActivity(pdb.db, author, messagetime, "posts", 1)
+	} else if err == nil && messagetype == "3" {
+		err = addDailyActivity(pdb.db, author, messagetime, "comments", 1)
+	}
 
 	return
 }
@@ -785,3 +861,377 @@ func (pdb *PubDB) GetUserTaskCollect(author, messagetype string, starttime, endt
 	}
 	return
 }
+
+// UpsertPubAnnouncement keeps the latest 'pub' message of a pub
+func (pdb *PubDB) UpsertPubAnnouncement(pi *PubInfo) (lastid int64, err error) {
+	stmt, err := pdb.db.Prepare("INSERT OR REPLACE INTO pubannounce(pubid,host,port,invitecode,capacity,api,announcetime) VALUES (?,?,?,?,?,?,?)")
+	if err != nil {
+		return 0, err
+	}
+	res, err := stmt.Exec(pi.PubID, pi.Host, pi.Port, pi.InviteCode, pi.Capacity, pi.API, pi.AnnounceTime)
+	if err != nil {
+		return 0, err
+	}
+	lastid, err = res.LastInsertId()
+	return
+}
+
+// SelectPubAnnouncements the pubs that announced themselves
+func (pdb *PubDB) SelectPubAnnouncements() (pubs []*PubInfo, err error) {
+	rows, err := pdb.db.Query("SELECT pubid,host,port,invitecode,capacity,api,announcetime FROM pubannounce")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		pi := &PubInfo{Announced: true, Load: -1, Healthy: true}
+		err = rows.Scan(&pi.PubID, &pi.Host, &pi.Port, &pi.InviteCode, &pi.Capacity, &pi.API, &pi.AnnounceTime)
+		if err != nil {
+			return nil, err
+		}
+		pubs = append(pubs, pi)
+	}
+	return pubs, rows.Err()
+}
+
+// rollupDay the utc day of a unix millisecond time, the key of the daily rollups
+func rollupDay(ms int64) string {
+	return time.Unix(ms/1000, 0).UTC().Format("2006-01-02")
+}
+
+// sqlExecer a *sql.DB or a *sql.Tx
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// addDailyActivity adds n to the counter column of the daily activity of clientid on the day of ms
+func addDailyActivity(ex sqlExecer, clientid string, ms int64, column string, n int) error {
+	_, err := ex.Exec("INSERT INTO userdailyactivity(clientid,day,"+column+") VALUES (?,?,?) "+
+		"ON CONFLICT(clientid,day) DO UPDATE SET "+column+"="+column+"+excluded."+column,
+		clientid, rollupDay(ms), n)
+	return err
+}
+
+// RebuildDailyRollups fills the daily activity and reward tables again from usertaskcollect, votes and rewardresult.
+// The vote index only keeps the last vote of a voter on a message, so the likes of the rebuilt days are on the day of that vote.
+func (pdb *PubDB) RebuildDailyRollups() error {
+	tx, err := pdb.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, stmt := range []string{
+		"DELETE FROM userdailyactivity",
+		"INSERT INTO userdailyactivity(clientid,day,posts,comments,likesgiven,likesreceived) " +
+			"SELECT clientid,day,sum(posts),sum(comments),sum(likesgiven),sum(likesreceived) FROM (" +
+			"SELECT author AS clientid,date(messagetime/1000,'unixepoch') AS day,messagetype='2' AS posts,messagetype='3' AS comments,0 AS likesgiven,0 AS likesreceived FROM usertaskcollect WHERE messagetype IN ('2','3') " +
+			"UNION ALL SELECT voter,date(votetime/1000,'unixepoch'),0,0,value,0 FROM votes WHERE value<>0 " +
+			"UNION ALL SELECT targetauthor,date(votetime/1000,'unixepoch'),0,0,0,value FROM votes WHERE value<>0 and targetauthor IS NOT NULL" +
+			") GROUP BY clientid,day",
+		"DELETE FROM userdailyreward",
+		"INSERT INTO userdailyreward(clientid,day,rewardreason,rewards,granttoken) " +
+			"SELECT clientid,date((CASE WHEN rewardtime>0 THEN rewardtime ELSE messagetime END)/1000,'unixepoch'),rewardreason,count(*),sum(granttoken) " +
+			"FROM rewardresult WHERE grantsuccess='success' GROUP BY 1,2,3",
+	} {
+		if _, err = tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SelectDailyActivity the daily activity of clientid from the day fromDay to the day toDay, both included
+func (pdb *PubDB) SelectDailyActivity(clientid, fromDay, toDay string) (days []*DailyActivity, err error) {
+	rows, err := pdb.db.Query("SELECT day,posts,comments,likesgiven,likesreceived FROM userdailyactivity WHERE clientid=? and day>=? and day<=? ORDER BY day", clientid, fromDay, toDay)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		d := &DailyActivity{}
+		err = rows.Scan(&d.Day, &d.Posts, &d.Comments, &d.LikesGiven, &d.LikesReceived)
+		if err != nil {
+			return nil, err
+		}
+		days = append(days, d)
+	}
+	return days, rows.Err()
+}
+
+// SelectDashboardRewards the rewards clientid earned from fromDay to toDay and the ones still pending by reason, amounts in wei
+func (pdb *PubDB) SelectDashboardRewards(clientid, fromDay, toDay string) (rewards []*DashboardReward, err error) {
+	rows, err := pdb.db.Query("SELECT rewardreason,sum(earned),sum(earnedtoken),sum(pending),sum(pendingtoken) FROM ("+
+		"SELECT rewardreason,rewards AS earned,granttoken AS earnedtoken,0 AS pending,0 AS pendingtoken FROM userdailyreward WHERE clientid=? and day>=? and day<=? "+
+		"UNION ALL SELECT rewardreason,0,0,1,granttoken FROM rewardresult WHERE clientid=? and grantsuccess<>'success'"+
+		") GROUP BY rewardreason ORDER BY rewardreason", clientid, fromDay, toDay, clientid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var earnedtoken, pendingtoken int64
+		r := &DashboardReward{}
+		err = rows.Scan(&r.RewardReason, &r.EarnedCount, &earnedtoken, &r.PendingCount, &pendingtoken)
+		if err != nil {
+			return nil, err
+		}
+		r.Earned = new(big.Int).Mul(big.NewInt(params.Ether), big.NewInt(earnedtoken))
+		r.Pending = new(big.Int).Mul(big.NewInt(params.Ether), big.NewInt(pendingtoken))
+		rewards = append(rewards, r)
+	}
+	return rewards, rows.Err()
+}
+
+// SelectModerationStatus the reports against and by clientid and its sensitive word records, by dealtag
+func (pdb *PubDB) SelectModerationStatus(clientid string) (m *DashboardModeration, err error) {
+	m = &DashboardModeration{}
+	for _, q := range []struct {
+		sql    string
+		counts *ModerationCounts
+	}{
+		{"SELECT ifnull(dealtag,'0'),count(*) FROM violationrecord WHERE defendant=? GROUP BY 1", &m.ReportsAgainst},
+		{"SELECT ifnull(dealtag,'0'),count(*) FROM violationrecord WHERE plaintiff=? GROUP BY 1", &m.ReportsFiled},
+		{"SELECT ifnull(dealtag,'0'),count(*) FROM sensitivewordrecord WHERE author=? GROUP BY 1", &m.SensitiveWords},
+	} {
+		rows, err := pdb.db.Query(q.sql, clientid)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var dealtag string
+			var n int
+			if err = rows.Scan(&dealtag, &n); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			q.counts.add(dealtag, n)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	m.Blacklisted = m.ReportsAgainst.Confirmed > 0
+	return m, nil
+}
+
+// UpsertVote keeps the vote of voter on target if seq, the sequence of the vote in the feed of voter, is after the one the index has.
+// value is 1 for a like and 0 for an unlike, changed is false for a vote that is older or the same as the one the index has.
+// firstLike is true for the first like of voter on target the index keeps, only that one is rewarded: liking again after an unlike is not.
+// The daily rollups get the difference, the likes received only once the author of target is known, see ResolveVoteTarget.
+func (pdb *PubDB) UpsertVote(voter, target string, value int, seq, votetime int64) (changed, firstLike bool, err error) {
+	pdb.lock.Lock()
+	defer pdb.lock.Unlock()
+	tx, err := pdb.db.Begin()
+	if err != nil {
+		return false, false, err
+	}
+	defer tx.Rollback()
+
+	var oldValue int
+	var oldSeq int64
+	var rewarded bool
+	var targetAuthor sql.NullString
+	err = tx.QueryRow("SELECT value,seq,targetauthor,rewarded FROM votes WHERE voter=? and target=?", voter, target).Scan(&oldValue, &oldSeq, &targetAuthor, &rewarded)
+	switch {
+	case err == sql.ErrNoRows:
+		//同一消息的其他投票可能已经找到了作者
+		err = tx.QueryRow("SELECT targetauthor FROM votes WHERE target=? and targetauthor IS NOT NULL LIMIT 1", target).Scan(&targetAuthor)
+		if err != nil && err != sql.ErrNoRows {
+			return false, false, err
+		}
+	case err != nil:
+		return false, false, err
+	case seq <= oldSeq:
+		return false, false, nil
+	}
+
+	firstLike = value == 1 && !rewarded
+	_, err = tx.Exec("INSERT INTO votes(voter,target,value,seq,votetime,targetauthor,rewarded) VALUES (?,?,?,?,?,?,?) "+
+		"ON CONFLICT(voter,target) DO UPDATE SET value=excluded.value,seq=excluded.seq,votetime=excluded.votetime,targetauthor=excluded.targetauthor,rewarded=excluded.rewarded",
+		voter, target, value, seq, votetime, targetAuthor, rewarded || firstLike)
+	if err != nil {
+		return false, false, err
+	}
+	if delta := value - oldValue; delta != 0 {
+		if err = addDailyActivity(tx, voter, votetime, "likesgiven", delta); err != nil {
+			return false, false, err
+		}
+		if targetAuthor.Valid {
+			if err = addDailyActivity(tx, targetAuthor.String, votetime, "likesreceived", delta); err != nil {
+				return false, false, err
+			}
+		}
+	}
+	return value != oldValue, firstLike, tx.Commit()
+}
+
+// SelectUnresolvedVoteTargets up to limit messages that were voted on and whose author is not known yet, the ones tried least often first
+func (pdb *PubDB) SelectUnresolvedVoteTargets(limit int) (targets []string, err error) {
+	rows, err := pdb.db.Query("SELECT target FROM votes WHERE targetauthor IS NULL GROUP BY target ORDER BY min(resolvetries) LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var target string
+		if err = rows.Scan(&target); err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	return targets, rows.Err()
+}
+
+// ResolveVoteTarget sets author as the author of target on its votes, the likes they give count as received on the days of the votes
+func (pdb *PubDB) ResolveVoteTarget(target, author string) error {
+	pdb.lock.Lock()
+	defer pdb.lock.Unlock()
+	tx, err := pdb.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec("INSERT INTO userdailyactivity(clientid,day,likesreceived) "+
+		"SELECT ?,date(votetime/1000,'unixepoch'),sum(value) FROM votes WHERE target=? and targetauthor IS NULL and value<>0 GROUP BY 2 "+
+		"ON CONFLICT(clientid,day) DO UPDATE SET likesreceived=likesreceived+excluded.likesreceived", author, target)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE votes SET targetauthor=? WHERE target=? and targetauthor IS NULL", author, target)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// MarkVoteTargetUnresolved counts a failed lookup of the author of target
+func (pdb *PubDB) MarkVoteTargetUnresolved(target string) error {
+	_, err := pdb.db.Exec("UPDATE votes SET resolvetries=resolvetries+1 WHERE target=?", target)
+	return err
+}
+
+// SelectAnalysisState a value the analysis keeps between its rounds, 0 if it was never set
+func (pdb *PubDB) SelectAnalysisState(name string) (value int64, err error) {
+	err = pdb.db.QueryRow("SELECT value FROM analysisstate WHERE name=?", name).Scan(&value)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return value, err
+}
+
+// UpdateAnalysisState sets a value the analysis keeps between its rounds
+func (pdb *PubDB) UpdateAnalysisState(name string, value int64) error {
+	_, err := pdb.db.Exec("INSERT OR REPLACE INTO analysisstate(name,value) VALUES (?,?)", name, value)
+	return err
+}
+
+// reindexCopied the rows of the existing database a reindex takes over, they come from the api and the payouts, not from the log
+var reindexCopied = []struct{ table, where string }{
+	{"userprofile", ""},
+	{"usertaskcollect", "messagetype NOT IN ('2','3')"},
+	{"violationrecord", ""},
+	{"rewardresult", ""},
+}
+
+// reindexCompared the tables the analysis fills from the log and the columns a reindex compares them by
+var reindexCompared = []struct{ table, columns, where string }{
+	{"votes", "voter,target,value,seq,targetauthor", ""},
+	{"usertaskcollect", "author,messagekey,messagetype,messageroot,messagetime", "messagetype IN ('2','3')"},
+	{"sensitivewordrecord", "messagekey,author,content,dealtag", ""},
+	{"userprofile", "clientid,clientname,other1", ""},
+	{"pubannounce", "pubid,host,port,invitecode,capacity,api,announcetime", ""},
+	{"userdailyactivity", "clientid,day,posts,comments,likesgiven,likesreceived", ""},
+	{"userdailyreward", "clientid,day,rewardreason,rewards,granttoken", ""},
+}
+
+// TableDiff a table of the existing database compared with the reindexed one, Only* are the rows the other one does not have
+type TableDiff struct {
+	Table        string `json:"table"`
+	Existing     int    `json:"existing"`
+	Reindexed    int    `json:"reindexed"`
+	OnlyExisting int    `json:"only_existing"`
+	OnlyReindex  int    `json:"only_reindexed"`
+}
+
+// Equal both databases have the same rows
+func (d *TableDiff) Equal() bool {
+	return d.OnlyExisting == 0 && d.OnlyReindex == 0
+}
+
+// withAttached runs fn on a connection that has the database file existing attached as "cur",
+// ATTACH only holds for the connection it ran on.
+func (pdb *PubDB) withAttached(existing string, fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := pdb.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err = conn.ExecContext(ctx, "ATTACH DATABASE ? AS cur", existing); err != nil {
+		return fmt.Errorf("attach %s: %w", existing, err)
+	}
+	err = fn(conn)
+	if _, derr := conn.ExecContext(ctx, "DETACH DATABASE cur"); derr != nil && err == nil {
+		err = derr
+	}
+	return err
+}
+
+// CopyReindexState copies the rows of the database file existing that do not come from the log, before a reindex replays it
+func (pdb *PubDB) CopyReindexState(existing string) error {
+	return pdb.withAttached(existing, func(conn *sql.Conn) error {
+		for _, c := range reindexCopied {
+			query := "INSERT INTO main." + c.table + " SELECT * FROM cur." + c.table
+			if c.where != "" {
+				query += " WHERE " + c.where
+			}
+			if _, err := conn.ExecContext(context.Background(), query); err != nil {
+				return fmt.Errorf("copy %s: %w", c.table, err)
+			}
+		}
+		return nil
+	})
+}
+
+// CopySensitiveWordDecisions takes the decisions of the administrator on the sensitive word records over from the database file existing,
+// the records themselves come from the log
+func (pdb *PubDB) CopySensitiveWordDecisions(existing string) error {
+	return pdb.withAttached(existing, func(conn *sql.Conn) error {
+		_, err := conn.ExecContext(context.Background(), "UPDATE main.sensitivewordrecord SET "+
+			"dealtag=(SELECT c.dealtag FROM cur.sensitivewordrecord c WHERE c.messagekey=sensitivewordrecord.messagekey ORDER BY c.dealtime DESC LIMIT 1),"+
+			"dealtime=(SELECT c.dealtime FROM cur.sensitivewordrecord c WHERE c.messagekey=sensitivewordrecord.messagekey ORDER BY c.dealtime DESC LIMIT 1) "+
+			"WHERE messagekey IN (SELECT messagekey FROM cur.sensitivewordrecord)")
+		return err
+	})
+}
+
+// DiffReindex compares the tables the analysis fills from the log with the ones of the database file existing
+func (pdb *PubDB) DiffReindex(existing string) (diffs []*TableDiff, err error) {
+	err = pdb.withAttached(existing, func(conn *sql.Conn) error {
+		ctx := context.Background()
+		for _, c := range reindexCompared {
+			sel := func(db string) string {
+				query := "SELECT " + c.columns + " FROM " + db + "." + c.table
+				if c.where != "" {
+					query += " WHERE " + c.where
+				}
+				return query
+			}
+			d := &TableDiff{Table: c.table}
+			err := conn.QueryRowContext(ctx, "SELECT "+
+				"(SELECT count(*) FROM ("+sel("cur")+")),"+
+				"(SELECT count(*) FROM ("+sel("main")+")),"+
+				"(SELECT count(*) FROM ("+sel("cur")+" EXCEPT "+sel("main")+")),"+
+				"(SELECT count(*) FROM ("+sel("main")+" EXCEPT "+sel("cur")+"))").
+				Scan(&d.Existing, &d.Reindexed, &d.OnlyExisting, &d.OnlyReindex)
+			if err != nil {
+				return fmt.Errorf("compare %s: %w", c.table, err)
+			}
+			diffs = append(diffs, d)
+		}
+		return nil
+	})
+	return diffs, err
+}
@@ -102,9 +102,7 @@ func NewExceptionAPIResponse(err error) *APIResponse {
 func (r *APIResponse) String() string {
 	buf, err := json.Marshal(r)
 	if err != nil {
-		fmt.Println(fmt.Sprintf("APIResponse marshal err = %s", err.Error()))
-
-		return ""
+		return fmt.Sprintf("APIResponse marshal err = %s", err.Error())
 	}
 	return string(buf)
 }
@@ -113,8 +111,7 @@ func (r *APIResponse) String() string {
 func (r *APIResponse) ToFormatString() string {
 	buf, err := json.MarshalIndent(r, "\t", "")
 	if err != nil {
-		fmt.Println(fmt.Sprintf("APIResponse marshal err = %s", err.Error()))
-		return ""
+		return fmt.Sprintf("APIResponse marshal err = %s", err.Error())
 	}
 	return string(buf)
 }
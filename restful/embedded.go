@@ -0,0 +1,249 @@
+package restful
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/restful/params"
+	"go.cryptoscope.co/ssb/sbot"
+	"go.mindeco.de/encodedTime"
+	"go.mindeco.de/log/level"
+	refs "go.mindeco.de/ssb-refs"
+)
+
+// WithMetalifeServices runs the restful api and the message analysis inside the sbot process.
+// They read the ReceiveLog and publish with the PublishLog of the bot, instead of dialing the pub over muxrpc,
+// the pub section of cfg is only used for the datadir of the analysis database.
+func WithMetalifeServices(cfg *params.Config) sbot.Option {
+	return sbot.WithService(&metalifeService{cfg: cfg})
+}
+
+type metalifeService struct {
+	cfg *params.Config
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// Serve implements sbot.Service
+func (ms *metalifeService) Serve(ctx context.Context, bot *sbot.Sbot) error {
+	pubID := bot.KeyPair.ID().String()
+	s, err := newService(ms.cfg, pubID, newSbotBackend(bot), bot.Logger())
+	if err != nil {
+		return fmt.Errorf("metalife: init analysis failed: %w", err)
+	}
+
+	server, err := s.newAPIServer()
+	if err != nil {
+		return fmt.Errorf("metalife: make router failed: %w", err)
+	}
+	ln, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return fmt.Errorf("metalife: restful api listen failed: %w", err)
+	}
+	level.Info(s.logger(logAPI)).Log("event", "services started in sbot process", "addr", server.Addr)
+
+	ctx, ms.cancel = context.WithCancel(ctx)
+	ms.done = make(chan struct{})
+	go func() {
+		ms.err = s.runServices(ctx, server, ln)
+		close(ms.done)
+	}()
+	return nil
+}
+
+// Close stops the services and waits for them, the logs of the bot are still open
+func (ms *metalifeService) Close() error {
+	if ms.cancel == nil {
+		return nil
+	}
+	ms.cancel()
+	<-ms.done
+	return ms.err
+}
+
+// sbotBackend uses the logs of the bot the service runs in
+type sbotBackend struct {
+	bot *sbot.Sbot
+
+	// round the last analysis round that streamed, the next one starts where it ended
+	mu    sync.Mutex
+	round rxRound
+}
+
+// rxRound the receive log seqs an analysis round with gt read, from the first one to next-1
+type rxRound struct {
+	gt, from, next int64
+}
+
+func newSbotBackend(bot *sbot.Sbot) *sbotBackend {
+	return &sbotBackend{bot: bot, round: rxRound{from: -1}}
+}
+
+// logStream skips the messages received up to gt, like createLogStream does.
+// The analysis rounds (gt > 0) continue at the receive log seq the previous round got to,
+// a round that is repeated with the same gt starts again where it started.
+// After a restart, or for gt 0, the messages are filtered by their received time.
+func (b *sbotBackend) logStream(ctx context.Context, gt int64) (messageSource, error) {
+	from, after := int64(-1), gt
+	b.mu.Lock()
+	if gt > 0 && b.round.from >= 0 {
+		switch {
+		case gt == b.round.gt:
+			from = b.round.from
+		case gt > b.round.gt:
+			from = b.round.next
+		}
+	}
+	if from >= 0 {
+		// the received time has milliseconds only, a message of the same millisecond as gt can come after the round
+		after = 0
+	} else {
+		from = 0
+	}
+	if gt > 0 {
+		b.round = rxRound{gt: gt, from: from, next: from}
+	}
+	b.mu.Unlock()
+
+	src, err := b.bot.ReceiveLog.Query(margaret.Gte(from), margaret.SeqWrap(true))
+	if err != nil {
+		return nil, fmt.Errorf("receive log query failed: %w", err)
+	}
+	rs := &receiveLogSource{src: src, gt: after}
+	if gt > 0 {
+		rs.seen = func(seq int64) {
+			b.mu.Lock()
+			if b.round.gt == gt && seq >= b.round.next {
+				b.round.next = seq + 1
+			}
+			b.mu.Unlock()
+		}
+	}
+	return rs, nil
+}
+
+func (b *sbotBackend) publish(ctx context.Context, content interface{}) (string, error) {
+	msg, err := b.bot.PublishLog.Publish(content)
+	if err != nil {
+		return "", err
+	}
+	return msg.Key().String(), nil
+}
+
+func (b *sbotBackend) status(ctx context.Context) (ssb.Status, error) {
+	return b.bot.Status()
+}
+
+func (b *sbotBackend) messageAuthor(ctx context.Context, key string) (string, error) {
+	ref, err := refs.ParseMessageRef(key)
+	if err != nil {
+		return "", err
+	}
+	msg, err := b.bot.Get(ref)
+	if err != nil {
+		return "", err
+	}
+	return msg.Author().String(), nil
+}
+
+func (b *sbotBackend) search(ctx context.Context, qry message.SearchArgs) ([]DeserializedMessageStu, error) {
+	found, err := b.bot.Search(qry)
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([]DeserializedMessageStu, len(found))
+	for i, msg := range found {
+		var kv refs.KeyValueRaw
+		kv.Key_ = msg.Key()
+		kv.Value = *msg.ValueContent()
+		kv.Timestamp = encodedTime.Millisecs(msg.Received())
+		raw, err := json.Marshal(kv)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(raw, &msgs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return msgs, nil
+}
+
+// receiveLogSource encodes the messages of the receive log like createLogStream with keys:true,
+// without the ones received up to gt (unix milliseconds)
+type receiveLogSource struct {
+	src luigi.Source
+	gt  int64
+	// seen is called with the receive log seq of every message that was read
+	seen func(seq int64)
+	cur  []byte
+	err  error
+}
+
+func (rs *receiveLogSource) Next(ctx context.Context) bool {
+	for {
+		v, err := rs.src.Next(ctx)
+		if err != nil {
+			if !luigi.IsEOS(err) {
+				rs.err = err
+			}
+			return false
+		}
+
+		if err, ok := v.(error); ok {
+			if margaret.IsErrNulled(err) {
+				continue
+			}
+			rs.err = err
+			return false
+		}
+
+		sw, ok := v.(margaret.SeqWrapper)
+		if !ok {
+			rs.err = fmt.Errorf("receive log: wrong value type %T", v)
+			return false
+		}
+		if rs.seen != nil {
+			rs.seen(sw.Seq())
+		}
+		if err, ok := sw.Value().(error); ok {
+			if margaret.IsErrNulled(err) {
+				continue
+			}
+			rs.err = err
+			return false
+		}
+		msg, ok := sw.Value().(refs.Message)
+		if !ok {
+			rs.err = fmt.Errorf("receive log: wrong message type %T", sw.Value())
+			return false
+		}
+
+		if msg.Received().UnixNano()/1e6 <= rs.gt {
+			continue
+		}
+
+		var kv refs.KeyValueRaw
+		kv.Key_ = msg.Key()
+		kv.Value = *msg.ValueContent()
+		kv.Timestamp = encodedTime.Millisecs(msg.Received())
+		rs.cur, rs.err = json.Marshal(kv)
+		return rs.err == nil
+	}
+}
+
+func (rs *receiveLogSource) Reader(fn func(io.Reader) error) error {
+	return fn(bytes.NewReader(rs.cur))
+}
+
+func (rs *receiveLogSource) Err() error { return rs.err }
@@ -0,0 +1,79 @@
+package restful
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	kitlog "go.mindeco.de/log"
+
+	"go.cryptoscope.co/ssb/restful/params"
+	"go.cryptoscope.co/ssb/sbot"
+)
+
+// TestSbotBackendRounds the analysis rounds on the receive log of a bot only see the messages they did not see before,
+// also with a new backend that has no seq of the last round, as after a restart
+func TestSbotBackendRounds(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "embedded")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+
+	bot, err := sbot.New(
+		sbot.WithInfo(kitlog.NewNopLogger()),
+		sbot.WithRepoPath(filepath.Join(dir, "repo")),
+		sbot.WithListenAddr(":0"),
+	)
+	r.NoError(err)
+	defer func() {
+		bot.Shutdown()
+		r.NoError(bot.Close())
+	}()
+	author := bot.KeyPair.ID().String()
+
+	s := newTestService(t, dir, params.DefaultConfig(), newSbotBackend(bot))
+	defer s.db.Close()
+	s.simulation = &rewardSimulator{from: 0, to: math.MaxInt64}
+
+	post := func(text string) {
+		_, err := bot.PublishLog.Publish(map[string]interface{}{"type": "post", "text": text})
+		r.NoError(err)
+	}
+	round := func() {
+		src, err := s.backend.logStream(ctx, s.lastAnalysisTime)
+		r.NoError(err)
+		end, _, err := s.SsbMessageAnalysis(ctx, src)
+		r.NoError(err)
+		s.lastAnalysisTime = end
+	}
+	postTasks := func() int {
+		tasks, err := s.db.GetUserTaskCollect(author, "2", 0, math.MaxInt64)
+		r.NoError(err)
+		return len(tasks)
+	}
+
+	post("one two three four five six seven eight nine ten eleven")
+	round()
+	r.Equal(1, postTasks())
+	r.Len(s.simulation.events, 1)
+
+	round()
+	r.Equal(1, postTasks(), "the second round analyzed the post again")
+	r.Len(s.simulation.events, 1, "the second round rewarded the post again")
+
+	post("eleven ten nine eight seven six five four three two one")
+	round()
+	r.Equal(2, postTasks())
+	r.Len(s.simulation.events, 2)
+
+	// a new backend starts from the received time of the messages
+	s.backend = newSbotBackend(bot)
+	round()
+	r.Equal(2, postTasks())
+	r.Len(s.simulation.events, 2)
+}
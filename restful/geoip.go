@@ -0,0 +1,117 @@
+package restful
+
+import (
+	"errors"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ip2location/ip2location-go/v9"
+	kitlog "go.mindeco.de/log"
+	"go.mindeco.de/log/level"
+)
+
+// errGeoIPUnavailable the IP2Location database could not be opened
+var errGeoIPUnavailable = errors.New("ip2location database is not available")
+
+// geoLocation where an ip is according to the IP2Location database
+type geoLocation struct {
+	CountryShort string
+	CountryLong  string
+	Region       string
+	City         string
+	Latitude     float64
+	Longitude    float64
+}
+
+// geoIPDB the IP2Location database, it is opened once and opened again by reload when the file was replaced
+type geoIPDB struct {
+	path string
+	log  kitlog.Logger
+
+	mu      sync.RWMutex
+	db      *ip2location.DB
+	modTime time.Time
+}
+
+// newGeoIPDB opens the database at path, a missing file is only logged, reload tries again later
+func newGeoIPDB(path string, logger kitlog.Logger) *geoIPDB {
+	g := &geoIPDB{path: path, log: logger}
+	if err := g.reload(); err != nil {
+		level.Warn(logger).Log("event", "geoip open failed", "path", path, "err", err)
+	}
+	return g
+}
+
+// reload opens the file again if it changed since it was opened, the lookups that run keep the old one until they are done
+func (g *geoIPDB) reload() error {
+	fi, err := os.Stat(g.path)
+	if err != nil {
+		return err
+	}
+	g.mu.RLock()
+	unchanged := g.db != nil && fi.ModTime().Equal(g.modTime)
+	g.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	db, err := ip2location.OpenDB(g.path)
+	if err != nil {
+		return err
+	}
+	g.mu.Lock()
+	old := g.db
+	g.db, g.modTime = db, fi.ModTime()
+	g.mu.Unlock()
+	if old != nil {
+		old.Close()
+		level.Info(g.log).Log("event", "geoip reloaded", "path", g.path)
+	}
+	return nil
+}
+
+// lookup the location of ip
+func (g *geoIPDB) lookup(ip string) (*geoLocation, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if g.db == nil {
+		return nil, errGeoIPUnavailable
+	}
+	rec, err := g.db.Get_all(ip)
+	if err != nil {
+		return nil, err
+	}
+	return &geoLocation{
+		CountryShort: rec.Country_short,
+		CountryLong:  rec.Country_long,
+		Region:       rec.Region,
+		City:         rec.City,
+		Latitude:     float64(rec.Latitude),
+		Longitude:    float64(rec.Longitude),
+	}, nil
+}
+
+// Close the database
+func (g *geoIPDB) Close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.db != nil {
+		g.db.Close()
+		g.db = nil
+	}
+}
+
+// earthRadiusKm mean radius of the earth
+const earthRadiusKm = 6371.0
+
+// distanceKm the great circle distance between a and b
+func distanceKm(a, b *geoLocation) float64 {
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := rad(b.Latitude - a.Latitude)
+	dLon := rad(b.Longitude - a.Longitude)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(rad(a.Latitude))*math.Cos(rad(b.Latitude))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
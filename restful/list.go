@@ -0,0 +1,466 @@
+package restful
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"go.cryptoscope.co/ssb/restful/rerr"
+	"go.mindeco.de/log/level"
+)
+
+const (
+	// defaultListLimit page size of a list endpoint if the query has no limit
+	defaultListLimit = 100
+	// maxListLimit the largest page a list endpoint returns, an ndjson stream without a limit returns the whole list
+	maxListLimit = 1000
+)
+
+// listStreamChunk how many rows an ndjson stream without a limit reads from the database at a time
+var listStreamChunk = 500
+
+// ListQuery the query-string of the list endpoints:
+// ?author=&from=&to=&reason=&state=&order=asc|desc&limit=&cursor=&format=json|ndjson,
+// from and to are unix milliseconds, to is exclusive
+type ListQuery struct {
+	Author string
+	From   int64
+	To     int64
+	Reason string
+	State  string
+	Desc   bool
+	Limit  int
+	Cursor string
+	Stream bool
+}
+
+// listQueryKeys the parameters of ListQuery, a request with one of them is answered with a ListPage
+var listQueryKeys = []string{"author", "from", "to", "reason", "state", "order", "limit", "cursor", "format"}
+
+// isListQuery whether the query-string of a GET list endpoint asks for a ListPage instead of the whole table
+func isListQuery(r *http.Request) bool {
+	query := r.URL.Query()
+	for _, key := range listQueryKeys {
+		if _, ok := query[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseListQuery reads a ListQuery from the query-string of a request
+func ParseListQuery(query url.Values) (q *ListQuery, err error) {
+	q = &ListQuery{
+		Author: query.Get("author"),
+		Reason: query.Get("reason"),
+		State:  query.Get("state"),
+		Cursor: query.Get("cursor"),
+		To:     math.MaxInt64,
+		Limit:  defaultListLimit,
+	}
+	if s := query.Get("from"); s != "" {
+		if q.From, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return nil, fmt.Errorf("from: %w", err)
+		}
+	}
+	if s := query.Get("to"); s != "" {
+		if q.To, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return nil, fmt.Errorf("to: %w", err)
+		}
+	}
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		return nil, fmt.Errorf("order must be asc or desc")
+	}
+	switch query.Get("format") {
+	case "", "json":
+	case "ndjson":
+		q.Stream = true
+		q.Limit = 0
+	default:
+		return nil, fmt.Errorf("format must be json or ndjson")
+	}
+	if s := query.Get("limit"); s != "" {
+		if q.Limit, err = strconv.Atoi(s); err != nil {
+			return nil, fmt.Errorf("limit: %w", err)
+		}
+		if q.Limit <= 0 {
+			return nil, fmt.Errorf("limit must be positive")
+		}
+	}
+	if q.Limit > maxListLimit {
+		q.Limit = maxListLimit
+	}
+	return
+}
+
+// listItem a row of a list endpoint and the values it is ordered and paged by.
+// Rows without a time are sorted by ID only.
+type listItem struct {
+	ID   string
+	Time int64
+	Data interface{}
+}
+
+// ListPage a page of a list endpoint, NextCursor is empty on the last page
+type ListPage struct {
+	Items      []interface{} `json:"items"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// listCursor encodes the position after item, IDs are unique within a list so the cursor is stable while rows are added
+func listCursor(item listItem) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(item.Time, 10) + "|" + item.ID))
+}
+
+// parseListCursor decodes a cursor of listCursor
+func parseListCursor(cursor string) (item listItem, err error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return item, fmt.Errorf("bad cursor")
+	}
+	kv := strings.SplitN(string(b), "|", 2)
+	if len(kv) != 2 {
+		return item, fmt.Errorf("bad cursor")
+	}
+	if item.Time, err = strconv.ParseInt(kv[0], 10, 64); err != nil {
+		return item, fmt.Errorf("bad cursor")
+	}
+	item.ID = kv[1]
+	return
+}
+
+// listFilters the parameters of ListQuery that not every list can filter by
+var listFilters = []string{"from", "to", "reason", "state"}
+
+// checkListFilters an error for a filter of query that is not one of supported
+func checkListFilters(query url.Values, supported []string) error {
+	for _, key := range listFilters {
+		if _, ok := query[key]; !ok {
+			continue
+		}
+		found := false
+		for _, s := range supported {
+			found = found || s == key
+		}
+		if !found {
+			return rerr.ErrArgumentError.Errorf("the list can not be filtered by %s", key)
+		}
+	}
+	return nil
+}
+
+// listPage the rows of a list after the cursor of the query, in its order, at most limit of them (0 is all).
+// The limit is one more than the page size, the extra row tells that there is a next page.
+type listPage struct {
+	after *listItem
+	desc  bool
+	limit int
+}
+
+// page the rows the database has to return for the query
+func (q *ListQuery) page() (*listPage, error) {
+	p := &listPage{desc: q.Desc}
+	if q.Limit > 0 {
+		p.limit = q.Limit + 1
+	}
+	if q.Cursor != "" {
+		c, err := parseListCursor(q.Cursor)
+		if err != nil {
+			return nil, rerr.ErrArgumentError.AppendError(err)
+		}
+		p.after = &c
+	}
+	return p, nil
+}
+
+// afterUID the uid of the row of the cursor, for the lists whose ID is the uid of the table
+func (p *listPage) afterUID() (int64, error) {
+	if p.after == nil {
+		return 0, nil
+	}
+	uid, err := strconv.ParseInt(p.after.ID, 10, 64)
+	if err != nil {
+		return 0, rerr.ErrArgumentError.Append("bad cursor")
+	}
+	return uid, nil
+}
+
+// listSQL the select of a list endpoint, the filters, the cursor, the order and the limit are done by the database
+type listSQL struct {
+	query   string
+	groupBy string
+	cond    []string
+	args    []interface{}
+}
+
+// where adds a condition with its arguments
+func (ls *listSQL) where(cond string, args ...interface{}) {
+	ls.cond = append(ls.cond, cond)
+	ls.args = append(ls.args, args...)
+}
+
+// build the statement for page p, ordered by timeCol ("" for the lists without a time) and then by idCol,
+// afterID is the ID of the cursor as idCol holds it
+func (ls *listSQL) build(p *listPage, timeCol, idCol string, afterID interface{}) (string, []interface{}) {
+	cond := append([]string(nil), ls.cond...)
+	args := append([]interface{}(nil), ls.args...)
+	cmp, dir := ">", " ASC"
+	if p.desc {
+		cmp, dir = "<", " DESC"
+	}
+	if p.after != nil {
+		if timeCol != "" {
+			cond = append(cond, fmt.Sprintf("(%[1]s%[2]s? OR (%[1]s=? AND %[3]s%[2]s?))", timeCol, cmp, idCol))
+			args = append(args, p.after.Time, p.after.Time, afterID)
+		} else {
+			cond = append(cond, idCol+cmp+"?")
+			args = append(args, afterID)
+		}
+	}
+	query := ls.query
+	if len(cond) > 0 {
+		query += " WHERE " + strings.Join(cond, " AND ")
+	}
+	if ls.groupBy != "" {
+		query += " GROUP BY " + ls.groupBy
+	}
+	order := idCol + dir
+	if timeCol != "" {
+		order = timeCol + dir + "," + order
+	}
+	query += " ORDER BY " + order
+	if p.limit > 0 {
+		query += " LIMIT " + strconv.Itoa(p.limit)
+	}
+	return query, args
+}
+
+// serveList answers a list endpoint with a ListPage, or with one json document per line for format=ndjson.
+// filters are the ones of listFilters the list supports, load returns the rows of the page from the database.
+func (s *Service) serveList(w rest.ResponseWriter, r *rest.Request, name string, filters []string, load func(q *ListQuery, p *listPage) ([]listItem, error)) {
+	var resp *APIResponse
+	q, err := ParseListQuery(r.URL.Query())
+	if err != nil {
+		err = rerr.ErrArgumentError.AppendError(err)
+	} else {
+		err = checkListFilters(r.URL.Query(), filters)
+	}
+	var p *listPage
+	if err == nil {
+		p, err = q.page()
+	}
+	// the whole list is read in chunks, the first one before the response is started
+	chunked := err == nil && q.Stream && q.Limit == 0
+	if chunked {
+		p.limit = listStreamChunk
+	}
+	var page []listItem
+	var next string
+	if err == nil {
+		page, err = load(q, p)
+	}
+	if err == nil && q.Limit > 0 && len(page) > q.Limit {
+		page = page[:q.Limit]
+		next = listCursor(page[len(page)-1])
+	}
+	if err != nil || !q.Stream {
+		defer func() {
+			writejson(w, resp)
+		}()
+		if err != nil {
+			resp = NewAPIResponse(err, nil)
+			return
+		}
+		lp := &ListPage{Items: make([]interface{}, 0, len(page)), NextCursor: next}
+		for _, item := range page {
+			lp.Items = append(lp.Items, item.Data)
+		}
+		resp = NewAPIResponse(nil, lp)
+		return
+	}
+
+	nw, err := newNDJSONWriter(w, next)
+	if err == nil {
+		err = nw.write(page)
+	}
+	for err == nil && chunked && len(page) == p.limit {
+		last := page[len(page)-1]
+		p.after = &last
+		if page, err = load(q, p); err == nil {
+			err = nw.write(page)
+		}
+	}
+	if err != nil {
+		level.Warn(s.logger(logAPI)).Log("event", "ndjson stream stopped", "list", name, "err", err)
+		return
+	}
+	level.Debug(s.logger(logAPI)).Log("event", "ndjson streamed", "list", name, "items", nw.n)
+}
+
+// ndjsonWriter writes the rows of a list endpoint as newline delimited json, flushing every line
+type ndjsonWriter struct {
+	enc     *json.Encoder
+	flusher http.Flusher
+	n       int
+}
+
+// newNDJSONWriter starts the response, with a limit the cursor of the following page is sent in the X-Next-Cursor header
+func newNDJSONWriter(w rest.ResponseWriter, next string) (*ndjsonWriter, error) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	if next != "" {
+		w.Header().Set("X-Next-Cursor", next)
+	}
+	w.WriteHeader(http.StatusOK)
+	hw, ok := w.(http.ResponseWriter)
+	if !ok {
+		return nil, fmt.Errorf("response writer %T can not stream", w)
+	}
+	flusher, _ := w.(http.Flusher)
+	return &ndjsonWriter{enc: json.NewEncoder(hw), flusher: flusher}, nil
+}
+
+func (nw *ndjsonWriter) write(items []listItem) error {
+	for _, item := range items {
+		if err := nw.enc.Encode(item.Data); err != nil {
+			return err
+		}
+		if nw.flusher != nil {
+			nw.flusher.Flush()
+		}
+		nw.n++
+	}
+	return nil
+}
+
+// listLikes the rows of GET /ssb/api/likes
+func (s *Service) listLikes(q *ListQuery, p *listPage) ([]listItem, error) {
+	return s.listVoteSums("targetauthor", q, p)
+}
+
+// listSetLikes the rows of GET /ssb/api/set-like-info
+func (s *Service) listSetLikes(q *ListQuery, p *listPage) ([]listItem, error) {
+	return s.listVoteSums("voter", q, p)
+}
+
+// listVoteSums the sums of the votes by the voter or the targetauthor column, one row per feed
+func (s *Service) listVoteSums(column string, q *ListQuery, p *listPage) (items []listItem, err error) {
+	ls := &listSQL{
+		query: "SELECT votes." + column + ",sum(votes.value),ifnull(userprofile.clientname,''),ifnull(userprofile.other1,'') " +
+			"FROM votes left outer join userprofile on votes." + column + "=userprofile.clientid",
+		groupBy: "votes." + column,
+	}
+	ls.where("votes." + column + " IS NOT NULL")
+	if q.Author != "" {
+		ls.where("votes."+column+"=?", q.Author)
+	}
+	var afterID string
+	if p.after != nil {
+		afterID = p.after.ID
+	}
+	query, args := ls.build(p, "", "votes."+column, afterID)
+	likes, err := s.db.queryVoteSums(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	for _, like := range likes {
+		items = append(items, listItem{ID: like.ClientID, Data: like})
+	}
+	return
+}
+
+// listNodeProfiles the rows of GET /ssb/api/node-info
+func (s *Service) listNodeProfiles(q *ListQuery, p *listPage) (items []listItem, err error) {
+	ls := &listSQL{query: "SELECT * FROM userprofile"}
+	if q.Author != "" {
+		ls.where("clientid=?", q.Author)
+	}
+	afterUID, err := p.afterUID()
+	if err != nil {
+		return nil, err
+	}
+	query, args := ls.build(p, "", "uid", afterUID)
+	uids, profiles, err := s.db.queryUserProfiles(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	for i, pr := range profiles {
+		items = append(items, listItem{ID: strconv.FormatInt(uids[i], 10), Data: pr})
+	}
+	return
+}
+
+// listRewardInfo the rows of GET /ssb/api/get-reward-info, reason is the reward reason and state grant_success
+func (s *Service) listRewardInfo(q *ListQuery, p *listPage) (items []listItem, err error) {
+	ls := &listSQL{query: "SELECT * FROM rewardresult"}
+	ls.where("rewardtime>=? and rewardtime<?", q.From, q.To)
+	if q.Author != "" {
+		ls.where("clientid=?", q.Author)
+	}
+	if q.Reason != "" {
+		ls.where("rewardreason=?", q.Reason)
+	}
+	if q.State != "" {
+		ls.where("grantsuccess=?", q.State)
+	}
+	afterUID, err := p.afterUID()
+	if err != nil {
+		return nil, err
+	}
+	query, args := ls.build(p, "rewardtime", "uid", afterUID)
+	uids, rewards, err := s.db.queryRewardResults(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	for i, rr := range rewards {
+		items = append(items, listItem{ID: strconv.FormatInt(uids[i], 10), Time: rr.RewardTime, Data: rr})
+	}
+	return
+}
+
+// listTippedOffInfo the rows of GET /ssb/api/tippedoff-info, author is the defendant, state the dealtag and the time the recordtime
+func (s *Service) listTippedOffInfo(q *ListQuery, p *listPage) (items []listItem, err error) {
+	ls := &listSQL{query: "SELECT * FROM violationrecord"}
+	ls.where("recordtime>=? and recordtime<?", q.From, q.To)
+	if q.Author != "" {
+		ls.where("defendant=?", q.Author)
+	}
+	if q.Reason != "" {
+		ls.where("reasons=?", q.Reason)
+	}
+	if q.State != "" {
+		ls.where("dealtag=?", q.State)
+	}
+	afterUID, err := p.afterUID()
+	if err != nil {
+		return nil, err
+	}
+	query, args := ls.build(p, "recordtime", "uid", afterUID)
+	uids, reports, err := s.db.queryViolations(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	for i, t := range reports {
+		items = append(items, listItem{ID: strconv.FormatInt(uids[i], 10), Time: t.Recordtime, Data: t})
+	}
+	return
+}
+
+// ListRewardInfo GET /ssb/api/get-reward-info
+func (s *Service) ListRewardInfo(w rest.ResponseWriter, r *rest.Request) {
+	s.serveList(w, r, "ListRewardInfo", listFilters, s.listRewardInfo)
+}
+
+// ListTippedOffInfo GET /ssb/api/tippedoff-info
+func (s *Service) ListTippedOffInfo(w rest.ResponseWriter, r *rest.Request) {
+	s.serveList(w, r, "ListTippedOffInfo", listFilters, s.listTippedOffInfo)
+}
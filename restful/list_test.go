@@ -0,0 +1,173 @@
+package restful
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"go.cryptoscope.co/ssb/restful/params"
+	"go.cryptoscope.co/ssb/restful/rerr"
+)
+
+func TestParseListQuery(t *testing.T) {
+	r := require.New(t)
+
+	q, err := ParseListQuery(url.Values{"author": {"@a"}, "from": {"10"}, "order": {"desc"}, "limit": {"5000"}})
+	r.NoError(err)
+	r.Equal("@a", q.Author)
+	r.EqualValues(10, q.From)
+	r.True(q.Desc)
+	r.Equal(maxListLimit, q.Limit)
+
+	q, err = ParseListQuery(url.Values{"format": {"ndjson"}})
+	r.NoError(err)
+	r.True(q.Stream)
+	r.Equal(0, q.Limit)
+
+	q, err = ParseListQuery(url.Values{"format": {"ndjson"}, "limit": {"5000"}})
+	r.NoError(err)
+	r.Equal(maxListLimit, q.Limit)
+
+	for _, bad := range []url.Values{
+		{"order": {"up"}},
+		{"format": {"xml"}},
+		{"limit": {"0"}},
+		{"from": {"yesterday"}},
+	} {
+		_, err = ParseListQuery(bad)
+		r.Error(err, "%v", bad)
+	}
+}
+
+// TestListQueryPaging pages through the rows the database selects, pairs of rewards share a time and the uid keeps them apart
+func TestListQueryPaging(t *testing.T) {
+	r := require.New(t)
+	dir, err := ioutil.TempDir("", "list")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+
+	s := newTestService(t, dir, params.DefaultConfig(), &idleBackend{})
+	defer s.db.Close()
+	for i := 0; i < 10; i++ {
+		reason := PostMessage
+		if i == 9 {
+			reason = LikePost
+		}
+		_, err = s.db.RecordRewardResult(fmt.Sprintf("@%d", i%2), "", "success", 1, reason, fmt.Sprintf("%%m%d", i), 0, int64(100+i/2))
+		r.NoError(err)
+	}
+
+	collect := func(query string) (keys []string) {
+		path := "/ssb/api/get-reward-info?" + query
+		for pages := 0; ; pages++ {
+			r.True(pages < 20, "cursor does not advance")
+			var page struct {
+				Items      []RewardResult `json:"items"`
+				NextCursor string         `json:"next_cursor"`
+			}
+			resp := serveAPI(t, s, http.MethodGet, path, nil, &page)
+			r.Equal(SUCCESS, resp.ErrorCode, resp.ErrorMsg)
+			for _, rr := range page.Items {
+				keys = append(keys, rr.MessageKey)
+			}
+			if page.NextCursor == "" {
+				return
+			}
+			path = "/ssb/api/get-reward-info?" + query + "&cursor=" + page.NextCursor
+		}
+	}
+	r.Equal([]string{"%m0", "%m1", "%m2", "%m3", "%m4", "%m5", "%m6", "%m7", "%m8", "%m9"}, collect("limit=3"))
+	r.Equal([]string{"%m9", "%m7", "%m5", "%m3", "%m1"}, collect("limit=4&order=desc&author=@1"))
+	r.Equal([]string{"%m2", "%m3", "%m4", "%m5"}, collect("limit=2&from=101&to=103"))
+	r.Equal([]string{"%m9"}, collect("reason="+url.QueryEscape(LikePost)))
+
+	resp := serveAPI(t, s, http.MethodGet, "/ssb/api/get-reward-info?cursor=notacursor", nil, nil)
+	r.NotEqual(SUCCESS, resp.ErrorCode)
+}
+
+// TestListStreamChunks an ndjson stream without a limit reads the whole list in chunks, in the order of the query
+func TestListStreamChunks(t *testing.T) {
+	r := require.New(t)
+	dir, err := ioutil.TempDir("", "list")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+
+	defer func(chunk int) { listStreamChunk = chunk }(listStreamChunk)
+	listStreamChunk = 3
+
+	s := newTestService(t, dir, params.DefaultConfig(), &idleBackend{})
+	defer s.db.Close()
+	for i := 0; i < 10; i++ {
+		_, err = s.db.RecordRewardResult(fmt.Sprintf("@%d", i%2), "", "success", 1, PostMessage, fmt.Sprintf("%%m%d", i), 0, int64(100+i/2))
+		r.NoError(err)
+	}
+	server, err := s.newAPIServer()
+	r.NoError(err)
+
+	stream := func(query string) (keys []string) {
+		req := httptest.NewRequest(http.MethodGet, "/ssb/api/get-reward-info?format=ndjson&"+query, http.NoBody)
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, req)
+		r.Equal(http.StatusOK, rec.Code, rec.Body.String())
+		r.Equal("application/x-ndjson", rec.Header().Get("Content-Type"))
+		dec := json.NewDecoder(rec.Body)
+		for dec.More() {
+			var rr RewardResult
+			r.NoError(dec.Decode(&rr))
+			keys = append(keys, rr.MessageKey)
+		}
+		return
+	}
+	r.Equal([]string{"%m0", "%m1", "%m2", "%m3", "%m4", "%m5", "%m6", "%m7", "%m8", "%m9"}, stream("order=asc"))
+	r.Equal([]string{"%m9", "%m7", "%m5", "%m3", "%m1"}, stream("order=desc&author=@1"))
+	r.Equal([]string{"%m0", "%m2", "%m4"}, stream("author=@0&from=100&to=103"), "a chunk as large as the list")
+}
+
+// TestListQueryFilters the lists without a time, a reason or a state reject those filters instead of ignoring them
+func TestListQueryFilters(t *testing.T) {
+	r := require.New(t)
+	dir, err := ioutil.TempDir("", "list")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+
+	s := newTestService(t, dir, params.DefaultConfig(), &idleBackend{})
+	defer s.db.Close()
+	for i := 0; i < 5; i++ {
+		_, err = s.db.InsertUserProfile(fmt.Sprintf("@%d", i), fmt.Sprintf("name%d", i), "")
+		r.NoError(err)
+	}
+
+	for _, path := range []string{"/ssb/api/likes", "/ssb/api/set-like-info", "/ssb/api/node-info"} {
+		for _, filter := range []string{"from=1", "to=1", "reason=x", "state=x"} {
+			resp := serveAPI(t, s, http.MethodGet, path+"?"+filter, nil, nil)
+			r.Equal(rerr.ErrArgumentError.ErrorCode, resp.ErrorCode, "%s?%s", path, filter)
+		}
+	}
+
+	var names []string
+	query := "limit=2&order=desc"
+	for pages := 0; ; pages++ {
+		r.True(pages < 10, "cursor does not advance")
+		var page struct {
+			Items      []Name2ProfileReponse `json:"items"`
+			NextCursor string                `json:"next_cursor"`
+		}
+		resp := serveAPI(t, s, http.MethodGet, "/ssb/api/node-info?"+query, nil, &page)
+		r.Equal(SUCCESS, resp.ErrorCode, resp.ErrorMsg)
+		for _, p := range page.Items {
+			names = append(names, p.Name)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		query = "limit=2&order=desc&cursor=" + page.NextCursor
+	}
+	r.Equal([]string{"name4", "name3", "name2", "name1", "name0"}, names)
+}
@@ -0,0 +1,217 @@
+package restful
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	kitlog "go.mindeco.de/log"
+	"go.mindeco.de/log/level"
+
+	"go.cryptoscope.co/ssb/restful/params"
+	"go.cryptoscope.co/ssb/restful/rerr"
+)
+
+// logDefault the name of the level of the modules without their own one
+const logDefault = "default"
+
+// the modules of the services, see params.LogModules
+const (
+	logAPI        = "api"
+	logAnalysis   = "analysis"
+	logRewards    = "rewards"
+	logPhoton     = "photon"
+	logModeration = "moderation"
+	logDirectory  = "directory"
+	logBackend    = "backend"
+)
+
+// logLevels the level of each module, they can be changed while the services run
+type logLevels struct {
+	mu      sync.RWMutex
+	def     int
+	modules map[string]int
+}
+
+// levelRank the position of lvl in params.LogLevels, -1 if it is no level
+func levelRank(lvl string) int {
+	for i, l := range params.LogLevels {
+		if l == lvl {
+			return i
+		}
+	}
+	return -1
+}
+
+// newLogLevels the levels of cfg
+func newLogLevels(cfg params.LogConfig) (*logLevels, error) {
+	ll := &logLevels{modules: make(map[string]int)}
+	if err := ll.set(logDefault, cfg.Level); err != nil {
+		return nil, err
+	}
+	for module, lvl := range cfg.Modules {
+		if err := ll.set(module, lvl); err != nil {
+			return nil, err
+		}
+	}
+	return ll, nil
+}
+
+// set the level of module, or the level of the modules without their own one for logDefault
+func (ll *logLevels) set(module, lvl string) error {
+	rank := levelRank(lvl)
+	if rank < 0 {
+		return fmt.Errorf("log level %q is not one of %v", lvl, params.LogLevels)
+	}
+	ll.mu.Lock()
+	defer ll.mu.Unlock()
+	if module == logDefault {
+		ll.def = rank
+		return nil
+	}
+	for _, m := range params.LogModules {
+		if m == module {
+			ll.modules[module] = rank
+			return nil
+		}
+	}
+	return fmt.Errorf("log module %q is not one of %v", module, params.LogModules)
+}
+
+// allows whether an entry of module with lvl is logged
+func (ll *logLevels) allows(module string, lvl level.Value) bool {
+	ll.mu.RLock()
+	defer ll.mu.RUnlock()
+	min, ok := ll.modules[module]
+	if !ok {
+		min = ll.def
+	}
+	return levelRank(lvl.String()) >= min
+}
+
+// levels the level of every module and the default
+func (ll *logLevels) levels() map[string]string {
+	ll.mu.RLock()
+	defer ll.mu.RUnlock()
+	levels := map[string]string{logDefault: params.LogLevels[ll.def]}
+	for _, module := range params.LogModules {
+		rank, ok := ll.modules[module]
+		if !ok {
+			rank = ll.def
+		}
+		levels[module] = params.LogLevels[rank]
+	}
+	return levels
+}
+
+// moduleLogger drops the entries below the level of its module, entries without a level are always logged
+type moduleLogger struct {
+	next   kitlog.Logger
+	module string
+	levels *logLevels
+}
+
+func (ml moduleLogger) Log(keyvals ...interface{}) error {
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		if keyvals[i] != level.Key() {
+			continue
+		}
+		if lvl, ok := keyvals[i+1].(level.Value); ok && !ml.levels.allows(ml.module, lvl) {
+			return nil
+		}
+		break
+	}
+	return ml.next.Log(keyvals...)
+}
+
+// logger the logger of module, the entries carry the module and the pub
+func (s *Service) logger(module string) kitlog.Logger {
+	if s.log == nil || s.logLevels == nil {
+		return kitlog.NewNopLogger()
+	}
+	return moduleLogger{
+		next:   kitlog.With(s.log, "module", module),
+		module: module,
+		levels: s.logLevels,
+	}
+}
+
+// logResponseWriter keeps the APIResponse a handler wrote for the access log
+type logResponseWriter struct {
+	rest.ResponseWriter
+	resp *APIResponse
+}
+
+func (w *logResponseWriter) WriteJson(v interface{}) error {
+	if resp, ok := v.(*APIResponse); ok {
+		w.resp = resp
+	}
+	return w.ResponseWriter.WriteJson(v)
+}
+
+// AccessLogMiddleware logs every call of the api with the error of its APIResponse, failed calls as warnings
+type AccessLogMiddleware struct {
+	log     kitlog.Logger
+	proxies trustedProxies
+}
+
+// MiddlewareFunc implements rest.Middleware
+func (m *AccessLogMiddleware) MiddlewareFunc(h rest.HandlerFunc) rest.HandlerFunc {
+	return func(w rest.ResponseWriter, r *rest.Request) {
+		start := time.Now()
+		lw := &logResponseWriter{ResponseWriter: w}
+		h(lw, r)
+
+		logger := level.Debug(m.log)
+		kv := []interface{}{"event", "api call", "method", r.Method, "path", r.URL.Path, "ip", m.proxies.clientIP(r.Request), "took", time.Since(start)}
+		if lw.resp != nil {
+			kv = append(kv, "code", lw.resp.ErrorCode)
+			if lw.resp.ErrorCode != SUCCESS {
+				logger = level.Warn(m.log)
+				kv = append(kv, "err", lw.resp.ErrorMsg)
+			}
+		}
+		logger.Log(kv...)
+	}
+}
+
+// LogLevelReq changes the level of a module, of all modules without their own level for module "default"
+type LogLevelReq struct {
+	Module string `json:"module"`
+	Level  string `json:"level"`
+}
+
+// GetLogLevels the level of every module of the log and the default
+func (s *Service) GetLogLevels(w rest.ResponseWriter, r *rest.Request) {
+	var resp *APIResponse
+	defer func() {
+		writejson(w, resp)
+	}()
+	resp = NewAPIResponse(nil, s.logLevels.levels())
+}
+
+// SetLogLevel changes the level of a module while the pub runs, only from the host of the pub
+func (s *Service) SetLogLevel(w rest.ResponseWriter, r *rest.Request) {
+	var resp *APIResponse
+	defer func() {
+		writejson(w, resp)
+	}()
+	if clientPublicIP(r.Request, s.proxies) != "" {
+		resp = NewAPIResponse(rerr.ErrNotLocalRequest.Errorf("log levels are only changed from the host of the pub"), nil)
+		return
+	}
+	var req LogLevelReq
+	err := r.DecodeJsonPayload(&req)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = s.logLevels.set(req.Module, req.Level); err != nil {
+		resp = NewAPIResponse(rerr.ErrArgumentError.AppendError(err), nil)
+		return
+	}
+	level.Info(s.logger(logAPI)).Log("event", "log level changed", "log_module", req.Module, "log_level", req.Level)
+	resp = NewAPIResponse(nil, s.logLevels.levels())
+}
@@ -0,0 +1,144 @@
+package restful
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/stretchr/testify/require"
+	kitlog "go.mindeco.de/log"
+	"go.mindeco.de/log/level"
+
+	"go.cryptoscope.co/ssb/restful/params"
+	"go.cryptoscope.co/ssb/restful/rerr"
+)
+
+// recordLogger keeps the entries that were logged
+type recordLogger struct {
+	mu      sync.Mutex
+	entries []map[string]interface{}
+}
+
+func (rl *recordLogger) Log(keyvals ...interface{}) error {
+	entry := make(map[string]interface{})
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		if keyvals[i] == level.Key() {
+			entry["level"] = keyvals[i+1].(level.Value).String()
+			continue
+		}
+		entry[keyvals[i].(string)] = keyvals[i+1]
+	}
+	rl.mu.Lock()
+	rl.entries = append(rl.entries, entry)
+	rl.mu.Unlock()
+	return nil
+}
+
+func (rl *recordLogger) events() []string {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	var events []string
+	for _, e := range rl.entries {
+		events = append(events, e["module"].(string)+" "+e["level"].(string)+" "+e["event"].(string))
+	}
+	return events
+}
+
+func TestLogLevels(t *testing.T) {
+	r := require.New(t)
+
+	cfg := params.DefaultConfig()
+	cfg.Log.Level = "warn"
+	cfg.Log.Modules = map[string]string{logRewards: "debug"}
+	levels, err := newLogLevels(cfg.Log)
+	r.NoError(err)
+	rec := new(recordLogger)
+	s := &Service{cfg: cfg, pubID: testPubA, log: kitlog.With(rec, "pub", testPubA), logLevels: levels}
+
+	logAll := func() {
+		for _, module := range []string{logAPI, logRewards} {
+			level.Debug(s.logger(module)).Log("event", "d")
+			level.Info(s.logger(module)).Log("event", "i")
+			level.Error(s.logger(module)).Log("event", "e")
+		}
+	}
+	logAll()
+	r.Equal([]string{"api error e", "rewards debug d", "rewards info i", "rewards error e"}, rec.events())
+	r.Equal(testPubA, rec.entries[0]["pub"])
+
+	// the levels change while the services run
+	rec.entries = nil
+	r.NoError(levels.set(logAPI, "info"))
+	r.NoError(levels.set(logDefault, "error"))
+	r.NoError(levels.set(logRewards, "error"))
+	logAll()
+	r.Equal([]string{"api info i", "api error e", "rewards error e"}, rec.events())
+
+	r.Error(levels.set("nope", "info"))
+	r.Error(levels.set(logAPI, "verbose"))
+	r.Equal("info", levels.levels()[logAPI])
+	r.Equal("error", levels.levels()[logPhoton])
+	r.Equal("error", levels.levels()[logDefault])
+}
+
+// TestSetLogLevel only the host of the pub changes the levels, the calls are in the access log
+func TestSetLogLevel(t *testing.T) {
+	r := require.New(t)
+
+	levels, err := newLogLevels(params.DefaultConfig().Log)
+	r.NoError(err)
+	rec := new(recordLogger)
+	s := &Service{cfg: params.DefaultConfig(), log: rec, logLevels: levels}
+	// the pub is behind a proxy on its host
+	s.proxies, err = parseTrustedProxies(s.cfg.API.TrustedProxies)
+	r.NoError(err)
+
+	api := rest.NewApi()
+	api.Use(&AccessLogMiddleware{log: s.logger(logAPI), proxies: s.proxies})
+	router, err := rest.MakeRouter(
+		rest.Get("/ssb/api/log-levels", s.GetLogLevels),
+		rest.Post("/ssb/api/log-levels", s.SetLogLevel),
+	)
+	r.NoError(err)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	set := func(req LogLevelReq, forwardedFor string) *APIResponse {
+		body, err := json.Marshal(req)
+		r.NoError(err)
+		hr := httptest.NewRequest(http.MethodPost, "/ssb/api/log-levels", bytes.NewReader(body))
+		hr.Header.Set("Content-Type", "application/json")
+		hr.RemoteAddr = "127.0.0.1:34567"
+		if forwardedFor != "" {
+			hr.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, hr)
+		var resp APIResponse
+		r.NoError(json.Unmarshal(rw.Body.Bytes(), &resp))
+		return &resp
+	}
+
+	resp := set(LogLevelReq{Module: logPhoton, Level: "debug"}, "8.8.8.8")
+	r.Equal(rerr.ErrNotLocalRequest.ErrorCode, resp.ErrorCode)
+	r.Equal("info", levels.levels()[logPhoton])
+
+	resp = set(LogLevelReq{Module: logPhoton, Level: "verbose"}, "")
+	r.Equal(rerr.ErrArgumentError.ErrorCode, resp.ErrorCode)
+
+	resp = set(LogLevelReq{Module: logPhoton, Level: "debug"}, "")
+	r.Equal(SUCCESS, resp.ErrorCode, resp.ErrorMsg)
+	var got map[string]string
+	r.NoError(json.Unmarshal(resp.Data, &got))
+	r.Equal("debug", got[logPhoton])
+	r.Equal("info", got[logDefault])
+
+	// the rejected calls are warnings, the successful one is below the info level of the api
+	r.Equal([]string{"api warn api call", "api warn api call", "api info log level changed"}, rec.events())
+	r.Equal("/ssb/api/log-levels", rec.entries[0]["path"])
+	r.Equal(http.MethodPost, rec.entries[0]["method"])
+}
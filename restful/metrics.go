@@ -0,0 +1,224 @@
+package restful
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	kitprom "github.com/go-kit/kit/metrics/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"go.cryptoscope.co/ssb/restful/params"
+)
+
+// the states of a reward in metalife_rewards_total
+const (
+	// rewardQueued a payout of the reward started
+	rewardQueued = "queued"
+	// rewardSent the tokens were transferred
+	rewardSent = "sent"
+	// rewardDeferred the partner was offline, backPay sends it later
+	rewardDeferred = "deferred"
+	// rewardRejected the feed got its maximum of rewards for the day
+	rewardRejected = "rejected"
+	// rewardFailed the channel or the transfer failed
+	rewardFailed = "failed"
+)
+
+// the kinds of metalife_moderation_open_cases
+const (
+	moderationReport        = "report"
+	moderationSensitiveWord = "sensitive-word"
+)
+
+// serviceMetrics the prometheus metrics of one Service, each has its own registry so more than one can run in a process
+type serviceMetrics struct {
+	registry *prometheus.Registry
+
+	// analysisLag messages of the receive log the analysis is behind its head
+	analysisLag metrics.Gauge
+	// analysisSeq the sequence of the receive log the analysis reached
+	analysisSeq metrics.Gauge
+	// analyzedMessages by "type"
+	analyzedMessages metrics.Counter
+
+	// rewards by "reason" and "state"
+	rewards metrics.Counter
+	// rewardTokens the tokens that were sent by "reason" and "token"
+	rewardTokens metrics.Counter
+	// pendingPayouts the rewards and channel deals that are running
+	pendingPayouts metrics.Gauge
+
+	// photonLatency and photonErrors of the calls of the photon api by "endpoint"
+	photonLatency metrics.Histogram
+	photonErrors  metrics.Counter
+	// channelsBelowMin the channels under min_balance_inchannel in the last check, before they were topped up
+	channelsBelowMin metrics.Gauge
+
+	// moderationOpen the cases nobody dealt with yet by "kind"
+	moderationOpen metrics.Gauge
+}
+
+// newServiceMetrics the metrics of a Service, with the go and process collectors
+func newServiceMetrics() *serviceMetrics {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewGoCollector(), prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+
+	counter := func(name, help string, labels ...string) metrics.Counter {
+		cv := prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: "metalife", Name: name, Help: help}, labels)
+		reg.MustRegister(cv)
+		return kitprom.NewCounter(cv)
+	}
+	gauge := func(name, help string, labels ...string) metrics.Gauge {
+		gv := prometheus.NewGaugeVec(prometheus.GaugeOpts{Namespace: "metalife", Name: name, Help: help}, labels)
+		reg.MustRegister(gv)
+		return kitprom.NewGauge(gv)
+	}
+
+	photonLatency := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "metalife",
+		Name:      "photon_request_seconds",
+		Help:      "latency of the calls of the photon api",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"endpoint"})
+	reg.MustRegister(photonLatency)
+
+	return &serviceMetrics{
+		registry: reg,
+
+		analysisLag:      gauge("analysis_lag_messages", "messages of the receive log the analysis is behind its head"),
+		analysisSeq:      gauge("analysis_seq", "sequence of the receive log the analysis reached"),
+		analyzedMessages: counter("analyzed_messages_total", "messages the analysis read", "type"),
+
+		rewards:        counter("rewards_total", "rewards by reason and state: queued, sent, deferred, rejected or failed", "reason", "state"),
+		rewardTokens:   counter("reward_tokens_total", "tokens sent as rewards", "reason", "token"),
+		pendingPayouts: gauge("pending_payouts", "rewards and channel deals that are running"),
+
+		photonLatency:    kitprom.NewHistogram(photonLatency),
+		photonErrors:     counter("photon_request_errors_total", "failed calls of the photon api", "endpoint"),
+		channelsBelowMin: gauge("photon_channels_below_min", "channels under min_balance_inchannel in the last check"),
+
+		moderationOpen: gauge("moderation_open_cases", "reports and sensitive words nobody dealt with yet", "kind"),
+	}
+}
+
+// discardMetrics the metrics of a Service without a registry, nothing is recorded
+var discardMetrics = &serviceMetrics{
+	analysisLag:      discard.NewGauge(),
+	analysisSeq:      discard.NewGauge(),
+	analyzedMessages: discard.NewCounter(),
+	rewards:          discard.NewCounter(),
+	rewardTokens:     discard.NewCounter(),
+	pendingPayouts:   discard.NewGauge(),
+	photonLatency:    discard.NewHistogram(),
+	photonErrors:     discard.NewCounter(),
+	channelsBelowMin: discard.NewGauge(),
+	moderationOpen:   discard.NewGauge(),
+}
+
+// metrics of s, the discarded ones if it has none
+func (s *Service) metrics() *serviceMetrics {
+	if s.stats == nil {
+		return discardMetrics
+	}
+	return s.stats
+}
+
+// metricsHandler serves the metrics of s on /metrics and everything else with api
+func (s *Service) metricsHandler(api http.Handler) http.Handler {
+	if s.stats == nil || !s.cfg.API.Metrics {
+		return api
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(s.stats.registry, promhttp.HandlerOpts{}))
+	mux.Handle("/", api)
+	return mux
+}
+
+// the tokens of metalife_reward_tokens_total
+const (
+	tokenMLT = "mlt"
+	tokenSMT = "smt"
+)
+
+// countTokens the amount in wei of token that was sent for reason
+func (s *Service) countTokens(reason, token string, amount *big.Int) {
+	if amount == nil {
+		return
+	}
+	f, _ := new(big.Float).Quo(new(big.Float).SetInt(amount), big.NewFloat(params.Ether)).Float64()
+	s.metrics().rewardTokens.With("reason", reason, "token", token).Add(f)
+}
+
+// countReward one reward of reason in state
+func (s *Service) countReward(reason, state string) {
+	s.metrics().rewards.With("reason", reason, "state", state).Add(1)
+}
+
+// analyzedTypes the types of messages that are counted by their name, the others are "other"
+var analyzedTypes = map[string]bool{
+	"post":                true,
+	"vote":                true,
+	"about":               true,
+	"contact":             true,
+	PubMessageType:        true,
+	ModerationMessageType: true,
+}
+
+// countAnalyzed one message with content in the analysis
+func (s *Service) countAnalyzed(content json.RawMessage) {
+	typ := "other"
+	if len(content) > 0 && content[0] == '"' {
+		typ = "encrypted"
+	} else {
+		var ct struct {
+			Type string `json:"type"`
+		}
+		if json.Unmarshal(content, &ct) == nil && analyzedTypes[ct.Type] {
+			typ = ct.Type
+		}
+	}
+	s.metrics().analyzedMessages.With("type", typ).Add(1)
+}
+
+// receiveHead the sequence of the newest message of the receive log of the pub
+func (s *Service) receiveHead(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	st, err := s.backend.status(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return st.Root, nil
+}
+
+// analysisDone updates the metrics after an analysis round, head is the receive log head at its start or -1 if unknown
+func (s *Service) analysisDone(ctx context.Context, head int64) {
+	s.updateModerationMetrics()
+	if head < 0 {
+		return
+	}
+	s.analyzedSeq = head
+	s.metrics().analysisSeq.Set(float64(head))
+	if now, err := s.receiveHead(ctx); err == nil {
+		s.metrics().analysisLag.Set(float64(now - head))
+	}
+}
+
+// updateModerationMetrics counts the open cases in the database
+func (s *Service) updateModerationMetrics() {
+	if s.db == nil {
+		return
+	}
+	reports, sensitive, err := s.db.CountOpenModerationCases()
+	if err != nil {
+		return
+	}
+	s.metrics().moderationOpen.With("kind", moderationReport).Set(float64(reports))
+	s.metrics().moderationOpen.With("kind", moderationSensitiveWord).Set(float64(sensitive))
+}
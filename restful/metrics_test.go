@@ -0,0 +1,85 @@
+package restful
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"go.cryptoscope.co/ssb/restful/params"
+)
+
+// scrape the metrics s serves on /metrics
+func scrape(t *testing.T, h http.Handler) string {
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rw.Code)
+	body, err := ioutil.ReadAll(rw.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestMetrics(t *testing.T) {
+	r := require.New(t)
+
+	s := &Service{cfg: params.DefaultConfig(), stats: newServiceMetrics()}
+	api := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusTeapot) })
+	h := s.metricsHandler(api)
+
+	// the api still gets everything else
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/ssb/api/pub-whoami", nil))
+	r.Equal(http.StatusTeapot, rw.Code)
+
+	for _, content := range []string{`{"type":"vote"}`, `{"type":"post"}`, `{"type":"post"}`, `{"type":"xyz"}`, `"Ym94.box"`} {
+		s.countAnalyzed(json.RawMessage(content))
+	}
+	s.countReward(LikePost, rewardQueued)
+	s.countReward(LikePost, rewardSent)
+	s.countTokens(LikePost, tokenMLT, new(big.Int).Mul(big.NewInt(params.Ether), big.NewInt(2)))
+	s.countReward(SignUp, rewardDeferred)
+	s.metrics().analysisLag.Set(7)
+
+	// a failing call of the photon api
+	photon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		json.NewEncoder(w).Encode(APIResponse{ErrorCode: -1, ErrorMsg: "not online"})
+	}))
+	defer photon.Close()
+	node := &PhotonNode{Host: photon.URL, stats: s.metrics()}
+	_, err := node.invoke("node-status", &Req{FullURL: photon.URL, Method: http.MethodGet})
+	r.Error(err)
+
+	body := scrape(t, h)
+	for _, line := range []string{
+		`metalife_analyzed_messages_total{type="post"} 2`,
+		`metalife_analyzed_messages_total{type="vote"} 1`,
+		`metalife_analyzed_messages_total{type="other"} 1`,
+		`metalife_analyzed_messages_total{type="encrypted"} 1`,
+		`metalife_rewards_total{reason="` + LikePost + `",state="queued"} 1`,
+		`metalife_rewards_total{reason="` + LikePost + `",state="sent"} 1`,
+		`metalife_rewards_total{reason="` + SignUp + `",state="deferred"} 1`,
+		`metalife_reward_tokens_total{reason="` + LikePost + `",token="mlt"} 2`,
+		`metalife_analysis_lag_messages 7`,
+		`metalife_photon_request_errors_total{endpoint="node-status"} 1`,
+		`metalife_photon_request_seconds_count{endpoint="node-status"} 1`,
+	} {
+		r.Contains(body, line+"\n")
+	}
+	r.True(strings.Contains(body, "go_goroutines"), "the go collector is registered")
+
+	// a second service has its own registry
+	other := &Service{cfg: params.DefaultConfig(), stats: newServiceMetrics()}
+	r.NotContains(scrape(t, other.metricsHandler(api)), "metalife_rewards_total{")
+
+	// without metrics the api gets /metrics too and nothing is recorded
+	s.cfg.API.Metrics = false
+	rw = httptest.NewRecorder()
+	s.metricsHandler(api).ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	r.Equal(http.StatusTeapot, rw.Code)
+	(&Service{}).countReward(LikePost, rewardFailed)
+}
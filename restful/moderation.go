@@ -0,0 +1,127 @@
+package restful
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.mindeco.de/log/level"
+)
+
+// ModerationMessageType the type of the message a pub publishes after its administrator dealt with a report
+const ModerationMessageType = "metalife/moderation"
+
+const (
+	// ModerationDecisionBlock the report is true, the defendant was unfollowed and blocked
+	ModerationDecisionBlock = "block"
+	// ModerationDecisionDismiss the report is not clear, nothing was done
+	ModerationDecisionDismiss = "dismiss"
+)
+
+// ModerationReasonSensitiveWord reason category used for posts caught by the sensitive-words check
+const ModerationReasonSensitiveWord = "sensitive-word"
+
+// ContentModerationStru content of a 'metalife/moderation' message
+type ContentModerationStru struct {
+	Type       string `json:"type"`
+	Defendant  string `json:"defendant"`
+	MessageKey string `json:"messagekey"`
+	Reasons    string `json:"reasons"`
+	Decision   string `json:"decision"`
+	DealTime   int64  `json:"dealtime"`
+}
+
+// moderationDecision maps the dealtag of violationrecord/sensitivewordrecord to a published decision
+func moderationDecision(dealtag string) string {
+	switch dealtag {
+	case "1":
+		return ModerationDecisionBlock
+	case "2":
+		return ModerationDecisionDismiss
+	}
+	return ""
+}
+
+// IsTrustedModerationPub whether the decisions of this feed are imported into our review queue
+func (s *Service) IsTrustedModerationPub(feed string) bool {
+	if feed == s.pubID {
+		return false
+	}
+	for _, trusted := range s.cfg.Moderation.TrustedPubs {
+		if trusted == feed {
+			return true
+		}
+	}
+	return false
+}
+
+// publishModeration let other metalife pubs know about a decision of our administrator
+func (s *Service) publishModeration(ctx context.Context, defendant, messagekey, reasons, dealtag string, dealtime int64) (err error) {
+	if !s.cfg.Moderation.Publish {
+		return
+	}
+	decision := moderationDecision(dealtag)
+	if decision == "" {
+		return
+	}
+	arg := &ContentModerationStru{
+		Type:       ModerationMessageType,
+		Defendant:  defendant,
+		MessageKey: messagekey,
+		Reasons:    reasons,
+		Decision:   decision,
+		DealTime:   dealtime,
+	}
+	_, err = s.backend.publish(ctx, arg)
+	if err != nil {
+		return fmt.Errorf("publish moderation call failed: %w", err)
+	}
+	return
+}
+
+// importModeration puts a decision published by a trusted pub into the review queue of violationrecord,
+// the trusted pub is recorded as plaintiff. With moderation.auto_apply, block decisions are dealt with at once.
+func (s *Service) importModeration(ctx context.Context, author string, content json.RawMessage) {
+	if !s.IsTrustedModerationPub(author) {
+		return
+	}
+	cms := ContentModerationStru{}
+	err := json.Unmarshal(content, &cms)
+	if err != nil || cms.Type != ModerationMessageType {
+		return
+	}
+	if cms.Defendant == "" || cms.Defendant == s.pubID {
+		return
+	}
+	if cms.Decision != ModerationDecisionBlock {
+		// a dismissed report at another pub is no reason to review the feed here
+		return
+	}
+
+	var recordtime = time.Now().UnixNano() / 1e6
+	lstid, err := s.db.InsertViolation(recordtime, author, cms.Defendant, cms.MessageKey, cms.Reasons)
+	if err != nil {
+		level.Error(s.logger(logModeration)).Log("event", "import decision failed", "feed", author, "defendant", cms.Defendant, "err", err)
+		return
+	}
+	if lstid == -1 {
+		return
+	}
+	level.Info(s.logger(logModeration)).Log("event", "decision imported", "feed", author, "defendant", cms.Defendant, "msgkey", cms.MessageKey, "decision", cms.Decision)
+
+	if !s.cfg.Moderation.AutoApply {
+		return
+	}
+	_, err = s.db.UpdateViolation("1", recordtime, "", author, cms.Defendant, cms.MessageKey)
+	if err != nil {
+		level.Error(s.logger(logModeration)).Log("event", "auto apply failed", "feed", author, "defendant", cms.Defendant, "err", err)
+		return
+	}
+	err = s.contactSomeone(ctx, cms.Defendant, true, true)
+	if err != nil {
+		level.Error(s.logger(logModeration)).Log("event", "unfollow and block failed", "defendant", cms.Defendant, "err", err)
+		return
+	}
+	level.Info(s.logger(logModeration)).Log("event", "decision applied", "feed", author, "defendant", cms.Defendant)
+}
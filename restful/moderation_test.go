@@ -0,0 +1,269 @@
+package restful
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"go.cryptoscope.co/ssb/dfa"
+	"go.cryptoscope.co/ssb/restful/params"
+)
+
+const testDefendant = "@DDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDD=.ed25519"
+
+// publishingBackend keeps the contents the service publishes
+type publishingBackend struct {
+	idleBackend
+
+	mu        sync.Mutex
+	published []map[string]interface{}
+}
+
+func (b *publishingBackend) publish(ctx context.Context, content interface{}) (string, error) {
+	raw, err := json.Marshal(content)
+	if err != nil {
+		return "", err
+	}
+	var c map[string]interface{}
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return "", err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.published = append(b.published, c)
+	return fmt.Sprintf("%%published%d.sha256", len(b.published)), nil
+}
+
+// ofType the published contents of type typ
+func (b *publishingBackend) ofType(typ string) []map[string]interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var cs []map[string]interface{}
+	for _, c := range b.published {
+		if c["type"] == typ {
+			cs = append(cs, c)
+		}
+	}
+	return cs
+}
+
+// newTestService a service of testPubA with a fresh database in dir, without the api server
+func newTestService(t *testing.T, dir string, cfg *params.Config, backend ssbBackend) *Service {
+	db, err := OpenPubDB(filepath.Join(dir, "pubdata"), testPubA)
+	require.NoError(t, err)
+	return &Service{
+		cfg:         cfg,
+		pubID:       testPubA,
+		backend:     backend,
+		db:          db,
+		dfa:         dfa.New(),
+		pubs:        newPubDirectory(cfg),
+		analyzedSeq: -1,
+	}
+}
+
+// serveAPI one request to the api of s, the data of the APIResponse is decoded into data
+func serveAPI(t *testing.T, s *Service, method, path string, body interface{}, data interface{}) *APIResponse {
+	r := require.New(t)
+	server, err := s.newAPIServer()
+	r.NoError(err)
+	var rd io.Reader = http.NoBody
+	if body != nil {
+		b, err := json.Marshal(body)
+		r.NoError(err)
+		rd = bytes.NewReader(b)
+	}
+	req := httptest.NewRequest(method, path, rd)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	server.Handler.ServeHTTP(rec, req)
+	r.Equal(http.StatusOK, rec.Code, rec.Body.String())
+
+	var resp APIResponse
+	r.NoError(json.Unmarshal(rec.Body.Bytes(), &resp))
+	if data != nil && resp.Data != nil {
+		r.NoError(json.Unmarshal(resp.Data, data))
+	}
+	return &resp
+}
+
+// sliceSource the messages of a log stream, as the backend would send them
+type sliceSource struct {
+	msgs [][]byte
+	i    int
+}
+
+func (src *sliceSource) Next(context.Context) bool {
+	if src.i >= len(src.msgs) {
+		return false
+	}
+	src.i++
+	return true
+}
+
+func (src *sliceSource) Reader(fn func(io.Reader) error) error {
+	return fn(bytes.NewReader(src.msgs[src.i-1]))
+}
+
+func (src *sliceSource) Err() error { return nil }
+
+// testMessage a message of author with content in the json the backends send
+func testMessage(t *testing.T, key, author string, seq int64, timestamp float64, content interface{}) []byte {
+	c, err := json.Marshal(content)
+	require.NoError(t, err)
+	msg, err := json.Marshal(map[string]interface{}{
+		"key": key,
+		"value": map[string]interface{}{
+			"author":    author,
+			"sequence":  seq,
+			"timestamp": timestamp,
+			"content":   json.RawMessage(c),
+		},
+		"timestamp": timestamp,
+	})
+	require.NoError(t, err)
+	return msg
+}
+
+// TestPublishModerationDecision the decisions of the administrator on reports and sensitive words are published, dismissed or not
+func TestPublishModerationDecision(t *testing.T) {
+	r := require.New(t)
+	dir, err := ioutil.TempDir("", "moderation")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+
+	backend := &publishingBackend{}
+	s := newTestService(t, dir, params.DefaultConfig(), backend)
+	defer s.db.Close()
+
+	report := TippedOffStu{Plaintiff: testPubB, Defendant: testDefendant, MessageKey: "%bad.sha256", Reasons: "spam"}
+	resp := serveAPI(t, s, http.MethodPost, "/ssb/api/tipped-who-off", report, nil)
+	r.Equal(SUCCESS, resp.ErrorCode, resp.ErrorMsg)
+
+	report.DealTag = "1"
+	resp = serveAPI(t, s, http.MethodPost, "/ssb/api/tippedoff-deal", report, nil)
+	r.Equal(SUCCESS, resp.ErrorCode, resp.ErrorMsg)
+
+	decisions := backend.ofType(ModerationMessageType)
+	r.Len(decisions, 1)
+	r.Equal(testDefendant, decisions[0]["defendant"])
+	r.Equal("%bad.sha256", decisions[0]["messagekey"])
+	r.Equal("spam", decisions[0]["reasons"])
+	r.Equal(ModerationDecisionBlock, decisions[0]["decision"])
+	contacts := backend.ofType("contact")
+	r.Len(contacts, 1)
+	r.Equal(testDefendant, contacts[0]["contact"])
+	r.Equal(true, contacts[0]["blocking"])
+
+	_, err = s.db.InsertSensitiveWordRecord(s.pubID, 1, "bad words", "%words.sha256", testDefendant, "0")
+	r.NoError(err)
+	deal := EventSensitive{MessageKey: "%words.sha256", MessageAuthor: testDefendant, DealTag: "2"}
+	resp = serveAPI(t, s, http.MethodPost, "/ssb/api/sensitive-word-deal", deal, nil)
+	r.Equal(SUCCESS, resp.ErrorCode, resp.ErrorMsg)
+
+	decisions = backend.ofType(ModerationMessageType)
+	r.Len(decisions, 2)
+	r.Equal("%words.sha256", decisions[1]["messagekey"])
+	r.Equal(ModerationReasonSensitiveWord, decisions[1]["reasons"])
+	r.Equal(ModerationDecisionDismiss, decisions[1]["decision"])
+	r.Len(backend.ofType("contact"), 1, "a dismissed case blocks nobody")
+
+	// without moderation.publish the decisions stay on this pub
+	s.cfg.Moderation.Publish = false
+	report.MessageKey = "%other.sha256"
+	_, err = s.db.InsertViolation(1, report.Plaintiff, report.Defendant, report.MessageKey, report.Reasons)
+	r.NoError(err)
+	resp = serveAPI(t, s, http.MethodPost, "/ssb/api/tippedoff-deal", report, nil)
+	r.Equal(SUCCESS, resp.ErrorCode, resp.ErrorMsg)
+	r.Len(backend.ofType(ModerationMessageType), 2)
+}
+
+// TestImportModerationDecision the block decisions of trusted pubs end up in the review queue, the others are left out
+func TestImportModerationDecision(t *testing.T) {
+	r := require.New(t)
+	dir, err := ioutil.TempDir("", "moderation")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+
+	cfg := params.DefaultConfig()
+	cfg.Moderation.TrustedPubs = []string{testPubB}
+	backend := &publishingBackend{}
+	s := newTestService(t, dir, cfg, backend)
+	defer s.db.Close()
+
+	decision := func(defendant, msgkey, dec string) ContentModerationStru {
+		return ContentModerationStru{Type: ModerationMessageType, Defendant: defendant, MessageKey: msgkey, Reasons: "spam", Decision: dec}
+	}
+	src := &sliceSource{msgs: [][]byte{
+		testMessage(t, "%m1.sha256", testPubB, 1, 1000, decision(testDefendant, "%bad.sha256", ModerationDecisionBlock)),
+		testMessage(t, "%m2.sha256", testPubB, 2, 1001, decision(testDefendant, "%fine.sha256", ModerationDecisionDismiss)),
+		testMessage(t, "%m3.sha256", testPubC, 1, 1002, decision(testDefendant, "%untrusted.sha256", ModerationDecisionBlock)),
+		testMessage(t, "%m4.sha256", testPubB, 3, 1003, decision(testPubA, "%ours.sha256", ModerationDecisionBlock)),
+	}}
+	_, _, err = s.SsbMessageAnalysis(context.Background(), src)
+	r.NoError(err)
+
+	var queue []*TippedOffStu
+	resp := serveAPI(t, s, http.MethodPost, "/ssb/api/tippedoff-info", TippedOffStu{}, &queue)
+	r.Equal(SUCCESS, resp.ErrorCode, resp.ErrorMsg)
+	r.Len(queue, 1)
+	r.Equal(testPubB, queue[0].Plaintiff, "the trusted pub is the plaintiff")
+	r.Equal(testDefendant, queue[0].Defendant)
+	r.Equal("%bad.sha256", queue[0].MessageKey)
+	r.Equal("0", queue[0].DealTag, "waits for the administrator")
+	r.Empty(backend.published)
+
+	// the administrator confirms it, the imported decision is not published again
+	imported := *queue[0]
+	imported.DealTag = "1"
+	resp = serveAPI(t, s, http.MethodPost, "/ssb/api/tippedoff-deal", imported, nil)
+	r.Equal(SUCCESS, resp.ErrorCode, resp.ErrorMsg)
+	r.Len(backend.ofType("contact"), 1)
+	r.Empty(backend.ofType(ModerationMessageType))
+}
+
+// TestAutoApplyModerationDecision with moderation.auto_apply the imported block decisions are dealt with at once
+func TestAutoApplyModerationDecision(t *testing.T) {
+	r := require.New(t)
+	dir, err := ioutil.TempDir("", "moderation")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+
+	cfg := params.DefaultConfig()
+	cfg.Moderation.TrustedPubs = []string{testPubB}
+	cfg.Moderation.AutoApply = true
+	backend := &publishingBackend{}
+	s := newTestService(t, dir, cfg, backend)
+	defer s.db.Close()
+
+	src := &sliceSource{msgs: [][]byte{
+		testMessage(t, "%m1.sha256", testPubB, 1, 1000, ContentModerationStru{
+			Type: ModerationMessageType, Defendant: testDefendant, MessageKey: "%bad.sha256", Reasons: "spam", Decision: ModerationDecisionBlock,
+		}),
+	}}
+	_, _, err = s.SsbMessageAnalysis(context.Background(), src)
+	r.NoError(err)
+
+	var queue []*TippedOffStu
+	resp := serveAPI(t, s, http.MethodPost, "/ssb/api/tippedoff-info", TippedOffStu{Defendant: testDefendant}, &queue)
+	r.Equal(SUCCESS, resp.ErrorCode, resp.ErrorMsg)
+	r.Len(queue, 1)
+	r.Equal("1", queue[0].DealTag)
+
+	contacts := backend.ofType("contact")
+	r.Len(contacts, 1)
+	r.Equal(testDefendant, contacts[0]["contact"])
+	r.Equal(true, contacts[0]["blocking"])
+	r.Empty(backend.ofType(ModerationMessageType), "imported decisions are not published again")
+}
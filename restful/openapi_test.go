@@ -0,0 +1,130 @@
+package restful
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/ssb/restful/params"
+)
+
+type openAPISpec struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+func loadOpenAPISpec(t *testing.T) *openAPISpec {
+	b, err := ioutil.ReadFile("openapi.json")
+	require.NoError(t, err)
+	var spec openAPISpec
+	require.NoError(t, json.Unmarshal(b, &spec))
+	return &spec
+}
+
+// TestOpenAPIRoutes every route of the router is in the spec and the other way round
+func TestOpenAPIRoutes(t *testing.T) {
+	spec := loadOpenAPISpec(t)
+
+	var inSpec, inRouter []string
+	for path, methods := range spec.Paths {
+		for method := range methods {
+			inSpec = append(inSpec, strings.ToUpper(method)+" "+path)
+		}
+	}
+	for _, route := range (&Service{}).apiRoutes() {
+		inRouter = append(inRouter, route.HttpMethod+" "+route.PathExp)
+	}
+	sort.Strings(inSpec)
+	sort.Strings(inRouter)
+	require.Equal(t, inRouter, inSpec)
+}
+
+// jsonFields the json names of the exported fields of a struct, duplicates fail the test
+func jsonFields(t *testing.T, v interface{}) []string {
+	typ := reflect.TypeOf(v)
+	seen := make(map[string]string)
+	var names []string
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if other, dup := seen[name]; dup {
+			t.Errorf("%s: json name %q of %s is used by %s too", typ, name, f.Name, other)
+		}
+		seen[name] = f.Name
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TestOpenAPISchemas the schemas of the spec have the json fields of the types the handlers read and write
+func TestOpenAPISchemas(t *testing.T) {
+	spec := loadOpenAPISpec(t)
+
+	dtos := map[string]interface{}{
+		"APIResponse":         APIResponse{},
+		"Whoami":              Whoami{},
+		"NodeProfile":         Name2ProfileReponse{},
+		"LikeSum":             LasterNumLikes{},
+		"TippedOff":           TippedOffStu{},
+		"SensitiveWordEvent":  EventSensitive{},
+		"UserTaskRequest":     ReqUserTask{},
+		"UserTask":            UserTasks{},
+		"LoginNotification":   ReqUserLoginApp{},
+		"NFTNotification":     ReqCreatedNFT{},
+		"RewardRequest":       RewardingReq{},
+		"RewardResult":        RewardResult{},
+		"RewardSum":           RewardSum{},
+		"PubInfoByIP":         PubInfoByIP{},
+		"PubCandidate":        PubCandidate{},
+		"PubInfo":             PubInfo{},
+		"PubStatus":           PubStatus{},
+		"RateLimitCounter":    RateLimitCounter{},
+		"LogLevelRequest":     LogLevelReq{},
+		"UserDashboard":       UserDashboard{},
+		"DailyActivity":       DailyActivity{},
+		"DashboardReward":     DashboardReward{},
+		"DashboardModeration": DashboardModeration{},
+		"ModerationCounts":    ModerationCounts{},
+		"NodeProfilePage":     ListPage{},
+		"LikeSumPage":         ListPage{},
+		"TippedOffPage":       ListPage{},
+		"RewardResultPage":    ListPage{},
+		"SearchPage":          SearchPage{},
+		"Message":             DeserializedMessageStu{},
+		"MessageValue":        MessageValue{},
+	}
+	for name, schema := range spec.Components.Schemas {
+		dto, ok := dtos[name]
+		if !ok {
+			t.Errorf("schema %s has no go type in this test", name)
+			continue
+		}
+		var props []string
+		for prop := range schema.Properties {
+			props = append(props, prop)
+		}
+		sort.Strings(props)
+		require.Equal(t, jsonFields(t, dto), props, "schema %s", name)
+	}
+
+	// types that are not part of the api yet
+	jsonFields(t, params.LasterNumLikes{})
+}
@@ -1,28 +1,24 @@
 package params
 
-import "time"
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
-type ApiConfig struct {
-	Host  string
-	Port  int
-	Debug bool
-}
+	"github.com/BurntSushi/toml"
+	refs "go.mindeco.de/ssb-refs"
+)
 
 type LasterNumLikes struct {
 	ClientID         string `json:"client_id"`
 	ClientAddress    string `json:"client_address"`
 	LasterAddVoteNum int64  `json:"laster_add_vote_num"`
 	LasterVoteNum    int64  `json:"laster_vote_num"`
-	VoteLink         string `json:"laster_add_vote_num"`
-}
-
-func NewApiServeConfig() *ApiConfig {
-	return &ApiConfig{
-		"0.0.0.0",
-		ServePort,
-		true,
-	}
-
+	VoteLink         string `json:"vote_link"`
 }
 
 //var PubTcpHostAddress = "106.52.171.12:8008"
@@ -45,68 +41,431 @@ const (
 	Douglas  = 1e42
 )
 
-var PhotonHost = "127.0.0.1:11001"
+// Duration a time.Duration that is written as "90s" or "10m" in the config file
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (d *Duration) UnmarshalText(text []byte) (err error) {
+	d.Duration, err = time.ParseDuration(string(text))
+	return err
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// Config everything a metalife pub service is configured with, the sections are the tables of the toml file.
+// It is passed to the services explicitly, two services with their own Config can run in one process.
+type Config struct {
+	Pub         PubConfig                `toml:"pub"`
+	API         APIConfig                `toml:"api"`
+	Photon      PhotonConfig             `toml:"photon"`
+	Analysis    AnalysisConfig           `toml:"analysis"`
+	Rewards     RewardConfig             `toml:"rewards"`
+	Moderation  ModerationConfig         `toml:"moderation"`
+	Attestation AttestationConfig        `toml:"attestation"`
+	Directory   DirectoryConfig          `toml:"directory"`
+	Log         LogConfig                `toml:"log"`
+	RateLimit   map[string]RateLimitRule `toml:"rate_limit"`
+	Invites     []InviteConfig           `toml:"invites"`
+}
+
+// PubConfig the ssb pub the services work on and where they keep their data
+type PubConfig struct {
+	// Addr tcp address of the pub, Key the secret the services connect with
+	Addr      string `toml:"addr"`
+	Key       string `toml:"key"`
+	RemoteKey string `toml:"remote_key"`
+	SHSCap    string `toml:"shscap"`
+	UnixSock  string `toml:"unixsock"`
+	// DataDir the analysis database
+	DataDir string `toml:"datadir"`
+	// EthAddress ethereum address the pub is bound to for rewards
+	EthAddress string `toml:"eth_address"`
+}
+
+// APIConfig the restful api
+type APIConfig struct {
+	Host            string   `toml:"host"`
+	Port            int      `toml:"port"`
+	Debug           bool     `toml:"debug"`
+	ShutdownTimeout Duration `toml:"shutdown_timeout"`
+	// Metrics serves the prometheus metrics of the services on /metrics
+	Metrics bool `toml:"metrics"`
+	// TrustedProxies ips or cidrs of the reverse proxies in front of the api,
+	// the X-Forwarded-For and X-Real-Ip headers of other callers are ignored
+	TrustedProxies []string `toml:"trusted_proxies"`
+}
+
+// PhotonConfig the photon node the pub pays rewards with
+type PhotonConfig struct {
+	Host                 string   `toml:"host"`
+	TokenAddress         string   `toml:"token_address"`
+	SettleTimeout        int      `toml:"settle_timeout"`
+	MinBalanceInchannel  int      `toml:"min_balance_inchannel"`
+	CheckChannelInterval Duration `toml:"check_channel_interval"`
+	BackPayInterval      Duration `toml:"back_pay_interval"`
+}
+
+// AnalysisConfig the scan of the messages of the pub
+type AnalysisConfig struct {
+	MessageScanInterval Duration `toml:"message_scan_interval"`
+	SensitiveWordsFile  string   `toml:"sensitive_words_file"`
+	IP2LocationDB       string   `toml:"ip2location_db"`
+}
+
+// RewardConfig the rewards of the user tasks (unit: 1e15 wei), the limits per day and for sign up
+type RewardConfig struct {
+	ReportProblematicPost int `toml:"report_problematic_post"`
+	Signup                int `toml:"signup"`
+	SignupSMT             int `toml:"signup_smt"`
+	DailyLogin            int `toml:"daily_login"`
+	PostMessage           int `toml:"post_message"`
+	PostComment           int `toml:"post_comment"`
+	MintNft               int `toml:"mint_nft"`
+	LikePost              int `toml:"like_post"`
+	MaxDaily              int `toml:"max_daily"`
+	MaxSignup             int `toml:"max_signup"`
+}
+
+// ModerationConfig how decisions on reports are shared with other pubs
+type ModerationConfig struct {
+	// Publish 'metalife/moderation' messages when the administrator deals with a report
+	Publish bool `toml:"publish"`
+	// TrustedPubs feed ids of other metalife pubs whose decisions are imported
+	TrustedPubs []string `toml:"trusted_pubs"`
+	// AutoApply apply imported block decisions without the review of the administrator
+	AutoApply bool `toml:"auto_apply"`
+}
+
+// AttestationConfig the routes whose requests must be signed by the key of the client_id feed
+type AttestationConfig struct {
+	// Required reject unsigned requests, disable it only while old clients are phased out
+	Required bool `toml:"required"`
+	// Window how far the timestamp of a signed request may be off, a signature is only accepted once within it
+	Window Duration `toml:"window"`
+	Routes []string `toml:"routes"`
+}
+
+// DirectoryConfig how get-pubhost-by-ip ranks the pubs of the invites and the pubs that announced themselves
+type DirectoryConfig struct {
+	// Candidates how many ranked pubs are returned if the client does not ask for a number
+	Candidates int `toml:"candidates"`
+	// Capacity how many peers this pub serves, 0 is unlimited
+	Capacity int `toml:"capacity"`
+	// ProbeInterval how often the load and the liveness of the pubs are checked, ProbeTimeout how long one check may take
+	ProbeInterval Duration `toml:"probe_interval"`
+	ProbeTimeout  Duration `toml:"probe_timeout"`
+	// LoadPenaltyKm a full pub ranks like one that is this much farther away
+	LoadPenaltyKm float64 `toml:"load_penalty_km"`
+	// Announcements add the pubs of the signed 'pub' messages in the log to the directory
+	Announcements bool `toml:"announcements"`
+	// TrustedAnnouncers the feeds whose 'pub' messages are added, the announcements of other feeds are ignored
+	TrustedAnnouncers []string `toml:"trusted_announcers"`
+	// MaxAnnounced how many announced pubs the directory keeps at most, later announcements of new feeds are ignored
+	MaxAnnounced int `toml:"max_announced"`
+}
+
+// LogModules the parts of the services that log with their own level
+var LogModules = []string{"api", "analysis", "rewards", "photon", "moderation", "directory", "backend"}
 
-var PhotonAddress = ""
+// LogLevels from the most to the least verbose
+var LogLevels = []string{"debug", "info", "warn", "error"}
 
-var TokenAddress = "0xA27F8f580C01Db0682Ce185209FFb84121a2F711"
+// LogConfig the levels of the log of the services, the modules without a level use Level.
+// They can be changed while the pub runs, see /ssb/api/log-levels.
+type LogConfig struct {
+	Level   string            `toml:"level"`
+	Modules map[string]string `toml:"modules"`
+}
 
-var SMTTokenAddress = "0x6601F810eaF2fa749EEa10533Fd4CC23B8C791dc"
+// InviteConfig a pub the clients are sent to by get-pubhost-by-ip.
+// Clients from one of Countries (long names of the IP2Location database) are in the region of the pub,
+// the others are ranked by their distance to the location of the host.
+type InviteConfig struct {
+	Code      string   `toml:"code"`
+	Countries []string `toml:"countries"`
+	// Capacity how many peers the pub serves, 0 is unknown
+	Capacity int `toml:"capacity"`
+	// API base url of the restful api of the pub, its pub-status is the load, without it the pub is only dialed
+	API string `toml:"api"`
+}
 
-var SettleTime = 40000
+// Host the address of the pub of the invite code
+func (ic InviteConfig) Host() string {
+	return strings.Split(ic.Code, ":")[0]
+}
 
-var ServePort = 10008
+// Port the ssb port of the pub of the invite code
+func (ic InviteConfig) Port() string {
+	parts := strings.SplitN(ic.Code, ":", 3)
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
 
-// MsgScanInterval 消息二轮扫描的时间间隔
-var MsgScanInterval = time.Second * 15
+// Feed the feed of the pub of the invite code, "" if the code has none
+func (ic InviteConfig) Feed() string {
+	parts := strings.SplitN(ic.Code, ":", 3)
+	if len(parts) < 3 {
+		return ""
+	}
+	return strings.Split(parts[2], "~")[0]
+}
 
-// minBalanceInchannel pub与客户端通道的最小资金，保障三方转账余额足够
-var MinBalanceInchannel = 100
+// DefaultConfig the configuration a pub runs with if nothing is set, the files are in ~/.ssb-go
+func DefaultConfig() *Config {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "."
+	}
+	ssbDir := filepath.Join(home, ".ssb-go")
+	return &Config{
+		Pub: PubConfig{
+			Addr:    PubTcpHostAddress,
+			Key:     filepath.Join(ssbDir, "secret"),
+			SHSCap:  "1KHLiKZvAvjbY1ziZEHMXawbCEIM6qwjCDm3VYRan/s=",
+			DataDir: filepath.Join(ssbDir, "pubdata"),
+		},
+		API: APIConfig{
+			Host:            "0.0.0.0",
+			Port:            10008,
+			Debug:           true,
+			ShutdownTimeout: Duration{30 * time.Second},
+			Metrics:         true,
+			TrustedProxies:  []string{"127.0.0.1", "::1"},
+		},
+		Photon: PhotonConfig{
+			Host:                 "127.0.0.1:11001",
+			TokenAddress:         "0x6601F810eaF2fa749EEa10533Fd4CC23B8C791dc",
+			SettleTimeout:        40000,
+			MinBalanceInchannel:  1,
+			CheckChannelInterval: Duration{120 * time.Minute},
+			BackPayInterval:      Duration{10 * time.Minute},
+		},
+		Analysis: AnalysisConfig{
+			MessageScanInterval: Duration{60 * time.Second},
+			SensitiveWordsFile:  filepath.Join(ssbDir, "sensitive.txt"),
+			IP2LocationDB:       filepath.Join(ssbDir, "IP2LOCATION-LITE-DB11.IPV6.BIN"),
+		},
+		Rewards: RewardConfig{
+			ReportProblematicPost: 0,
+			Signup:                0,
+			SignupSMT:             0,
+			DailyLogin:            10,
+			PostMessage:           5,
+			PostComment:           2,
+			MintNft:               10,
+			LikePost:              1,
+			MaxDaily:              500,
+			MaxSignup:             601,
+		},
+		Moderation: ModerationConfig{
+			Publish: true,
+		},
+		Attestation: AttestationConfig{
+			Required: true,
+			Window:   Duration{5 * time.Minute},
+			Routes: []string{
+				"/ssb/api/notify-login",
+				"/ssb/api/notify-created-nft",
+			},
+		},
+		Directory: DirectoryConfig{
+			Candidates:    2,
+			ProbeInterval: Duration{time.Minute},
+			ProbeTimeout:  Duration{5 * time.Second},
+			LoadPenaltyKm: 2000,
+			Announcements: true,
+			MaxAnnounced:  100,
+		},
+		Log: LogConfig{
+			Level: "info",
+		},
+		RateLimit: DefaultRateLimitRules(),
+		Invites: []InviteConfig{
+			{Code: "106.52.171.12:8008:@1qF7giAqTYBuAUbFsO13ezRy1WhKvwcX23II65jwxUc=.ed25519~bZ/KKsdDMq+FdcjePXEBaRG81BP4mVnO2NfSLOkg46g=", Countries: []string{"China"}},
+			{Code: "13.213.41.31:8008:@HZnU6wM+F17J0RSLXP05x3Lag2jGv3F3LzHMjh72coE=.ed25519~S0gwfIeutgCK6zsbQDXqEP0FxiitAIlzZeK7QDSYk40="},
+		},
+	}
+}
 
-// PubID this
-var PubID = ""
+// LoadConfigFile reads the toml file at path over the defaults, keys the schema does not know are an error
+func LoadConfigFile(path string) (*Config, error) {
+	cfg := DefaultConfig()
+	// the tables in the file replace the defaults
+	cfg.RateLimit = nil
+	cfg.Invites = nil
+	md, err := toml.DecodeFile(path, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		var keys []string
+		for _, k := range undecoded {
+			keys = append(keys, k.String())
+		}
+		return nil, fmt.Errorf("config %s: unknown keys %s", path, strings.Join(keys, ", "))
+	}
+	if !md.IsDefined("rate_limit") {
+		cfg.RateLimit = DefaultRateLimitRules()
+	}
+	if !md.IsDefined("invites") {
+		cfg.Invites = DefaultConfig().Invites
+	}
+	return cfg, nil
+}
 
-// RewardOfReportProblematicPost default 100
-var RewardOfReportProblematicPost = 100
+// LoadRewardPolicy a candidate reward policy, the [rewards] table of a toml file like the one of the config.
+// The keys it leaves out keep their value of base.
+func LoadRewardPolicy(path string, base RewardConfig) (RewardConfig, error) {
+	policy := struct {
+		Rewards RewardConfig `toml:"rewards"`
+	}{base}
+	md, err := toml.DecodeFile(path, &policy)
+	if err != nil {
+		return base, fmt.Errorf("reward policy %s: %w", path, err)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		var keys []string
+		for _, k := range undecoded {
+			keys = append(keys, k.String())
+		}
+		return base, fmt.Errorf("reward policy %s: unknown keys %s", path, strings.Join(keys, ", "))
+	}
+	rc := policy.Rewards
+	for name, v := range map[string]int{
+		"report_problematic_post": rc.ReportProblematicPost,
+		"signup":                  rc.Signup,
+		"signup_smt":              rc.SignupSMT,
+		"daily_login":             rc.DailyLogin,
+		"post_message":            rc.PostMessage,
+		"post_comment":            rc.PostComment,
+		"mint_nft":                rc.MintNft,
+		"like_post":               rc.LikePost,
+		"max_daily":               rc.MaxDaily,
+		"max_signup":              rc.MaxSignup,
+	} {
+		if v < 0 {
+			return base, fmt.Errorf("reward policy %s: rewards.%s %d error", path, name, v)
+		}
+	}
+	return rc, nil
+}
 
-// RewardOfSignup
-var RewardOfSignup = 300
+// Validate checks the values of the config, all problems are reported at once
+func (c *Config) Validate() error {
+	var errs []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Sprintf(format, args...))
+		}
+	}
+	isHostPort := func(s string) bool {
+		_, _, err := net.SplitHostPort(s)
+		return err == nil
+	}
+	isEthAddress := func(s string) bool {
+		return len(s) == 42 && s[0:2] == "0x"
+	}
 
-// RewardOfSignupSMT
-var RewardOfSignupSMT = 10
+	check(c.Pub.UnixSock != "" || isHostPort(c.Pub.Addr), "pub.addr %q is not host:port", c.Pub.Addr)
+	check(c.Pub.Key != "", "pub.key must be set")
+	check(c.Pub.DataDir != "", "pub.datadir must be set")
+	check(isEthAddress(c.Pub.EthAddress), "pub.eth_address %q must be set to an ethereum address", c.Pub.EthAddress)
 
-// RewardOfDailyLogin
-var RewardOfDailyLogin = 10
+	check(c.API.Port > 0 && c.API.Port < 65536, "api.port %d error", c.API.Port)
+	check(c.API.ShutdownTimeout.Duration > 0, "api.shutdown_timeout must be positive")
+	for _, proxy := range c.API.TrustedProxies {
+		_, _, err := net.ParseCIDR(proxy)
+		check(err == nil || net.ParseIP(proxy) != nil, "api.trusted_proxies %q is no ip or cidr", proxy)
+	}
 
-// RewardOfPostMessage
-var RewardOfPostMessage = 5
+	check(isHostPort(c.Photon.Host), "photon.host %q is not host:port", c.Photon.Host)
+	check(isEthAddress(c.Photon.TokenAddress), "photon.token_address %q must be set to an ethereum address", c.Photon.TokenAddress)
+	check(c.Photon.SettleTimeout > 0, "photon.settle_timeout should > 0")
+	check(c.Photon.MinBalanceInchannel > 0, "photon.min_balance_inchannel %d error", c.Photon.MinBalanceInchannel)
+	check(c.Photon.CheckChannelInterval.Duration > 0, "photon.check_channel_interval must be positive")
+	check(c.Photon.BackPayInterval.Duration > 0, "photon.back_pay_interval must be positive")
 
-// RewardOfPostComment
-var RewardOfPostComment = 2
+	check(c.Analysis.MessageScanInterval.Duration > 0, "analysis.message_scan_interval must be positive")
+	check(c.Analysis.SensitiveWordsFile != "", "analysis.sensitive_words_file must be set")
 
-// RewardOfMintNft
-var RewardOfMintNft = 10
+	for name, v := range map[string]int{
+		"report_problematic_post": c.Rewards.ReportProblematicPost,
+		"signup":                  c.Rewards.Signup,
+		"signup_smt":              c.Rewards.SignupSMT,
+		"daily_login":             c.Rewards.DailyLogin,
+		"post_message":            c.Rewards.PostMessage,
+		"post_comment":            c.Rewards.PostComment,
+		"mint_nft":                c.Rewards.MintNft,
+		"like_post":               c.Rewards.LikePost,
+		"max_daily":               c.Rewards.MaxDaily,
+		"max_signup":              c.Rewards.MaxSignup,
+	} {
+		check(v >= 0, "rewards.%s %d error", name, v)
+	}
 
-// RewardOfLikePost
-var RewardOfLikePost = 1
+	for _, trusted := range c.Moderation.TrustedPubs {
+		_, err := refs.ParseFeedRef(trusted)
+		check(err == nil, "moderation.trusted_pubs %s error: %v", trusted, err)
+	}
 
-// SensitiveWordsFilePath
-var SensitiveWordsFilePath = ""
+	check(c.Attestation.Window.Duration > 0, "attestation.window must be positive")
+	for _, route := range c.Attestation.Routes {
+		check(strings.HasPrefix(route, "/"), "attestation.routes %q is not a path", route)
+	}
 
-// Ip2LocationLiteDbPath
-var Ip2LocationLiteDbPath = ""
+	for path, rule := range c.RateLimit {
+		check(strings.HasPrefix(path, "/"), "rate_limit %q is not a path", path)
+		check(rule.PerIPRate >= 0 && rule.PerIPBurst >= 0 && rule.PerFeedRate >= 0 && rule.PerFeedBurst >= 0,
+			"rate_limit %q: negative value", path)
+	}
 
-// MaxDailyRewarding pub send mlt, instead of supernode
-var MaxDailyRewarding = 500
+	check(c.Directory.Candidates > 0, "directory.candidates should > 0")
+	check(c.Directory.Capacity >= 0, "directory.capacity %d error", c.Directory.Capacity)
+	check(c.Directory.ProbeInterval.Duration > 0, "directory.probe_interval must be positive")
+	check(c.Directory.ProbeTimeout.Duration > 0, "directory.probe_timeout must be positive")
+	check(c.Directory.LoadPenaltyKm >= 0, "directory.load_penalty_km %v error", c.Directory.LoadPenaltyKm)
+	check(c.Directory.MaxAnnounced >= 0, "directory.max_announced %d error", c.Directory.MaxAnnounced)
+	for _, trusted := range c.Directory.TrustedAnnouncers {
+		_, err := refs.ParseFeedRef(trusted)
+		check(err == nil, "directory.trusted_announcers %s error: %v", trusted, err)
+	}
 
-// MaxSignupReward
-var MaxSignupReward = 601
+	isOneOf := func(s string, list []string) bool {
+		for _, item := range list {
+			if s == item {
+				return true
+			}
+		}
+		return false
+	}
+	check(isOneOf(c.Log.Level, LogLevels), "log.level %q is not one of %s", c.Log.Level, strings.Join(LogLevels, ", "))
+	for module, lvl := range c.Log.Modules {
+		check(isOneOf(module, LogModules), "log.modules: %q is not one of %s", module, strings.Join(LogModules, ", "))
+		check(isOneOf(lvl, LogLevels), "log.modules.%s %q is not one of %s", module, lvl, strings.Join(LogLevels, ", "))
+	}
 
-//RoundTimeOfBackPay
-var RoundTimeOfBackPay = time.Minute * 10
+	for i, invite := range c.Invites {
+		_, err := refs.ParseFeedRef(invite.Feed())
+		check(err == nil && strings.Contains(invite.Code, "~"), "invites[%d].code %q is not host:port:@key~secret", i, invite.Code)
+		check(invite.Capacity >= 0, "invites[%d].capacity %d error", i, invite.Capacity)
+		check(invite.API == "" || strings.HasPrefix(invite.API, "http://") || strings.HasPrefix(invite.API, "https://"),
+			"invites[%d].api %q is not a http url", i, invite.API)
+	}
 
-//RoundTimeOfCheckChannelBalance
-var RoundTimeOfCheckChannelBalance = time.Minute * 120
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config:\n  %s", strings.Join(errs, "\n  "))
+	}
+	return nil
+}
 
-var InviteCodeOfPub1 = "106.52.171.12:8008:@1qF7giAqTYBuAUbFsO13ezRy1WhKvwcX23II65jwxUc=.ed25519~bZ/KKsdDMq+FdcjePXEBaRG81BP4mVnO2NfSLOkg46g="
-var InviteCodeOfPub2 = "13.213.41.31:8008:@HZnU6wM+F17J0RSLXP05x3Lag2jGv3F3LzHMjh72coE=.ed25519~S0gwfIeutgCK6zsbQDXqEP0FxiitAIlzZeK7QDSYk40="
+// Dump writes the config as toml, e.g. to see the effective config after the environment was applied
+func (c *Config) Dump(w io.Writer) error {
+	return toml.NewEncoder(w).Encode(c)
+}
@@ -0,0 +1,189 @@
+package params
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metalife-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "metalife.toml")
+	err = ioutil.WriteFile(path, []byte(`
+[pub]
+eth_address = "0x1111111111111111111111111111111111111111"
+
+[api]
+port = 10010
+shutdown_timeout = "5s"
+
+[rate_limit."/ssb/api/notify-login"]
+ip_rate = 1.5
+ip_burst = 3
+
+[[invites]]
+code = "1.2.3.4:8008:@HZnU6wM+F17J0RSLXP05x3Lag2jGv3F3LzHMjh72coE=.ed25519~secret"
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.API.Port != 10010 || cfg.API.ShutdownTimeout.Duration != 5*time.Second {
+		t.Errorf("api table not read: %+v", cfg.API)
+	}
+	if cfg.Photon.SettleTimeout != 40000 {
+		t.Errorf("default lost: %d", cfg.Photon.SettleTimeout)
+	}
+	if len(cfg.RateLimit) != 1 || cfg.RateLimit["/ssb/api/notify-login"].PerIPBurst != 3 {
+		t.Errorf("rate_limit does not replace the defaults: %+v", cfg.RateLimit)
+	}
+	if len(cfg.Invites) != 1 || cfg.Invites[0].Host() != "1.2.3.4" {
+		t.Errorf("invites not read: %+v", cfg.Invites)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	// the dump reads back to the same config
+	var buf bytes.Buffer
+	if err := cfg.Dump(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dumped := filepath.Join(dir, "dumped.toml")
+	if err := ioutil.WriteFile(dumped, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	again, err := LoadConfigFile(dumped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf2 bytes.Buffer
+	again.Dump(&buf2)
+	if buf.String() != buf2.String() {
+		t.Errorf("dump does not round trip:\n%s\n---\n%s", buf.String(), buf2.String())
+	}
+
+	ioutil.WriteFile(path, []byte("[api]\nprot = 1\n"), 0600)
+	if _, err := LoadConfigFile(path); err == nil || !strings.Contains(err.Error(), "api.prot") {
+		t.Errorf("unknown key not reported: %v", err)
+	}
+}
+
+func TestConfigEnv(t *testing.T) {
+	env := map[string]string{
+		"METALIFE_API_PORT":                  "10011",
+		"METALIFE_API_DEBUG":                 "false",
+		"METALIFE_PHOTON_BACK_PAY_INTERVAL":  "1m",
+		"METALIFE_MODERATION_TRUSTED_PUBS":   "@a, @b",
+		"METALIFE_DIRECTORY_LOAD_PENALTY_KM": "500.5",
+		"METALIFE_LOG_MODULES":               "photon=debug, api=warn",
+	}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	cfg := DefaultConfig()
+	if err := cfg.ApplyEnv(lookup); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.API.Port != 10011 || cfg.API.Debug {
+		t.Errorf("api not overridden: %+v", cfg.API)
+	}
+	if cfg.Photon.BackPayInterval.Duration != time.Minute {
+		t.Errorf("duration not overridden: %v", cfg.Photon.BackPayInterval)
+	}
+	if strings.Join(cfg.Moderation.TrustedPubs, "|") != "@a|@b" {
+		t.Errorf("list not overridden: %q", cfg.Moderation.TrustedPubs)
+	}
+	if cfg.Directory.LoadPenaltyKm != 500.5 {
+		t.Errorf("float not overridden: %v", cfg.Directory.LoadPenaltyKm)
+	}
+	if len(cfg.Log.Modules) != 2 || cfg.Log.Modules["photon"] != "debug" || cfg.Log.Modules["api"] != "warn" {
+		t.Errorf("table not overridden: %v", cfg.Log.Modules)
+	}
+
+	env["METALIFE_API_PORT"] = "many"
+	if err := DefaultConfig().ApplyEnv(lookup); err == nil {
+		t.Error("expected an error for a bad int")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Pub.EthAddress = "0x1111111111111111111111111111111111111111"
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.API.Port = 0
+	cfg.Photon.Host = "nohost"
+	cfg.Moderation.TrustedPubs = []string{"@nope"}
+	cfg.Directory.TrustedAnnouncers = []string{"@nope"}
+	cfg.Invites[0].API = "10.0.0.1:10008" // no scheme
+	cfg.Log.Modules = map[string]string{"photon": "verbose"}
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected errors")
+	}
+	for _, want := range []string{"api.port", "photon.host", "moderation.trusted_pubs", "directory.trusted_announcers", "invites", "log.modules.photon"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("%s not reported in %s", want, err)
+		}
+	}
+}
+
+func TestInviteConfig(t *testing.T) {
+	ic := DefaultConfig().Invites[1]
+	if ic.Host() != "13.213.41.31" || ic.Port() != "8008" {
+		t.Errorf("wrong address %s %s", ic.Host(), ic.Port())
+	}
+	if ic.Feed() != "@HZnU6wM+F17J0RSLXP05x3Lag2jGv3F3LzHMjh72coE=.ed25519" {
+		t.Errorf("wrong feed %s", ic.Feed())
+	}
+	if (InviteConfig{Code: "nohost"}).Feed() != "" {
+		t.Error("feed of a broken code")
+	}
+}
+
+func TestLoadRewardPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metalife-policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	base := DefaultConfig().Rewards
+	path := filepath.Join(dir, "policy.toml")
+	ioutil.WriteFile(path, []byte("[rewards]\nlike_post = 3\nmax_daily = 50\n"), 0600)
+	policy, err := LoadRewardPolicy(path, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.LikePost != 3 || policy.MaxDaily != 50 {
+		t.Errorf("policy not applied: %+v", policy)
+	}
+	if policy.PostMessage != base.PostMessage || policy.MaxSignup != base.MaxSignup {
+		t.Errorf("the keys that are left out should keep their value: %+v", policy)
+	}
+
+	for _, bad := range []string{"[rewards]\nlike_post = -1\n", "[rewards]\nlike_posts = 1\n", "like_post = 1\n"} {
+		ioutil.WriteFile(path, []byte(bad), 0600)
+		if _, err := LoadRewardPolicy(path, base); err == nil {
+			t.Errorf("%q should fail", bad)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package params
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix of the environment variables that override the config, e.g. METALIFE_API_PORT=10010
+const EnvPrefix = "METALIFE_"
+
+var durationType = reflect.TypeOf(Duration{})
+
+// ApplyEnv overrides the values of the config with the environment variables lookup finds.
+// The name of a value is METALIFE_<TABLE>_<KEY> of the toml file, lists are comma separated, tables of strings are comma separated key=value pairs.
+// The rate_limit and invites tables can only be set in the file.
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	rv := reflect.ValueOf(c).Elem()
+	for i := 0; i < rv.NumField(); i++ {
+		table := rv.Type().Field(i).Tag.Get("toml")
+		section := rv.Field(i)
+		if section.Kind() != reflect.Struct {
+			continue
+		}
+		for j := 0; j < section.NumField(); j++ {
+			key := section.Type().Field(j).Tag.Get("toml")
+			name := EnvPrefix + strings.ToUpper(table+"_"+key)
+			val, ok := lookup(name)
+			if !ok {
+				continue
+			}
+			if err := setFromEnv(section.Field(j), val); err != nil {
+				return fmt.Errorf("config: %s=%q: %w", name, val, err)
+			}
+		}
+	}
+	return nil
+}
+
+func setFromEnv(field reflect.Value, val string) error {
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(Duration{d}))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(val)
+	case reflect.Int:
+		n, err := strconv.Atoi(val)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", field.Type())
+		}
+		var list []string
+		for _, item := range strings.Split(val, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		field.Set(reflect.ValueOf(list))
+	case reflect.Map:
+		if field.Type().Key().Kind() != reflect.String || field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", field.Type())
+		}
+		m := make(map[string]string)
+		for _, item := range strings.Split(val, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			kv := strings.SplitN(item, "=", 2)
+			if len(kv) != 2 {
+				return fmt.Errorf("%q is no key=value", item)
+			}
+			m[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+		field.Set(reflect.ValueOf(m))
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package params
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RateLimitRule token buckets of a restful route, one per client ip and one per feed.
+// Rate is the number of tokens refilled per second, Burst the size of the bucket, a Rate of 0 disables the bucket.
+type RateLimitRule struct {
+	PerIPRate    float64 `toml:"ip_rate"`
+	PerIPBurst   int     `toml:"ip_burst"`
+	PerFeedRate  float64 `toml:"feed_rate"`
+	PerFeedBurst int     `toml:"feed_burst"`
+}
+
+// DefaultRateLimitRules route path -> rule, routes not in the map are not limited
+func DefaultRateLimitRules() map[string]RateLimitRule {
+	return map[string]RateLimitRule{
+		"/ssb/api/tipped-who-off":     {PerIPRate: 0.2, PerIPBurst: 10, PerFeedRate: 1.0 / 60, PerFeedBurst: 5},
+		"/ssb/api/notify-login":       {PerIPRate: 0.5, PerIPBurst: 10, PerFeedRate: 1.0 / 600, PerFeedBurst: 3},
+		"/ssb/api/notify-created-nft": {PerIPRate: 0.5, PerIPBurst: 10, PerFeedRate: 1.0 / 60, PerFeedBurst: 5},
+		"/ssb/api/id2eth":             {PerIPRate: 0.2, PerIPBurst: 5, PerFeedRate: 1.0 / 600, PerFeedBurst: 2},
+	}
+}
+
+// ParseRateLimitRule parses "path=ip-rate:ip-burst:feed-rate:feed-burst", e.g. "/ssb/api/notify-login=0.5:10:0.002:3"
+func ParseRateLimitRule(s string) (path string, rule RateLimitRule, err error) {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || !strings.HasPrefix(kv[0], "/") {
+		err = fmt.Errorf("rate limit rule %q: want path=ip-rate:ip-burst:feed-rate:feed-burst", s)
+		return
+	}
+	path = kv[0]
+	fields := strings.Split(kv[1], ":")
+	if len(fields) != 4 {
+		err = fmt.Errorf("rate limit rule %q: want 4 values, got %d", s, len(fields))
+		return
+	}
+	if rule.PerIPRate, err = strconv.ParseFloat(fields[0], 64); err != nil {
+		return
+	}
+	if rule.PerIPBurst, err = strconv.Atoi(fields[1]); err != nil {
+		return
+	}
+	if rule.PerFeedRate, err = strconv.ParseFloat(fields[2], 64); err != nil {
+		return
+	}
+	if rule.PerFeedBurst, err = strconv.Atoi(fields[3]); err != nil {
+		return
+	}
+	if rule.PerIPRate < 0 || rule.PerIPBurst < 0 || rule.PerFeedRate < 0 || rule.PerFeedBurst < 0 {
+		err = fmt.Errorf("rate limit rule %q: negative value", s)
+	}
+	return
+}
@@ -0,0 +1,29 @@
+package params
+
+import "testing"
+
+func TestParseRateLimitRule(t *testing.T) {
+	path, rule, err := ParseRateLimitRule("/ssb/api/notify-login=0.5:10:0.002:3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/ssb/api/notify-login" {
+		t.Errorf("wrong path: %s", path)
+	}
+	want := RateLimitRule{PerIPRate: 0.5, PerIPBurst: 10, PerFeedRate: 0.002, PerFeedBurst: 3}
+	if rule != want {
+		t.Errorf("wrong rule: %+v", rule)
+	}
+
+	for _, bad := range []string{
+		"",
+		"notify-login=1:1:1:1",
+		"/ssb/api/notify-login=1:1:1",
+		"/ssb/api/notify-login=a:1:1:1",
+		"/ssb/api/notify-login=1:-1:1:1",
+	} {
+		if _, _, err := ParseRateLimitRule(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
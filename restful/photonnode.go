@@ -12,10 +12,10 @@ import (
 	"strings"
 
 	"go.cryptoscope.co/ssb/restful/channel"
+	kitlog "go.mindeco.de/log"
+	"go.mindeco.de/log/level"
 )
 
-//var log kitlog.Logger
-
 // PhotonNode a photon node
 type PhotonNode struct {
 	Host       string
@@ -25,6 +25,45 @@ type PhotonNode struct {
 
 	DebugCrash bool
 	Running    bool
+
+	// log the calls of the photon api, nothing is logged without it
+	log kitlog.Logger
+	// stats gets the latency and the errors of the calls, nothing is recorded without it
+	stats *serviceMetrics
+}
+
+func (node *PhotonNode) logger() kitlog.Logger {
+	if node.log == nil {
+		return kitlog.NewNopLogger()
+	}
+	return node.log
+}
+
+// photonNode the photon node of the pub
+func (s *Service) photonNode() *PhotonNode {
+	return &PhotonNode{
+		Host:       "http://" + s.cfg.Photon.Host,
+		Address:    s.cfg.Pub.EthAddress,
+		APIAddress: s.cfg.Photon.Host,
+		DebugCrash: false,
+		log:        s.logger(logPhoton),
+		stats:      s.metrics(),
+	}
+}
+
+// invoke req to endpoint of the photon api, endpoint is the label of the metrics
+func (node *PhotonNode) invoke(endpoint string, req *Req) ([]byte, error) {
+	stats := node.stats
+	if stats == nil {
+		stats = discardMetrics
+	}
+	start := time.Now()
+	body, err := req.Invoke()
+	stats.photonLatency.With("endpoint", endpoint).Observe(time.Since(start).Seconds())
+	if err != nil {
+		stats.photonErrors.With("endpoint", endpoint).Add(1)
+	}
+	return body, err
 }
 
 type TransferPayload struct {
@@ -65,14 +104,14 @@ func (node *PhotonNode) GetChannelWith(partnerNode *PhotonNode, tokenAddr string
 		Payload: "",
 		Timeout: time.Second * 30,
 	}
-	body, err := req.Invoke()
+	body, err := node.invoke("channels", req)
 	if err != nil {
 		return nil, err
 	}
 	var nodeChannels []Channel
 	err = json.Unmarshal(body, &nodeChannels)
 	if err != nil {
-		fmt.Println(fmt.Sprintf("GetChannel Unmarshal err= %s", err))
+		level.Debug(node.logger()).Log("event", "channels unmarshal failed", "err", err)
 		return nil, err
 	}
 	if len(nodeChannels) == 0 {
@@ -110,16 +149,16 @@ func (node *PhotonNode) OpenChannel(partnerAddress, tokenAddress string, balance
 		Payload: string(p),
 		Timeout: time.Second * 60,
 	}
-	body, err := req.Invoke()
+	body, err := node.invoke("deposit", req)
 	if err != nil {
-		fmt.Println(fmt.Sprintf("[Pub]OpenChannelApi err %s", err))
+		level.Debug(node.logger()).Log("event", "open channel failed", "partner", partnerAddress, "err", err)
 		return err
 	}
-	fmt.Println(fmt.Sprintf("[Pub]OpenChannelApi returned %s", string(body)))
+	level.Debug(node.logger()).Log("event", "open channel returned", "partner", partnerAddress, "body", string(body))
 	ch := channel.ChannelDataDetail{}
 	err = json.Unmarshal(body, &ch)
 	if err != nil {
-		fmt.Println(fmt.Sprintf("OpenChannel Unmarshal err= %s", err))
+		level.Debug(node.logger()).Log("event", "open channel unmarshal failed", "partner", partnerAddress, "err", err)
 		return err
 	}
 	var ws int
@@ -150,9 +189,9 @@ func (node *PhotonNode) SpecifiedChannel(channelIdentifier string) (c channel.Ch
 		Method:  http.MethodGet,
 		Timeout: time.Second * 20,
 	}
-	body, err := req.Invoke()
+	body, err := node.invoke("channel", req)
 	if err != nil {
-		fmt.Println(fmt.Sprintf("[Pub]SpecifiedChannel err %s", err))
+		level.Debug(node.logger()).Log("event", "channel query failed", "channel", channelIdentifier, "err", err)
 		return
 	}
 	err = json.Unmarshal(body, &c)
@@ -175,9 +214,9 @@ func (node *PhotonNode) SendTrans(tokenAddress string, amount *big.Int, targetAd
 		Payload: string(p),
 		Timeout: time.Second * 60,
 	}
-	body, err := req.Invoke()
+	body, err := node.invoke("transfers", req)
 	if err != nil {
-		fmt.Println(fmt.Sprintf("[Pub]SendTransApi err=%s,body=%s ", err, string(body)))
+		level.Debug(node.logger()).Log("event", "transfer failed", "eth", targetAddress, "amount", amount, "body", string(body), "err", err)
 	}
 	return err
 }
@@ -186,11 +225,11 @@ func (node *PhotonNode) CheckChannelExist(partnerAddress, tokenAddress string) b
 	//记录deposit之前的通道余额
 	partners, err := node.TokenPartners(tokenAddress)
 	if err != nil {
-		fmt.Println(fmt.Sprintf("CheckChannelExist err :%s when get node-balance in this channel before deposit", err))
+		level.Debug(node.logger()).Log("event", "token partners failed", "partner", partnerAddress, "err", err)
 		return false
 	}
 	if len(partners) == 0 {
-		fmt.Println(fmt.Sprintf("CheckChannelExist err :%s,no channel between %s and %s in token %s", err, node.Address, partnerAddress, tokenAddress))
+		level.Debug(node.logger()).Log("event", "no channel", "partner", partnerAddress, "token", tokenAddress)
 		return false
 	}
 	channelInfo := ""
@@ -204,7 +243,7 @@ func (node *PhotonNode) CheckChannelExist(partnerAddress, tokenAddress string) b
 	channelInfo = strings.Split(channelInfo, "/")[3]
 	_, err = node.SpecifiedChannel(channelInfo)
 	if err != nil {
-		fmt.Println(fmt.Sprintf("CheckChannelExist err when get SpecifiedChannel:%s", err))
+		level.Debug(node.logger()).Log("event", "channel query failed", "partner", partnerAddress, "err", err)
 		return false
 	}
 	return true
@@ -234,11 +273,11 @@ func (node *PhotonNode) Deposit(partnerAddress, tokenAddress string, balance *bi
 	//记录deposit之前的通道余额
 	partners, err := node.TokenPartners(tokenAddress)
 	if err != nil {
-		fmt.Println(fmt.Sprintf("DepositApi %s err :%s when get node-balance in this channel before deposit", req.FullURL, err))
+		level.Debug(node.logger()).Log("event", "deposit: token partners failed", "partner", partnerAddress, "err", err)
 		return err
 	}
 	if len(partners) == 0 {
-		fmt.Println(fmt.Sprintf("DepositApi %s err :%s,no channel between %s and %s in token %s", req.FullURL, err, node.Address, partnerAddress, tokenAddress))
+		level.Debug(node.logger()).Log("event", "deposit: no channel", "partner", partnerAddress, "token", tokenAddress)
 		return err
 	}
 	channelInfo := ""
@@ -252,21 +291,21 @@ func (node *PhotonNode) Deposit(partnerAddress, tokenAddress string, balance *bi
 	channelInfo = strings.Split(channelInfo, "/")[3]
 	c, err := node.SpecifiedChannel(channelInfo)
 	if err != nil {
-		fmt.Println(fmt.Sprintf("DepositApi %s err when get SpecifiedChannel:%s", req.FullURL, err))
+		level.Debug(node.logger()).Log("event", "deposit: channel query failed", "partner", partnerAddress, "err", err)
 		return err
 	}
 	nodeBalanceBeforeDeposit := c.Balance
 
-	body, err := req.Invoke()
+	body, err := node.invoke("deposit", req)
 	if err != nil {
-		fmt.Println(fmt.Sprintf("[Pub]DepositApi err=%s ", err))
+		level.Debug(node.logger()).Log("event", "deposit failed", "partner", partnerAddress, "amount", balance, "err", err)
 		return err
 	}
-	fmt.Println(fmt.Sprintf("[Pub]Deposit returned=%s ", string(body)))
+	level.Debug(node.logger()).Log("event", "deposit returned", "partner", partnerAddress, "body", string(body))
 	ch := channel.ChannelDataDetail{}
 	err = json.Unmarshal(body, &ch)
 	if err != nil {
-		fmt.Println(fmt.Sprintf("Deposit Unmarshal err= %s", err))
+		level.Debug(node.logger()).Log("event", "deposit unmarshal failed", "partner", partnerAddress, "err", err)
 		return err
 	}
 	var ws int
@@ -319,9 +358,9 @@ func (node *PhotonNode) TokenPartners(token string) (partners []*PartnersDataRes
 		Method:  http.MethodGet,
 		Timeout: time.Second * 20,
 	}
-	body, err := req.Invoke()
+	body, err := node.invoke("partners", req)
 	if err != nil {
-		fmt.Println(fmt.Sprintf("TokenPartners err :%s", err))
+		level.Debug(node.logger()).Log("event", "token partners failed", "token", token, "err", err)
 		return
 	}
 	err = json.Unmarshal(body, &partners)
@@ -343,9 +382,9 @@ func (node *PhotonNode) GetNodeStatus(nodeaddr string) (status *repsNodeStatus,
 		Method:  http.MethodGet,
 		Timeout: time.Second * 20,
 	}
-	body, err := req.Invoke()
+	body, err := node.invoke("node-status", req)
 	if err != nil {
-		fmt.Println(fmt.Sprintf("GetNodeStatus err :%s", err))
+		level.Debug(node.logger()).Log("event", "node status failed", "eth", nodeaddr, "err", err)
 		return
 	}
 	err = json.Unmarshal(body, &status)
@@ -362,9 +401,9 @@ func (node *PhotonNode) TransferSMT(addr, value string) (err error) {
 		Method:  http.MethodPost,
 		Timeout: time.Second * 180,
 	}
-	body, err := req.Invoke()
+	body, err := node.invoke("transfer-smt", req)
 	if err != nil {
-		fmt.Println(fmt.Sprintf("transfer-smt err :%s", err))
+		level.Debug(node.logger()).Log("event", "transfer smt failed", "eth", addr, "amount", value, "err", err)
 		return
 	}
 	err = json.Unmarshal(body, new(interface{}))
@@ -0,0 +1,508 @@
+package restful
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.cryptoscope.co/ssb/restful/params"
+	"go.mindeco.de/log/level"
+)
+
+// PubMessageType the type of the message a pub announces its address with, ssb-server publishes the same
+const PubMessageType = "pub"
+
+// ContentPubStru content of a 'pub' message, invite, capacity and api are added by metalife pubs
+type ContentPubStru struct {
+	Type    string `json:"type"`
+	Address struct {
+		Host string `json:"host"`
+		Port int    `json:"port"`
+		Key  string `json:"key"`
+	} `json:"address"`
+	Invite   string `json:"invite,omitempty"`
+	Capacity int    `json:"capacity,omitempty"`
+	API      string `json:"api,omitempty"`
+}
+
+// PubInfo a pub of the directory, from the invites of the config or from a 'pub' message
+type PubInfo struct {
+	PubID      string   `json:"pub_id"`
+	Host       string   `json:"host"`
+	Port       int      `json:"port"`
+	InviteCode string   `json:"invite_code"`
+	Countries  []string `json:"countries"`
+	Capacity   int      `json:"capacity"`
+	API        string   `json:"api"`
+	Announced  bool     `json:"announced"`
+	// Country where the host is, "" until it was looked up
+	Country string `json:"country"`
+	// Load the peers of the pub at the last probe, -1 is unknown
+	Load      int   `json:"load"`
+	Healthy   bool  `json:"healthy"`
+	ProbeTime int64 `json:"probe_time"`
+	// AnnounceTime the time of the 'pub' message, 0 for the invites of the config
+	AnnounceTime int64 `json:"announce_time"`
+
+	location *geoLocation
+}
+
+// PubCandidate a pub get-pubhost-by-ip recommends, the best first
+type PubCandidate struct {
+	PubID      string  `json:"pub_id"`
+	PubHost    string  `json:"pub_host"`
+	InviteCode string  `json:"invite_code"`
+	Country    string  `json:"country"`
+	DistanceKm float64 `json:"distance_km"`
+	Load       int     `json:"load"`
+	Capacity   int     `json:"capacity"`
+	Healthy    bool    `json:"healthy"`
+}
+
+// PubStatus the load of this pub, the directories of other pubs probe it
+type PubStatus struct {
+	PubID    string `json:"pub_id"`
+	Peers    int    `json:"peers"`
+	Capacity int    `json:"capacity"`
+}
+
+// pubDirectory the pubs get-pubhost-by-ip chooses from, the invites of the config win over announcements of the same feed
+type pubDirectory struct {
+	mu   sync.Mutex
+	pubs map[string]*PubInfo
+	// maxAnnounced how many announced pubs are kept, 0 is none
+	maxAnnounced int
+}
+
+// newPubDirectory the directory with the pubs of the invites of cfg
+func newPubDirectory(cfg *params.Config) *pubDirectory {
+	d := &pubDirectory{pubs: make(map[string]*PubInfo), maxAnnounced: cfg.Directory.MaxAnnounced}
+	for _, ic := range cfg.Invites {
+		port, _ := strconv.Atoi(ic.Port())
+		d.pubs[ic.Feed()] = &PubInfo{
+			PubID:      ic.Feed(),
+			Host:       ic.Host(),
+			Port:       port,
+			InviteCode: ic.Code,
+			Countries:  ic.Countries,
+			Capacity:   ic.Capacity,
+			API:        strings.TrimSuffix(ic.API, "/"),
+			Load:       -1,
+			Healthy:    true,
+		}
+	}
+	return d
+}
+
+// parsePubAnnouncement the pub of a 'pub' message of author, nil if it is no valid announcement.
+// A feed can only announce itself and only with an invite code of its own,
+// the host and the api must not be a loopback, private or link-local address.
+func parsePubAnnouncement(author string, content json.RawMessage, msgTime int64) *PubInfo {
+	cps := ContentPubStru{}
+	err := json.Unmarshal(content, &cps)
+	if err != nil || cps.Type != PubMessageType {
+		return nil
+	}
+	if cps.Address.Key != author || cps.Address.Host == "" || cps.Address.Port <= 0 || cps.Address.Port > 65535 {
+		return nil
+	}
+	if cps.Invite != "" && (params.InviteConfig{Code: cps.Invite}).Feed() != author {
+		return nil
+	}
+	if !publicHost(cps.Address.Host) {
+		return nil
+	}
+	if cps.API != "" && !publicAPI(cps.API) {
+		return nil
+	}
+	if cps.Capacity < 0 {
+		return nil
+	}
+	return &PubInfo{
+		PubID:        author,
+		Host:         cps.Address.Host,
+		Port:         cps.Address.Port,
+		InviteCode:   cps.Invite,
+		Capacity:     cps.Capacity,
+		API:          strings.TrimSuffix(cps.API, "/"),
+		Announced:    true,
+		Load:         -1,
+		Healthy:      true,
+		AnnounceTime: msgTime,
+	}
+}
+
+// announce adds or updates an announced pub, false if the config has the feed, a newer announcement is known
+// or the directory has maxAnnounced announced pubs already
+func (d *pubDirectory) announce(pi *PubInfo) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	known, ok := d.pubs[pi.PubID]
+	if ok && (!known.Announced || known.AnnounceTime > pi.AnnounceTime) {
+		return false
+	}
+	if !ok {
+		announced := 0
+		for _, other := range d.pubs {
+			if other.Announced {
+				announced++
+			}
+		}
+		if announced >= d.maxAnnounced {
+			return false
+		}
+	}
+	if ok && known.Host == pi.Host {
+		// the host did not move, keep what the probes found
+		pi.location, pi.Country = known.location, known.Country
+		pi.Load, pi.Healthy, pi.ProbeTime = known.Load, known.Healthy, known.ProbeTime
+	}
+	d.pubs[pi.PubID] = pi
+	return true
+}
+
+// list copies of the pubs, ordered by feed
+func (d *pubDirectory) list() []PubInfo {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	pubs := make([]PubInfo, 0, len(d.pubs))
+	for _, pi := range d.pubs {
+		pubs = append(pubs, *pi)
+	}
+	sort.Slice(pubs, func(i, j int) bool { return pubs[i].PubID < pubs[j].PubID })
+	return pubs
+}
+
+// update the result of a probe of feed
+func (d *pubDirectory) update(feed string, fn func(pi *PubInfo)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if pi, ok := d.pubs[feed]; ok {
+		fn(pi)
+	}
+}
+
+// rankPubs the n best pubs with an invite code for a client at client (nil if unknown).
+// Healthy pubs come before the others and pubs with room before the full ones, then the lowest score wins:
+// the distance to the client, 0 if the client is in one of the countries of the pub, plus loadPenaltyKm times the load of the pub.
+func rankPubs(pubs []PubInfo, client *geoLocation, n int, loadPenaltyKm float64) []*PubCandidate {
+	type ranked struct {
+		cand  *PubCandidate
+		full  bool
+		score float64
+	}
+	var rs []ranked
+	for _, pi := range pubs {
+		if pi.InviteCode == "" {
+			continue
+		}
+		// a pub we know nothing about ranks behind every pub on earth
+		distance := math.Pi * earthRadiusKm
+		if client != nil && inCountries(client.CountryLong, pi.Countries) {
+			distance = 0
+		} else if client != nil && pi.location != nil {
+			distance = distanceKm(client, pi.location)
+		}
+		usage := 0.5
+		if pi.Capacity > 0 && pi.Load >= 0 {
+			usage = float64(pi.Load) / float64(pi.Capacity)
+		}
+		rs = append(rs, ranked{
+			cand: &PubCandidate{
+				PubID:      pi.PubID,
+				PubHost:    net.JoinHostPort(pi.Host, strconv.Itoa(pi.Port)),
+				InviteCode: pi.InviteCode,
+				Country:    pi.Country,
+				DistanceKm: math.Round(distance),
+				Load:       pi.Load,
+				Capacity:   pi.Capacity,
+				Healthy:    pi.Healthy,
+			},
+			full:  pi.Capacity > 0 && pi.Load >= pi.Capacity,
+			score: distance + loadPenaltyKm*usage,
+		})
+	}
+	sort.SliceStable(rs, func(i, j int) bool {
+		a, b := rs[i], rs[j]
+		if a.cand.Healthy != b.cand.Healthy {
+			return a.cand.Healthy
+		}
+		if a.full != b.full {
+			return !a.full
+		}
+		if a.score != b.score {
+			return a.score < b.score
+		}
+		return a.cand.PubID < b.cand.PubID
+	})
+	if n > len(rs) {
+		n = len(rs)
+	}
+	cands := make([]*PubCandidate, n)
+	for i := range cands {
+		cands[i] = rs[i].cand
+	}
+	return cands
+}
+
+func inCountries(country string, countries []string) bool {
+	for _, c := range countries {
+		if strings.EqualFold(c, country) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadPubAnnouncements puts the announcements of the earlier scans into the directory
+func (s *Service) loadPubAnnouncements() error {
+	if !s.cfg.Directory.Announcements {
+		return nil
+	}
+	pubs, err := s.db.SelectPubAnnouncements()
+	if err != nil {
+		return err
+	}
+	for _, pi := range pubs {
+		// the announcements of feeds that are no longer trusted, or of hosts an older version accepted, stay out
+		if s.trustedAnnouncer(pi.PubID) && publicHost(pi.Host) && (pi.API == "" || publicAPI(pi.API)) {
+			s.pubs.announce(pi)
+		}
+	}
+	return nil
+}
+
+// trustedAnnouncer whether the 'pub' messages of feed are added to the directory
+func (s *Service) trustedAnnouncer(feed string) bool {
+	for _, trusted := range s.cfg.Directory.TrustedAnnouncers {
+		if trusted == feed {
+			return true
+		}
+	}
+	return false
+}
+
+// importPubAnnouncement adds the pub of a 'pub' message of a trusted feed to the directory and keeps it for the next start
+func (s *Service) importPubAnnouncement(author string, content json.RawMessage, msgTime int64) {
+	if !s.cfg.Directory.Announcements || !s.trustedAnnouncer(author) {
+		return
+	}
+	pi := parsePubAnnouncement(author, content, msgTime)
+	if pi == nil || !s.pubs.announce(pi) {
+		return
+	}
+	_, err := s.db.UpsertPubAnnouncement(pi)
+	if err != nil {
+		level.Error(s.logger(logDirectory)).Log("event", "save announcement failed", "feed", author, "err", err)
+		return
+	}
+	level.Info(s.logger(logDirectory)).Log("event", "pub announced", "feed", author, "host", pi.Host, "port", pi.Port)
+}
+
+// probePubs checks the load and the liveness of the pubs of the directory every probe_interval, until ctx is done.
+// The IP2Location database is reloaded before each round.
+func (s *Service) probePubs(ctx context.Context) {
+	for {
+		if err := s.geoip.reload(); err != nil {
+			level.Warn(s.logger(logDirectory)).Log("event", "geoip reload failed", "path", s.cfg.Analysis.IP2LocationDB, "err", err)
+		}
+		var wg sync.WaitGroup
+		for _, pi := range s.pubs.list() {
+			wg.Add(1)
+			go func(pi PubInfo) {
+				defer wg.Done()
+				s.probePub(ctx, pi)
+			}(pi)
+		}
+		wg.Wait()
+
+		if !sleepCtx(ctx, s.cfg.Directory.ProbeInterval.Duration) {
+			return
+		}
+	}
+}
+
+// probePub one check of pi: this pub asks its ssb server, pubs with an api are asked for their pub-status, the others are dialed.
+// Announced pubs are only connected to on public addresses, whatever their host resolves to.
+func (s *Service) probePub(ctx context.Context, pi PubInfo) {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.Directory.ProbeTimeout.Duration)
+	defer cancel()
+
+	var dialer net.Dialer
+	client := http.DefaultClient
+	if pi.Announced {
+		dialer.Control = publicOnly
+		client = &http.Client{Transport: &http.Transport{DialContext: dialer.DialContext}}
+	}
+
+	var location *geoLocation
+	if pi.location == nil {
+		location = s.lookupHost(ctx, pi.Host)
+	}
+
+	var status *PubStatus
+	var err error
+	switch {
+	case pi.PubID == s.pubID:
+		status, err = s.status(ctx)
+	case pi.API != "":
+		status, err = probePubStatus(ctx, client, pi.API)
+	default:
+		var conn net.Conn
+		conn, err = dialer.DialContext(ctx, "tcp", net.JoinHostPort(pi.Host, strconv.Itoa(pi.Port)))
+		if err == nil {
+			conn.Close()
+		}
+	}
+	if err != nil && ctx.Err() == context.Canceled {
+		// the services stop, this is no result
+		return
+	}
+	if err != nil {
+		level.Warn(s.logger(logDirectory)).Log("event", "probe failed", "feed", pi.PubID, "err", err)
+	}
+
+	s.pubs.update(pi.PubID, func(known *PubInfo) {
+		if location != nil {
+			known.location, known.Country = location, location.CountryLong
+		}
+		known.Healthy = err == nil
+		known.ProbeTime = time.Now().UnixNano() / 1e6
+		known.Load = -1
+		if status != nil {
+			known.Load = status.Peers
+			if known.Capacity == 0 {
+				known.Capacity = status.Capacity
+			}
+		}
+	})
+}
+
+// lookupHost the location of the first address of host, nil if it is not known
+func (s *Service) lookupHost(ctx context.Context, host string) *geoLocation {
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return nil
+	}
+	location, err := s.geoip.lookup(addrs[0])
+	if err != nil {
+		return nil
+	}
+	return location
+}
+
+// status the load of this pub
+func (s *Service) status(ctx context.Context) (*PubStatus, error) {
+	st, err := s.backend.status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &PubStatus{
+		PubID:    s.pubID,
+		Peers:    len(st.Peers),
+		Capacity: s.cfg.Directory.Capacity,
+	}, nil
+}
+
+// probePubStatus asks the restful api at base for the load of its pub
+func probePubStatus(ctx context.Context, client *http.Client, base string) (*PubStatus, error) {
+	req, err := http.NewRequest(http.MethodGet, base+"/ssb/api/pub-status", nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("pub-status of %s: %s", base, res.Status)
+	}
+	var resp APIResponse
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return nil, err
+	}
+	if resp.ErrorCode != SUCCESS {
+		return nil, fmt.Errorf("pub-status of %s: %s", base, resp.ErrorMsg)
+	}
+	var status PubStatus
+	if err := json.Unmarshal(resp.Data, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// apiHost the host:port of the restful api of a candidate, for the fields the old clients read
+func (s *Service) apiHost(cand *PubCandidate) string {
+	for _, pi := range s.pubs.list() {
+		if pi.PubID == cand.PubID && pi.API != "" {
+			if u, err := url.Parse(pi.API); err == nil && u.Host != "" {
+				return u.Host
+			}
+		}
+	}
+	host, _, _ := net.SplitHostPort(cand.PubHost)
+	return net.JoinHostPort(host, strconv.Itoa(s.cfg.API.Port))
+}
+
+// nonPublicNets the private and shared address ranges, loopback and link-local are checked by net.IP
+var nonPublicNets = func() (nets []*net.IPNet) {
+	for _, cidr := range []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7"} {
+		_, n, _ := net.ParseCIDR(cidr)
+		nets = append(nets, n)
+	}
+	return
+}()
+
+// publicIP whether ip is neither unspecified, loopback, private, link-local nor multicast
+func publicIP(ip net.IP) bool {
+	if ip.IsUnspecified() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, n := range nonPublicNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// publicHost whether host can be a public pub, names are checked again when they are dialed (see publicOnly)
+func publicHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" || host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return publicIP(ip)
+	}
+	return true
+}
+
+// publicAPI whether api is a http url of a public host
+func publicAPI(api string) bool {
+	u, err := url.Parse(api)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && publicHost(u.Hostname())
+}
+
+// publicOnly the net.Dialer control that refuses to connect to an address that is not public
+func publicOnly(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+		return fmt.Errorf("%s is not a public address", host)
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package restful
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/stretchr/testify/require"
+	kitlog "go.mindeco.de/log"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/restful/params"
+)
+
+var (
+	testPubA = "@AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=.ed25519"
+	testPubB = "@BBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBB=.ed25519"
+	testPubC = "@CCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCC=.ed25519"
+)
+
+func TestRankPubs(t *testing.T) {
+	r := require.New(t)
+
+	singapore := &geoLocation{CountryLong: "Singapore", Latitude: 1.29, Longitude: 103.85}
+	frankfurt := &geoLocation{CountryLong: "Germany", Latitude: 50.11, Longitude: 8.68}
+	shanghai := &geoLocation{CountryLong: "China", Latitude: 31.23, Longitude: 121.47}
+
+	pubs := []PubInfo{
+		{PubID: testPubA, Host: "1.1.1.1", Port: 8008, InviteCode: "a", Countries: []string{"China"}, Load: -1, Healthy: true, location: shanghai},
+		{PubID: testPubB, Host: "2.2.2.2", Port: 8008, InviteCode: "b", Capacity: 100, Load: 10, Healthy: true, location: singapore},
+		{PubID: testPubC, Host: "3.3.3.3", Port: 8008, InviteCode: "c", Capacity: 100, Load: 10, Healthy: true, location: frankfurt},
+		// announced without an invite, it can not be recommended
+		{PubID: "@nope", Host: "4.4.4.4", Port: 8008, Load: -1, Healthy: true, location: frankfurt},
+	}
+	ids := func(cands []*PubCandidate) []string {
+		var ids []string
+		for _, c := range cands {
+			ids = append(ids, c.PubID)
+		}
+		return ids
+	}
+
+	// the countries of a pub win over the distance
+	cands := rankPubs(pubs, &geoLocation{CountryLong: "China", Latitude: 39.9, Longitude: 116.4}, 3, 2000)
+	r.Equal([]string{testPubA, testPubB, testPubC}, ids(cands))
+	r.Equal(float64(0), cands[0].DistanceKm)
+	r.Equal("2.2.2.2:8008", cands[1].PubHost)
+
+	cands = rankPubs(pubs, &geoLocation{CountryLong: "France", Latitude: 48.85, Longitude: 2.35}, 2, 2000)
+	r.Equal([]string{testPubC, testPubA}, ids(cands))
+	r.InDelta(480, cands[0].DistanceKm, 20)
+
+	// a full pub is behind the ones with room, an unhealthy one behind all
+	pubs[2].Load = 100
+	cands = rankPubs(pubs, frankfurt, 10, 2000)
+	r.Equal([]string{testPubA, testPubB, testPubC}, ids(cands))
+	pubs[1].Healthy = false
+	cands = rankPubs(pubs, frankfurt, 10, 2000)
+	r.Equal([]string{testPubA, testPubC, testPubB}, ids(cands))
+
+	// without the location of the client only the load counts
+	pubs[1].Healthy = true
+	pubs[2].Load = 0
+	cands = rankPubs(pubs, nil, 10, 2000)
+	r.Equal([]string{testPubC, testPubB, testPubA}, ids(cands))
+}
+
+func TestPubAnnouncement(t *testing.T) {
+	r := require.New(t)
+
+	cfg := params.DefaultConfig()
+	configured := cfg.Invites[1].Feed()
+	d := newPubDirectory(cfg)
+	r.Len(d.list(), 2)
+
+	announce := func(author string, content map[string]interface{}, msgTime int64) bool {
+		raw, err := json.Marshal(content)
+		r.NoError(err)
+		pi := parsePubAnnouncement(author, raw, msgTime)
+		return pi != nil && d.announce(pi)
+	}
+	content := func(key, host string) map[string]interface{} {
+		return map[string]interface{}{
+			"type":     "pub",
+			"address":  map[string]interface{}{"host": host, "port": 8008, "key": key},
+			"invite":   host + ":8008:" + key + "~secret",
+			"capacity": 50,
+			"api":      "http://" + host + ":10008/",
+		}
+	}
+
+	r.True(announce(testPubA, content(testPubA, "5.5.5.5"), 10))
+	// a feed can only announce itself
+	r.False(announce(testPubB, content(testPubA, "6.6.6.6"), 11))
+	other := content(testPubB, "6.6.6.6")
+	other["invite"] = "6.6.6.6:8008:" + testPubA + "~secret"
+	r.False(announce(testPubB, other, 11))
+	// the invites of the config are not replaced
+	r.False(announce(configured, content(configured, "7.7.7.7"), 12))
+	// an older message does not replace a newer one
+	r.False(announce(testPubA, content(testPubA, "8.8.8.8"), 9))
+	r.True(announce(testPubA, content(testPubA, "9.9.9.9"), 13))
+	r.False(announce(testPubA, map[string]interface{}{"type": "post", "text": "hi"}, 14))
+	// no loopback, private or link-local hosts and apis
+	for _, host := range []string{"127.0.0.1", "localhost", "10.1.2.3", "192.168.1.1", "169.254.169.254", "::1", "fd00::1", "0.0.0.0"} {
+		r.False(announce(testPubA, content(testPubA, host), 15), host)
+		internal := content(testPubA, "9.9.9.9")
+		internal["api"] = "http://" + net.JoinHostPort(host, "10008")
+		r.False(announce(testPubA, internal, 15), host)
+	}
+
+	pubs := d.list()
+	r.Len(pubs, 3)
+	for _, pi := range pubs {
+		switch pi.PubID {
+		case testPubA:
+			r.True(pi.Announced)
+			r.Equal("9.9.9.9", pi.Host)
+			r.Equal(50, pi.Capacity)
+			r.Equal("http://9.9.9.9:10008", pi.API)
+		case configured:
+			r.False(pi.Announced)
+			r.Equal("13.213.41.31", pi.Host)
+		}
+	}
+
+	// the directory keeps max_announced announced pubs
+	d.maxAnnounced = 2
+	r.True(announce(testPubB, content(testPubB, "6.6.6.6"), 16))
+	r.False(announce(testPubC, content(testPubC, "7.7.7.7"), 17))
+	r.True(announce(testPubB, content(testPubB, "8.8.8.8"), 18), "a known pub can move")
+	r.Len(d.list(), 4)
+}
+
+// TestImportPubAnnouncement only the announcements of the trusted feeds end up in the directory and in the database
+func TestImportPubAnnouncement(t *testing.T) {
+	r := require.New(t)
+	dir, err := ioutil.TempDir("", "directory")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+
+	cfg := params.DefaultConfig()
+	cfg.Invites = nil
+	cfg.Directory.TrustedAnnouncers = []string{testPubB}
+	s := newTestService(t, dir, cfg, &idleBackend{})
+	defer s.db.Close()
+
+	for _, author := range []string{testPubB, testPubC} {
+		content, err := json.Marshal(map[string]interface{}{
+			"type":    "pub",
+			"address": map[string]interface{}{"host": "5.5.5.5", "port": 8008, "key": author},
+		})
+		r.NoError(err)
+		s.importPubAnnouncement(author, content, 10)
+	}
+	pubs := s.pubs.list()
+	r.Len(pubs, 1)
+	r.Equal(testPubB, pubs[0].PubID)
+
+	// a feed that is no longer trusted is left out at the next start
+	cfg.Directory.TrustedAnnouncers = nil
+	s.pubs = newPubDirectory(cfg)
+	r.NoError(s.loadPubAnnouncements())
+	r.Empty(s.pubs.list())
+	cfg.Directory.TrustedAnnouncers = []string{testPubB}
+	r.NoError(s.loadPubAnnouncements())
+	r.Len(s.pubs.list(), 1)
+}
+
+// peersBackend a ssb server with n peers
+type peersBackend int
+
+func (peersBackend) logStream(ctx context.Context, gt int64) (messageSource, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (peersBackend) publish(ctx context.Context, content interface{}) (string, error) {
+	return "%none.sha256", nil
+}
+
+func (n peersBackend) status(ctx context.Context) (ssb.Status, error) {
+	return ssb.Status{Peers: make([]ssb.PeerStatus, n)}, nil
+}
+
+func (peersBackend) messageAuthor(ctx context.Context, key string) (string, error) {
+	return "", fmt.Errorf("no message %s", key)
+}
+
+func (peersBackend) search(ctx context.Context, qry message.SearchArgs) ([]DeserializedMessageStu, error) {
+	return nil, nil
+}
+
+// TestProbePubs this pub is asked directly, a pub with an api for its pub-status and the others are dialed
+func TestProbePubs(t *testing.T) {
+	r := require.New(t)
+
+	// the other pub, with one peer
+	other := &Service{cfg: params.DefaultConfig(), pubID: testPubB, backend: peersBackend(1)}
+	other.cfg.Directory.Capacity = 20
+	api := rest.NewApi()
+	router, err := rest.MakeRouter(rest.Get("/ssb/api/pub-status", other.GetPubStatus))
+	r.NoError(err)
+	api.SetApp(router)
+	srv := httptest.NewServer(api.MakeHandler())
+	defer srv.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	r.NoError(err)
+	deadPort := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	cfg := params.DefaultConfig()
+	cfg.Directory.Capacity = 10
+	cfg.Invites = []params.InviteConfig{
+		{Code: "127.0.0.1:8008:" + testPubA + "~secret"},
+		{Code: "127.0.0.1:8008:" + testPubB + "~secret", API: srv.URL},
+		{Code: "127.0.0.1:" + strconv.Itoa(deadPort) + ":" + testPubC + "~secret"},
+	}
+	s := &Service{cfg: cfg, pubID: testPubA, backend: peersBackend(3), pubs: newPubDirectory(cfg), geoip: newGeoIPDB("/nonexistent", kitlog.NewNopLogger())}
+	// an announced pub whose name resolves to the api of the other pub, it is not asked
+	r.True(s.pubs.announce(&PubInfo{PubID: testDefendant, Host: "5.5.5.5", Port: 8008, API: srv.URL, Announced: true, Load: -1, Healthy: true}))
+	for _, pi := range s.pubs.list() {
+		s.probePub(context.Background(), pi)
+	}
+
+	got := make(map[string]PubInfo)
+	for _, pi := range s.pubs.list() {
+		r.NotZero(pi.ProbeTime)
+		got[pi.PubID] = pi
+	}
+	r.True(got[testPubA].Healthy)
+	r.Equal(3, got[testPubA].Load)
+	r.True(got[testPubB].Healthy)
+	r.Equal(1, got[testPubB].Load)
+	r.Equal(20, got[testPubB].Capacity)
+	r.False(got[testPubC].Healthy)
+	r.Equal(-1, got[testPubC].Load)
+	r.False(got[testDefendant].Healthy)
+	r.Equal(-1, got[testDefendant].Load)
+
+	// the client ip is not in the database, the ranking falls back to the load
+	req := httptest.NewRequest(http.MethodGet, "/ssb/api/get-pubhost-by-ip?n=2", nil)
+	rec := httptest.NewRecorder()
+	api = rest.NewApi()
+	router, err = rest.MakeRouter(rest.Get("/ssb/api/get-pubhost-by-ip", s.GetPublicIPLocation))
+	r.NoError(err)
+	api.SetApp(router)
+	api.MakeHandler().ServeHTTP(rec, req)
+
+	var resp APIResponse
+	r.NoError(json.Unmarshal(rec.Body.Bytes(), &resp))
+	r.Equal(SUCCESS, resp.ErrorCode, resp.ErrorMsg)
+	var pbi PubInfoByIP
+	r.NoError(json.Unmarshal(resp.Data, &pbi))
+	r.Len(pbi.Candidates, 2)
+	r.Equal(testPubB, pbi.Candidates[0].PubID)
+	r.Equal(testPubA, pbi.Candidates[1].PubID)
+	r.Equal(srv.Listener.Addr().String(), pbi.FirstChoicePubHost)
+	r.Equal("127.0.0.1:10008", pbi.SecondChoicePubHost)
+}
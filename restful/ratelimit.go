@@ -0,0 +1,237 @@
+package restful
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"go.cryptoscope.co/ssb/restful/params"
+	"go.cryptoscope.co/ssb/restful/rerr"
+)
+
+// maxPeekBody how much of a request body is read to find the feed of the caller
+const maxPeekBody = 1 << 20
+
+// bucketPruneEvery full (idle) buckets are dropped after this many calls
+const bucketPruneEvery = 4096
+
+// tokenBucket is refilled with rate tokens per second up to burst
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// refill adds the tokens since the last call, it returns true if the bucket is full
+func (b *tokenBucket) refill(now time.Time, rate float64, burst int) bool {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens += elapsed * rate
+		b.last = now
+	}
+	if b.tokens >= float64(burst) {
+		b.tokens = float64(burst)
+		return true
+	}
+	return false
+}
+
+// ready refills the bucket and reports whether a token can be taken
+func (b *tokenBucket) ready(now time.Time, rate float64, burst int) bool {
+	b.refill(now, rate, burst)
+	return b.tokens >= 1
+}
+
+// RateLimitCounter allowed and rejected calls of a route
+type RateLimitCounter struct {
+	Allowed          int64 `json:"allowed"`
+	RejectedByIP     int64 `json:"rejected_by_ip"`
+	RejectedByFeed   int64 `json:"rejected_by_feed"`
+	LastRejectedTime int64 `json:"last_rejected_time"`
+}
+
+// RateLimitMiddleware limits the calls of the routes in Rules with a token bucket per client ip and per feed.
+// It runs after the AttestationMiddleware, on the attested routes the feed is the one that signed the request.
+type RateLimitMiddleware struct {
+	Rules map[string]params.RateLimitRule
+
+	mu       sync.Mutex
+	buckets  map[string]*tokenBucket
+	counters map[string]*RateLimitCounter
+	calls    int
+
+	// proxies the X-Forwarded-For of their requests is the ip of the caller
+	proxies trustedProxies
+
+	now func() time.Time
+}
+
+// NewRateLimitMiddleware creates a rate limiter for the routes of rules
+func NewRateLimitMiddleware(rules map[string]params.RateLimitRule) *RateLimitMiddleware {
+	return &RateLimitMiddleware{
+		Rules:    rules,
+		buckets:  make(map[string]*tokenBucket),
+		counters: make(map[string]*RateLimitCounter),
+		now:      time.Now,
+	}
+}
+
+// MiddlewareFunc makes RateLimitMiddleware implement the rest.Middleware interface
+func (rl *RateLimitMiddleware) MiddlewareFunc(h rest.HandlerFunc) rest.HandlerFunc {
+	return func(w rest.ResponseWriter, r *rest.Request) {
+		path := r.URL.Path
+		rule, ok := rl.Rules[path]
+		if !ok {
+			h(w, r)
+			return
+		}
+
+		var feed string
+		if attested, ok := r.Env[attestedFeedEnv]; ok {
+			// only the feed that signed the request is charged, an unsigned request only has its ip bucket
+			feed, _ = attested.(string)
+		} else if rule.PerFeedRate > 0 {
+			feed = peekRequestFeed(r.Request)
+		}
+
+		rejected := rl.allow(path, rule, rl.proxies.clientIP(r.Request), feed)
+		if rejected != "" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			writejson(w, NewExceptionAPIResponse(rerr.ErrTooManyRequests.Append(rejected)))
+			return
+		}
+		h(w, r)
+	}
+}
+
+// allow takes a token from the ip and the feed bucket of the route, it returns why the call is rejected or ""
+func (rl *RateLimitMiddleware) allow(path string, rule params.RateLimitRule, ip, feed string) (rejected string) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	counter, ok := rl.counters[path]
+	if !ok {
+		counter = &RateLimitCounter{}
+		rl.counters[path] = counter
+	}
+
+	rl.calls++
+	if rl.calls%bucketPruneEvery == 0 {
+		rl.prune(now)
+	}
+
+	// a token is only taken if both buckets have one
+	var ipBucket, feedBucket *tokenBucket
+	if rule.PerIPRate > 0 && ip != "" {
+		ipBucket = rl.bucket(path+"|ip|"+ip, now, rule.PerIPBurst)
+		if !ipBucket.ready(now, rule.PerIPRate, rule.PerIPBurst) {
+			counter.RejectedByIP++
+			counter.LastRejectedTime = now.UnixNano() / 1e6
+			return "too many requests from " + ip
+		}
+	}
+	if rule.PerFeedRate > 0 && feed != "" {
+		feedBucket = rl.bucket(path+"|feed|"+feed, now, rule.PerFeedBurst)
+		if !feedBucket.ready(now, rule.PerFeedRate, rule.PerFeedBurst) {
+			counter.RejectedByFeed++
+			counter.LastRejectedTime = now.UnixNano() / 1e6
+			return "too many requests for " + feed
+		}
+	}
+	if ipBucket != nil {
+		ipBucket.tokens--
+	}
+	if feedBucket != nil {
+		feedBucket.tokens--
+	}
+	counter.Allowed++
+	return ""
+}
+
+// bucket returns the bucket of key, a new bucket starts full
+func (rl *RateLimitMiddleware) bucket(key string, now time.Time, burst int) *tokenBucket {
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(burst), last: now}
+		rl.buckets[key] = b
+	}
+	return b
+}
+
+// prune drops the buckets that are full again, they behave the same as new ones
+func (rl *RateLimitMiddleware) prune(now time.Time) {
+	for key, b := range rl.buckets {
+		path := key[:strings.Index(key, "|")]
+		rule := rl.Rules[path]
+		rate, burst := rule.PerIPRate, rule.PerIPBurst
+		if strings.HasPrefix(key[len(path):], "|feed|") {
+			rate, burst = rule.PerFeedRate, rule.PerFeedBurst
+		}
+		if b.refill(now, rate, burst) {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// Counters returns a copy of the counters of all limited routes
+func (rl *RateLimitMiddleware) Counters() map[string]RateLimitCounter {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	counters := make(map[string]RateLimitCounter, len(rl.counters))
+	for path, c := range rl.counters {
+		counters[path] = *c
+	}
+	return counters
+}
+
+// peekRequestBody reads up to maxPeekBody of the body of a request and restores the body for the handler
+func peekRequestBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxPeekBody))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	return body, err
+}
+
+// peekRequestFeed reads the feed a request is made for from its json body
+func peekRequestFeed(r *http.Request) string {
+	body, err := peekRequestBody(r)
+	if err != nil || len(body) == 0 {
+		return ""
+	}
+	var who struct {
+		ClientID  string `json:"client_id"`
+		Plaintiff string `json:"plaintiff"`
+		Author    string `json:"author"`
+	}
+	if json.Unmarshal(body, &who) != nil {
+		return ""
+	}
+	switch {
+	case who.ClientID != "":
+		return who.ClientID
+	case who.Plaintiff != "":
+		return who.Plaintiff
+	}
+	return who.Author
+}
+
+// GetRateLimitStats counters of the rate limited routes
+func (s *Service) GetRateLimitStats(w rest.ResponseWriter, r *rest.Request) {
+	var resp *APIResponse
+	defer func() {
+		writejson(w, resp)
+	}()
+	resp = NewAPIResponse(nil, s.rateLimiter.Counters())
+}
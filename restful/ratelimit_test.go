@@ -0,0 +1,85 @@
+package restful
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"go.cryptoscope.co/ssb/restful/params"
+)
+
+func TestRateLimitBuckets(t *testing.T) {
+	r := require.New(t)
+
+	const path = "/ssb/api/notify-login"
+	rule := params.RateLimitRule{PerIPRate: 1, PerIPBurst: 3, PerFeedRate: 0.1, PerFeedBurst: 2}
+	rl := NewRateLimitMiddleware(map[string]params.RateLimitRule{path: rule})
+
+	now := time.Unix(1656800000, 0)
+	rl.now = func() time.Time { return now }
+
+	// the feed bucket is the smaller one
+	r.Equal("", rl.allow(path, rule, "1.2.3.4", "@alice"))
+	r.Equal("", rl.allow(path, rule, "1.2.3.4", "@alice"))
+	r.NotEqual("", rl.allow(path, rule, "1.2.3.4", "@alice"))
+
+	// another feed from the same ip uses up the ip bucket
+	r.Equal("", rl.allow(path, rule, "1.2.3.4", "@bob"))
+	r.NotEqual("", rl.allow(path, rule, "1.2.3.4", "@bob"))
+
+	// other ips are not affected
+	r.Equal("", rl.allow(path, rule, "5.6.7.8", "@carol"))
+
+	// refilled after a while
+	now = now.Add(10 * time.Second)
+	r.Equal("", rl.allow(path, rule, "1.2.3.4", "@alice"))
+
+	c := rl.Counters()[path]
+	r.EqualValues(5, c.Allowed)
+	r.EqualValues(1, c.RejectedByIP)
+	r.EqualValues(1, c.RejectedByFeed)
+
+	// full buckets are dropped
+	now = now.Add(time.Hour)
+	rl.prune(now)
+	r.Len(rl.buckets, 0)
+}
+
+// TestClientIP the forwarding headers only count on the connections of a trusted proxy
+func TestClientIP(t *testing.T) {
+	r := require.New(t)
+
+	tp, err := parseTrustedProxies([]string{"10.0.0.1", "192.168.0.0/16"})
+	r.NoError(err)
+	_, err = parseTrustedProxies([]string{"proxy.local"})
+	r.Error(err)
+
+	req := func(remote, forwardedFor, realIP string) *http.Request {
+		hr := httptest.NewRequest(http.MethodPost, "/ssb/api/tipped-who-off", nil)
+		hr.RemoteAddr = remote
+		if forwardedFor != "" {
+			hr.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		if realIP != "" {
+			hr.Header.Set("X-Real-Ip", realIP)
+		}
+		return hr
+	}
+
+	// a caller can not choose its bucket
+	r.Equal("5.6.7.8", tp.clientIP(req("5.6.7.8:1234", "1.1.1.1", "2.2.2.2")))
+	r.Equal("5.6.7.8", clientPublicIP(req("5.6.7.8:1234", "1.1.1.1", ""), nil))
+
+	// behind the proxies the first hop from the right that is no proxy is the caller, what it sent itself is ignored
+	r.Equal("1.2.3.4", tp.clientIP(req("10.0.0.1:1234", "9.9.9.9, 1.2.3.4, 192.168.1.7", "")))
+	r.Equal("1.2.3.4", tp.clientIP(req("10.0.0.1:1234", "", "1.2.3.4")))
+	r.Equal("192.168.1.7", tp.clientIP(req("10.0.0.1:1234", "junk, 192.168.1.7", "")))
+	r.Equal("10.0.0.1", tp.clientIP(req("10.0.0.1:1234", "", "")))
+
+	// local callers have no public ip
+	r.Equal("", clientPublicIP(req("127.0.0.1:1234", "8.8.8.8", ""), nil))
+	r.Equal("8.8.8.8", clientPublicIP(req("10.0.0.1:1234", "8.8.8.8", ""), tp))
+}
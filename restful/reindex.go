@@ -0,0 +1,172 @@
+package restful
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	kitlog "go.mindeco.de/log"
+	"go.mindeco.de/log/level"
+
+	"go.cryptoscope.co/ssb/restful/params"
+)
+
+// ReindexReport what a reindex did, Tables compares the tables the analysis fills from the log
+type ReindexReport struct {
+	// Path the reindexed database, the database of the config after a swap
+	Path     string       `json:"path"`
+	Messages int          `json:"messages"`
+	Tables   []*TableDiff `json:"tables"`
+	// Backup the existing database before the swap, empty without a swap
+	Backup string `json:"backup,omitempty"`
+}
+
+// Equal the reindexed database has the same rows as the existing one
+func (rr *ReindexReport) Equal() bool {
+	for _, d := range rr.Tables {
+		if !d.Equal() {
+			return false
+		}
+	}
+	return true
+}
+
+// Reindex replays the whole receive log of the pub of cfg through the analysis into a fresh database next to the one of cfg.
+// Nothing is paid and nothing is published, the rows that come from the api and the payouts are copied from the existing database.
+// With swap the fresh database replaces the existing one, which is kept as a backup, the services of the pub must be stopped for it.
+func Reindex(ctx context.Context, cfg *params.Config, swap bool, logger kitlog.Logger) (*ReindexReport, error) {
+	connCtx, closeConn := context.WithCancel(context.Background())
+	defer closeConn()
+
+	backend, pubID, err := newMuxrpcBackend(connCtx, &cfg.Pub, logger)
+	if err != nil {
+		return nil, fmt.Errorf("reindex: %w", err)
+	}
+	return reindex(ctx, cfg, pubID, backend, swap, logger)
+}
+
+func reindex(ctx context.Context, cfg *params.Config, pubID string, backend ssbBackend, swap bool, logger kitlog.Logger) (*ReindexReport, error) {
+	existing := cfg.Pub.DataDir
+	fresh := existing + ".reindex"
+	s, err := newReplayService(cfg, pubID, backend, fresh, logger)
+	if err != nil {
+		return nil, fmt.Errorf("reindex: %w", err)
+	}
+	rr, err := s.replayLog(ctx, existing)
+	if cerr := s.db.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reindex: %w", err)
+	}
+	rr.Path = fresh
+	if swap {
+		if rr.Backup, err = swapDatabase(existing, fresh, time.Now()); err != nil {
+			return nil, fmt.Errorf("reindex: %w", err)
+		}
+		rr.Path = existing
+	}
+	return rr, nil
+}
+
+// newReplayService a service for the pub of cfg that analyzes into a fresh database at path, next to the existing database of cfg.
+// It pays nothing and publishes nothing, the rows of the existing database that do not come from the log are copied.
+func newReplayService(cfg *params.Config, pubID string, backend ssbBackend, path string, logger kitlog.Logger) (*Service, error) {
+	existing := cfg.Pub.DataDir
+	if _, err := os.Stat(existing); err != nil {
+		return nil, fmt.Errorf("existing database: %w", err)
+	}
+	//旧数据库先补齐表结构,以便复制和比较
+	cur, err := OpenPubDB(existing, pubID)
+	if err != nil {
+		return nil, fmt.Errorf("open existing database: %w", err)
+	}
+	if err = cur.Close(); err != nil {
+		return nil, err
+	}
+
+	if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("remove the database of an earlier replay: %w", err)
+	}
+	levels, err := newLogLevels(cfg.Log)
+	if err != nil {
+		return nil, err
+	}
+	rcfg := *cfg
+	rcfg.Pub.DataDir = path
+	s := &Service{
+		cfg:       &rcfg,
+		pubID:     pubID,
+		backend:   backend,
+		log:       kitlog.With(logger, "pub", pubID),
+		logLevels: levels,
+		pubs:      newPubDirectory(cfg),
+
+		analyzedSeq: -1,
+		replay:      true,
+	}
+	if err = s.initAnalysis(); err != nil {
+		return nil, err
+	}
+	if err = s.db.CopyReindexState(existing); err != nil {
+		s.db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// replayLog analyzes the receive log from its start into the database of s and compares it with the database file existing
+func (s *Service) replayLog(ctx context.Context, existing string) (*ReindexReport, error) {
+	alog := s.logger(logAnalysis)
+	level.Info(alog).Log("event", "replaying the receive log", "into", s.cfg.Pub.DataDir)
+	src, err := s.backend.logStream(ctx, 0)
+	if err != nil {
+		return nil, fmt.Errorf("log stream: %w", err)
+	}
+	_, messages, err := s.SsbMessageAnalysis(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+
+	//每个被投票的消息至少查找一次作者
+	targets, err := s.db.SelectUnresolvedVoteTargets(-1)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(targets); i += resolveVoteTargetsLimit {
+		if err = s.resolveVoteTargets(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if err = s.db.UpdateAnalysisState(votesIndexedState, 1); err != nil {
+		return nil, err
+	}
+	if err = s.db.CopySensitiveWordDecisions(existing); err != nil {
+		return nil, err
+	}
+	//激励结果是复制过来的,汇总表重新生成
+	if err = s.db.RebuildDailyRollups(); err != nil {
+		return nil, fmt.Errorf("rebuild daily rollups: %w", err)
+	}
+
+	tables, err := s.db.DiffReindex(existing)
+	if err != nil {
+		return nil, err
+	}
+	level.Info(alog).Log("event", "receive log replayed", "messages", messages)
+	return &ReindexReport{Messages: messages, Tables: tables}, nil
+}
+
+// swapDatabase replaces the database file existing with fresh in one rename, existing stays as a backup next to it
+func swapDatabase(existing, fresh string, now time.Time) (backup string, err error) {
+	backup = existing + ".bak-" + now.UTC().Format("20060102T150405")
+	if err = os.Link(existing, backup); err != nil {
+		return "", fmt.Errorf("backup %s: %w", existing, err)
+	}
+	if err = os.Rename(fresh, existing); err != nil {
+		os.Remove(backup)
+		return "", fmt.Errorf("swap in %s: %w", fresh, err)
+	}
+	return backup, nil
+}
@@ -0,0 +1,56 @@
+package restful
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSwapDatabase(t *testing.T) {
+	r := require.New(t)
+	dir, err := ioutil.TempDir("", "reindex")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+
+	existing := filepath.Join(dir, "pubdata")
+	fresh := existing + ".reindex"
+	r.NoError(ioutil.WriteFile(existing, []byte("existing"), 0600))
+	r.NoError(ioutil.WriteFile(fresh, []byte("fresh"), 0600))
+
+	backup, err := swapDatabase(existing, fresh, time.Date(2022, 3, 4, 15, 4, 5, 0, time.UTC))
+	r.NoError(err)
+	r.Equal(existing+".bak-20220304T150405", backup)
+
+	data, err := ioutil.ReadFile(existing)
+	r.NoError(err)
+	r.Equal("fresh", string(data))
+	data, err = ioutil.ReadFile(backup)
+	r.NoError(err)
+	r.Equal("existing", string(data))
+	_, err = os.Stat(fresh)
+	r.True(os.IsNotExist(err))
+
+	// nothing to swap in, the existing database stays and no backup is left
+	_, err = swapDatabase(existing, fresh, time.Date(2022, 3, 4, 16, 0, 0, 0, time.UTC))
+	r.Error(err)
+	data, err = ioutil.ReadFile(existing)
+	r.NoError(err)
+	r.Equal("fresh", string(data))
+	_, err = os.Stat(existing + ".bak-20220304T160000")
+	r.True(os.IsNotExist(err))
+}
+
+func TestReindexReportEqual(t *testing.T) {
+	r := require.New(t)
+	rr := &ReindexReport{Tables: []*TableDiff{
+		{Table: "votes", Existing: 3, Reindexed: 3},
+		{Table: "usertaskcollect", Existing: 2, Reindexed: 3, OnlyReindex: 1},
+	}}
+	r.False(rr.Equal())
+	rr.Tables[1] = &TableDiff{Table: "usertaskcollect", Existing: 2, Reindexed: 2}
+	r.True(rr.Equal())
+}
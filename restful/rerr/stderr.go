@@ -310,6 +310,27 @@ var (
 	//ErrSubScribeNeighbor 订阅节点在线信息错误
 	ErrSubScribeNeighbor = newError(6001, "ErrSubScribeNeighbor")
 
+	/*
+		Metalife restful api error
+	*/
+
+	//ErrTooManyRequests 请求过于频繁,被限流
+	ErrTooManyRequests = newError(7000, "TooManyRequests")
+	//ErrAttestationMissing 请求缺少客户端签名
+	ErrAttestationMissing = newError(7001, "AttestationMissing")
+	//ErrAttestationInvalid 客户端签名验证失败
+	ErrAttestationInvalid = newError(7002, "AttestationInvalid")
+	//ErrAttestationExpired 签名时间超出允许的时间窗口
+	ErrAttestationExpired = newError(7003, "AttestationExpired")
+	//ErrAttestationReplayed 签名已经使用过,重放请求
+	ErrAttestationReplayed = newError(7004, "AttestationReplayed")
+	//ErrAlreadyLoggedInToday 今天已经登录过,每日登录只记录一次
+	ErrAlreadyLoggedInToday = newError(7005, "AlreadyLoggedInToday")
+	//ErrNoPubAvailable 目录中没有可以推荐给客户端的pub
+	ErrNoPubAvailable = newError(7006, "NoPubAvailable")
+	//ErrNotLocalRequest 管理接口只接受来自pub所在主机的请求
+	ErrNotLocalRequest = newError(7007, "NotLocalRequest")
+
 	// ErrUnknown 未知错误
 	ErrUnknown = newError(9999, "unknown error")
 )
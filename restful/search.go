@@ -0,0 +1,87 @@
+package restful
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ant0ine/go-json-rest/rest"
+
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/restful/rerr"
+)
+
+const (
+	// defaultSearchLimit page size of a search without a limit
+	defaultSearchLimit = 20
+	// maxSearchLimit the largest page of a search
+	maxSearchLimit = 100
+)
+
+// SearchPage the public messages that contain all the terms of a search, GET /ssb/api/search.
+// Newest first by the time the authors claim, the next page is the same search with before=next_before
+type SearchPage struct {
+	Messages   []DeserializedMessageStu `json:"messages"`
+	NextBefore int64                    `json:"next_before,omitempty"`
+}
+
+// parseSearchQuery reads ?q=&limit=&before= into the arguments of search.query, private messages are never searched
+func parseSearchQuery(query url.Values) (qry message.SearchArgs, err error) {
+	qry.Query = strings.TrimSpace(query.Get("q"))
+	if qry.Query == "" {
+		return qry, fmt.Errorf("q is required")
+	}
+	qry.Keys = true
+	qry.Limit = defaultSearchLimit
+	if s := query.Get("limit"); s != "" {
+		if qry.Limit, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return qry, fmt.Errorf("limit: %w", err)
+		}
+		if qry.Limit <= 0 || qry.Limit > maxSearchLimit {
+			return qry, fmt.Errorf("limit must be between 1 and %d", maxSearchLimit)
+		}
+	}
+	if s := query.Get("before"); s != "" {
+		before, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return qry, fmt.Errorf("before: %w", err)
+		}
+		if before <= 0 {
+			return qry, fmt.Errorf("before must be positive")
+		}
+		qry.Lt = message.RoundedInteger(before)
+	}
+	return qry, nil
+}
+
+// newSearchPage the page of msgs, it has a next page if it is full
+func newSearchPage(msgs []DeserializedMessageStu, limit int64) *SearchPage {
+	page := &SearchPage{Messages: msgs}
+	if page.Messages == nil {
+		page.Messages = []DeserializedMessageStu{}
+	}
+	if n := len(msgs); n > 0 && int64(n) >= limit && msgs[n-1].Value != nil {
+		page.NextBefore = int64(msgs[n-1].Value.Timestamp)
+	}
+	return page
+}
+
+// Search the full-text search of the pub over posts and abouts, the pub needs the search index enabled
+func (s *Service) Search(w rest.ResponseWriter, r *rest.Request) {
+	var resp *APIResponse
+	defer func() {
+		writejson(w, resp)
+	}()
+	qry, err := parseSearchQuery(r.URL.Query())
+	if err != nil {
+		resp = NewAPIResponse(rerr.ErrArgumentError.AppendError(err), nil)
+		return
+	}
+	msgs, err := s.backend.search(r.Context(), qry)
+	if err != nil {
+		resp = NewAPIResponse(err, nil)
+		return
+	}
+	resp = NewAPIResponse(nil, newSearchPage(msgs, qry.Limit))
+}
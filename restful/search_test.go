@@ -0,0 +1,53 @@
+package restful
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"go.cryptoscope.co/ssb/message"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	r := require.New(t)
+
+	qry, err := parseSearchQuery(url.Values{"q": {" hello world "}})
+	r.NoError(err)
+	r.Equal("hello world", qry.Query)
+	r.Equal(int64(defaultSearchLimit), qry.Limit)
+	r.Equal(message.RoundedInteger(0), qry.Lt)
+	r.False(qry.Private)
+
+	qry, err = parseSearchQuery(url.Values{"q": {"hello"}, "limit": {"5"}, "before": {"1646092800000"}})
+	r.NoError(err)
+	r.Equal(int64(5), qry.Limit)
+	r.Equal(message.RoundedInteger(1646092800000), qry.Lt)
+
+	for _, q := range []url.Values{
+		{},
+		{"q": {"  "}},
+		{"q": {"hello"}, "limit": {"0"}},
+		{"q": {"hello"}, "limit": {"1000"}},
+		{"q": {"hello"}, "before": {"yesterday"}},
+		{"q": {"hello"}, "before": {"-1"}},
+	} {
+		_, err := parseSearchQuery(q)
+		r.Error(err, "%v", q)
+	}
+}
+
+func TestNewSearchPage(t *testing.T) {
+	r := require.New(t)
+
+	page := newSearchPage(nil, 20)
+	r.NotNil(page.Messages)
+	r.Zero(page.NextBefore)
+
+	msgs := []DeserializedMessageStu{
+		{Key: "%a.sha256", Value: &MessageValue{Timestamp: 2000}},
+		{Key: "%b.sha256", Value: &MessageValue{Timestamp: 1000}},
+	}
+	r.Zero(newSearchPage(msgs, 20).NextBefore)
+	r.Equal(int64(1000), newSearchPage(msgs, 2).NextBefore)
+}
@@ -3,26 +3,18 @@ package restful
 import (
 	"bytes"
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"math/big"
 	"net"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/ant0ine/go-json-rest/rest"
-	"go.cryptoscope.co/muxrpc/v2"
-	"go.cryptoscope.co/netwrap"
-	"go.cryptoscope.co/secretstream"
-	ssbClient "go.cryptoscope.co/ssb/client"
 	"go.cryptoscope.co/ssb/restful/params"
 	kitlog "go.mindeco.de/log"
 	"go.mindeco.de/log/level"
-	"golang.org/x/crypto/ed25519"
-	"gopkg.in/urfave/cli.v2"
 
 	/*"go.cryptoscope.co/ssb/message"
 	"go.mindeco.de/ssb-refs"*/
@@ -34,28 +26,9 @@ import (
 
 	"errors"
 
-	"go.cryptoscope.co/ssb"
 	"go.cryptoscope.co/ssb/dfa"
-	"go.cryptoscope.co/ssb/message"
-	refs "go.mindeco.de/ssb-refs"
 )
 
-var Config *params.ApiConfig
-
-var longCtx context.Context
-
-var quitSignal chan struct{}
-
-var client *ssbClient.Client
-
-var log kitlog.Logger
-
-var lastAnalysisTimesnamp int64
-
-var likeDB *PubDB
-
-var dfax *dfa.DFA
-
 const (
 	SignUp                = "sign up"
 	PostMessage           = "post message"
@@ -67,310 +40,312 @@ const (
 	ReportProblematicPost = "report problematic post"
 )
 
-// Start
-func Start(ctx *cli.Context) {
-	Config = params.NewApiServeConfig()
-	longCtx = ctx
+// Start runs the restful api and the message analysis for the pub of cfg, until runCtx is done.
+// The running requests, the background loops and the outstanding payouts are finished before it returns,
+// logger gets the entries of all modules, filtered by the levels of the log section of cfg.
+func Start(runCtx context.Context, cfg *params.Config, logger kitlog.Logger) error {
+	// the connection to the pub stays open until the requests that still publish are done
+	connCtx, closeConn := context.WithCancel(context.Background())
+	defer closeConn()
 
-	sclient, err := newClient(ctx)
+	backend, pubID, err := newMuxrpcBackend(connCtx, &cfg.Pub, logger)
 	if err != nil {
-		level.Error(log).Log("Ssb restful api and message analysis service start err", err)
-		return
+		return fmt.Errorf("Ssb restful api and message analysis service start err: %w", err)
+	}
+
+	s, err := newService(cfg, pubID, backend, logger)
+	if err != nil {
+		return err
+	}
+	backend.log = s.logger(logBackend)
+
+	server, err := s.newAPIServer()
+	if err != nil {
+		return fmt.Errorf("make router err: %w", err)
 	}
-	client = sclient
+	ln, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return fmt.Errorf("restful api listen err: %w", err)
+	}
+	level.Info(s.logger(logAPI)).Log("event", "services started", "addr", server.Addr)
+
+	//go dealBlacklist()
+
+	return s.runServices(runCtx, server, ln)
+}
 
-	quitSignal := make(chan struct{})
+// newAPIServer the http server of the restful api, with the middlewares of the config
+func (s *Service) newAPIServer() (*http.Server, error) {
 	api := rest.NewApi()
-	if Config.Debug {
+	if s.cfg.API.Debug {
 		api.Use(rest.DefaultDevStack...)
 	} else {
 		api.Use(rest.DefaultProdStack...)
 	}
 	api.Use(rest.DefaultDevStack...)
-	router, err := rest.MakeRouter(
+	proxies, err := parseTrustedProxies(s.cfg.API.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	s.proxies = proxies
+	// outside of the rate limit and the attestation, so their rejections are logged too
+	api.Use(&AccessLogMiddleware{log: s.logger(logAPI), proxies: proxies})
+	// the feed buckets of the rate limit are only charged for the feeds that signed their requests
+	api.Use(NewAttestationMiddleware(s.cfg.Attestation.Routes, s.cfg.Attestation.Window.Duration, s.cfg.Attestation.Required, s.pubID))
+	s.rateLimiter = NewRateLimitMiddleware(s.cfg.RateLimit)
+	s.rateLimiter.proxies = proxies
+	api.Use(s.rateLimiter)
+	router, err := rest.MakeRouter(s.apiRoutes()...)
+	if err != nil {
+		return nil, err
+	}
 
+	api.SetApp(router)
+
+	listen := fmt.Sprintf("%s:%d", s.cfg.API.Host, s.cfg.API.Port)
+	return &http.Server{Addr: listen, Handler: s.metricsHandler(api.MakeHandler())}, nil
+}
+
+// apiRoutes the routes of the metalife restful api, restful/openapi.json describes the same routes
+func (s *Service) apiRoutes() []*rest.Route {
+	return []*rest.Route{
 		/*
 			ssb pub信息
 		*/
 		//pub's whoami
-		rest.Get("/ssb/api/pub-whoami", GetPubWhoami),
+		rest.Get("/ssb/api/pub-whoami", s.GetPubWhoami),
 
 		/*
 			ssb节点注册,信息查询,例如查询其绑定的钱包地址
 		*/
 		//get all 'about' message,e.g:'about'='eth address'
-		rest.Get("/ssb/api/node-info", clientid2Profiles),
+		rest.Get("/ssb/api/node-info", s.clientid2Profiles),
 		//get the 'about' message by client id ,e.g:'about'='eth address'
-		rest.Post("/ssb/api/node-info", clientid2Profile),
+		rest.Post("/ssb/api/node-info", s.clientid2Profile),
 		//register client's eth address to it's ID
-		rest.Post("/ssb/api/id2eth", UpdateEthAddr),
+		rest.Post("/ssb/api/id2eth", s.UpdateEthAddr),
 
 		/*
 			受赞统计
 		*/
 		//likes of all client
-		rest.Get("/ssb/api/likes", GetAllLikes),
+		rest.Get("/ssb/api/likes", s.GetAllLikes),
 		//likes of someone client
-		rest.Post("/ssb/api/likes", GetSomeoneLike),
+		rest.Post("/ssb/api/likes", s.GetSomeoneLike),
 
 		/*
 			点赞统计
 		*/
 		//get set like infos of all
-		rest.Get("/ssb/api/set-like-info", GetAllSetLikes),
+		rest.Get("/ssb/api/set-like-info", s.GetAllSetLikes),
 		//get set like info of someone client
-		rest.Post("/ssb/api/set-like-info", GetSomeoneSetLikes),
+		rest.Post("/ssb/api/set-like-info", s.GetSomeoneSetLikes),
 
 		/*
 			举报
 		*/
 		// tipped someone off 举报
-		rest.Post("/ssb/api/tipped-who-off", TippedOff),
+		rest.Post("/ssb/api/tipped-who-off", s.TippedOff),
 		//tipped off infomation 所有举报的信息汇总
-		rest.Post("/ssb/api/tippedoff-info", GetTippedOffInfo),
+		rest.Post("/ssb/api/tippedoff-info", s.GetTippedOffInfo),
+		//the same with query-string filters, paged or streamed as ndjson
+		rest.Get("/ssb/api/tippedoff-info", s.ListTippedOffInfo),
 		//tippedoff-deal pub管理员对举报的信息进行处理，认证，如属实，则对该账号进行黑名单处理
-		rest.Post("/ssb/api/tippedoff-deal", DealTippedOff),
+		rest.Post("/ssb/api/tippedoff-deal", s.DealTippedOff),
 
 		/*
 			敏感词
 		*/
 		//DealSensitiveWord pub管理对敏感词的处理/block or ignore
-		rest.Post("/ssb/api/sensitive-word-deal", DealSensitiveWord),
+		rest.Post("/ssb/api/sensitive-word-deal", s.DealSensitiveWord),
 		//get all sensitive-word-events from pub
-		rest.Post("/ssb/api/sensitive-word-events", GetEventSensitiveWord),
+		rest.Post("/ssb/api/sensitive-word-events", s.GetEventSensitiveWord),
 
 		/*
 			用户每日任务,数据类型：1-登录 2-发帖(Pub自动处理) 3-评论(Pub自动处理) 4-铸造NFT
 		*/
 		//notify pub the login infomation, pub will collect through this interface
-		rest.Post("/ssb/api/notify-login", NotifyUserLogin),
+		rest.Post("/ssb/api/notify-login", s.NotifyUserLogin),
 		//[temporary scheme] notify the pub that user have created a NFT in metalife app
-		rest.Post("/ssb/api/notify-created-nft", NotifyCreatedNFT),
+		rest.Post("/ssb/api/notify-created-nft", s.NotifyCreatedNFT),
 		//get some user daily task infos from pub,
 		//a message may appear in multiple pubs, and the client removes redundant data through messagekey and pub id
 		//used by supernode to awarding or ssb-client
-		rest.Post("/ssb/api/get-user-daily-task", GetUserDailyTasks),
+		rest.Post("/ssb/api/get-user-daily-task", s.GetUserDailyTasks),
 
 		/*
 			激励查询
 		*/
 		//get all or someones' reward information in PUB RULE
-		rest.Post("/ssb/api/get-reward-info", GetRewardInfo),
-
-		rest.Post("/ssb/api/get-reward-subtotals", GetRewardSubtotals),
-
-		rest.Get("/ssb/api/get-pubhost-by-ip", GetPublicIPLocation),
-	)
-	if err != nil {
-		level.Error(log).Log("make router err", err)
-		return
-	}
-
-	api.SetApp(router)
-
-	listen := fmt.Sprintf("%s:%d", Config.Host, Config.Port)
-	server := &http.Server{Addr: listen, Handler: api.MakeHandler()}
-	go server.ListenAndServe()
-	fmt.Println(fmt.Sprintf(PrintTime() + "ssb restful api and message analysis service start...\nWelcome..."))
-
-	go DoMessageTask(ctx)
-
-	//go dealBlacklist()
-
-	//检查pub 与 所有metalife内已注册eth地址的账户的通道余额，按规定补充
-	//每隔10分钟检查一次
-	go checkPubChannelBalance()
+		rest.Post("/ssb/api/get-reward-info", s.GetRewardInfo),
+		//the same with query-string filters, paged or streamed as ndjson
+		rest.Get("/ssb/api/get-reward-info", s.ListRewardInfo),
 
-	//补发激励，
-	go backPay()
+		rest.Post("/ssb/api/get-reward-subtotals", s.GetRewardSubtotals),
 
-	<-quitSignal
-	err = server.Shutdown(context.Background())
-	if err != nil {
-		fmt.Println(fmt.Sprintf(PrintTime()+"API restful service Shutdown err : %s", err))
-	}
-}
-
-// newClient creat a client link to ssb-server
-func newClient(ctx *cli.Context) (*ssbClient.Client, error) {
-	sockPath := ctx.String("unixsock")
-	if sockPath != "" {
-		client, err := ssbClient.NewUnix(sockPath, ssbClient.WithContext(longCtx))
-		if err != nil {
-			level.Debug(log).Log("client", "unix-path based init failed", "err", err)
-			level.Info(log).Log("client", "Now try switching to TCP working mode and init it")
-			return newTCPClient(ctx)
-		}
-		level.Info(log).Log("client", "connected", "method", "unix sock")
-		return client, nil
-	}
+		/*
+			用户看板,按天汇总的发帖,评论,点赞,激励和举报状态
+		*/
+		rest.Get("/ssb/api/dashboard", s.GetUserDashboard),
 
-	// Assume TCP connection
-	return newTCPClient(ctx)
-}
+		rest.Get("/ssb/api/get-pubhost-by-ip", s.GetPublicIPLocation),
 
-// newTCPClient create tcp client to support remote applications
-func newTCPClient(ctx *cli.Context) (*ssbClient.Client, error) {
-	localKey, err := ssb.LoadKeyPair(ctx.String("key"))
-	if err != nil {
-		return nil, err
-	}
+		/*
+			全文搜索,帖子和about的公开消息
+		*/
+		rest.Get("/ssb/api/search", s.Search),
 
-	var remotePubKey = make(ed25519.PublicKey, ed25519.PublicKeySize)
-	copy(remotePubKey, localKey.ID().PubKey())
-	if rk := ctx.String("remoteKey"); rk != "" {
-		rk = strings.TrimSuffix(rk, ".ed25519")
-		rk = strings.TrimPrefix(rk, "@")
-		rpk, err := base64.StdEncoding.DecodeString(rk)
-		if err != nil {
-			return nil, fmt.Errorf("Init: base64 decode of --remoteKey failed: %w", err)
-		}
-		copy(remotePubKey, rpk)
-	}
+		/*
+			pub目录,其他pub的目录通过pub-status检查本pub的负载
+		*/
+		rest.Get("/ssb/api/pubs", s.GetPubs),
+		rest.Get("/ssb/api/pub-status", s.GetPubStatus),
 
-	plainAddr, err := net.ResolveTCPAddr("tcp", ctx.String("addr"))
-	if err != nil {
-		return nil, fmt.Errorf("Init: failed to resolve TCP address: %w", err)
-	}
+		/*
+			限流统计
+		*/
+		//counters of the rate limited routes
+		rest.Get("/ssb/api/rate-limit-stats", s.GetRateLimitStats),
 
-	shsAddr := netwrap.WrapAddr(plainAddr, secretstream.Addr{PubKey: remotePubKey})
-	client, err := ssbClient.NewTCP(localKey, shsAddr,
-		ssbClient.WithSHSAppKey(ctx.String("shscap")),
-		ssbClient.WithContext(longCtx))
-	if err != nil {
-		return nil, fmt.Errorf("Init: failed to connect to %s: %w", shsAddr.String(), err)
+		/*
+			日志级别,只能在pub本机修改
+		*/
+		rest.Get("/ssb/api/log-levels", s.GetLogLevels),
+		rest.Post("/ssb/api/log-levels", s.SetLogLevel),
 	}
-
-	fmt.Println(fmt.Sprintf(PrintTime()+"Client = [%s] , method = [%s] , linked pub server = [%s]", "connected", "TCP", shsAddr.String()))
-	//127.0.0.1:8008|@HZnU6wM+F17J0RSLXP05x3Lag2jGv3F3LzHMjh72coE=.ed25519
-	params.PubID = strings.Split(shsAddr.String(), "|")[1]
-	fmt.Println(fmt.Sprintf(PrintTime()+"Init: success to work on pub [%s]", params.PubID))
-
-	return client, nil
 }
 
 // initDb
-func initDb(ctx *cli.Context) error {
-	pubdatadir := ctx.String("datadir")
-
-	likedb, err := OpenPubDB(pubdatadir)
+func (s *Service) initDb() error {
+	likedb, err := OpenPubDB(s.cfg.Pub.DataDir, s.pubID)
 	if err != nil {
-		fmt.Println(fmt.Errorf("Failed to create database", err))
+		return fmt.Errorf("Failed to create database: %w", err)
 	}
 
 	lstime, err := likedb.SelectLastScanTime()
 	if err != nil {
-		fmt.Println(fmt.Errorf("Failed to init database", err))
+		return fmt.Errorf("Failed to init database: %w", err)
 	}
 	if lstime == 0 {
 		_, err = likedb.UpdateLastScanTime(0)
 		if err != nil {
-			fmt.Println(fmt.Errorf("Failed to init database", err))
+			return fmt.Errorf("Failed to init database: %w", err)
 		}
 	}
-	lastAnalysisTimesnamp = lstime
+	s.lastAnalysisTime = lstime
 
-	likeDB = likedb
+	s.db = likedb
 
 	return nil
 }
 
-// DoMessageTask get message from the server copy
-func DoMessageTask(ctx *cli.Context) {
+// initAnalysis opens the database of the pub and loads the sensitive words
+func (s *Service) initAnalysis() error {
 	//init db
-	if err := initDb(ctx); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	if err := s.initDb(); err != nil {
+		return err
 	}
-	time.Sleep(time.Second * 1)
 
 	//init sensitive words
-	f, err := os.Open(params.SensitiveWordsFilePath)
+	f, err := os.Open(s.cfg.Analysis.SensitiveWordsFile)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return err
 	}
 	defer f.Close()
+	var sensitiveWords []string
 	scanner := bufio.NewScanner(f)
 	for scanner.Scan() {
 		word := scanner.Text()
-		SensitiveWords = append(SensitiveWords, word)
+		sensitiveWords = append(sensitiveWords, word)
 	}
 	if err := scanner.Err(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return err
 	}
-	dfax = dfa.New()
-	dfax.AddBadWords(SensitiveWords)
-
-	time.Sleep(time.Second * 1)
+	s.dfa = dfa.New()
+	s.dfa.AddBadWords(sensitiveWords)
+	return nil
+}
 
+// DoMessageTask get message from the server copy, until ctx is done
+func (s *Service) DoMessageTask(ctx context.Context) {
 	//ssb-message work
 	for {
-		//构建符合条件的message请求
-		var ref refs.FeedRef
-		if id := ctx.String("id"); id != "" {
-			var err error
-			ref, err = refs.ParseFeedRef(id)
-			if err != nil {
-				panic(err)
+		if err := s.backfillVotes(ctx); err != nil {
+			level.Error(s.logger(logAnalysis)).Log("event", "vote index backfill failed", "err", err)
+			if !sleepCtx(ctx, time.Second*10) {
+				return
 			}
+			continue
 		}
-		args := message.CreateHistArgs{
-			ID:     ref,
-			Seq:    ctx.Int64("seq"),
-			AsJSON: ctx.Bool("asJSON"),
-		}
-		args.Gt = message.RoundedInteger(lastAnalysisTimesnamp)
-		args.Limit = -1
-		args.Seq = 0
-		args.Keys = true
-		args.Values = true
-		args.Private = false
-		src, err := client.Source(longCtx, muxrpc.TypeJSON, muxrpc.Method{"createLogStream"}, args)
+		break
+	}
+	for {
+		head, err := s.receiveHead(ctx)
 		if err != nil {
-			//client可能失效,则需要重建新的连接,链接资源的释放在ssb-server端
-			fmt.Println(fmt.Errorf(PrintTime()+"Source stream call failed: %w ,will try other tcp connect socket...", err))
-			otherClient, err := newClient(ctx)
-			if err != nil {
-				fmt.Println(fmt.Errorf(PrintTime()+"Try set up a ssb client tcp socket failed , will try again...", err))
-				time.Sleep(time.Second * 10)
-				continue
-			}
+			level.Debug(s.logger(logAnalysis)).Log("event", "receive log head unknown", "err", err)
+			head = -1
+		} else if s.analyzedSeq >= 0 {
+			s.metrics().analysisLag.Set(float64(head - s.analyzedSeq))
+		}
 
-			client = otherClient
+		src, err := s.backend.logStream(ctx, s.lastAnalysisTime)
+		if err != nil {
+			level.Warn(s.logger(logAnalysis)).Log("event", "log stream failed, trying again", "err", err)
+			if !sleepCtx(ctx, time.Second*10) {
+				return
+			}
 			continue
 		}
 
 		//从上一次的计算点（数据库记录的毫秒时间戳）到最后一条记录的解析
-		time.Sleep(time.Second)
-		calcComplateTime, err := SsbMessageAnalysis(src)
+		calcComplateTime, calcsumthisTurn, err := s.SsbMessageAnalysis(ctx, src)
 		if err != nil {
-			fmt.Println(fmt.Sprintf(PrintTime()+"Message pump failed: %w", err))
-			time.Sleep(time.Second * 5)
+			level.Error(s.logger(logAnalysis)).Log("event", "analysis round failed", "err", err)
+			if !sleepCtx(ctx, time.Second*5) {
+				return
+			}
 			continue
 		}
 
-		var calcsumthisTurn = len(TempMsgMap)
-		fmt.Println(fmt.Sprintf(PrintTime()+"A round of message data analysis has been completed ,from TimeSanmp [%v] to [%v] ,message number = [%d]", lastAnalysisTimesnamp, calcComplateTime, calcsumthisTurn))
-		lastAnalysisTimesnamp = calcComplateTime
+		level.Info(s.logger(logAnalysis)).Log("event", "analysis round done", "from", s.lastAnalysisTime, "to", calcComplateTime, "messages", calcsumthisTurn)
+		s.lastAnalysisTime = calcComplateTime
+		if err := s.resolveVoteTargets(ctx); err != nil {
+			level.Error(s.logger(logAnalysis)).Log("event", "vote target resolution failed", "err", err)
+		}
+		s.analysisDone(ctx, head)
 
-		time.Sleep(params.MsgScanInterval)
+		if !sleepCtx(ctx, s.cfg.Analysis.MessageScanInterval.Duration) {
+			return
+		}
+	}
+}
+
+// sleepCtx waits for d, false if ctx is done before
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
 	}
 }
 
-func contactSomeone(ctx *cli.Context, dealwho string, isfollow, isblock bool) (err error) {
-	if dealwho == params.PubID {
+func (s *Service) contactSomeone(ctx context.Context, dealwho string, isfollow, isblock bool) (err error) {
+	if dealwho == s.pubID {
 		return fmt.Errorf("Permission denied, from pub : %s", dealwho)
 	}
+	if s.replay {
+		return nil
+	}
 	arg := map[string]interface{}{
 		"contact":   dealwho,
 		"type":      "contact",
 		"following": isfollow,
 		"blocking":  isblock,
 	}
-	var v string
-	err = client.Async(longCtx, &v, muxrpc.TypeString, muxrpc.Method{"publish"}, arg)
+	_, err = s.backend.publish(ctx, arg)
 	if err != nil {
 		return fmt.Errorf("publish call failed: %w", err)
 	}
@@ -382,48 +357,21 @@ func contactSomeone(ctx *cli.Context, dealwho string, isfollow, isblock bool) (e
 	return
 }
 
-func privatePublish(ctx *cli.Context, recpobj, root, branch string) (err error) {
-	arg := map[string]interface{}{
-		"text": ctx.Args().First(),
-		"type": "post",
-	}
-	if r := ctx.String("root"); r != "" {
-		arg["root"] = r
-		if b := ctx.String("branch"); b != "" {
-			arg["branch"] = b
-		} else {
-			arg["branch"] = r
-		}
-	}
-	var v string
-	if recps := ctx.StringSlice("recps"); len(recps) > 0 {
-		err = client.Async(longCtx, &v,
-			muxrpc.TypeString,
-			muxrpc.Method{"private", "publish"}, arg, recps)
-	} else {
-		err = client.Async(longCtx, &v,
-			muxrpc.TypeString,
-			muxrpc.Method{"publish"}, arg)
-	}
-	if err != nil {
-		return fmt.Errorf("publish call failed: %w", err)
-	}
-	return
-}
-
-func SsbMessageAnalysis(r *muxrpc.ByteSource) (int64, error) {
+// SsbMessageAnalysis one round of the analysis over the messages of r, returns the time the round ended and the number of messages
+func (s *Service) SsbMessageAnalysis(ctx context.Context, r messageSource) (int64, int, error) {
 	var buf = &bytes.Buffer{}
-	TempMsgMap = make(map[string]*TempdMessage)
-	ClientID2Name = make(map[string]string)
-	LikeDetail = []string{}
-	UnLikeDetail = []string{}
+	// the messages of this round and their authors
+	tempMsgMap := make(map[string]*TempdMessage)
+	// the latest about name of the authors of this round
+	clientID2Name := make(map[string]string)
 
 	//不能以最后一条消息的时间作为本轮计算的时间点,后期改为从服务器上取得pub的时间,
 	//计算周期越小越好,加载完本轮所有消息的时间点即为下一轮的开始时间，这样规避了在计算过程中有新消息被同步进入pub
 	//注意：manyvse等客户端向服务器同步数据，延迟时间不定，如果无网状态发送过来的消息被视为空
 	nowUnixTime := time.Now().UnixNano() / 1e6
+	alog := s.logger(logAnalysis)
 
-	for r.Next(context.TODO()) {
+	for r.Next(ctx) {
 		//在本轮for计算周期内如果有数据
 		buf.Reset()
 		err := r.Reader(func(r io.Reader) error {
@@ -431,7 +379,7 @@ func SsbMessageAnalysis(r *muxrpc.ByteSource) (int64, error) {
 			return err
 		})
 		if err != nil {
-			return 0, err
+			return 0, 0, err
 		}
 
 		/*_, err = buf.WriteTo(os.Stdout)
@@ -443,77 +391,35 @@ func SsbMessageAnalysis(r *muxrpc.ByteSource) (int64, error) {
 		var msgStruct DeserializedMessageStu
 		err = json.Unmarshal(buf.Bytes(), &msgStruct)
 		if err != nil {
-			fmt.Println(fmt.Errorf("Muxrpc.ByteSource Unmarshal to json err =%s", err))
-			return 0, err
+			return 0, 0, fmt.Errorf("message source unmarshal: %w", err)
 		}
 
-		//1、记录本轮所有消息ID和author的关系,保存下来,被点赞的消息基本不会在本轮被扫描到
+		s.countAnalyzed(msgStruct.Value.Content)
+
+		//1、记录本轮所有消息ID和author的关系
 		msgkey := fmt.Sprintf("%v", msgStruct.Key)
 		msgauther := fmt.Sprintf("%v", msgStruct.Value.Author)
 		var msgtime = msgStruct.Value.Timestamp
 		var msgTime = int64(msgtime*math.Pow10(2)) / 100
 
-		TempMsgMap[msgkey] = &TempdMessage{
+		tempMsgMap[msgkey] = &TempdMessage{
 			Author: msgauther,
 		}
-		_, err = likeDB.InsertLikeDetail(msgkey, msgauther)
-		if err != nil {
-			fmt.Println(fmt.Errorf(PrintTime()+"Failed to InsertLikeDetail, err=%s", err))
-			return 0, err
-		}
 
-		//2、记录like的统计结果
 		contentJust := string(msgStruct.Value.Content[0])
 		if contentJust == "{" {
-			//1、like的信息
-			cvs := ContentVoteStru{}
-			err = json.Unmarshal(msgStruct.Value.Content, &cvs)
-			if err == nil {
-				if string(cvs.Type) == "vote" {
-					/*if cvs.Vote.Expression != "️Unlike" { //1:❤️ 2:👍 3:✌️ 4:👍这种判断不知道什么是错误的：可以同时有点赞和取消点赞的判断
-						LikeDetail = append(LikeDetail, cvs.Vote.Link)
-						timesp := time.Unix(int64(msgStruct.Value.Timestamp)/1e3, 0).Format("2006-01-02 15:04:05")
-						fmt.Println("like-time:\t" + timesp + "MessageKey:\t" + cvs.Vote.Link)
-					}*/
-					//get the Unlike tag ,先记录被like的link，再找author；由于图谱深度不一样，按照时间顺序查询存在问题，则先统一记录
-					timesp := time.Unix(int64(msgStruct.Value.Timestamp)/1e3, 0).Format("2006-01-02 15:04:05")
-					if cvs.Vote.Expression == "Unlike" {
-						UnLikeDetail = append(UnLikeDetail, cvs.Vote.Link)
-						fmt.Println(PrintTime() + "unlike-time: " + timesp + "---MessageKey: " + cvs.Vote.Link)
-
-						//统计我取消点赞的
-						_, err = likeDB.InsertUserSetLikeInfo(msgkey, msgauther, -1, msgTime)
-						if err != nil {
-							fmt.Println(fmt.Errorf(PrintTime()+" %s set a unlike FAILED, err=%s", msgauther, err))
-						}
-						fmt.Println(fmt.Sprintf(PrintTime()+" %s set a unlike, msgkey=%s", msgauther, msgkey))
-					} else {
-						//get the Like tag ,因为like肯定在发布message后,先记录被like的link，再找author
-						LikeDetail = append(LikeDetail, cvs.Vote.Link)
-						fmt.Println(PrintTime() + "  like-time: " + timesp + "---MessageKey: " + cvs.Vote.Link)
-
-						//统计我点赞的
-						_, err = likeDB.InsertUserSetLikeInfo(msgkey, msgauther, 1, msgTime)
-						if err != nil {
-							fmt.Println(fmt.Errorf(PrintTime()+" %s set a like FAILED, err=%s", msgauther, err))
-						}
-						fmt.Println(fmt.Sprintf(PrintTime()+" %s set a like, msgkey=%s", msgauther, msgkey))
+			//1、vote 投票进入索引,同一投票者对同一消息只保留feed中最新的一次,被投票消息的作者在本轮结束后通过get索引查找
+			if target, value, ok := parseVote(msgStruct.Value.Content); ok {
+				changed, firstLike, err := s.db.UpsertVote(msgauther, target, value, msgStruct.Value.Sequence, msgTime)
+				if err != nil {
+					return 0, 0, fmt.Errorf("index vote %s: %w", msgkey, err)
+				}
+				level.Debug(alog).Log("event", "vote", "feed", msgauther, "msgkey", msgkey, "link", target, "value", value, "changed", changed)
 
-						{ //发送激励
-							//如果点赞了，又取消了，不影响token的发放
-							name2addr, err := GetNodeProfile(msgauther)
-							if err != nil || len(name2addr) != 1 {
-								fmt.Println(fmt.Errorf(LikePost+" Reward %s ethereum address failed, err= not found or %s", msgauther, err))
-							} else {
-								ehtAddr := name2addr[0].EthAddress
-								go PubRewardToken(ehtAddr, int64(params.RewardOfLikePost), msgauther, LikePost, msgkey, msgTime)
-							}
-						}
-					}
+				//发送激励,只有对同一消息的第一次点赞才发送,取消后再点赞不再发送,如果点赞了又取消了,不影响已发放的token
+				if firstLike {
+					s.rewardFeed(msgauther, LikePost, msgkey, msgTime)
 				}
-			} else {
-				/*fmt.Println(fmt.Sprintf("Unmarshal  for vote , err %v", err))*/
-				//todox 可以根据协议的扩展，记录其他的vote数据，目前没有这个需求
 			}
 
 			//3、about即修改备注名为hex-address的信息,注意:修改N次name,只需要返回最新的即可
@@ -522,30 +428,31 @@ func SsbMessageAnalysis(r *muxrpc.ByteSource) (int64, error) {
 			err = json.Unmarshal(msgStruct.Value.Content, &cau)
 			if err == nil {
 				if cau.Type == "about" {
-					ClientID2Name[fmt.Sprintf("%v", cau.About)] =
+					clientID2Name[fmt.Sprintf("%v", cau.About)] =
 						fmt.Sprintf("%v", cau.Name)
 				}
 			} else {
-				fmt.Println(fmt.Errorf(PrintTime()+"Unmarshal for about , err %v", err))
+				level.Debug(alog).Log("event", "unmarshal about failed", "feed", msgauther, "msgkey", msgkey, "err", err)
 			}
 
 			//4、contact触发对blakclist的处理, 通过pub关注重新进来的黑名单的消息来持续block该账户
-			if msgauther == params.PubID {
+			if msgauther == s.pubID {
 				ccs := ContentContactStru{}
 				err = json.Unmarshal(msgStruct.Value.Content, &ccs)
 				if err == nil {
 					if ccs.Type == "contact" {
-						if IsBlackList(ccs.Contact) && ccs.Following && ccs.Pub {
+						if s.IsBlackList(ccs.Contact) && ccs.Following && ccs.Pub {
 							//block he
-							err = contactSomeone(nil, ccs.Contact, true, true)
+							err = s.contactSomeone(ctx, ccs.Contact, true, true)
 							if err != nil {
-								fmt.Println(fmt.Errorf(PrintTime()+"[black-list]Unfollow and Block %s FAILED, err=%s", ccs.Contact, err))
+								level.Error(alog).Log("event", "block blacklisted failed", "feed", ccs.Contact, "err", err)
+							} else {
+								level.Info(alog).Log("event", "blacklisted blocked", "feed", ccs.Contact)
 							}
-							fmt.Println(fmt.Sprintf(PrintTime()+"[black-list]Unfollow and Block %s SUCCESS", ccs.Contact))
 						}
 					}
 				} else {
-					fmt.Println(fmt.Errorf(PrintTime()+"[black-list]Unmarshal for contact, err %v", err))
+					level.Debug(alog).Log("event", "unmarshal contact failed", "msgkey", msgkey, "err", err)
 				}
 			}
 
@@ -556,8 +463,8 @@ func SsbMessageAnalysis(r *muxrpc.ByteSource) (int64, error) {
 				if cps.Type == "post" {
 					postContent := cps.Text
 					//5.1敏感词处理
-					_, _, b := dfax.Check(postContent)
-					if b && (msgauther != params.PubID) {
+					_, _, b := s.dfa.Check(postContent)
+					if b && (msgauther != s.pubID) {
 						/*//block he
 						err = contactSomeone(nil, msgauther, true, true)
 						if err != nil {
@@ -565,135 +472,120 @@ func SsbMessageAnalysis(r *muxrpc.ByteSource) (int64, error) {
 						}
 						fmt.Println(fmt.Sprintf(PrintTime()+"[sensitive-check]Unfollow and Block %s SUCCESS", msgauther))*/
 						//fix:处理违规消息由 "直接block" 转为 "提供接口人工审核处理"
-						_, err = likeDB.InsertSensitiveWordRecord(params.PubID, nowUnixTime, postContent, msgkey, msgauther, "0")
+						_, err = s.db.InsertSensitiveWordRecord(s.pubID, nowUnixTime, postContent, msgkey, msgauther, "0")
 						if err != nil {
-							fmt.Println(fmt.Errorf(PrintTime()+"[sensitive-check]InsertSensitiveWordRecord FAILED, err=%s", err))
+							level.Error(alog).Log("event", "save sensitive word record failed", "feed", msgauther, "msgkey", msgkey, "err", err)
+						} else {
+							level.Info(alog).Log("event", "sensitive word", "feed", msgauther, "msgkey", msgkey)
 						}
-						fmt.Println(fmt.Sprintf(PrintTime()+"[sensitive-check]InsertSensitiveWordRecord SUCCESS, author=%s, message=%s, msgkey=%s", msgauther, postContent, msgkey))
 					}
 					//5.2我发表的invitation
 					if cps.Root == "" && PostWordCountBigThan10(postContent) { //1-登录 2-发表帖子 3-评论 4-铸造NFT
-						_, err = likeDB.InsertUserTaskCollect(params.PubID, msgauther, msgkey, "2", "", msgTime, "", "", "")
+						_, err = s.db.InsertUserTaskCollect(s.pubID, msgauther, msgkey, "2", "", msgTime, "", "", "")
 						if err != nil {
-							fmt.Println(fmt.Errorf(PrintTime()+"[UserTaskCollect-post]InsertUserTaskCollect FAILED, err=%s", err))
+							level.Error(alog).Log("event", "save post task failed", "feed", msgauther, "msgkey", msgkey, "err", err)
+						} else {
+							level.Debug(alog).Log("event", "post task", "feed", msgauther, "msgkey", msgkey)
 						}
-						fmt.Println(fmt.Sprintf(PrintTime()+"[UserTaskCollect-post]InsertUserTaskCollect SUCCESS, author=%s, msgkey=%s", msgauther, msgkey))
 
-						{ //发送激励
-							name2addr, err := GetNodeProfile(msgauther)
-							if err != nil || len(name2addr) != 1 {
-								fmt.Println(fmt.Errorf(PostMessage+" Reward %s ethereum address failed, err= not found or %s", msgauther, err))
-							} else {
-								ehtAddr := name2addr[0].EthAddress
-								go PubRewardToken(ehtAddr, int64(params.RewardOfPostMessage), msgauther, PostMessage, msgkey, msgTime)
-							}
-						}
+						//发送激励
+						s.rewardFeed(msgauther, PostMessage, msgkey, msgTime)
 					}
 					//5.3我发表的comment
 					if cps.Root != "" && PostWordCountBigThan10(postContent) {
-						_, err = likeDB.InsertUserTaskCollect(params.PubID, msgauther, msgkey, "3", cps.Root, msgTime, "", "", "")
+						_, err = s.db.InsertUserTaskCollect(s.pubID, msgauther, msgkey, "3", cps.Root, msgTime, "", "", "")
 						if err != nil {
-							fmt.Println(fmt.Errorf(PrintTime()+"[UserTaskCollect-comment]InsertUserTaskCollect FAILED, err=%s", err))
+							level.Error(alog).Log("event", "save comment task failed", "feed", msgauther, "msgkey", msgkey, "err", err)
+						} else {
+							level.Debug(alog).Log("event", "comment task", "feed", msgauther, "msgkey", msgkey)
 						}
-						fmt.Println(fmt.Sprintf(PrintTime()+"[UserTaskCollect-comment]InsertUserTaskCollect SUCCESS, author=%s, msgkey=%s", msgauther, msgkey))
 
-						{ //发送激励
-							name2addr, err := GetNodeProfile(msgauther)
-							if err != nil || len(name2addr) != 1 {
-								fmt.Println(fmt.Errorf(PostComment+" Reward %s ethereum address failed, err= not found or %s", msgauther, err))
-							} else {
-								ehtAddr := name2addr[0].EthAddress
-								go PubRewardToken(ehtAddr, int64(params.RewardOfPostComment), msgauther, PostComment, msgkey, msgTime)
-							}
-						}
+						//发送激励
+						s.rewardFeed(msgauther, PostComment, msgkey, msgTime)
 					}
 				}
 			} else {
-				fmt.Println(fmt.Errorf("json.Unmarshal(msgStruct.Value.Content err=%s", err))
+				level.Debug(alog).Log("event", "unmarshal post failed", "msgkey", msgkey, "err", err)
 			}
-		}
-	}
 
-	//save message-result to database
-	for _, likeLink := range LikeDetail { //被点赞的ID集合,标记被点赞的记录
-		_, err := likeDB.UpdateLikeDetail(1, nowUnixTime, likeLink)
-		if err != nil {
-			fmt.Println(fmt.Errorf(PrintTime()+"Failed to UpdateLikeDetail", err))
-			return 0, err
+			//6、metalife/moderation 其他pub的处理结果,来自受信任的pub则进入待审核队列
+			if s.IsTrustedModerationPub(msgauther) {
+				s.importModeration(ctx, msgauther, msgStruct.Value.Content)
+			}
+
+			//7、pub 其他pub的地址公告,加入pub目录
+			s.importPubAnnouncement(msgauther, msgStruct.Value.Content, msgTime)
 		}
 	}
 
-	for _, unLikeLink := range UnLikeDetail { //被取消点赞的ID集合
-		_, err := likeDB.UpdateLikeDetail(-1, nowUnixTime, unLikeLink)
-		if err != nil {
-			fmt.Println(fmt.Errorf(PrintTime()+"Failed to UpdateLikeDetail", err))
-			return 0, err
-		}
+	if err := r.Err(); err != nil {
+		return 0, 0, err
+	}
+	//本轮被中断,不保存扫描时间
+	if err := ctx.Err(); err != nil {
+		return 0, 0, err
 	}
 
-	_, err := likeDB.UpdateLastScanTime(nowUnixTime)
+	_, err := s.db.UpdateLastScanTime(nowUnixTime)
 	if err != nil {
-		fmt.Println(fmt.Errorf(PrintTime()+"Failed to UpdateLastScanTime", err))
-		return 0, err
+		return 0, 0, fmt.Errorf("update last scan time: %w", err)
 	}
 	//更新table userethaddr
-	for key := range ClientID2Name {
-		_, err := likeDB.UpdateUserProfile(key, ClientID2Name[key], "")
+	for key := range clientID2Name {
+		_, err := s.db.UpdateUserProfile(key, clientID2Name[key], "")
 		if err != nil {
-			fmt.Println(fmt.Errorf(PrintTime()+"Failed to UpdateUserEthAddr", err))
-			return 0, err
+			return 0, 0, fmt.Errorf("update profile of %s: %w", key, err)
 		}
 	}
-	//fmt.Println(fmt.Sprintf(PrintTime()+"A round of message data analysis has been completed ,message number = [%v]", len(TempMsgMap)))
+	//fmt.Println(fmt.Sprintf(PrintTime()+"A round of message data analysis has been completed ,message number = [%v]", len(tempMsgMap)))
 	/*//print for test
-	for key,value := range TempMsgMap {
+	for key,value := range tempMsgMap {
 		fmt.Println(key, "<-this round message ID---ClientID->", value.Author)
 	}
-	for key := range ClientID2Name { //取map中的值err
-		fmt.Println(key, "<-ClientID---Name->", ClientID2Name[key])
+	for key := range clientID2Name { //取map中的值err
+		fmt.Println(key, "<-ClientID---Name->", clientID2Name[key])
 	}*/
-	return nowUnixTime, nil
+	return nowUnixTime, len(tempMsgMap), nil
 }
 
 // NewChannelDeal
-func NewChannelDeal(partnerAddress string, clientID string, messageTime int64) (err error) {
-	photonNode := &PhotonNode{
-		Host:       "http://" + params.PhotonHost,
-		Address:    params.PhotonAddress,
-		APIAddress: params.PhotonHost,
-		DebugCrash: false,
-	}
+func (s *Service) NewChannelDeal(partnerAddress string, clientID string, messageTime int64) (err error) {
+	rlog := kitlog.With(s.logger(logRewards), "feed", clientID, "eth", partnerAddress, "reason", SignUp)
+	photonNode := s.photonNode()
 	partnerNode := &PhotonNode{
 		//:utils.APex2(rs.Config.PubAddress),
 		Address:    partnerAddress,
 		DebugCrash: false,
 	}
 
-	channel00, err := photonNode.GetChannelWith(partnerNode, params.TokenAddress)
+	channel00, err := photonNode.GetChannelWith(partnerNode, s.cfg.Photon.TokenAddress)
 	if err != nil {
-		fmt.Println(fmt.Errorf(PrintTime()+SignUp+" GetChannelWith %s", err))
+		level.Error(rlog).Log("event", "channel query failed", "err", err)
 		return
 	}
 	if channel00 == nil {
-		if ExceedRewardLimit(clientID, SignUp) {
+		if s.ExceedRewardLimit(clientID, SignUp) {
 			//如果一个SSB-ID连续注册地址达到2次以上，则该账号以后无法得到注册激励
-			fmt.Println(fmt.Errorf(PrintTime()+SignUp+" reward %s to ethaddr=%s REJECT,reason:ExceedRewardLimit", clientID, partnerAddress))
+			level.Warn(rlog).Log("event", "reward rejected", "err", "exceeds the reward limit")
+			s.countReward(SignUp, rewardRejected)
 			return
 		}
+		s.countReward(SignUp, rewardQueued)
 		//create new channel with  mlt
-		initRegistAmount := int64(params.MinBalanceInchannel + params.RewardOfSignup)
-		err = photonNode.OpenChannel(partnerNode.Address, params.TokenAddress, new(big.Int).Mul(big.NewInt(params.Ether), big.NewInt(initRegistAmount)), params.SettleTime)
+		initRegistAmount := int64(s.cfg.Photon.MinBalanceInchannel + s.cfg.Rewards.Signup)
+		err = photonNode.OpenChannel(partnerNode.Address, s.cfg.Photon.TokenAddress, new(big.Int).Mul(big.NewInt(params.Ether), big.NewInt(initRegistAmount)), s.cfg.Photon.SettleTimeout)
 		if err != nil {
-			fmt.Println(fmt.Errorf(PrintTime()+SignUp+" create channel, err=%s", err))
+			level.Error(rlog).Log("event", "open channel failed", "err", err)
+			s.countReward(SignUp, rewardFailed)
 			return
 		}
-		fmt.Println(fmt.Sprintf(PrintTime()+SignUp+" create channel success[%s], with %s", clientID, partnerAddress))
+		level.Info(rlog).Log("event", "channel opened", "amount", initRegistAmount)
 
 		netStatus := false
 		for i := 0; i < 10; i++ {
 			nodeS, err := photonNode.GetNodeStatus(partnerAddress)
 			if err != nil {
-				fmt.Println(fmt.Errorf(PrintTime()+SignUp+" GetNodeStatus[%s], err=%s", clientID, err))
+				level.Warn(rlog).Log("event", "node status failed", "err", err)
 			}
 			netStatus = nodeS.IsOnline
 			if netStatus {
@@ -702,40 +594,49 @@ func NewChannelDeal(partnerAddress string, clientID string, messageTime int64) (
 			time.Sleep(time.Second * 30)
 		}
 		if !netStatus {
-			fmt.Println(fmt.Errorf(PrintTime()+SignUp+" GetNodeStatus[%s](retry 10 times) %s online=%v", clientID, partnerAddress, netStatus))
 			//如果此时客户端不在线，则先记录，后续补发
 			{
 				//=======Record Reward Result=======
-				_, err = likeDB.RecordRewardResult(clientID, partnerAddress, "fail", int64(params.RewardOfSignup), SignUp, "", messageTime, 0)
-				fmt.Println(fmt.Sprintf(PrintTime()+SignUp+" but offline ,then[RecordRewardResult] reword to eth-address=%s for clientid=%s, reason=%s, err=%s", partnerAddress, clientID, err))
+				_, err = s.db.RecordRewardResult(clientID, partnerAddress, "fail", int64(s.cfg.Rewards.Signup), SignUp, "", messageTime, 0)
+				level.Warn(rlog).Log("event", "partner offline, reward deferred", "amount", s.cfg.Rewards.Signup, "err", err)
+				s.countReward(SignUp, rewardDeferred)
 			}
 			return errors.New("partner offline")
 		}
 		//registration award 新地址才发送注册激励
-		amount := new(big.Int).Mul(big.NewInt(params.Ether), big.NewInt(int64(params.RewardOfSignup)))
-		err = photonNode.SendTrans(params.TokenAddress, amount, partnerAddress, true, false)
+		amount := new(big.Int).Mul(big.NewInt(params.Ether), big.NewInt(int64(s.cfg.Rewards.Signup)))
+		err = photonNode.SendTrans(s.cfg.Photon.TokenAddress, amount, partnerAddress, true, false)
 		if err != nil {
+			level.Error(rlog).Log("event", "reward failed", "amount", amount, "err", err)
+			s.countReward(SignUp, rewardFailed)
 			return err
 		}
-		fmt.Println(fmt.Sprintf(PrintTime()+SignUp+" award[%s] to %s, amount= %v, err= %v", clientID, partnerAddress, amount, err))
+		level.Info(rlog).Log("event", "rewarded", "amount", amount)
+		s.countTokens(SignUp, tokenMLT, amount)
 
 		//继续发送SMT激励
-		smtAmount := new(big.Int).Mul(big.NewInt(params.Ether), big.NewInt(int64(params.RewardOfSignupSMT)))
+		smtAmount := new(big.Int).Mul(big.NewInt(params.Ether), big.NewInt(int64(s.cfg.Rewards.SignupSMT)))
 		err = photonNode.TransferSMT(partnerAddress, smtAmount.String())
 		if err != nil {
+			level.Error(rlog).Log("event", "reward smt failed", "amount", smtAmount, "err", err)
+			s.countReward(SignUp, rewardFailed)
 			return err
 		}
-		fmt.Println(fmt.Sprintf(PrintTime()+SignUp+" award(SMT)[%s] to %s, amount=%v, err=%v", clientID, partnerAddress, smtAmount, err))
+		level.Info(rlog).Log("event", "rewarded smt", "amount", smtAmount)
+		s.countTokens(SignUp, tokenSMT, smtAmount)
+		s.countReward(SignUp, rewardSent)
 
 		{
 			//=======Record Reward Result=======
 			nowTime := time.Now().UnixNano() / 1e6
-			_, err = likeDB.RecordRewardResult(clientID, partnerAddress, "success", int64(params.RewardOfSignup), SignUp, "", messageTime, nowTime)
-			fmt.Println(fmt.Sprintf(PrintTime()+SignUp+"[RecordRewardResult] reword to eth-address=%s for clientid=%s, reason=%s, err=%v", partnerAddress, clientID, SignUp, err))
+			_, err = s.db.RecordRewardResult(clientID, partnerAddress, "success", int64(s.cfg.Rewards.Signup), SignUp, "", messageTime, nowTime)
+			if err != nil {
+				level.Error(rlog).Log("event", "record reward failed", "err", err)
+			}
 		}
 
 	} else {
-		fmt.Println(fmt.Errorf(PrintTime()+"[Pub-Client-ChannelDeal-OK]channel has exist[%s], with %s", clientID, partnerAddress))
+		level.Debug(rlog).Log("event", "channel exists")
 	}
 
 	return
@@ -743,23 +644,39 @@ func NewChannelDeal(partnerAddress string, clientID string, messageTime int64) (
 
 // PubRewardToken  pub paid additionally
 // It is stipulated that 'the award' needs to be paid additionally by pub, and the 'min-balance-inchannel' is not used
-func PubRewardToken(partnerAddress string, xamount int64, clientID, reason, messageKey string, messageTime int64) (err error) {
+// rewardFeed pays feed the reward for reason in the background if it has an eth address,
+// a reward simulation only records it (see SimulateRewards)
+func (s *Service) rewardFeed(feed, reason, msgkey string, msgTime int64) {
+	var ethAddr string
+	name2addr, err := s.GetNodeProfile(feed)
+	if err == nil && len(name2addr) == 1 {
+		ethAddr = name2addr[0].EthAddress
+	}
+	if s.simulation != nil {
+		s.simulation.add(feed, ethAddr, reason, msgTime)
+		return
+	}
+	if err != nil || len(name2addr) != 1 {
+		level.Debug(s.logger(logRewards)).Log("event", "no eth address to reward", "feed", feed, "msgkey", msgkey, "reason", reason, "err", err)
+		return
+	}
+	amount := int64(rewardAmount(s.cfg.Rewards, reason))
+	s.goPayout(func() { s.PubRewardToken(ethAddr, amount, feed, reason, msgkey, msgTime) })
+}
+
+func (s *Service) PubRewardToken(partnerAddress string, xamount int64, clientID, reason, messageKey string, messageTime int64) (err error) {
 	_, err = HexToAddress(partnerAddress)
 	if err != nil {
 		err = fmt.Errorf("[sendToken]verify eth-address=[%s], error=%s", partnerAddress, err)
 		return
 	}
-	photonNode := &PhotonNode{
-		Host:       "http://" + params.PhotonHost,
-		Address:    params.PhotonAddress,
-		APIAddress: params.PhotonHost,
-		DebugCrash: false,
-	}
+	rlog := kitlog.With(s.logger(logRewards), "feed", clientID, "eth", partnerAddress, "reason", reason, "msgkey", messageKey)
+	photonNode := s.photonNode()
 	netStatus := false
 	for i := 0; i < 18; i++ {
 		nodeS, err := photonNode.GetNodeStatus(partnerAddress)
 		if err != nil {
-			fmt.Println(fmt.Sprintf(PrintTime()+reason+"[sendToken]GetNodeStatus[%s], err=%s", partnerAddress, err))
+			level.Warn(rlog).Log("event", "node status failed", "err", err)
 		}
 		netStatus = nodeS.IsOnline
 		if netStatus {
@@ -767,160 +684,200 @@ func PubRewardToken(partnerAddress string, xamount int64, clientID, reason, mess
 		}
 		time.Sleep(time.Second * 10)
 	}
-	if ExceedRewardLimit(clientID, reason) {
-		fmt.Println(fmt.Errorf(PrintTime()+reason+" reward %s to ethaddr=%s REJECT,reason:ExceedRewardLimit", clientID, partnerAddress))
+	if s.ExceedRewardLimit(clientID, reason) {
+		level.Warn(rlog).Log("event", "reward rejected", "err", "exceeds the reward limit")
+		s.countReward(reason, rewardRejected)
 		return
 	}
+	s.countReward(reason, rewardQueued)
 	amount := new(big.Int).Mul(big.NewInt(params.Ether), big.NewInt(xamount))
 	if !netStatus {
-		fmt.Println(fmt.Errorf(PrintTime()+reason+"[sendToken]GetNodeStatus(retry 120 minites) %s online= %s", partnerAddress, netStatus))
 		//如果此时客户端不在线，则先记录，后续补发
 		{
 			//=======Record Reward Result=======
-			_, err = likeDB.RecordRewardResult(clientID, partnerAddress, "fail", xamount, reason, messageKey, messageTime, 0)
-			fmt.Println(fmt.Sprintf(PrintTime()+"offline,then[RecordRewardResult] reword to eth-address=%s for clientid=%s, reason=%s, err=%v", partnerAddress, clientID, reason, err))
+			_, err = s.db.RecordRewardResult(clientID, partnerAddress, "fail", xamount, reason, messageKey, messageTime, 0)
+			level.Warn(rlog).Log("event", "partner offline, reward deferred", "amount", amount, "err", err)
+			s.countReward(reason, rewardDeferred)
 		}
 		return errors.New("partner offline")
 	}
 
 	//如果不在线了，检查通道没有任何意义
-	err = photonNode.SendTrans(params.TokenAddress, amount, partnerAddress, true, false)
+	err = photonNode.SendTrans(s.cfg.Photon.TokenAddress, amount, partnerAddress, true, false)
 	if err != nil {
-		fmt.Println(fmt.Errorf(PrintTime()+reason+" [sendToken]SendTrans error=%s", err))
+		level.Error(rlog).Log("event", "reward failed", "amount", amount, "err", err)
+		s.countReward(reason, rewardFailed)
 		return err
 	}
-	fmt.Println(fmt.Sprintf(PrintTime()+reason+" reward %s to ethaddr=%s SUCCESS", clientID, partnerAddress))
+	level.Info(rlog).Log("event", "rewarded", "amount", amount)
+	s.countTokens(reason, tokenMLT, amount)
+	s.countReward(reason, rewardSent)
 	{
 		//=======Record Reward Result=======
 		nowTime := time.Now().UnixNano() / 1e6
-		_, err = likeDB.RecordRewardResult(clientID, partnerAddress, "success", xamount, reason, messageKey, messageTime, nowTime)
+		_, err = s.db.RecordRewardResult(clientID, partnerAddress, "success", xamount, reason, messageKey, messageTime, nowTime)
 		if err != nil {
-			fmt.Println(fmt.Sprintf(PrintTime()+"[RecordRewardResult] reword to eth-address=%s for clientid=%s, reason=%s, FAILED, err=%s", partnerAddress, clientID, reason, err))
+			level.Error(rlog).Log("event", "record reward failed", "err", err)
 		}
-		fmt.Println(fmt.Sprintf(PrintTime()+"[RecordRewardResult] reword to eth-address=%s for clientid=%s, reason=%s, SUCCESS", partnerAddress, clientID, reason))
 	}
 	return
 }
 
-func checkPubChannelBalance() {
-	time.Sleep(time.Second * 5) //数据库可能没准备好
-	name2addr, err := GetAllNodesProfile()
+// checkPubChannelBalance every RoundTimeOfCheckChannelBalance, until ctx is done
+func (s *Service) checkPubChannelBalance(ctx context.Context) {
+	if !sleepCtx(ctx, time.Second*5) { //数据库可能没准备好
+		return
+	}
+	for {
+		s.checkPubChannelBalanceRound(ctx)
+		if !sleepCtx(ctx, s.cfg.Photon.CheckChannelInterval.Duration) {
+			return
+		}
+	}
+}
+
+func (s *Service) checkPubChannelBalanceRound(ctx context.Context) {
+	plog := s.logger(logPhoton)
+	name2addr, err := s.GetAllNodesProfile()
+	if err != nil {
+		level.Error(plog).Log("event", "profiles failed", "err", err)
+	}
+	var belowMin int
+	defer func() {
+		if ctx.Err() == nil {
+			s.metrics().channelsBelowMin.Set(float64(belowMin))
+		}
+	}()
 	for _, info := range name2addr {
+		if ctx.Err() != nil {
+			return
+		}
 		clientaddrStr := info.EthAddress
 		if clientaddrStr == "" {
 			continue
 		}
 		_, err = HexToAddress(clientaddrStr)
 		if err != nil {
-			fmt.Println(fmt.Errorf("[Pub-CheckPubChannelBalance]verify clientid=[%s] 's eth-address=%s, error=%s", info.ID, clientaddrStr, err))
+			level.Debug(plog).Log("event", "invalid eth address", "feed", info.ID, "eth", clientaddrStr, "err", err)
 			continue
 		}
-		pubNode := &PhotonNode{
-			Host:       "http://" + params.PhotonHost,
-			Address:    params.PhotonAddress,
-			APIAddress: params.PhotonHost,
-			DebugCrash: false,
-		}
+		pubNode := s.photonNode()
 		channelX, err := pubNode.GetChannelWith(
 			&PhotonNode{Address: clientaddrStr, DebugCrash: false},
-			params.TokenAddress)
+			s.cfg.Photon.TokenAddress)
 		if err != nil || channelX == nil {
-			fmt.Println(fmt.Errorf("[Pub-CheckPubChannelBalance]between pub %v and %v client,there has no channel,so no work todo", params.PhotonAddress, clientaddrStr))
+			level.Debug(plog).Log("event", "no channel to check", "feed", info.ID, "eth", clientaddrStr, "err", err)
 			continue
 		}
-		var minNum = new(big.Int).Mul(big.NewInt(params.Ether), big.NewInt(int64(params.MinBalanceInchannel)))
+		var minNum = new(big.Int).Mul(big.NewInt(params.Ether), big.NewInt(int64(s.cfg.Photon.MinBalanceInchannel)))
 		var nowNum = channelX.Balance
 		var diffNum = new(big.Int).Sub(minNum, nowNum)
 		if minNum.Cmp(nowNum) == 1 {
+			belowMin++
 			//补充至MinBalanceInchannel
-			err0 := pubNode.Deposit(clientaddrStr, params.TokenAddress, diffNum, 48)
+			err0 := pubNode.Deposit(clientaddrStr, s.cfg.Photon.TokenAddress, diffNum, 48)
 			if err0 != nil {
-				fmt.Println(fmt.Errorf("[Pub-CheckPubChannelBalance]between pub %v and %v client,Deposit to channel err=%s", params.PhotonAddress, clientaddrStr, err0))
+				level.Error(plog).Log("event", "deposit failed", "feed", info.ID, "eth", clientaddrStr, "amount", diffNum, "err", err0)
 				continue
 			}
-			fmt.Println(fmt.Sprintf(PrintTime()+"[Pub-CheckPubChannelBalance]between pub %v and %v client,Deposit to channel SUCCESS, num=%v", params.PhotonAddress, clientaddrStr, diffNum))
+			level.Info(plog).Log("event", "deposited", "feed", info.ID, "eth", clientaddrStr, "amount", diffNum)
 		}
 		time.Sleep(time.Second)
 	}
+}
 
-	time.AfterFunc(params.RoundTimeOfCheckChannelBalance, checkPubChannelBalance)
+// backPay every RoundTimeOfBackPay, until ctx is done
+func (s *Service) backPay(ctx context.Context) {
+	if !sleepCtx(ctx, time.Second*5) { //数据库可能没准备好
+		return
+	}
+	for {
+		s.backPayRound(ctx)
+		if !sleepCtx(ctx, s.cfg.Photon.BackPayInterval.Duration) {
+			return
+		}
+	}
 }
 
-func backPay() {
-	time.Sleep(time.Second * 5) //数据库可能没准备好
-	rinfos, err := likeDB.SelectRewardResult("", 0, time.Now().UnixNano()/1e6)
+func (s *Service) backPayRound(ctx context.Context) {
+	rinfos, err := s.db.SelectRewardResult("", 0, time.Now().UnixNano()/1e6)
 	if err != nil {
-		fmt.Println(fmt.Errorf("[Pub-backPay]SelectRewardResult err=%s", err))
+		level.Error(s.logger(logRewards)).Log("event", "back pay: reward results failed", "err", err)
 	}
 	for _, info := range rinfos {
+		if ctx.Err() != nil {
+			return
+		}
 		if info.GrantSuccess == "fail" {
 			partnerAddress := info.ClientEthAddress
 			amount := info.GrantTokenAmount
 			cid := info.ClientID
 			msgtime := info.MessageTime
 			reason := info.RewardReason
-			photonNode := &PhotonNode{
-				Host:       "http://" + params.PhotonHost,
-				Address:    params.PhotonAddress,
-				APIAddress: params.PhotonHost,
-				DebugCrash: false,
-			}
+			rlog := kitlog.With(s.logger(logRewards), "event", "back pay", "feed", cid, "eth", partnerAddress, "reason", reason)
+			photonNode := s.photonNode()
 			//------------------------------------------------------
 			//如果因为某种原因通道未建立成功，这里重新开通道
 			channelX, err := photonNode.GetChannelWith(&PhotonNode{
 				Address: partnerAddress,
-			}, params.TokenAddress)
+			}, s.cfg.Photon.TokenAddress)
 			if err != nil {
-				fmt.Println(fmt.Errorf(PrintTime()+"[Pub-backPay] GetChannelWith %s", err))
+				level.Error(rlog).Log("step", "channel query", "err", err)
 				continue
 			}
 			if channelX == nil {
-				err = photonNode.OpenChannel(partnerAddress, params.TokenAddress, amount, params.SettleTime)
+				err = photonNode.OpenChannel(partnerAddress, s.cfg.Photon.TokenAddress, amount, s.cfg.Photon.SettleTimeout)
 				if err != nil {
-					fmt.Println(fmt.Errorf(PrintTime()+" [Pub-backPay] create channel, err=%s", err))
+					level.Error(rlog).Log("step", "open channel", "err", err)
 					continue
 				}
-				fmt.Println(fmt.Sprintf(PrintTime()+" [Pub-backPay] create channel SUCCESS[%s], with %s", cid, partnerAddress))
+				level.Info(rlog).Log("step", "channel opened", "amount", amount)
 			}
 			//------------------------------------------------------
 			netStatus := false
 			nodeS, err := photonNode.GetNodeStatus(partnerAddress)
 			if err != nil {
-				fmt.Println(fmt.Sprintf(PrintTime()+" [Pub-backPay]GetNodeStatus[], err=%s", partnerAddress, err))
+				level.Warn(rlog).Log("step", "node status", "err", err)
 			}
 			netStatus = nodeS.IsOnline
 			if netStatus {
-				err = photonNode.SendTrans(params.TokenAddress, amount, partnerAddress, true, false)
+				err = photonNode.SendTrans(s.cfg.Photon.TokenAddress, amount, partnerAddress, true, false)
 				if err != nil {
-					fmt.Println(fmt.Errorf(PrintTime()+" [Pub-backPay] back pay to partnerAddress=%s, ClientID=%s, error=%s", partnerAddress, cid, err))
+					level.Error(rlog).Log("step", "transfer", "amount", amount, "err", err)
+					s.countReward(reason, rewardFailed)
 					continue
 				}
+				s.countTokens(reason, tokenMLT, amount)
 				//对sign up 补发SMT激励
 				if reason == SignUp {
-					err = photonNode.TransferSMT(partnerAddress, new(big.Int).Mul(big.NewInt(params.Ether), big.NewInt(int64(params.RewardOfSignupSMT))).String())
+					smtAmount := new(big.Int).Mul(big.NewInt(params.Ether), big.NewInt(int64(s.cfg.Rewards.SignupSMT)))
+					err = photonNode.TransferSMT(partnerAddress, smtAmount.String())
 					if err != nil {
+						level.Error(rlog).Log("step", "transfer smt", "amount", smtAmount, "err", err)
+						s.countReward(reason, rewardFailed)
 						continue
 					}
-					fmt.Println(fmt.Sprintf(PrintTime()+" [Pub-backPay] award(SMT) to %s, amount=%v, err=%v", partnerAddress, err))
+					level.Info(rlog).Log("step", "rewarded smt", "amount", smtAmount)
+					s.countTokens(reason, tokenSMT, smtAmount)
 				}
+				s.countReward(reason, rewardSent)
 
-				_, err = likeDB.UpdateRewardResult(cid, partnerAddress, "success", msgtime)
+				_, err = s.db.UpdateRewardResult(cid, partnerAddress, "success", msgtime)
 				if err != nil {
-					fmt.Println(fmt.Errorf(PrintTime()+" [Pub-backPay] back pay to partnerAddress=%s, ClientID=%s success,but RecordRewardResult error=%s", partnerAddress, cid, err))
+					level.Error(rlog).Log("step", "record reward", "err", err)
 				}
-				fmt.Println(fmt.Sprintf(PrintTime()+" [Pub-backPay] back pay to partnerAddress=%s, ClientID=%s SUCCESS", partnerAddress, cid))
+				level.Info(rlog).Log("step", "rewarded", "amount", amount)
 			} else {
 				//fmt.Println(fmt.Errorf(PrintTime()+" [Pub-backPay] back pay to partnerAddress=%s, ClientID=%s failed, because node is not online", partnerAddress, cid))
 			}
 		}
 	}
-	time.AfterFunc(params.RoundTimeOfBackPay, backPay)
 }
 
-func IsBlackList(defendant string) bool {
-	blacklists, err := likeDB.SelectViolationByWhere("", defendant, "", "", "1")
+func (s *Service) IsBlackList(defendant string) bool {
+	blacklists, err := s.db.SelectViolationByWhere("", defendant, "", "", "1")
 	if err != nil {
-		fmt.Println(fmt.Errorf(PrintTime()+"selectBlacklist-Failed to get blacklist, err=%s", err))
+		level.Error(s.logger(logModeration)).Log("event", "blacklist query failed", "feed", defendant, "err", err)
 		return false
 	}
 	if len(blacklists) > 0 {
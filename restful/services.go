@@ -0,0 +1,160 @@
+package restful
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"go.cryptoscope.co/ssb/dfa"
+	"go.cryptoscope.co/ssb/restful/params"
+	kitlog "go.mindeco.de/log"
+	"go.mindeco.de/log/level"
+	"golang.org/x/sync/errgroup"
+)
+
+// Service the restful api, the message analysis and the photon loops of one pub.
+// It keeps all its state itself, so more than one can run in a process, each with its own config.
+type Service struct {
+	cfg     *params.Config
+	pubID   string
+	backend ssbBackend
+
+	// log the entries of all modules, logLevels filters them per module, see logger
+	log       kitlog.Logger
+	logLevels *logLevels
+
+	// stats the metrics of the services, served on /metrics, see metrics
+	stats *serviceMetrics
+
+	db               *PubDB
+	dfa              *dfa.DFA
+	lastAnalysisTime int64
+	// analyzedSeq the head of the receive log when the last analysis round started, -1 before the first round
+	analyzedSeq int64
+
+	rateLimiter *RateLimitMiddleware
+	// proxies the reverse proxies whose forwarding headers name the caller, see clientIP
+	proxies trustedProxies
+
+	// pubs the directory get-pubhost-by-ip ranks, geoip locates the clients and the pubs
+	pubs  *pubDirectory
+	geoip *geoIPDB
+
+	// dailyLoginLock makes the check and the insert of collectDailyLogin atomic
+	dailyLoginLock sync.Mutex
+
+	// payouts the rewards and channel deals that are still being sent, the services wait for them before they stop
+	payouts sync.WaitGroup
+
+	// replay the analysis reads the log again for a reindex, it pays no rewards and publishes nothing, see Reindex
+	replay bool
+	// simulation collects the rewards instead of paying them, see SimulateRewards
+	simulation *rewardSimulator
+}
+
+// newService opens the database in the datadir of cfg, loads the sensitive words and the pub directory,
+// pubID is the feed of the pub that backend reads from and publishes to, logger gets the entries of all modules
+func newService(cfg *params.Config, pubID string, backend ssbBackend, logger kitlog.Logger) (*Service, error) {
+	levels, err := newLogLevels(cfg.Log)
+	if err != nil {
+		return nil, err
+	}
+	s := &Service{
+		cfg:       cfg,
+		pubID:     pubID,
+		backend:   backend,
+		log:       kitlog.With(logger, "pub", pubID),
+		logLevels: levels,
+		stats:     newServiceMetrics(),
+
+		analyzedSeq: -1,
+	}
+	if err := s.initAnalysis(); err != nil {
+		return nil, err
+	}
+	s.pubs = newPubDirectory(cfg)
+	if err := s.loadPubAnnouncements(); err != nil {
+		return nil, fmt.Errorf("load pub announcements: %w", err)
+	}
+	s.geoip = newGeoIPDB(cfg.Analysis.IP2LocationDB, s.logger(logDirectory))
+	return s, nil
+}
+
+// goPayout runs a reward or a channel deal in the background, a replay drops it
+func (s *Service) goPayout(pay func()) {
+	if s.replay {
+		return
+	}
+	s.payouts.Add(1)
+	s.metrics().pendingPayouts.Add(1)
+	go func() {
+		defer s.payouts.Done()
+		defer s.metrics().pendingPayouts.Add(-1)
+		pay()
+	}()
+}
+
+// runServices serves the api on ln and runs the message analysis and the photon loops until ctx is done or one of them fails.
+// The api gets the shutdown_timeout of the config to finish the running requests, then the loops and the outstanding payouts are waited for
+// and the database is closed.
+func (s *Service) runServices(ctx context.Context, server *http.Server, ln net.Listener) error {
+	g, ctx := errgroup.WithContext(ctx)
+
+	g.Go(func() error {
+		err := server.Serve(ln)
+		if err != nil && err != http.ErrServerClosed {
+			return fmt.Errorf("restful api stopped: %w", err)
+		}
+		return nil
+	})
+	g.Go(func() error {
+		<-ctx.Done()
+		sctx, cancel := context.WithTimeout(context.Background(), s.cfg.API.ShutdownTimeout.Duration)
+		defer cancel()
+		if err := server.Shutdown(sctx); err != nil {
+			return fmt.Errorf("restful api shutdown: %w", err)
+		}
+		return nil
+	})
+
+	g.Go(func() error {
+		s.DoMessageTask(ctx)
+		return nil
+	})
+
+	//检查pub 与 所有metalife内已注册eth地址的账户的通道余额，按规定补充
+	g.Go(func() error {
+		s.checkPubChannelBalance(ctx)
+		return nil
+	})
+
+	//补发激励，
+	g.Go(func() error {
+		s.backPay(ctx)
+		return nil
+	})
+
+	//pub目录: 检查各pub的负载和存活
+	if s.pubs != nil {
+		g.Go(func() error {
+			s.probePubs(ctx)
+			return nil
+		})
+	}
+
+	err := g.Wait()
+	s.payouts.Wait()
+	level.Info(s.logger(logAPI)).Log("event", "services stopped", "err", err)
+
+	if s.geoip != nil {
+		s.geoip.Close()
+	}
+	if s.db != nil {
+		if cerr := s.db.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("close pub database: %w", cerr)
+		}
+	}
+	return err
+}
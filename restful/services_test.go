@@ -0,0 +1,159 @@
+package restful
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/internal/leakcheck"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/restful/params"
+)
+
+// idleBackend has no messages, the log stream waits until the services stop
+type idleBackend struct{}
+
+func (idleBackend) logStream(ctx context.Context, gt int64) (messageSource, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (idleBackend) publish(ctx context.Context, content interface{}) (string, error) {
+	return "%none.sha256", nil
+}
+
+func (idleBackend) status(ctx context.Context) (ssb.Status, error) {
+	return ssb.Status{}, nil
+}
+
+func (idleBackend) messageAuthor(ctx context.Context, key string) (string, error) {
+	return "", fmt.Errorf("no message %s", key)
+}
+
+func (idleBackend) search(ctx context.Context, qry message.SearchArgs) ([]DeserializedMessageStu, error) {
+	return nil, nil
+}
+
+// TestRunServicesShutdown the services drain the running request and wait for the payout before they stop, without leaking goroutines
+func TestRunServicesShutdown(t *testing.T) {
+	defer leakcheck.Check(t)
+	r := require.New(t)
+
+	s := &Service{cfg: params.DefaultConfig(), backend: idleBackend{}}
+
+	inRequest := make(chan struct{})
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, req *http.Request) {
+		close(inRequest)
+		<-release
+		w.Write([]byte("done"))
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	r.NoError(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- s.runServices(ctx, &http.Server{Handler: mux}, ln)
+	}()
+
+	hc := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	got := make(chan string, 1)
+	go func() {
+		resp, err := hc.Get("http://" + ln.Addr().String() + "/slow")
+		if err != nil {
+			got <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		got <- string(b)
+	}()
+	<-inRequest
+
+	paid := false
+	s.goPayout(func() {
+		<-release
+		paid = true
+	})
+
+	cancel()
+	select {
+	case err := <-stopped:
+		t.Fatalf("stopped before the request and the payout were done: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	r.Equal("done", <-got)
+	r.NoError(<-stopped)
+	r.True(paid)
+}
+
+// TestRunServicesListenError a failing api stops the other services
+func TestRunServicesListenError(t *testing.T) {
+	defer leakcheck.Check(t)
+	r := require.New(t)
+
+	s := &Service{cfg: params.DefaultConfig(), backend: idleBackend{}}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	r.NoError(err)
+	ln.Close()
+
+	err = s.runServices(context.Background(), &http.Server{}, ln)
+	r.Error(err)
+}
+
+// TestTwoServices two services with their own config run side by side in one process
+func TestTwoServices(t *testing.T) {
+	defer leakcheck.Check(t)
+	r := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 2)
+	var urls []string
+	for i, pubID := range []string{"@pubA.ed25519", "@pubB.ed25519"} {
+		cfg := params.DefaultConfig()
+		cfg.API.Host = "127.0.0.1"
+		cfg.Pub.EthAddress = fmt.Sprintf("0x%040d", i)
+		s := &Service{cfg: cfg, pubID: pubID, backend: idleBackend{}}
+
+		server, err := s.newAPIServer()
+		r.NoError(err)
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		r.NoError(err)
+		urls = append(urls, "http://"+ln.Addr().String())
+		go func() {
+			stopped <- s.runServices(ctx, server, ln)
+		}()
+	}
+
+	hc := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	for i, pubID := range []string{"@pubA.ed25519", "@pubB.ed25519"} {
+		resp, err := hc.Get(urls[i] + "/ssb/api/pub-whoami")
+		r.NoError(err)
+		var whoami struct {
+			Data Whoami `json:"data"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&whoami)
+		resp.Body.Close()
+		r.NoError(err)
+		r.Equal(pubID, whoami.Data.Pub_Id)
+		r.Equal(fmt.Sprintf("0x%040d", i), whoami.Data.Pub_Eth_Address)
+	}
+
+	cancel()
+	r.NoError(<-stopped)
+	r.NoError(<-stopped)
+}
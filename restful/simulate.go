@@ -0,0 +1,200 @@
+package restful
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"time"
+
+	kitlog "go.mindeco.de/log"
+	"go.mindeco.de/log/level"
+
+	"go.cryptoscope.co/ssb/restful/params"
+)
+
+// RewardSimulation the rewards of the messages, logins and nfts from From to To (unix milliseconds, To is exclusive)
+// by a candidate policy, next to the rewards by the policy of the config
+type RewardSimulation struct {
+	From      int64        `json:"from"`
+	To        int64        `json:"to"`
+	Candidate *RewardSpend `json:"candidate"`
+	Current   *RewardSpend `json:"current"`
+}
+
+// RewardSpend the rewards by a policy, tokens are whole tokens
+type RewardSpend struct {
+	Tokens  int64               `json:"tokens"`
+	Rewards int                 `json:"rewards"`
+	Reasons []*SimulatedRewards `json:"reasons"`
+	Users   []*SimulatedRewards `json:"users"`
+}
+
+// SimulatedRewards the rewards of a reason or of a feed
+type SimulatedRewards struct {
+	Reason     string `json:"reason,omitempty"`
+	ClientID   string `json:"client_id,omitempty"`
+	EthAddress string `json:"eth_address,omitempty"`
+	Rewards    int    `json:"rewards"`
+	Tokens     int64  `json:"tokens"`
+	// Rejected the rewards over the daily cap
+	Rejected int `json:"rejected"`
+	// NoAddress the rewards of feeds without a valid eth address
+	NoAddress int `json:"no_address"`
+}
+
+func (sr *SimulatedRewards) count(amount int64, paid, capped bool) {
+	switch {
+	case paid:
+		sr.Rewards++
+		sr.Tokens += amount
+	case capped:
+		sr.Rejected++
+	default:
+		sr.NoAddress++
+	}
+}
+
+// rewardEvent a reward the analysis or the api gives
+type rewardEvent struct {
+	feed, ethAddr, reason string
+	time                  int64
+}
+
+// rewardSimulator collects the rewards of a replay, instead of paying them (see rewardFeed)
+type rewardSimulator struct {
+	from, to int64
+	events   []rewardEvent
+}
+
+func (rs *rewardSimulator) add(feed, ethAddr, reason string, msgTime int64) {
+	if msgTime < rs.from || msgTime >= rs.to {
+		return
+	}
+	rs.events = append(rs.events, rewardEvent{feed: feed, ethAddr: ethAddr, reason: reason, time: msgTime})
+}
+
+// apply pays the rewards in the order of their time with the amounts of policy.
+// Like PubRewardToken a reward needs a valid eth address, and like ExceedRewardLimit a feed gets no more rewards of a reason
+// once the ones of the day (local time of the pub) reached the cap of policy.
+func (rs *rewardSimulator) apply(policy params.RewardConfig) *RewardSpend {
+	events := make([]rewardEvent, len(rs.events))
+	copy(events, rs.events)
+	sort.SliceStable(events, func(i, j int) bool { return events[i].time < events[j].time })
+
+	spend := &RewardSpend{Reasons: []*SimulatedRewards{}, Users: []*SimulatedRewards{}}
+	reasons := make(map[string]*SimulatedRewards)
+	users := make(map[string]*SimulatedRewards)
+	daily := make(map[string]*big.Int)
+	for _, ev := range events {
+		amount := int64(rewardAmount(policy, ev.reason))
+		_, err := HexToAddress(ev.ethAddr)
+		paid, capped := err == nil, false
+		if paid {
+			day := ev.feed + "|" + ev.reason + "|" + time.Unix(ev.time/1000, 0).Format("2006-01-02")
+			history, ok := daily[day]
+			if !ok {
+				history = new(big.Int)
+				daily[day] = history
+			}
+			if history.Cmp(rewardCap(policy, ev.reason)) >= 0 {
+				paid, capped = false, true
+			} else {
+				history.Add(history, new(big.Int).Mul(big.NewInt(params.Ether), big.NewInt(amount)))
+			}
+		}
+
+		r, ok := reasons[ev.reason]
+		if !ok {
+			r = &SimulatedRewards{Reason: ev.reason}
+			reasons[ev.reason] = r
+			spend.Reasons = append(spend.Reasons, r)
+		}
+		r.count(amount, paid, capped)
+		u, ok := users[ev.feed]
+		if !ok {
+			u = &SimulatedRewards{ClientID: ev.feed, EthAddress: ev.ethAddr}
+			users[ev.feed] = u
+			spend.Users = append(spend.Users, u)
+		}
+		u.count(amount, paid, capped)
+		if paid {
+			spend.Rewards++
+			spend.Tokens += amount
+		}
+	}
+	sort.Slice(spend.Reasons, func(i, j int) bool { return spend.Reasons[i].Reason < spend.Reasons[j].Reason })
+	sort.Slice(spend.Users, func(i, j int) bool {
+		if spend.Users[i].Tokens != spend.Users[j].Tokens {
+			return spend.Users[i].Tokens > spend.Users[j].Tokens
+		}
+		return spend.Users[i].ClientID < spend.Users[j].ClientID
+	})
+	return spend
+}
+
+// SimulateRewards replays the receive log of the pub of cfg into a scratch database and sums up the rewards of the messages,
+// logins and nfts from from to to (unix milliseconds, to is exclusive) by policy and by the rewards of cfg.
+// Nothing is paid, photon is not called and the database of cfg is only read.
+func SimulateRewards(ctx context.Context, cfg *params.Config, policy params.RewardConfig, from, to int64, logger kitlog.Logger) (*RewardSimulation, error) {
+	connCtx, closeConn := context.WithCancel(context.Background())
+	defer closeConn()
+
+	backend, pubID, err := newMuxrpcBackend(connCtx, &cfg.Pub, logger)
+	if err != nil {
+		return nil, fmt.Errorf("simulate rewards: %w", err)
+	}
+	return simulateRewards(ctx, cfg, pubID, backend, policy, from, to, logger)
+}
+
+func simulateRewards(ctx context.Context, cfg *params.Config, pubID string, backend ssbBackend, policy params.RewardConfig, from, to int64, logger kitlog.Logger) (*RewardSimulation, error) {
+	if from < 0 || to <= from {
+		return nil, fmt.Errorf("simulate rewards: from must be before to")
+	}
+	scratch := cfg.Pub.DataDir + ".simulate"
+	s, err := newReplayService(cfg, pubID, backend, scratch, logger)
+	if err != nil {
+		return nil, fmt.Errorf("simulate rewards: %w", err)
+	}
+	defer os.Remove(scratch)
+	sim := &rewardSimulator{from: from, to: to}
+	s.simulation = sim
+	err = s.simulateRound(ctx)
+	if cerr := s.db.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("simulate rewards: %w", err)
+	}
+	return &RewardSimulation{
+		From:      from,
+		To:        to,
+		Candidate: sim.apply(policy),
+		Current:   sim.apply(cfg.Rewards),
+	}, nil
+}
+
+// simulateRound collects the rewards of the whole log and of the logins and nfts of the database of s
+func (s *Service) simulateRound(ctx context.Context) error {
+	src, err := s.backend.logStream(ctx, 0)
+	if err != nil {
+		return fmt.Errorf("log stream: %w", err)
+	}
+	_, messages, err := s.SsbMessageAnalysis(ctx, src)
+	if err != nil {
+		return err
+	}
+	//登录和铸造NFT的激励来自api,记录在usertaskcollect
+	for msgtype, reason := range map[string]string{"1": DailyLogin, "4": MintNft} {
+		tasks, err := s.db.GetUserTaskCollect("", msgtype, s.simulation.from, s.simulation.to-1)
+		if err != nil {
+			return err
+		}
+		for _, task := range tasks {
+			s.rewardFeed(task.Author, reason, task.MessageKey, task.MessageTime)
+		}
+	}
+	level.Info(s.logger(logRewards)).Log("event", "rewards simulated", "messages", messages, "rewards", len(s.simulation.events))
+	return nil
+}
@@ -0,0 +1,62 @@
+package restful
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"go.cryptoscope.co/ssb/restful/params"
+)
+
+func TestRewardSimulator(t *testing.T) {
+	r := require.New(t)
+	const aliceEth = "0x1111111111111111111111111111111111111111"
+	at := func(day, hour int) int64 {
+		return time.Date(2022, 3, day, hour, 0, 0, 0, time.Local).UnixNano() / 1e6
+	}
+
+	sim := &rewardSimulator{from: at(1, 0), to: at(3, 0)}
+	sim.add("@alice", aliceEth, PostMessage, at(1, 12))
+	sim.add("@alice", aliceEth, PostMessage, at(1, 10))
+	sim.add("@alice", aliceEth, LikePost, at(1, 11))
+	sim.add("@alice", aliceEth, PostMessage, at(1, 13))
+	sim.add("@alice", aliceEth, PostMessage, at(2, 9))
+	sim.add("@bob", "", PostMessage, at(1, 9))
+	sim.add("@alice", aliceEth, PostMessage, at(3, 9))
+	r.Len(sim.events, 6, "the ones after to are left out")
+
+	policy := params.RewardConfig{PostMessage: 5, LikePost: 3, MaxDaily: 7}
+	spend := sim.apply(policy)
+	// the second post of the first day reaches the cap of 7, the third one is rejected, the cap is per reason
+	r.Equal(int64(18), spend.Tokens)
+	r.Equal(4, spend.Rewards)
+	r.Equal([]*SimulatedRewards{
+		{Reason: LikePost, Rewards: 1, Tokens: 3},
+		{Reason: PostMessage, Rewards: 3, Tokens: 15, Rejected: 1, NoAddress: 1},
+	}, spend.Reasons)
+	r.Equal([]*SimulatedRewards{
+		{ClientID: "@alice", EthAddress: aliceEth, Rewards: 4, Tokens: 18, Rejected: 1},
+		{ClientID: "@bob", NoAddress: 1},
+	}, spend.Users)
+
+	// a policy without a daily cap pays nothing
+	none := sim.apply(params.RewardConfig{PostMessage: 5, LikePost: 3})
+	r.Zero(none.Tokens)
+	r.Equal(5, none.Users[0].Rejected)
+	r.Equal(1, none.Users[1].NoAddress)
+
+	empty := (&rewardSimulator{from: 0, to: 1}).apply(policy)
+	r.NotNil(empty.Reasons)
+	r.NotNil(empty.Users)
+}
+
+func TestRewardPolicy(t *testing.T) {
+	r := require.New(t)
+	rc := params.DefaultConfig().Rewards
+	r.Equal(rc.LikePost, rewardAmount(rc, LikePost))
+	r.Equal(rc.DailyLogin, rewardAmount(rc, DailyLogin))
+	r.Equal(0, rewardAmount(rc, "unknown"))
+	r.Equal("601000000000000000000", rewardCap(rc, SignUp).String())
+	r.Equal("500000000000000000000", rewardCap(rc, PostComment).String())
+}
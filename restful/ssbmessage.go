@@ -25,18 +25,6 @@ type DeserializedMessageStu struct {
 	Timestamp float64       `json:"timestamp"`
 }
 
-// LikeDetail 存储一轮搜索到的被Like的消息ID
-var LikeDetail []string
-
-// LikeDetail 存储一轮搜索到的被Unlike的消息ID
-var UnLikeDetail []string
-
-// LikeCount for save message for search likes's author
-var TempMsgMap map[string]*TempdMessage
-
-// ClientID2Name for save message for search likes's author clientid---name
-var ClientID2Name map[string]string
-
 func PrintTime() string {
 	return "[" + time.Now().Format("2006-01-02 15:04:05") + "] "
 }
@@ -71,7 +59,7 @@ type TippedOffStu struct {
 // VoteStru
 type VoteStru struct {
 	Link       string `json:"link"`
-	value      int    `json:"value"`
+	Value      int    `json:"value"`
 	Expression string `json:"expression"`
 }
 
@@ -120,9 +108,6 @@ type Whoami struct {
 	Pub_Eth_Address string `json:"pub_eth_address"`
 }
 
-// SensitiveWords
-var SensitiveWords []string
-
 // EventSensitive
 type EventSensitive struct {
 	PubID           string `json:"pub_id"`
@@ -215,4 +200,6 @@ type PubInfoByIP struct {
 	FirstChoicePubInviteCode  string `json:"first_choice_pub_invite_code"`
 	SecondChoicePubHost       string `json:"second_choice_pub_host"`
 	SecondChoicePubInviteCode string `json:"second_choice_pub_invite_code"`
+	// Candidates the ranked pubs, the first two are the choices above
+	Candidates []*PubCandidate `json:"candidates"`
 }
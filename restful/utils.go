@@ -7,11 +7,9 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 )
 
+// writejson the client is gone when it fails, the access log has the call
 func writejson(w rest.ResponseWriter, result interface{}) {
-	err := w.WriteJson(result)
-	if err != nil {
-		fmt.Println(fmt.Sprintf("writejson err %s", err))
-	}
+	_ = w.WriteJson(result)
 }
 
 func HexToAddress(addr string) (address common.Address, err error) {
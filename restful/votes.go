@@ -0,0 +1,136 @@
+package restful
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"go.mindeco.de/log/level"
+)
+
+const (
+	// votesIndexedState the analysisstate that is set once the votes of the whole log are in the vote index
+	votesIndexedState = "votes_indexed"
+	// resolveVoteTargetsLimit the messages whose author is looked up in one round
+	resolveVoteTargetsLimit = 200
+)
+
+// parseVote the message a vote is on and its value, 1 for a like and 0 for an unlike, ok is false for other messages
+func parseVote(content json.RawMessage) (target string, value int, ok bool) {
+	var cvs ContentVoteStru
+	if err := json.Unmarshal(content, &cvs); err != nil || cvs.Type != "vote" || cvs.Vote == nil || cvs.Vote.Link == "" {
+		return "", 0, false
+	}
+	if cvs.Vote.Value > 0 {
+		value = 1
+	}
+	return cvs.Vote.Link, value, true
+}
+
+// resolveVoteTargets looks the authors of the messages that were voted on up with the get index of the pub.
+// Messages the pub does not have yet are tried again in the next rounds, the ones tried least often first.
+func (s *Service) resolveVoteTargets(ctx context.Context) error {
+	targets, err := s.db.SelectUnresolvedVoteTargets(resolveVoteTargetsLimit)
+	if err != nil {
+		return err
+	}
+	alog := s.logger(logAnalysis)
+	var resolved int
+	for _, target := range targets {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		author, err := s.messageAuthor(ctx, target)
+		if err != nil {
+			level.Debug(alog).Log("event", "vote target unknown", "msgkey", target, "err", err)
+			if err = s.db.MarkVoteTargetUnresolved(target); err != nil {
+				return err
+			}
+			continue
+		}
+		if err = s.db.ResolveVoteTarget(target, author); err != nil {
+			return err
+		}
+		resolved++
+	}
+	if len(targets) > 0 {
+		level.Debug(alog).Log("event", "vote targets resolved", "resolved", resolved, "unknown", len(targets)-resolved)
+	}
+	return nil
+}
+
+// messageAuthor the author of the message key from the get index of the pub
+func (s *Service) messageAuthor(ctx context.Context, key string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return s.backend.messageAuthor(ctx, key)
+}
+
+// backfillVotes fills the vote index from the whole log once, for databases of the analysis before the index,
+// the daily rollups are built again from it. No rewards are sent for these votes, the analysis sent them already.
+func (s *Service) backfillVotes(ctx context.Context) error {
+	if s.db == nil {
+		return nil
+	}
+	indexed, err := s.db.SelectAnalysisState(votesIndexedState)
+	if err != nil || indexed != 0 {
+		return err
+	}
+	alog := s.logger(logAnalysis)
+	if s.lastAnalysisTime == 0 {
+		//新数据库,分析会从头读取日志
+		return s.db.UpdateAnalysisState(votesIndexedState, 1)
+	}
+
+	level.Info(alog).Log("event", "indexing the votes of the log")
+	src, err := s.backend.logStream(ctx, 0)
+	if err != nil {
+		return fmt.Errorf("log stream: %w", err)
+	}
+	var buf bytes.Buffer
+	var votes int
+	for src.Next(ctx) {
+		buf.Reset()
+		err = src.Reader(func(r io.Reader) error {
+			_, err := buf.ReadFrom(r)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		var msg DeserializedMessageStu
+		if err = json.Unmarshal(buf.Bytes(), &msg); err != nil {
+			return fmt.Errorf("message source unmarshal: %w", err)
+		}
+		if msg.Value == nil {
+			continue
+		}
+		target, value, ok := parseVote(msg.Value.Content)
+		if !ok {
+			continue
+		}
+		msgTime := int64(msg.Value.Timestamp*math.Pow10(2)) / 100
+		if _, _, err = s.db.UpsertVote(msg.Value.Author.String(), target, value, msg.Value.Sequence, msgTime); err != nil {
+			return fmt.Errorf("index vote %s: %w", msg.Key, err)
+		}
+		votes++
+	}
+	if err = src.Err(); err != nil {
+		return err
+	}
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	if err = s.resolveVoteTargets(ctx); err != nil {
+		return err
+	}
+	if err = s.db.RebuildDailyRollups(); err != nil {
+		return fmt.Errorf("rebuild daily rollups: %w", err)
+	}
+	level.Info(alog).Log("event", "votes indexed", "votes", votes)
+	return s.db.UpdateAnalysisState(votesIndexedState, 1)
+}
@@ -0,0 +1,164 @@
+package restful
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVote(t *testing.T) {
+	r := require.New(t)
+	msgKey := "%2pJcGMZMTRr4oRn5hOtbTn9Au+eV4PC54n2XFdAoKF8=.sha256"
+
+	for _, tc := range []struct {
+		content string
+		value   int
+		ok      bool
+	}{
+		{`{"type":"vote","vote":{"link":"` + msgKey + `","value":1,"expression":"Like"}}`, 1, true},
+		{`{"type":"vote","vote":{"link":"` + msgKey + `","value":0,"expression":"Unlike"}}`, 0, true},
+		{`{"type":"vote","vote":{"link":"` + msgKey + `","value":-1,"expression":"dig"}}`, 0, true},
+		// the value counts, not the expression
+		{`{"type":"vote","vote":{"link":"` + msgKey + `","value":1,"expression":"Unlike"}}`, 1, true},
+		{`{"type":"vote","vote":{"link":"` + msgKey + `","value":0,"expression":"Like"}}`, 0, true},
+		{`{"type":"vote","vote":{"link":"` + msgKey + `"}}`, 0, true},
+		{`{"type":"vote","vote":{"value":1}}`, 0, false},
+		{`{"type":"vote"}`, 0, false},
+		{`{"type":"post","text":"hello"}`, 0, false},
+		{`"Ym94.box"`, 0, false},
+	} {
+		target, value, ok := parseVote(json.RawMessage(tc.content))
+		r.Equal(tc.ok, ok, tc.content)
+		r.Equal(tc.value, value, tc.content)
+		if ok {
+			r.Equal(msgKey, target)
+		}
+	}
+}
+
+// TestUpsertVote the index keeps the newest vote of a feed, the first like is rewarded once
+// and the likes received are counted on the days of the votes once the author of the target is known
+func TestUpsertVote(t *testing.T) {
+	r := require.New(t)
+	dir, err := ioutil.TempDir("", "votes")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+	db, err := OpenPubDB(filepath.Join(dir, "pubdata"), testPubA)
+	r.NoError(err)
+	defer db.Close()
+
+	const target = "%target.sha256"
+	day1, day2 := int64(10*86400000), int64(11*86400000)
+	vote := func(voter string, value int, seq, votetime int64) (changed, firstLike bool) {
+		changed, firstLike, err := db.UpsertVote(voter, target, value, seq, votetime)
+		r.NoError(err)
+		return changed, firstLike
+	}
+	activity := func(feed, day string) (given, received int) {
+		days, err := db.SelectDailyActivity(feed, day, day)
+		r.NoError(err)
+		if len(days) == 0 {
+			return 0, 0
+		}
+		return days[0].LikesGiven, days[0].LikesReceived
+	}
+
+	changed, first := vote(testPubB, 1, 2, day1)
+	r.True(changed)
+	r.True(first)
+	given, _ := activity(testPubB, rollupDay(day1))
+	r.Equal(1, given)
+
+	// an older vote of the feed arrives late
+	changed, first = vote(testPubB, 0, 1, day1)
+	r.False(changed)
+	r.False(first)
+	given, _ = activity(testPubB, rollupDay(day1))
+	r.Equal(1, given)
+
+	// unlike and like again, the like is not rewarded a second time
+	changed, first = vote(testPubB, 0, 3, day1)
+	r.True(changed)
+	r.False(first)
+	given, _ = activity(testPubB, rollupDay(day1))
+	r.Equal(0, given)
+	changed, first = vote(testPubB, 1, 4, day2)
+	r.True(changed)
+	r.False(first)
+	given, _ = activity(testPubB, rollupDay(day2))
+	r.Equal(1, given)
+
+	changed, first = vote(testPubC, 1, 1, day1)
+	r.True(changed)
+	r.True(first)
+
+	// the author is found later, the likes count as received on the days of the votes
+	_, received := activity(testDefendant, rollupDay(day1))
+	r.Equal(0, received)
+	targets, err := db.SelectUnresolvedVoteTargets(10)
+	r.NoError(err)
+	r.Equal([]string{target}, targets)
+	r.NoError(db.ResolveVoteTarget(target, testDefendant))
+	_, received = activity(testDefendant, rollupDay(day1))
+	r.Equal(1, received)
+	_, received = activity(testDefendant, rollupDay(day2))
+	r.Equal(1, received)
+	targets, err = db.SelectUnresolvedVoteTargets(10)
+	r.NoError(err)
+	r.Empty(targets)
+
+	// a new voter takes the author over from the other votes
+	changed, first = vote(testPubA, 1, 1, day2)
+	r.True(changed)
+	r.True(first)
+	_, received = activity(testDefendant, rollupDay(day2))
+	r.Equal(2, received)
+	changed, _ = vote(testPubA, 0, 2, day2)
+	r.True(changed)
+	_, received = activity(testDefendant, rollupDay(day2))
+	r.Equal(1, received)
+
+	likes, err := db.SelectLikeSum(testDefendant)
+	r.NoError(err)
+	r.Equal(2, likes[testDefendant].LasterLikeNum)
+}
+
+// TestVotesRewardedMigration the likes of a database from before votes.rewarded count as rewarded
+func TestVotesRewardedMigration(t *testing.T) {
+	r := require.New(t)
+	dir, err := ioutil.TempDir("", "votes")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "pubdata")
+
+	old, err := sql.Open("sqlite3", path)
+	r.NoError(err)
+	_, err = old.Exec(`CREATE TABLE "votes" (
+   "voter" TEXT NOT NULL,
+   "target" TEXT NOT NULL,
+   "value" INTEGER NOT NULL default 0,
+   "seq" INTEGER NOT NULL default 0,
+   "votetime" INTEGER NOT NULL default 0,
+   "targetauthor" TEXT NULL,
+   "resolvetries" INTEGER NOT NULL default 0,
+   PRIMARY KEY ("voter","target")
+);
+INSERT INTO votes(voter,target,value,seq,votetime) VALUES ('` + testPubB + `','%liked.sha256',1,1,0),('` + testPubB + `','%unliked.sha256',0,2,0)`)
+	r.NoError(err)
+	r.NoError(old.Close())
+
+	db, err := OpenPubDB(path, testPubA)
+	r.NoError(err)
+	defer db.Close()
+	_, first, err := db.UpsertVote(testPubB, "%liked.sha256", 1, 5, 0)
+	r.NoError(err)
+	r.False(first)
+	_, first, err = db.UpsertVote(testPubB, "%unliked.sha256", 1, 5, 0)
+	r.NoError(err)
+	r.True(first)
+}
@@ -6,6 +6,7 @@ package ssb
 
 import (
 	"fmt"
+	"time"
 
 	"go.cryptoscope.co/margaret"
 	librarian "go.cryptoscope.co/margaret/indexes"
@@ -87,6 +88,45 @@ type Status struct {
 	Blobs    []BlobWant
 	Root     int64
 	Indicies IndexStates
+	Scrub    *ScrubStatus // nil if the bot has no scrubber
+
+	Retention *RetentionStatus // nil if the bot has no retention policy
+}
+
+// ScrubStatus informs about the background check of the receive log and the indexes
+type ScrubStatus struct {
+	Position int64 // the next entry of the receive log that is checked
+	Passes   int   // how often the whole receive log was checked
+	Problems []ScrubProblem
+}
+
+// ScrubProblem is an entry of the receive log the scrubber found a problem with
+type ScrubProblem struct {
+	Seq   int64 // the entry in the receive log, -1 for problems of the whole log
+	Found time.Time
+	Err   string
+}
+
+// RetentionStatus informs about the enforcement of the storage quotas and retention policy
+type RetentionStatus struct {
+	Runs      int // how often all the feeds were checked
+	LastRun   time.Time
+	Nulled    int64 // messages that were nulled since the bot started
+	Decisions []RetentionDecision
+
+	// Skipped are the feeds the policy applies to that are kept whole, only gabby grove messages can drop their content alone
+	Skipped []string
+}
+
+// RetentionDecision is what the retention policy did to a feed the last time it had to null messages of it
+type RetentionDecision struct {
+	Feed   string
+	Hops   int    // the distance of the feed, -1 if it is outside of the graph
+	Rule   string // max-messages, max-bytes or max-age
+	Nulled int    // the messages that were nulled
+	Kept   int64  // the messages that are kept
+	Bytes  int64  // the size of the kept messages
+	When   time.Time
 }
 
 // IndexStates is a slice of index states (for easier sort implementations)
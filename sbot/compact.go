@@ -0,0 +1,290 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package sbot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/offset2"
+
+	"go.cryptoscope.co/ssb/message/multimsg"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+const (
+	compactJournalName = "compact-journal.json"
+	compactLogName     = "log.compact"
+	precompactLogName  = "log.precompact"
+
+	compactPhaseCopy = "copy"
+	compactPhaseSwap = "swap"
+)
+
+// compactDropped are the folders that hold receive log sequences, they are rebuilt after a compaction.
+// The ebt state matrix is dropped as well since it still claims the messages of nulled feeds.
+var compactDropped = [][]string{
+	{repo.PrefixMultiLog},
+	{repo.PrefixIndex},
+	{"ebt-state-matrix"},
+	{"scrubber"},
+}
+
+// CompactReport is what a compaction of the receive log did
+type CompactReport struct {
+	// Messages that were copied to the compacted log
+	Messages int64
+	// Nulled entries that were left out
+	Nulled int64
+
+	// SizeBefore and SizeAfter are the bytes of the log on disk
+	SizeBefore, SizeAfter int64
+}
+
+// compactJournal is written next to the log while a compaction runs, see recoverCompaction
+type compactJournal struct {
+	Phase string
+}
+
+// CompactReceiveLog rewrites the receive log of the repo at path without the entries that were nulled by NullFeed or HealRepo,
+// messages whose content was dropped by NullContent are kept. The sequences of the receive log change, so all the indexes are dropped and rebuilt by the next New().
+//
+// The bot of the repo must not be running. The log is copied before it is swapped in and the steps are recorded in a journal,
+// if the compaction is interrupted the next New() finishes or discards it.
+func CompactReceiveLog(ctx context.Context, path string) (*CompactReport, error) {
+	r := repo.New(path)
+	err := recoverCompaction(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var report CompactReport
+	report.SizeBefore, err = dirSize(r.GetPath("log"))
+	if err != nil {
+		return nil, fmt.Errorf("compact: failed to open the receive log: %w", err)
+	}
+
+	err = writeCompactJournal(r, compactPhaseCopy)
+	if err != nil {
+		return nil, err
+	}
+
+	err = copyLiveEntries(ctx, r, &report)
+	if err != nil {
+		if rerr := recoverCompaction(r); rerr != nil {
+			return nil, fmt.Errorf("compact: %w (and discarding the copy failed: %s)", err, rerr)
+		}
+		return nil, fmt.Errorf("compact: %w", err)
+	}
+
+	report.SizeAfter, err = dirSize(r.GetPath(compactLogName))
+	if err != nil {
+		return nil, fmt.Errorf("compact: %w", err)
+	}
+
+	// from here on the next New() completes the swap
+	err = writeCompactJournal(r, compactPhaseSwap)
+	if err != nil {
+		return nil, err
+	}
+	err = swapCompactedLog(r)
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func copyLiveEntries(ctx context.Context, r repo.Interface, report *CompactReport) error {
+	current, err := repo.OpenLog(r)
+	if err != nil {
+		return err
+	}
+	defer current.Close()
+
+	compactPath := r.GetPath(compactLogName)
+	err = os.RemoveAll(compactPath)
+	if err != nil {
+		return fmt.Errorf("failed to remove the copy of an earlier compaction: %w", err)
+	}
+	ol, err := offset2.Open(compactPath, multimsg.MargaretCodec{})
+	if err != nil {
+		return fmt.Errorf("failed to create the compacted log: %w", err)
+	}
+	compacted := multimsg.NewWrappedLog(ol)
+
+	for seq := int64(0); seq <= current.Seq(); seq++ {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+
+		var v interface{}
+		v, err = current.Get(seq)
+		if err != nil {
+			if margaret.IsErrNulled(err) {
+				report.Nulled++
+				err = nil
+				continue
+			}
+			err = fmt.Errorf("failed to get entry %d: %w", seq, err)
+			break
+		}
+		if verr, ok := v.(error); ok {
+			if margaret.IsErrNulled(verr) {
+				report.Nulled++
+				continue
+			}
+			err = fmt.Errorf("failed to get entry %d: %w", seq, verr)
+			break
+		}
+
+		_, err = compacted.Append(v)
+		if err != nil {
+			err = fmt.Errorf("failed to copy entry %d: %w", seq, err)
+			break
+		}
+		report.Messages++
+	}
+
+	if cerr := compacted.Close(); cerr != nil && err == nil {
+		err = fmt.Errorf("failed to close the compacted log: %w", cerr)
+	}
+	return err
+}
+
+// swapCompactedLog replaces the log with the compacted copy and drops the indexes.
+// Each step can be repeated, it picks up where an interrupted swap stopped.
+func swapCompactedLog(r repo.Interface) error {
+	logPath := r.GetPath("log")
+	compactPath := r.GetPath(compactLogName)
+	prePath := r.GetPath(precompactLogName)
+
+	if pathExists(compactPath) {
+		if pathExists(logPath) {
+			if pathExists(prePath) {
+				return fmt.Errorf("compact: %s and %s both exist, move one of them away", logPath, prePath)
+			}
+			err := os.Rename(logPath, prePath)
+			if err != nil {
+				return fmt.Errorf("compact: failed to move the log aside: %w", err)
+			}
+		}
+		err := os.Rename(compactPath, logPath)
+		if err != nil {
+			return fmt.Errorf("compact: failed to swap in the compacted log: %w", err)
+		}
+	}
+
+	for _, dropped := range compactDropped {
+		err := os.RemoveAll(r.GetPath(dropped...))
+		if err != nil {
+			return fmt.Errorf("compact: failed to drop %s: %w", filepath.Join(dropped...), err)
+		}
+	}
+
+	err := os.RemoveAll(prePath)
+	if err != nil {
+		return fmt.Errorf("compact: failed to remove the old log: %w", err)
+	}
+	return removeCompactJournal(r)
+}
+
+// recoverCompaction is called before the receive log is opened.
+// A compaction that stopped while copying is discarded, one that stopped while swapping is completed.
+func recoverCompaction(r repo.Interface) error {
+	data, err := os.ReadFile(r.GetPath(compactJournalName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("compact: failed to read the journal: %w", err)
+	}
+
+	var journal compactJournal
+	err = json.Unmarshal(data, &journal)
+	if err != nil {
+		return fmt.Errorf("compact: broken journal: %w", err)
+	}
+
+	switch journal.Phase {
+	case compactPhaseCopy:
+		err = os.RemoveAll(r.GetPath(compactLogName))
+		if err != nil {
+			return fmt.Errorf("compact: failed to discard the incomplete copy: %w", err)
+		}
+		return removeCompactJournal(r)
+	case compactPhaseSwap:
+		return swapCompactedLog(r)
+	default:
+		return fmt.Errorf("compact: unknown journal phase: %q", journal.Phase)
+	}
+}
+
+func writeCompactJournal(r repo.Interface, phase string) error {
+	data, err := json.Marshal(compactJournal{Phase: phase})
+	if err != nil {
+		return err
+	}
+
+	err = writeFileAtomic(r.GetPath(compactJournalName), data)
+	if err != nil {
+		return fmt.Errorf("compact: failed to write journal: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic replaces the file at path with data, a crash leaves either the old or the new content
+func writeFileAtomic(path string, data []byte) error {
+	newPath := path + ".new"
+
+	f, err := os.OpenFile(newPath, os.O_TRUNC|os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(newPath, path)
+}
+
+func removeCompactJournal(r repo.Interface) error {
+	err := os.Remove(r.GetPath(compactJournalName))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("compact: failed to remove journal: %w", err)
+	}
+	return nil
+}
+
+func pathExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func dirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,138 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package sbot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb/internal/storedrefs"
+	"go.cryptoscope.co/ssb/internal/testutils"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+func TestCompactReceiveLog(t *testing.T) {
+	if testutils.SkipOnCI(t) {
+		return
+	}
+	r := require.New(t)
+	ctx := context.Background()
+
+	testPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(testPath)
+
+	theBot, botOptions := makeFSCKTestBot(t)
+
+	// interleave the posts of the bot with the ones of a feed that is nulled later
+	const n = 10
+	for i := 0; i < n; i++ {
+		_, err := theBot.PublishLog.Publish(refs.NewPost(fmt.Sprintf("test:%d", i)))
+		r.NoError(err)
+		_, err = theBot.PublishAs("one", map[string]interface{}{"type": "test", "spam": i})
+		r.NoError(err)
+	}
+	r.EqualValues(2*n-1, theBot.ReceiveLog.Seq())
+
+	kps, err := repo.AllKeyPairs(repo.New(testPath))
+	r.NoError(err)
+	oneLog, err := theBot.Users.Get(storedrefs.Feed(kps["one"].ID()))
+	r.NoError(err)
+	for i := int64(0); i < n; i++ {
+		rxSeq, err := oneLog.Get(i)
+		r.NoError(err)
+		r.NoError(theBot.ReceiveLog.Null(rxSeq.(int64)))
+	}
+
+	theBot.Shutdown()
+	r.NoError(theBot.Close())
+
+	report, err := CompactReceiveLog(ctx, testPath)
+	r.NoError(err)
+	r.EqualValues(n, report.Messages)
+	r.EqualValues(n, report.Nulled)
+	r.Less(report.SizeAfter, report.SizeBefore)
+	r.NoFileExists(filepath.Join(testPath, compactJournalName))
+	r.NoDirExists(filepath.Join(testPath, precompactLogName))
+
+	// the indexes are rebuilt from the compacted log
+	theBot, err = New(botOptions...)
+	r.NoError(err)
+	theBot.WaitUntilIndexesAreSynced()
+	r.EqualValues(n-1, theBot.ReceiveLog.Seq())
+
+	mainLog, err := theBot.Users.Get(storedrefs.Feed(theBot.KeyPair.ID()))
+	r.NoError(err)
+	r.EqualValues(n-1, mainLog.Seq())
+	oneLog, err = theBot.Users.Get(storedrefs.Feed(kps["one"].ID()))
+	r.NoError(err)
+	r.EqualValues(-1, oneLog.Seq())
+
+	r.NoError(theBot.FSCK(FSCKWithMode(FSCKModeSequences)))
+
+	// the bot can keep publishing
+	_, err = theBot.PublishLog.Publish(refs.NewPost("after compaction"))
+	r.NoError(err)
+
+	theBot.Shutdown()
+	r.NoError(theBot.Close())
+}
+
+func TestCompactReceiveLogRecovery(t *testing.T) {
+	if testutils.SkipOnCI(t) {
+		return
+	}
+	r := require.New(t)
+
+	testPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(testPath)
+	tRepo := repo.New(testPath)
+
+	theBot, botOptions := makeFSCKTestBot(t)
+	_, err := theBot.PublishAs("one", map[string]interface{}{"type": "test", "spam": true})
+	r.NoError(err)
+	const n = 5
+	for i := 0; i < n; i++ {
+		_, err := theBot.PublishLog.Publish(refs.NewPost(fmt.Sprintf("test:%d", i)))
+		r.NoError(err)
+	}
+	r.NoError(theBot.ReceiveLog.Null(0))
+	theBot.Shutdown()
+	r.NoError(theBot.Close())
+
+	// an incomplete copy is discarded, the log stays as it is
+	r.NoError(writeCompactJournal(tRepo, compactPhaseCopy))
+	r.NoError(os.MkdirAll(filepath.Join(testPath, compactLogName), 0700))
+
+	theBot, err = New(botOptions...)
+	r.NoError(err)
+	r.NoDirExists(filepath.Join(testPath, compactLogName))
+	r.NoFileExists(filepath.Join(testPath, compactJournalName))
+	r.EqualValues(n, theBot.ReceiveLog.Seq())
+	theBot.Shutdown()
+	r.NoError(theBot.Close())
+
+	// a swap that was interrupted is completed
+	var report CompactReport
+	r.NoError(writeCompactJournal(tRepo, compactPhaseCopy))
+	r.NoError(copyLiveEntries(context.Background(), tRepo, &report))
+	r.NoError(writeCompactJournal(tRepo, compactPhaseSwap))
+	r.NoError(os.Rename(tRepo.GetPath("log"), tRepo.GetPath(precompactLogName)))
+
+	theBot, err = New(botOptions...)
+	r.NoError(err)
+	r.NoFileExists(filepath.Join(testPath, compactJournalName))
+	r.NoDirExists(filepath.Join(testPath, precompactLogName))
+	theBot.WaitUntilIndexesAreSynced()
+	r.EqualValues(n-1, theBot.ReceiveLog.Seq())
+	r.NoError(theBot.FSCK(FSCKWithMode(FSCKModeSequences)))
+	theBot.Shutdown()
+	r.NoError(theBot.Close())
+}
@@ -8,6 +8,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"runtime"
+	"sort"
 	"sync"
 	"time"
 
@@ -15,13 +17,18 @@ import (
 	"github.com/machinebox/progress"
 	"go.cryptoscope.co/luigi"
 	"go.cryptoscope.co/margaret"
+	librarian "go.cryptoscope.co/margaret/indexes"
 	"go.cryptoscope.co/margaret/multilog"
 	kitlog "go.mindeco.de/log"
 	"go.mindeco.de/log/level"
 	refs "go.mindeco.de/ssb-refs"
 	"go.mindeco.de/ssb-refs/tfk"
+	"golang.org/x/sync/errgroup"
 
 	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/internal/storedrefs"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/message/multimsg"
 	"go.cryptoscope.co/ssb/multilogs"
 )
 
@@ -38,21 +45,32 @@ const (
 	FSCKModeSequences
 
 	// FSCKModeVerify does a full signature and hash verification
-	// FSCKModeVerify
+	FSCKModeVerify
 )
 
 // ErrConsistencyProblems are returned if there are inconsistenceis found in the receive log
 type ErrConsistencyProblems struct {
-	Errors    []ssb.ErrWrongSequence
+	Errors []ssb.ErrWrongSequence
+	// Invalid are the feeds with a message that failed the verification (FSCKModeVerify)
+	Invalid []ssb.ErrInvalidMessage
+
+	// Sequences are all the receive log entries of the broken feeds
 	Sequences *roaring.Bitmap
 }
 
 func (e ErrConsistencyProblems) Error() string {
-	if len(e.Errors) == 1 {
-		return e.Errors[0].Error()
+	var errs []error
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+	for _, err := range e.Invalid {
+		errs = append(errs, err)
+	}
+	if len(errs) == 1 {
+		return errs[0].Error()
 	}
-	errStr := fmt.Sprintf("ssb: multiple consistency problems (%d) over %d messages", len(e.Errors), e.Sequences.GetCardinality())
-	for i, err := range e.Errors {
+	errStr := fmt.Sprintf("ssb: multiple consistency problems (%d) over %d messages", len(errs), e.Sequences.GetCardinality())
+	for i, err := range errs {
 		errStr += fmt.Sprintf("\n%02d: %s", i, err.Error())
 	}
 	errStr += "\n"
@@ -63,6 +81,7 @@ type fsckOpt struct {
 	feedsIdx   multilog.MultiLog
 	mode       FSCKMode
 	progressFn FSCKUpdateFunc
+	workers    int
 }
 
 // FSCKOption can be used to tune the check procedure
@@ -79,7 +98,7 @@ func FSCKWithFeedIndex(idx multilog.MultiLog) FSCKOption {
 // FSCKWithMode changes the FSCKMode
 func FSCKWithMode(m FSCKMode) FSCKOption {
 	return func(o *fsckOpt) error {
-		if m != FSCKModeLength && m != FSCKModeSequences {
+		if m != FSCKModeLength && m != FSCKModeSequences && m != FSCKModeVerify {
 			return fmt.Errorf("invalid fsck mode: %d", m)
 		}
 
@@ -99,6 +118,17 @@ func FSCKWithProgress(fn FSCKUpdateFunc) FSCKOption {
 	}
 }
 
+// FSCKWithWorkers sets how many feeds FSCKModeVerify checks at the same time, the default is the number of CPUs
+func FSCKWithWorkers(n int) FSCKOption {
+	return func(o *fsckOpt) error {
+		if n < 1 {
+			return fmt.Errorf("invalid number of fsck workers: %d", n)
+		}
+		o.workers = n
+		return nil
+	}
+}
+
 // FSCKUpdateFunc is called with the a percentage float between 0 and 100
 // and a durration who much time it should take, rounded to seconds.
 type FSCKUpdateFunc func(percentage float64, timeLeft time.Duration)
@@ -133,12 +163,19 @@ func (s *Sbot) FSCK(opts ...FSCKOption) error {
 		opt.mode = FSCKModeLength
 	}
 
+	if opt.workers == 0 {
+		opt.workers = runtime.NumCPU()
+	}
+
 	switch opt.mode {
 	case FSCKModeLength:
 		return lengthFSCK(opt.feedsIdx, s.ReceiveLog)
 
 	case FSCKModeSequences:
-		return sequenceFSCK(s.ReceiveLog, opt.progressFn)
+		return sequenceFSCK(opt.feedsIdx, s.ReceiveLog, opt.progressFn)
+
+	case FSCKModeVerify:
+		return verifyFSCK(opt.feedsIdx, s.ReceiveLog, s.signHMACsecret, opt.workers, opt.progressFn)
 
 	default:
 		return errors.New("sbot: unknown fsck mode")
@@ -231,8 +268,9 @@ func (p *processedCounter) N() int64 {
 func (p *processedCounter) Err() error { return nil }
 
 // sequenceFSCK goes through every message in the receiveLog
-// and checks tha the sequence of a feed is correctly increasing by one each message
-func sequenceFSCK(receiveLog margaret.Log, progressFn FSCKUpdateFunc) error {
+// and checks tha the sequence of a feed is correctly increasing by one each message.
+// A feed may skip the messages that were nulled before, as the retention does it, their entries in the feeds index are kept.
+func sequenceFSCK(authorMlog multilog.MultiLog, receiveLog margaret.Log, progressFn FSCKUpdateFunc) error {
 	ctx := context.Background()
 
 	// the last sequence number we saw of that author
@@ -302,7 +340,8 @@ func sequenceFSCK(receiveLog margaret.Log, progressFn FSCKUpdateFunc) error {
 		currSeq, has := lastSequence[authorRef]
 
 		if !has {
-			if msgSeq != 1 { // not seen yet, so has to be the first
+			// not seen yet, so has to be the first or come after nulled ones
+			if msgSeq != 1 && !nulledBefore(authorMlog, receiveLog, msg.Author(), 1, msgSeq, rxLogSeq) {
 				seqErr := ssb.ErrWrongSequence{
 					Ref:     msg.Author(),
 					Stored:  sw.Seq(),
@@ -312,7 +351,7 @@ func sequenceFSCK(receiveLog margaret.Log, progressFn FSCKUpdateFunc) error {
 				lastSequence[authorRef] = -1
 				continue
 			}
-			lastSequence[authorRef] = 1
+			lastSequence[authorRef] = msgSeq
 			continue
 		}
 
@@ -320,7 +359,8 @@ func sequenceFSCK(receiveLog margaret.Log, progressFn FSCKUpdateFunc) error {
 			continue
 		}
 
-		if currSeq+1 != msgSeq { // correct next value?
+		// correct next value, or one after nulled ones?
+		if currSeq+1 != msgSeq && !(msgSeq > currSeq+1 && nulledBefore(authorMlog, receiveLog, msg.Author(), currSeq+1, msgSeq, rxLogSeq)) {
 			seqErr := ssb.ErrWrongSequence{
 				Ref:     msg.Author(),
 				Stored:  int64(currSeq + 1),
@@ -330,7 +370,7 @@ func sequenceFSCK(receiveLog margaret.Log, progressFn FSCKUpdateFunc) error {
 			lastSequence[authorRef] = -1
 			continue
 		}
-		lastSequence[authorRef] = currSeq + 1
+		lastSequence[authorRef] = msgSeq
 
 		// bench stats
 		pc.Incr()
@@ -354,10 +394,284 @@ func sequenceFSCK(receiveLog margaret.Log, progressFn FSCKUpdateFunc) error {
 	}
 }
 
+// nulledBefore checks that the messages of the feed with the sequences from up to before to
+// are nulled in the receiveLog, at entries before rxSeq
+func nulledBefore(authorMlog multilog.MultiLog, receiveLog margaret.Log, author refs.FeedRef, from, to, rxSeq int64) bool {
+	feed, err := authorMlog.Get(storedrefs.Feed(author))
+	if err != nil {
+		return false
+	}
+
+	for seq := from; seq < to; seq++ {
+		// internal data strucutres are 0-indexed
+		v, err := feed.Get(seq - 1)
+		if err != nil {
+			return false
+		}
+		entry, ok := v.(int64)
+		if !ok || entry >= rxSeq {
+			return false
+		}
+
+		_, err = receiveLog.Get(entry)
+		if !margaret.IsErrNulled(err) {
+			return false
+		}
+	}
+	return true
+}
+
+// verifyFSCK verifies every stored message again with the verifier of its feed format, the same as for received messages.
+// That checks the signature, the hash of the previous message and the sequence of each message of a feed.
+// The feeds are checked in parallel by the workers, a feed is broken after its first invalid message.
+func verifyFSCK(authorMlog multilog.MultiLog, receiveLog margaret.Log, hmacSec *[32]byte, workers int, progressFn FSCKUpdateFunc) error {
+	feeds, err := authorMlog.List()
+	if err != nil {
+		return fmt.Errorf("fsck/verify: author listing failed: %w", err)
+	}
+
+	totalMessages := receiveLog.Seq() + 1
+	var pc processedCounter
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		p := progress.NewTicker(ctx, &pc, totalMessages, 3*time.Second)
+		for remaining := range p {
+			estDone := remaining.Estimated()
+			// how much time until it's done?
+			timeLeft := estDone.Sub(time.Now()).Round(time.Second)
+			progressFn(remaining.Percent(), timeLeft)
+		}
+	}()
+
+	var (
+		mu      sync.Mutex
+		invalid []ssb.ErrInvalidMessage
+		nullMap = roaring.New()
+	)
+
+	grp, grpCtx := errgroup.WithContext(ctx)
+
+	authors := make(chan librarian.Addr)
+	grp.Go(func() error {
+		defer close(authors)
+		for _, author := range feeds {
+			select {
+			case authors <- author:
+			case <-grpCtx.Done():
+				return grpCtx.Err()
+			}
+		}
+		return nil
+	})
+
+	for i := 0; i < workers; i++ {
+		grp.Go(func() error {
+			for author := range authors {
+				var sr tfk.Feed
+				err := sr.UnmarshalBinary([]byte(author))
+				if err != nil {
+					return fmt.Errorf("fsck/verify: failed to unpack author %q: %w", author, err)
+				}
+				fr, err := sr.Feed()
+				if err != nil {
+					return fmt.Errorf("fsck/verify: failed to feed reference for author (%q): %w", author, err)
+				}
+
+				subLog, err := authorMlog.Get(author)
+				if err != nil {
+					return fmt.Errorf("fsck/verify: failed to get sublog for %s: %w", fr.ShortSigil(), err)
+				}
+
+				seqs, problem, err := verifyFeed(grpCtx, fr, subLog, receiveLog, hmacSec, &pc)
+				if err != nil {
+					return fmt.Errorf("fsck/verify: feed %s: %w", fr.ShortSigil(), err)
+				}
+				if problem == nil {
+					continue
+				}
+
+				mu.Lock()
+				invalid = append(invalid, *problem)
+				nullMap.Or(seqs)
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+
+	if err := grp.Wait(); err != nil {
+		return err
+	}
+
+	if len(invalid) == 0 {
+		return nil
+	}
+
+	sort.Slice(invalid, func(i, j int) bool {
+		return invalid[i].Ref.String() < invalid[j].Ref.String()
+	})
+
+	// error report
+	return ErrConsistencyProblems{
+		Invalid:   invalid,
+		Sequences: nullMap,
+	}
+}
+
+// verifyFeed pours the messages of one feed through a verification sink for its format, in the order of its sublog.
+// It returns the receive log sequences of all the messages of the feed and its first invalid message, if there is one.
+// A nulled message leaves nothing to check the next one against, the sink starts again after it, like the scrubber does.
+func verifyFeed(ctx context.Context, fr refs.FeedRef, subLog, receiveLog margaret.Log, hmacSec *[32]byte, pc *processedCounter) (*roaring.Bitmap, *ssb.ErrInvalidMessage, error) {
+	// before the first message
+	var start refs.KeyValueRaw
+	start.Value.Author = fr
+
+	saver := new(fsckSaver)
+	snk, err := message.NewVerifySink(fr, start, saver, hmacSec)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	src, err := subLog.Query()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	seqs := roaring.New()
+	var problem *ssb.ErrInvalidMessage
+	gap := false // the previous message was nulled
+	for {
+		v, err := src.Next(ctx)
+		if err != nil {
+			if luigi.IsEOS(err) {
+				break
+			}
+			return nil, nil, err
+		}
+		pc.Incr()
+
+		rxSeq, ok := v.(int64)
+		if !ok {
+			if errv, ok := v.(error); ok && margaret.IsErrNulled(errv) {
+				gap = true
+				continue
+			}
+			return nil, nil, fmt.Errorf("unexpected sublog entry: %T", v)
+		}
+		seqs.Add(uint32(rxSeq))
+
+		if problem != nil { // feed broken, only collecting the rest of it
+			continue
+		}
+
+		rv, err := receiveLog.Get(rxSeq)
+		if err != nil {
+			if margaret.IsErrNulled(err) {
+				gap = true
+				continue
+			}
+			return nil, nil, fmt.Errorf("failed to load rxlog entry %d: %w", rxSeq, err)
+		}
+
+		msg, raw, err := storedMessage(rv)
+		if err != nil {
+			return nil, nil, fmt.Errorf("rxlog entry %d: %w", rxSeq, err)
+		}
+
+		if gap {
+			// the hash of the nulled message is unknown, only the previous link isn't checked
+			snk, err = message.NewVerifySink(fr, nulledPrevious(msg), saver, hmacSec)
+			if err != nil {
+				return nil, nil, err
+			}
+			gap = false
+		}
+
+		saver.stored = msg
+		err = snk.Verify(raw)
+		if err == nil && snk.Seq() != msg.Seq() {
+			// the sink skips messages it already got
+			err = fmt.Errorf("sequence %d was already stored", msg.Seq())
+		}
+		if err != nil {
+			problem = &ssb.ErrInvalidMessage{
+				Ref:      fr,
+				Sequence: msg.Seq(),
+				Reason:   err,
+			}
+		}
+	}
+
+	return seqs, problem, nil
+}
+
+// nulledPrevious stands in for the nulled message before msg.
+// It has the key msg points to, a verification sink still checks the signature and the sequence of msg against it.
+func nulledPrevious(msg refs.Message) refs.Message {
+	var prev refs.KeyValueRaw
+	prev.Value.Author = msg.Author()
+	prev.Value.Sequence = msg.Seq() - 1
+	if p := msg.Previous(); p != nil {
+		prev.Key_ = *p
+	}
+	return prev
+}
+
+// fsckSaver takes the place of the storage of a verification sink.
+// Instead of saving the verified message it checks that it hashes to the key it was stored under.
+type fsckSaver struct {
+	stored refs.Message
+}
+
+func (fs *fsckSaver) Save(msg refs.Message) error {
+	if !msg.Key().Equal(fs.stored.Key()) {
+		return fmt.Errorf("stored as %s but hashes to %s", fs.stored.Key().String(), msg.Key().String())
+	}
+	return nil
+}
+
+// storedMessage unpacks a receive log entry into the message and its bytes in the encoding of its feed format, as the verifiers expect them
+func storedMessage(v interface{}) (refs.Message, []byte, error) {
+	var mm *multimsg.MultiMessage
+	switch tv := v.(type) {
+	case *multimsg.MultiMessage:
+		mm = tv
+	case multimsg.MultiMessage:
+		mm = &tv
+	default:
+		return nil, nil, fmt.Errorf("unexpected message type: %T (wanted %T)", v, mm)
+	}
+
+	if sm, ok := mm.AsLegacy(); ok {
+		return mm, sm.Raw_, nil
+	}
+
+	if tr, ok := mm.AsGabby(); ok {
+		raw, err := tr.MarshalCBOR()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to marshal transfer object: %w", err)
+		}
+		return mm, raw, nil
+	}
+
+	if mf, ok := mm.AsMetaFeed(); ok {
+		raw, err := mf.MarshalBencode()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to marshal metafeed message: %w", err)
+		}
+		return mm, raw, nil
+	}
+
+	return nil, nil, errors.New("unsupported message format")
+}
+
 // HealRepo just nulls the messages and is a very naive repair but the only one that is feasably implemented right now
 func (s *Sbot) HealRepo(report ErrConsistencyProblems) error {
 	funcLog := kitlog.With(s.info, "event", "heal repo")
-	brokenCount := len(report.Errors)
+	brokenCount := len(report.Errors) + len(report.Invalid)
 	if brokenCount == 0 {
 		level.Warn(funcLog).Log("msg", "no errors to repair, run FSCK first.")
 		return nil
@@ -378,12 +692,19 @@ func (s *Sbot) HealRepo(report ErrConsistencyProblems) error {
 	}
 
 	// now remove feed metadata from the indexes
-	for i, constErr := range report.Errors {
-		err := s.NullFeed(constErr.Ref)
+	var brokenFeeds []refs.FeedRef
+	for _, constErr := range report.Errors {
+		brokenFeeds = append(brokenFeeds, constErr.Ref)
+	}
+	for _, invalid := range report.Invalid {
+		brokenFeeds = append(brokenFeeds, invalid.Ref)
+	}
+	for i, fr := range brokenFeeds {
+		err := s.NullFeed(fr)
 		if err != nil {
 			return fmt.Errorf("heal(%d): failed to null broken feed: %w", i, err)
 		}
-		level.Debug(funcLog).Log("feed", constErr.Ref.String())
+		level.Debug(funcLog).Log("feed", fr.String())
 	}
 
 	return nil
@@ -5,6 +5,7 @@
 package sbot
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"fmt"
@@ -20,6 +21,7 @@ import (
 	refs "go.mindeco.de/ssb-refs"
 
 	"go.cryptoscope.co/ssb/internal/testutils"
+	"go.cryptoscope.co/ssb/message/multimsg"
 	"go.cryptoscope.co/ssb/repo"
 )
 
@@ -65,6 +67,9 @@ func TestFSCK(t *testing.T) {
 	t.Run("correct", testFSCKcorrect)
 	t.Run("double", testFSCKdouble)
 	t.Run("multipleFeeds", testFSCKmultipleFeeds)
+	t.Run("verify", testFSCKverify)
+	t.Run("verifyNulled", testFSCKverifyNulled)
+	t.Run("sequencesNulled", testFSCKsequencesNulled)
 	// t.Run("rerpo", testFSCKrerpo)
 }
 
@@ -242,6 +247,191 @@ func testFSCKmultipleFeeds(t *testing.T) {
 	r.NoError(theBot.Close())
 }
 
+func testFSCKverify(t *testing.T) {
+	r := require.New(t)
+	theBot, _ := makeFSCKTestBot(t)
+
+	// some valid messages on a legacy and a gabbygrove feed
+	const n = 16
+	for i := n; i > 0; i-- {
+		post := refs.NewPost(fmt.Sprintf("test:%d", i))
+		_, err := theBot.PublishLog.Publish(post)
+		r.NoError(err)
+
+		_, err = theBot.PublishAs("two", map[string]interface{}{"type": "test", "i": i})
+		r.NoError(err)
+	}
+
+	err := theBot.FSCK(FSCKWithMode(FSCKModeVerify), FSCKWithWorkers(2))
+	r.NoError(err)
+
+	// tamper with the content of the 3rd message of the main feed
+	const tampered = 4 // main feed messages are the even entries
+	v, err := theBot.ReceiveLog.Get(tampered)
+	r.NoError(err)
+	mm, ok := v.(*multimsg.MultiMessage)
+	r.True(ok, "wrong message type. got %T", v)
+	sm, ok := mm.AsLegacy()
+	r.True(ok)
+	r.EqualValues(3, sm.Seq())
+	sm.Raw_ = bytes.Replace(sm.Raw_, []byte("test:"), []byte("tset:"), 1)
+	changed, err := mm.MarshalBinary()
+	r.NoError(err)
+	r.NoError(theBot.ReceiveLog.Replace(tampered, changed))
+
+	// the other modes don't look at the signatures
+	err = theBot.FSCK(FSCKWithMode(FSCKModeSequences))
+	r.NoError(err)
+
+	err = theBot.FSCK(FSCKWithMode(FSCKModeVerify))
+	r.Error(err)
+	constErrs, ok := err.(ErrConsistencyProblems)
+	r.True(ok, "wrong error type. got %T", err)
+	r.Len(constErrs.Errors, 0)
+	r.Len(constErrs.Invalid, 1)
+	r.True(constErrs.Invalid[0].Ref.Equal(theBot.KeyPair.ID()))
+	r.EqualValues(3, constErrs.Invalid[0].Sequence)
+	r.EqualValues(n, constErrs.Sequences.GetCardinality(), "all messages of the broken feed")
+
+	// try to repair it
+	err = theBot.HealRepo(constErrs)
+	r.NoError(err)
+
+	// errors are gone
+	err = theBot.FSCK(FSCKWithMode(FSCKModeVerify))
+	r.NoError(err, "after heal (verify)")
+
+	err = theBot.FSCK(FSCKWithMode(FSCKModeSequences))
+	r.NoError(err, "after heal (seq)")
+
+	// cleanup
+	theBot.Shutdown()
+	r.NoError(theBot.Close())
+}
+
+func testFSCKverifyNulled(t *testing.T) {
+	r := require.New(t)
+	theBot, _ := makeFSCKTestBot(t)
+
+	const n = 8
+	for i := n; i > 0; i-- {
+		post := refs.NewPost(fmt.Sprintf("test:%d", i))
+		_, err := theBot.PublishLog.Publish(post)
+		r.NoError(err)
+	}
+
+	// null the 4th message, the 5th has nothing to be checked against
+	r.NoError(theBot.ReceiveLog.Null(3))
+	err := theBot.FSCK(FSCKWithMode(FSCKModeVerify))
+	r.NoError(err, "a nulled message is no corruption")
+
+	// the messages after the gap are still checked
+	const tampered = 6
+	v, err := theBot.ReceiveLog.Get(tampered)
+	r.NoError(err)
+	mm, ok := v.(*multimsg.MultiMessage)
+	r.True(ok, "wrong message type. got %T", v)
+	sm, ok := mm.AsLegacy()
+	r.True(ok)
+	r.EqualValues(7, sm.Seq())
+	sm.Raw_ = bytes.Replace(sm.Raw_, []byte("test:"), []byte("tset:"), 1)
+	changed, err := mm.MarshalBinary()
+	r.NoError(err)
+	r.NoError(theBot.ReceiveLog.Replace(tampered, changed))
+
+	err = theBot.FSCK(FSCKWithMode(FSCKModeVerify))
+	r.Error(err)
+	constErrs, ok := err.(ErrConsistencyProblems)
+	r.True(ok, "wrong error type. got %T", err)
+	r.Len(constErrs.Invalid, 1)
+	r.EqualValues(7, constErrs.Invalid[0].Sequence)
+
+	// the message right after the nulled one is checked as well, only its previous link isn't
+	const afterNulled = 4
+	v, err = theBot.ReceiveLog.Get(afterNulled)
+	r.NoError(err)
+	mm, ok = v.(*multimsg.MultiMessage)
+	r.True(ok, "wrong message type. got %T", v)
+	sm, ok = mm.AsLegacy()
+	r.True(ok)
+	r.EqualValues(5, sm.Seq())
+	sm.Raw_ = bytes.Replace(sm.Raw_, []byte("test:"), []byte("tset:"), 1)
+	changed, err = mm.MarshalBinary()
+	r.NoError(err)
+	r.NoError(theBot.ReceiveLog.Replace(afterNulled, changed))
+
+	err = theBot.FSCK(FSCKWithMode(FSCKModeVerify))
+	r.Error(err)
+	constErrs, ok = err.(ErrConsistencyProblems)
+	r.True(ok, "wrong error type. got %T", err)
+	r.Len(constErrs.Invalid, 1)
+	r.EqualValues(5, constErrs.Invalid[0].Sequence)
+
+	// cleanup
+	theBot.Shutdown()
+	r.NoError(theBot.Close())
+}
+
+func testFSCKsequencesNulled(t *testing.T) {
+	r := require.New(t)
+	theBot, _ := makeFSCKTestBot(t)
+
+	const n = 8
+	for i := n; i > 0; i-- {
+		post := refs.NewPost(fmt.Sprintf("test:%d", i))
+		_, err := theBot.PublishLog.Publish(post)
+		r.NoError(err)
+	}
+
+	// like the retention: the oldest messages of a feed over its quota and one that got too old
+	r.NoError(theBot.ReceiveLog.Null(0))
+	r.NoError(theBot.ReceiveLog.Null(1))
+	r.NoError(theBot.ReceiveLog.Null(4))
+	err := theBot.FSCK(FSCKWithMode(FSCKModeSequences))
+	r.NoError(err, "nulled messages are no gap in the feed")
+
+	// a message that is missing without being nulled still is
+	otherPath := filepath.Join("testrun", t.Name()+"-other")
+	os.RemoveAll(otherPath)
+	otherBot, err := New(
+		WithInfo(log.NewNopLogger()),
+		WithRepoPath(otherPath),
+		DisableNetworkNode(),
+	)
+	r.NoError(err)
+	for i := 1; i <= 3; i++ {
+		_, err := otherBot.PublishLog.Publish(refs.NewPost(fmt.Sprintf("other:%d", i)))
+		r.NoError(err)
+	}
+	for _, seq := range []int64{0, 2} {
+		v, err := otherBot.ReceiveLog.Get(seq)
+		r.NoError(err)
+		_, err = theBot.ReceiveLog.Append(v)
+		r.NoError(err)
+	}
+	theBot.WaitUntilIndexesAreSynced()
+
+	err = theBot.FSCK(FSCKWithMode(FSCKModeSequences))
+	r.Error(err)
+	constErrs, ok := err.(ErrConsistencyProblems)
+	r.True(ok, "wrong error type. got %T", err)
+	r.Len(constErrs.Errors, 1)
+	r.True(constErrs.Errors[0].Ref.Equal(otherBot.KeyPair.ID()))
+
+	// healing only drops the broken feed
+	r.NoError(theBot.HealRepo(constErrs))
+	err = theBot.FSCK(FSCKWithMode(FSCKModeSequences))
+	r.NoError(err, "after heal (seq)")
+	_, err = theBot.ReceiveLog.Get(n - 1)
+	r.NoError(err, "the feed with nulled messages is kept")
+
+	// cleanup
+	otherBot.Shutdown()
+	r.NoError(otherBot.Close())
+	theBot.Shutdown()
+	r.NoError(theBot.Close())
+}
+
 // to use this, put the repo in
 func testFSCKrepro(t *testing.T) {
 	r := require.New(t)
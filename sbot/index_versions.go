@@ -0,0 +1,196 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package sbot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/dgraph-io/badger/v3"
+	"go.mindeco.de/log/level"
+
+	"go.cryptoscope.co/ssb/multilogs"
+	"go.cryptoscope.co/ssb/plugins/search"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+// indexVersionsName is the file in the sublogs folder that records the version each index was built with.
+// It goes away together with the indexes, a repo without it but with indexes is from before the versions were recorded.
+const indexVersionsName = "index-versions.json"
+
+// indexVersion is the version an index is built with now and how to reset an index that was built with another one
+type indexVersion struct {
+	version int
+
+	// reset removes the data of the index and its position in the receive log
+	reset func(s *Sbot) error
+}
+
+// builtinIndexVersions are the versions of the indexes the bot opens itself.
+// Bump the version of an index when the way it is built changes,
+// the next start resets only that index and fills it again from the receive log.
+var builtinIndexVersions = map[string]indexVersion{
+	"timestamps": {1, resetFiles(repo.PrefixIndex, "seqmaps")},
+	"get":        {1, resetPrefixes("byMsgRef")},
+
+	// 2: channels and mentions
+	// users, privates, msgTypes and tangles are kept, other indexes read them by position and a replay only adds to them
+	"combined": {2, resetAll(
+		resetFiles(repo.PrefixMultiLog, "combined-state.json"),
+		resetPrefixes("mlog-"+multilogs.IndexNameChannels, "mlog-"+multilogs.IndexNameMentions),
+	)},
+
+	"group-members": {1, resetPrefixes("group-members")},
+
+	// 2: every request is stored until it is done
+	"content-delete-requests": {2, resetPrefixes("index"+FolderNameDelete, pendingDropPrefix)},
+	"contacts":                {1, resetPrefixes("trust-graph")},
+	"abouts":                  {1, resetPrefixes("idx-abouts")},
+	search.IndexName:          {1, resetPrefixes("index"+search.IndexName, "mlog-"+search.IndexName)},
+}
+
+// WithIndexVersion declares the version of an index that is mounted with MountSimpleIndex or MountMultiLog.
+// When the index was built with another version, reset is called with the shared index database before the index is opened.
+// It has to remove the data and the position of the index, which is then filled again from the start of the receive log.
+// Versions start at 1, an index from before its version was declared counts as version 1.
+func WithIndexVersion(name string, version int, reset func(db *badger.DB) error) Option {
+	return func(s *Sbot) error {
+		if version < 1 {
+			return fmt.Errorf("sbot: index version of %s needs to be at least 1", name)
+		}
+		if _, has := builtinIndexVersions[name]; has {
+			return fmt.Errorf("sbot: %s is a builtin index", name)
+		}
+		s.indexVersions[name] = indexVersion{version, func(s *Sbot) error {
+			return reset(s.indexStore)
+		}}
+		return nil
+	}
+}
+
+// indexVersionStore is the content of the index versions file
+type indexVersionStore struct {
+	path string
+
+	// legacy is set if the indexes were built before the versions were recorded
+	legacy bool
+
+	Versions map[string]int `json:"versions"`
+}
+
+func loadIndexVersions(r repo.Interface, hadIndexes bool) (*indexVersionStore, error) {
+	ivs := &indexVersionStore{
+		path:     r.GetPath(repo.PrefixMultiLog, indexVersionsName),
+		Versions: make(map[string]int),
+	}
+
+	data, err := os.ReadFile(ivs.path)
+	if errors.Is(err, os.ErrNotExist) {
+		ivs.legacy = hadIndexes
+		return ivs, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("index versions: failed to read: %w", err)
+	}
+
+	err = json.Unmarshal(data, ivs)
+	if err != nil {
+		return nil, fmt.Errorf("index versions: failed to decode: %w", err)
+	}
+	return ivs, nil
+}
+
+func (ivs *indexVersionStore) save() error {
+	data, err := json.Marshal(ivs)
+	if err != nil {
+		return err
+	}
+
+	err = writeFileAtomic(ivs.path, data)
+	if err != nil {
+		return fmt.Errorf("index versions: failed to write: %w", err)
+	}
+	return nil
+}
+
+// stored returns the version the index was built with.
+// An index that isn't recorded is either from before the versions were recorded or new and still empty.
+func (ivs *indexVersionStore) stored(name string) (int, bool) {
+	v, has := ivs.Versions[name]
+	if has {
+		return v, true
+	}
+	if ivs.legacy {
+		return 1, true
+	}
+	return 0, false
+}
+
+// resetOutdatedIndexes resets the builtin indexes and the ones of WithIndexVersion that were built with another version
+func (s *Sbot) resetOutdatedIndexes() error {
+	for name, iv := range builtinIndexVersions {
+		if err := s.resetOutdatedIndex(name, iv); err != nil {
+			return err
+		}
+	}
+	for name, iv := range s.indexVersions {
+		if err := s.resetOutdatedIndex(name, iv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resetOutdatedIndex resets the index if it was built with another version and records the current one.
+// A reset index is filled from the start of the receive log by serveIndexFrom.
+func (s *Sbot) resetOutdatedIndex(name string, iv indexVersion) error {
+	stored, known := s.indexVersionStore.stored(name)
+	if known && stored == iv.version {
+		return nil
+	}
+
+	if known {
+		level.Info(s.info).Log("event", "index outdated, rebuilding", "index", name, "built", stored, "current", iv.version)
+		err := iv.reset(s)
+		if err != nil {
+			return fmt.Errorf("sbot: failed to reset index %s: %w", name, err)
+		}
+		s.indexStateMu.Lock()
+		s.indexRebuilds[name] = fmt.Sprintf("rebuilding (version %d to %d)", stored, iv.version)
+		s.indexStateMu.Unlock()
+	}
+
+	s.indexVersionStore.Versions[name] = iv.version
+	return s.indexVersionStore.save()
+}
+
+func resetPrefixes(prefixes ...string) func(s *Sbot) error {
+	return func(s *Sbot) error {
+		var bs [][]byte
+		for _, p := range prefixes {
+			bs = append(bs, []byte(p))
+		}
+		return s.indexStore.DropPrefix(bs...)
+	}
+}
+
+func resetFiles(path ...string) func(s *Sbot) error {
+	return func(s *Sbot) error {
+		return os.RemoveAll(repo.New(s.repoPath).GetPath(path...))
+	}
+}
+
+func resetAll(resets ...func(s *Sbot) error) func(s *Sbot) error {
+	return func(s *Sbot) error {
+		for _, reset := range resets {
+			if err := reset(s); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
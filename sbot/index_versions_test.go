@@ -0,0 +1,190 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package sbot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+	librarian "go.cryptoscope.co/margaret/indexes"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb/internal/storedrefs"
+	"go.cryptoscope.co/ssb/internal/testutils"
+	"go.cryptoscope.co/ssb/multilogs"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+func readIndexVersions(t *testing.T, testPath string) map[string]int {
+	ivs, err := loadIndexVersions(repo.New(testPath), false)
+	require.NoError(t, err)
+	return ivs.Versions
+}
+
+func indexState(t *testing.T, bot *Sbot, name string) string {
+	st, err := bot.Status()
+	require.NoError(t, err)
+	for _, idx := range st.Indicies {
+		if idx.Name == name {
+			return idx.State
+		}
+	}
+	return ""
+}
+
+// a pub from before the channels were indexed gets them when it starts with the new version of the combined index
+func TestIndexVersionsRebuildCombined(t *testing.T) {
+	if testutils.SkipOnCI(t) {
+		return
+	}
+	r := require.New(t)
+
+	testPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(testPath)
+
+	theBot, botOptions := makeFSCKTestBot(t)
+	botOptions = append(botOptions, DisableLiveIndexMode())
+
+	const n = 5
+	for i := 0; i < n; i++ {
+		_, err := theBot.PublishLog.Publish(map[string]interface{}{"type": "post", "text": fmt.Sprintf("post %d", i), "channel": "go"})
+		r.NoError(err)
+	}
+	theBot.WaitUntilIndexesAreSynced()
+
+	channelCount := func(bot *Sbot) uint64 {
+		bmap, err := bot.Channels.LoadInternalBitmap(storedrefs.Channel("go"))
+		r.NoError(err)
+		return bmap.GetCardinality()
+	}
+	r.EqualValues(n, channelCount(theBot))
+
+	theBot.Shutdown()
+	r.NoError(theBot.Close())
+
+	// a fresh repo is recorded as current
+	versions := readIndexVersions(t, testPath)
+	r.Equal(builtinIndexVersions["combined"].version, versions["combined"])
+	r.Equal(1, versions["get"])
+
+	// turn it into a repo from before the channels, without the versions file
+	db, err := repo.OpenBadgerDB(repo.New(testPath).GetPath(repo.PrefixMultiLog, "shared-badger"))
+	r.NoError(err)
+	r.NoError(db.DropPrefix([]byte("mlog-" + multilogs.IndexNameChannels)))
+	r.NoError(db.Close())
+	r.NoError(os.Remove(repo.New(testPath).GetPath(repo.PrefixMultiLog, indexVersionsName)))
+
+	theBot, err = New(botOptions...)
+	r.NoError(err)
+	theBot.WaitUntilIndexesAreSynced()
+
+	r.EqualValues(n, channelCount(theBot))
+	r.Equal("rebuilt", indexState(t, theBot, "combined"))
+	r.NotEqual("rebuilt", indexState(t, theBot, "get"))
+
+	versions = readIndexVersions(t, testPath)
+	r.Equal(builtinIndexVersions["combined"].version, versions["combined"])
+
+	mainLog, err := theBot.Users.Get(storedrefs.Feed(theBot.KeyPair.ID()))
+	r.NoError(err)
+	r.EqualValues(n-1, mainLog.Seq())
+
+	theBot.Shutdown()
+	r.NoError(theBot.Close())
+
+	// nothing to do on the next start
+	theBot, err = New(botOptions...)
+	r.NoError(err)
+	theBot.WaitUntilIndexesAreSynced()
+	r.NotEqual("rebuilt", indexState(t, theBot, "combined"))
+	r.EqualValues(n, channelCount(theBot))
+
+	theBot.Shutdown()
+	r.NoError(theBot.Close())
+}
+
+// countingIndex counts the messages it sees
+type countingIndex struct {
+	resets int
+	seen   int
+}
+
+func (ci *countingIndex) open(db *badger.DB) (librarian.Index, librarian.SinkIndex, error) {
+	return repo.OpenIndex(db, "counter", func(seqIdx librarian.SeqSetterIndex) librarian.SinkIndex {
+		return librarian.NewSinkIndex(func(ctx context.Context, seq int64, val interface{}, idx librarian.SetterIndex) error {
+			ci.seen++
+			return nil
+		}, seqIdx)
+	})
+}
+
+func (ci *countingIndex) reset(db *badger.DB) error {
+	ci.resets++
+	return db.DropPrefix([]byte("indexcounter"))
+}
+
+func TestIndexVersionsMounted(t *testing.T) {
+	if testutils.SkipOnCI(t) {
+		return
+	}
+	r := require.New(t)
+
+	testPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(testPath)
+
+	theBot, botOptions := makeFSCKTestBot(t)
+	const n = 3
+	for i := 0; i < n; i++ {
+		_, err := theBot.PublishLog.Publish(refs.NewPost(fmt.Sprintf("post %d", i)))
+		r.NoError(err)
+	}
+	theBot.Shutdown()
+	r.NoError(theBot.Close())
+
+	startWith := func(version int) *countingIndex {
+		var ci countingIndex
+		opts := append(append([]Option{}, botOptions...),
+			DisableLiveIndexMode(),
+			WithIndexVersion("counter", version, ci.reset),
+			LateOption(MountSimpleIndex("counter", ci.open)),
+		)
+		bot, err := New(opts...)
+		r.NoError(err)
+		bot.WaitUntilIndexesAreSynced()
+		bot.Shutdown()
+		r.NoError(bot.Close())
+		return &ci
+	}
+
+	// new indexes start from the beginning without a reset
+	ci := startWith(1)
+	r.Equal(0, ci.resets)
+	r.Equal(n, ci.seen)
+
+	ci = startWith(1)
+	r.Equal(0, ci.resets)
+	r.Equal(0, ci.seen)
+
+	// a new version is filled again
+	ci = startWith(2)
+	r.Equal(1, ci.resets)
+	r.Equal(n, ci.seen)
+	r.Equal(2, readIndexVersions(t, testPath)["counter"])
+
+	ci = startWith(2)
+	r.Equal(0, ci.resets)
+	r.Equal(0, ci.seen)
+
+	// builtin indexes can't be overwritten
+	_, err := New(append(append([]Option{}, botOptions...), WithIndexVersion("combined", 3, ci.reset))...)
+	r.Error(err)
+	r.True(strings.Contains(err.Error(), "builtin"))
+}
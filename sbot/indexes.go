@@ -37,6 +37,15 @@ func MountPlugin(plug ssb.Plugin, mode plugins2.AuthMode) Option {
 			}
 		}
 
+		if vi, ok := plug.(repo.VersionedIndex); ok {
+			err := s.resetOutdatedIndex(plug.Name(), indexVersion{vi.IndexVersion(), func(s *Sbot) error {
+				return vi.ResetIndex(s.indexStore)
+			}})
+			if err != nil {
+				return fmt.Errorf("sbot/mount plug: %w", err)
+			}
+		}
+
 		if slm, ok := plug.(repo.KeyValueIndexMaker); ok {
 			err := MountSimpleIndex(plug.Name(), slm.MakeKeyValueIndex)(s)
 			if err != nil {
@@ -130,8 +139,13 @@ func (s *Sbot) WaitUntilIndexesAreSynced() {
 	s.idxInSync.Wait()
 }
 
-// the default is to fill an index with all messages
+// the default is to fill an index with all messages.
+// During New the indexes share a single read of the receive log, see startIndexFanOut.
 func (s *Sbot) serveIndex(name string, snk librarian.SinkIndex) {
+	if s.indexFanOut != nil {
+		s.serveIndexFanOut(name, snk)
+		return
+	}
 	s.serveIndexFrom(name, snk, s.ReceiveLog)
 }
 
@@ -142,83 +156,162 @@ if err != nil { ... }
 msgs := mutil.Indirect(s.ReceiveLog, contactLog)
 */
 func (s *Sbot) serveIndexFrom(name string, snk librarian.SinkIndex, msgs margaret.Log) {
-	s.idxInSync.Add(1)
-
-	s.indexStateMu.Lock()
-	s.indexStates[name] = "pending"
-	s.indexStateMu.Unlock()
+	rebuild := s.startIndexState(name)
 
 	s.idxDone.Go(func() error {
+		logger := log.With(s.info, "index", name)
 
 		src, err := msgs.Query(margaret.Live(false), margaret.SeqWrap(true), snk.QuerySpec())
 		if err != nil {
 			return fmt.Errorf("sbot index(%s) error querying receiveLog for message backlog: %w", name, err)
 		}
 
-		logger := log.With(s.info, "index", name)
-
 		var ps progressSink
 		ps.backing = snk
 
-		totalMessages := msgs.Seq()
+		stopProgress := s.trackIndexProgress(name, rebuild, logger, &ps, msgs.Seq())
+		err = luigi.Pump(s.rootCtx, &ps, src)
+		stopProgress()
+
+		return s.serveIndexLive(name, snk, msgs, rebuild, err)
+	})
+}
+
+// serveIndexFanOut fills the index from the shared read of the receive log and goes live on its own after that.
+// Indexes that don't just start at a position of the receive log read it on their own.
+func (s *Sbot) serveIndexFanOut(name string, snk librarian.SinkIndex) {
+	logger := log.With(s.info, "index", name)
+
+	var (
+		ps           progressSink
+		rebuild      string
+		stopProgress context.CancelFunc
+	)
+	ps.backing = snk
+
+	// done is only called once the fan out runs, after the state below is set up
+	err := s.indexFanOut.Add(name, snk.QuerySpec(), &ps, func(err error) {
+		stopProgress()
+		s.idxDone.Go(func() error {
+			return s.serveIndexLive(name, snk, s.ReceiveLog, rebuild, err)
+		})
+	})
+	if err != nil {
+		level.Debug(logger).Log("event", "index reads the receive log on its own", "err", err)
+		s.serveIndexFrom(name, snk, s.ReceiveLog)
+		return
+	}
 
-		ctx, cancel := context.WithCancel(s.rootCtx)
-		go func() {
-			p := progress.NewTicker(ctx, &ps, int64(totalMessages), 7*time.Second)
-			pinfo := log.With(level.Info(logger), "event", "index-progress")
-			for remaining := range p {
-				// how much time until it's done?
-				estDone := remaining.Estimated()
-				timeLeft := estDone.Sub(time.Now()).Round(time.Second)
+	rebuild = s.startIndexState(name)
+	stopProgress = s.trackIndexProgress(name, rebuild, logger, &ps, s.ReceiveLog.Seq())
+}
 
-				pinfo.Log("done", remaining.Percent(), "time-left", timeLeft)
+// startIndexFanOut reads the receive log once for all the indexes that were served during New.
+// Indexes that are served later read it on their own.
+func (s *Sbot) startIndexFanOut() {
+	fo := s.indexFanOut
+	if fo == nil {
+		return
+	}
+	s.indexFanOut = nil
 
-				s.indexStateMu.Lock()
-				s.indexStates[name] = fmt.Sprintf("%.2f%% (time left:%s)", remaining.Percent(), timeLeft)
-				s.indexStateMu.Unlock()
-			}
-		}()
+	s.idxDone.Go(func() error {
+		fo.Run(s.rootCtx, s.ReceiveLog)
+		return nil
+	})
+}
 
-		err = luigi.Pump(s.rootCtx, &ps, src)
-		cancel()
-		if errors.Is(err, ssb.ErrShuttingDown) || errors.Is(err, context.Canceled) {
-			return nil
-		}
-		if err != nil {
+// startIndexState marks the index as not in sync yet.
+// It returns the label of the rebuild if the index was reset by resetOutdatedIndex.
+func (s *Sbot) startIndexState(name string) string {
+	s.idxInSync.Add(1)
+
+	s.indexStateMu.Lock()
+	defer s.indexStateMu.Unlock()
+	s.indexStates[name] = "pending"
+	// indexes that were reset by resetOutdatedIndex say so while they catch up
+	rebuild, rebuilding := s.indexRebuilds[name]
+	if rebuilding {
+		s.indexStates[name] = rebuild
+	}
+	return rebuild
+}
+
+// trackIndexProgress logs and updates the state of the index while it works through the backlog, until the returned func is called
+func (s *Sbot) trackIndexProgress(name, rebuild string, logger log.Logger, ps *progressSink, totalMessages int64) context.CancelFunc {
+	ctx, cancel := context.WithCancel(s.rootCtx)
+	go func() {
+		p := progress.NewTicker(ctx, ps, totalMessages, 7*time.Second)
+		pinfo := log.With(level.Info(logger), "event", "index-progress")
+		for remaining := range p {
+			// how much time until it's done?
+			estDone := remaining.Estimated()
+			timeLeft := estDone.Sub(time.Now()).Round(time.Second)
+
+			pinfo.Log("done", remaining.Percent(), "time-left", timeLeft)
+
+			state := fmt.Sprintf("%.2f%% (time left:%s)", remaining.Percent(), timeLeft)
+			if rebuild != "" {
+				state = rebuild + ": " + state
+			}
 			s.indexStateMu.Lock()
-			s.indexStates[name] = err.Error()
+			s.indexStates[name] = state
 			s.indexStateMu.Unlock()
-			level.Warn(logger).Log("event", "index stopped", "err", err)
-			return fmt.Errorf("sbot index(%s) update of backlog failed: %w", name, err)
 		}
-		s.idxInSync.Done()
+	}()
+	return cancel
+}
 
-		if !s.liveIndexUpdates {
-			return nil
-		}
+// serveIndexLive finishes the backlog of the index, which ended with backlogErr, and keeps it updated with new messages
+func (s *Sbot) serveIndexLive(name string, snk librarian.SinkIndex, msgs margaret.Log, rebuild string, backlogErr error) error {
+	logger := log.With(s.info, "index", name)
 
-		src, err = msgs.Query(margaret.Live(true), margaret.SeqWrap(true), snk.QuerySpec())
-		if err != nil {
-			return fmt.Errorf("sbot index(%s) failed to query receive log for live updates: %w", name, err)
-		}
+	err := backlogErr
+	if errors.Is(err, ssb.ErrShuttingDown) || errors.Is(err, context.Canceled) {
+		return nil
+	}
+	if err != nil {
+		s.indexStateMu.Lock()
+		s.indexStates[name] = err.Error()
+		s.indexStateMu.Unlock()
+		level.Warn(logger).Log("event", "index stopped", "err", err)
+		return fmt.Errorf("sbot index(%s) update of backlog failed: %w", name, err)
+	}
+	s.idxInSync.Done()
 
+	if rebuild != "" {
+		level.Info(logger).Log("event", "index rebuilt")
 		s.indexStateMu.Lock()
-		s.indexStates[name] = "live"
+		delete(s.indexRebuilds, name)
+		s.indexStates[name] = "rebuilt"
 		s.indexStateMu.Unlock()
+	}
 
-		err = luigi.Pump(s.rootCtx, snk, src)
-		if errors.Is(err, ssb.ErrShuttingDown) || errors.Is(err, context.Canceled) {
-			return nil
-		}
-		if err != nil {
-			s.indexStateMu.Lock()
-			s.indexStates[name] = err.Error()
-			s.indexStateMu.Unlock()
-			level.Warn(logger).Log("event", "index stopped", "err", err)
-			return fmt.Errorf("sbot index(%s) live update failed: %w", name, err)
-		}
+	if !s.liveIndexUpdates {
 		return nil
-	})
+	}
+
+	src, err := msgs.Query(margaret.Live(true), margaret.SeqWrap(true), snk.QuerySpec())
+	if err != nil {
+		return fmt.Errorf("sbot index(%s) failed to query receive log for live updates: %w", name, err)
+	}
+
+	s.indexStateMu.Lock()
+	s.indexStates[name] = "live"
+	s.indexStateMu.Unlock()
+
+	err = luigi.Pump(s.rootCtx, snk, src)
+	if errors.Is(err, ssb.ErrShuttingDown) || errors.Is(err, context.Canceled) {
+		return nil
+	}
+	if err != nil {
+		s.indexStateMu.Lock()
+		s.indexStates[name] = err.Error()
+		s.indexStateMu.Unlock()
+		level.Warn(logger).Log("event", "index stopped", "err", err)
+		return fmt.Errorf("sbot index(%s) live update failed: %w", name, err)
+	}
+	return nil
 }
 
 type progressSink struct {
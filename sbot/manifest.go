@@ -68,6 +68,8 @@ var manifestBlob manifestHandler = `
 	"createSequenceStream": "source",
 	"createLogStream": "source",
 	"messagesByType": "source",
+	"messagesByChannel": "source",
+	"mentions": "source",
 	"createHistoryStream": "source",
 
 	"ebt": {
@@ -90,6 +92,10 @@ var manifestBlob manifestHandler = `
       "thread": "source"
 	},
 
+	"search": {
+		"query": "source"
+	},
+
     "names": {
         "get": "async",
         "getImageFor": "async",
@@ -20,6 +20,7 @@ import (
 
 	"github.com/dgraph-io/badger/v3"
 	"github.com/go-kit/kit/metrics"
+	multierror "github.com/hashicorp/go-multierror"
 	"github.com/rs/cors"
 	"github.com/ssb-ngi-pointer/go-metafeed/metamngmt"
 	"github.com/zeebo/bencode"
@@ -59,6 +60,7 @@ import (
 	"go.cryptoscope.co/ssb/plugins/publish"
 	"go.cryptoscope.co/ssb/plugins/rawread"
 	"go.cryptoscope.co/ssb/plugins/replicate"
+	"go.cryptoscope.co/ssb/plugins/search"
 	"go.cryptoscope.co/ssb/plugins/status"
 	"go.cryptoscope.co/ssb/plugins/tangles"
 	"go.cryptoscope.co/ssb/plugins/whoami"
@@ -79,6 +81,18 @@ type Sbot struct {
 	// lateInit are options that need to be applied after others (like plugins that depend on keypairs)
 	lateInit []Option
 
+	// services are started at the end of New, see WithService
+	services []Service
+
+	// scrubber is one of the services, if WithScrubber is used
+	scrubber *scrubber
+
+	// retention is one of the services, if WithRetention is used
+	retention *retention
+
+	// dcrTrigger drops the content of messages when their authors request it
+	dcrTrigger *dropContentTrigger
+
 	rootCtx context.Context
 	// Shutdown needs to be called to shutdown indexing
 	Shutdown  context.CancelFunc
@@ -130,10 +144,12 @@ type Sbot struct {
 	signHMACsecret *[32]byte
 
 	// hardcoded default indexes
-	Users   *roaring.MultiLog // one sublog per feed
-	Private *roaring.MultiLog // one sublog per keypair
-	ByType  *roaring.MultiLog // one sublog per type: ... (special cases for private messages by suffix)
-	Tangles *roaring.MultiLog // one sublog per root:%ref (actual root is in the get index)
+	Users    *roaring.MultiLog // one sublog per feed
+	Private  *roaring.MultiLog // one sublog per keypair
+	ByType   *roaring.MultiLog // one sublog per type: ... (special cases for private messages by suffix)
+	Tangles  *roaring.MultiLog // one sublog per root:%ref (actual root is in the get index)
+	Channels *roaring.MultiLog // one sublog per channel:name of posts (see storedrefs.NormalizeChannel)
+	Mentions *roaring.MultiLog // one sublog per mention:@feed of posts
 
 	indexStore *badger.DB
 
@@ -145,6 +161,15 @@ type Sbot struct {
 	indexStateMu     sync.Mutex
 	indexStates      map[string]string
 
+	// the indexes that are served during New share one read of the receive log (see WithIndexWorkers)
+	indexWorkers int
+	indexFanOut  *indexes.FanOut
+
+	// index versions (see WithIndexVersion)
+	indexVersions     map[string]indexVersion
+	indexVersionStore *indexVersionStore
+	indexRebuilds     map[string]string // the state of the indexes that are rebuilt, guarded by indexStateMu
+
 	ebtState *statematrix.StateMatrix
 
 	verifyRouter *message.VerificationRouter
@@ -163,6 +188,9 @@ type Sbot struct {
 	MetaFeeds       ssb.MetaFeeds
 	IndexFeeds      ssb.IndexFeedManager
 
+	enableSearch bool
+	searchIndex  *search.Index
+
 	ssb.Replicator
 }
 
@@ -177,6 +205,8 @@ func New(fopts ...Option) (*Sbot, error) {
 	s.mlogIndicies = make(map[string]multilog.MultiLog)
 	s.simpleIndex = make(map[string]librarian.Index)
 	s.indexStates = make(map[string]string)
+	s.indexVersions = make(map[string]indexVersion)
+	s.indexRebuilds = make(map[string]string)
 
 	s.disableLegacyLiveReplication = true
 
@@ -187,6 +217,8 @@ func New(fopts ...Option) (*Sbot, error) {
 		}
 	}
 
+	s.indexFanOut = indexes.NewFanOut(s.indexWorkers)
+
 	if s.repoPath == "" {
 		u, err := user.Current()
 		if err != nil {
@@ -237,6 +269,12 @@ func New(fopts ...Option) (*Sbot, error) {
 		}
 	}
 
+	// finish or discard an interrupted CompactReceiveLog
+	err = recoverCompaction(storageRepo)
+	if err != nil {
+		return nil, fmt.Errorf("sbot: failed to recover the receive log compaction: %w", err)
+	}
+
 	// TODO: optionize
 	s.ReceiveLog, err = repo.OpenLog(storageRepo)
 	if err != nil {
@@ -244,6 +282,23 @@ func New(fopts ...Option) (*Sbot, error) {
 	}
 	s.closers.AddCloser(s.ReceiveLog.(io.Closer))
 
+	sharedIndexPath := storageRepo.GetPath(repo.PrefixMultiLog, "shared-badger")
+	hadIndexes := pathExists(sharedIndexPath)
+	s.indexStore, err = repo.OpenBadgerDB(sharedIndexPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// reset the indexes that were built with another version, before they are opened
+	s.indexVersionStore, err = loadIndexVersions(storageRepo, hadIndexes)
+	if err != nil {
+		return nil, fmt.Errorf("sbot: %w", err)
+	}
+	err = s.resetOutdatedIndexes()
+	if err != nil {
+		return nil, err
+	}
+
 	// if not configured
 	if s.BlobStore == nil {
 		// load default, local file blob store
@@ -288,11 +343,6 @@ func New(fopts ...Option) (*Sbot, error) {
 	s.closers.AddCloser(idxTimestamps)
 	s.serveIndex("timestamps", idxTimestamps)
 
-	s.indexStore, err = repo.OpenBadgerDB(storageRepo.GetPath(repo.PrefixMultiLog, "shared-badger"))
-	if err != nil {
-		return nil, err
-	}
-
 	// default multilogs
 	var mlogs = []struct {
 		Name string
@@ -302,8 +352,8 @@ func New(fopts ...Option) (*Sbot, error) {
 		{multilogs.IndexNamePrivates, &s.Private},
 		{"msgTypes", &s.ByType},
 		{"tangles", &s.Tangles},
-		// TODO: channels
-		// TODO: mentions
+		{multilogs.IndexNameChannels, &s.Channels},
+		{multilogs.IndexNameMentions, &s.Mentions},
 	}
 	for _, index := range mlogs {
 		mlog, err := multibadger.NewShared(s.indexStore, []byte("mlog-"+index.Name))
@@ -358,6 +408,8 @@ func New(fopts ...Option) (*Sbot, error) {
 		s.Private,
 		s.ByType,
 		s.Tangles,
+		s.Channels,
+		s.Mentions,
 		groupsHelperMlog,
 		sm,
 	)
@@ -387,19 +439,18 @@ func New(fopts ...Option) (*Sbot, error) {
 
 	s.serveIndexFrom("group-members", membersSnk, justAddMemberMsgs)
 
-	/* TODO: fix deadlock in index update locking
 	if _, ok := s.simpleIndex["content-delete-requests"]; !ok {
-		var dcrTrigger dropContentTrigger
-		dcrTrigger.logger = log.With(s.info, "module", "dcrTrigger")
-		dcrTrigger.root = s.ReceiveLog
-		dcrTrigger.feeds = uf
-		dcrTrigger.nuller = s
-		err = MountSimpleIndex("content-delete-requests", dcrTrigger.MakeSimpleIndex)(s)
+		s.dcrTrigger = &dropContentTrigger{
+			logger: log.With(s.info, "module", "dcrTrigger"),
+			root:   s.ReceiveLog,
+			feeds:  s.Users,
+			nuller: s,
+		}
+		err = MountSimpleIndex("content-delete-requests", s.dcrTrigger.MakeSimpleIndex)(s)
 		if err != nil {
-			return nil, errors.Wrap(err, "sbot: failed to open load default DCR index")
+			return nil, fmt.Errorf("sbot: failed to open load default DCR index: %w", err)
 		}
 	}
-	*/
 
 	// contact/follow graph
 	gb := graph.NewBuilder(log.With(s.info, "module", "graph"), s.indexStore, s.signHMACsecret)
@@ -431,6 +482,23 @@ func New(fopts ...Option) (*Sbot, error) {
 	s.closers.AddCloser(aboutSnk)
 	s.serveIndexFrom("abouts", aboutSnk, aboutsOnly)
 
+	// full-text search
+	if s.enableSearch {
+		searchTerms, err := multibadger.NewShared(s.indexStore, []byte("mlog-"+search.IndexName))
+		if err != nil {
+			return nil, fmt.Errorf("sbot: failed to open search terms: %w", err)
+		}
+		s.closers.AddCloser(searchTerms)
+
+		s.searchIndex = search.NewIndex(searchTerms, s.Groups)
+		_, searchSnk, err := s.searchIndex.OpenSinkIndex(s.indexStore)
+		if err != nil {
+			return nil, fmt.Errorf("sbot: failed to open search index: %w", err)
+		}
+		s.closers.AddCloser(searchSnk)
+		s.serveIndex(search.IndexName, searchSnk)
+	}
+
 	// need to close s.indexStore _after_ the all the indexes closed and flushed
 	s.closers.AddCloser(s.indexStore)
 
@@ -536,8 +604,14 @@ func New(fopts ...Option) (*Sbot, error) {
 		s.serveIndexFrom("metafeed announcements", announcementSink, byTypeAnnouncements)
 	}
 
+	// all the indexes are set up, fill them from one read of the receive log
+	s.startIndexFanOut()
+
 	// from here on just network related stuff
 	if s.disableNetwork {
+		if err := s.startServices(); err != nil {
+			return nil, err
+		}
 		return s, nil
 	}
 
@@ -735,6 +809,8 @@ func New(fopts ...Option) (*Sbot, error) {
 		s.Users,
 		s.ByType,
 		s.Tangles,
+		s.Channels,
+		s.Mentions,
 		s.ReceiveLog, s)
 	s.public.Register(plug)
 	s.master.Register(plug)
@@ -754,6 +830,13 @@ func New(fopts ...Option) (*Sbot, error) {
 		s.SeqResolver,
 		sc))
 
+	s.master.Register(rawread.NewByChannelPlugin(s.info, s.ReceiveLog, s.Channels, s.SeqResolver))
+	s.master.Register(rawread.NewMentionsPlugin(s.info, s.ReceiveLog, s.Mentions, s.SeqResolver))
+
+	if s.searchIndex != nil {
+		s.master.Register(search.NewPlugin(s.info, s.ReceiveLog, s.searchIndex, s.SeqResolver, s.Groups, sc))
+	}
+
 	s.master.Register(rawread.NewRXLog(s.ReceiveLog)) // createLogStream
 	s.master.Register(rawread.NewSortedStream(s.info, s.ReceiveLog, s.SeqResolver))
 	s.master.Register(hist) // createHistoryStream
@@ -871,9 +954,28 @@ func New(fopts ...Option) (*Sbot, error) {
 	s.public.Register(networkNode.TunnelPlugin())
 	s.Network = networkNode
 
+	if err := s.startServices(); err != nil {
+		return nil, err
+	}
+
 	return s, nil
 }
 
+// startServices runs the services of WithService once the bot is set up
+func (s *Sbot) startServices() error {
+	for _, svc := range s.services {
+		if err := svc.Serve(s.rootCtx, s); err != nil {
+			return fmt.Errorf("sbot: failed to start service %T: %w", svc, err)
+		}
+	}
+	return nil
+}
+
+// Logger the info logger of the bot, the services of WithService log with it
+func (s *Sbot) Logger() log.Logger {
+	return s.info
+}
+
 // Close closes the bot by stopping network connections and closing the internal databases
 func (s *Sbot) Close() error {
 	s.closedMu.Lock()
@@ -886,26 +988,37 @@ func (s *Sbot) Close() error {
 	closeEvt := log.With(s.info, "event", "sbot closing")
 	s.closed = true
 
+	// a failing step doesn't stop the others, the databases are closed and flushed in any case
+	var err error
+
 	if s.Network != nil {
-		if err := s.Network.Close(); err != nil {
-			s.closeErr = fmt.Errorf("sbot: failed to close own network node: %w", err)
-			return s.closeErr
+		if nerr := s.Network.Close(); nerr != nil {
+			err = multierror.Append(err, fmt.Errorf("sbot: failed to close own network node: %w", nerr))
 		}
 		s.Network.GetConnTracker().CloseAll()
 		level.Debug(closeEvt).Log("msg", "connections closed")
 	}
 
-	if err := s.idxDone.Wait(); err != nil {
-		s.closeErr = fmt.Errorf("sbot: index group shutdown failed: %w", err)
-		return s.closeErr
+	for _, svc := range s.services {
+		if serr := svc.Close(); serr != nil {
+			err = multierror.Append(err, fmt.Errorf("sbot: failed to close service %T: %w", svc, serr))
+		}
+	}
+
+	if ierr := s.idxDone.Wait(); ierr != nil {
+		err = multierror.Append(err, fmt.Errorf("sbot: index group shutdown failed: %w", ierr))
 	}
 	level.Debug(closeEvt).Log("msg", "waited for indexes to close")
 
-	if err := s.closers.Close(); err != nil {
-		s.closeErr = err
-		return s.closeErr
+	if cerr := s.closers.Close(); cerr != nil {
+		err = multierror.Append(err, cerr)
 	}
 
+	s.closeErr = err
+	if err != nil {
+		level.Error(closeEvt).Log("msg", "closed with errors", "err", err)
+		return err
+	}
 	level.Info(closeEvt).Log("msg", "closers closed")
 	return nil
 }
@@ -7,9 +7,13 @@ package sbot
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"sync"
 
 	"github.com/dgraph-io/badger/v3"
+	"go.cryptoscope.co/luigi"
 	"go.cryptoscope.co/margaret"
 	librarian "go.cryptoscope.co/margaret/indexes"
 	"go.cryptoscope.co/margaret/multilog"
@@ -18,7 +22,6 @@ import (
 	refs "go.mindeco.de/ssb-refs"
 
 	"go.cryptoscope.co/ssb"
-	"go.cryptoscope.co/ssb/internal/mutil"
 	"go.cryptoscope.co/ssb/internal/storedrefs"
 	"go.cryptoscope.co/ssb/message/multimsg"
 	"go.cryptoscope.co/ssb/multilogs"
@@ -53,7 +56,12 @@ func (s *Sbot) NullContent(fr refs.FeedRef, seq uint) error {
 		return fmt.Errorf("not a sequence type: %T", seqv)
 	}
 
-	msgv, err := s.ReceiveLog.Get(rootLogSeq)
+	return s.nullReceived(rootLogSeq)
+}
+
+// nullReceived drops the content portion of the gabbygrove transfer at rxSeq in the receive log
+func (s *Sbot) nullReceived(rxSeq int64) error {
+	msgv, err := s.ReceiveLog.Get(rxSeq)
 	if err != nil {
 		return fmt.Errorf("nullContent: failed to get message in rootLog: %w", err)
 	}
@@ -75,7 +83,7 @@ func (s *Sbot) NullContent(fr refs.FeedRef, seq uint) error {
 		return fmt.Errorf("nullContent: unable to marshall nulled content transfer: %w", err)
 	}
 
-	err = s.ReceiveLog.Replace(rootLogSeq, nulled)
+	err = s.ReceiveLog.Replace(rxSeq, nulled)
 	if err != nil {
 		return fmt.Errorf("nullContent: failed to execute replace operation: %w", err)
 	}
@@ -85,70 +93,352 @@ func (s *Sbot) NullContent(fr refs.FeedRef, seq uint) error {
 // FolderNameDelete is the namespace/location the drop-content index uses
 const FolderNameDelete = "drop-content-requests"
 
+// pendingDropPrefix is the key prefix of the requests the trigger did not finish yet
+const pendingDropPrefix = FolderNameDelete + "-pending"
+
+// dropContentTrigger nulls the content of the messages that drop-content-requests ask for.
+// The index update only stores and queues the requests, they are checked and executed outside of it
+// since the locking of margaret/offset doesn't allow us to get or replace messages while being in an index update.
+// A request stays stored until it is done, the requests of a trigger that was closed are queued again on the next start.
 type dropContentTrigger struct {
 	logger kitlog.Logger
 
 	root  margaret.Log
 	feeds multilog.MultiLog
 
-	nuller ssb.ContentNuller
+	nuller receivedNuller
+
+	// the requests that are not done yet, feed and sequence -> pendingDrop
+	db *badger.DB
 
-	check chan *triggerEvent
+	mu     sync.Mutex
+	queue  []*triggerEvent
+	wakeup chan struct{}
+	closed bool
+	done   chan struct{}
+}
+
+// receivedNuller drops the content of a message by its sequence in the receive log
+type receivedNuller interface {
+	nullReceived(rxSeq int64) error
 }
 
 type triggerEvent struct {
 	author refs.FeedRef
 	dcr    ssb.DropContentRequest
+
+	// the receive log before this sequence has the messages the trigger saw, -1 for all of it
+	rxBound int64
+}
+
+// pendingDrop is how a request is stored until it is done
+type pendingDrop struct {
+	Author  string                 `json:"author"`
+	Request ssb.DropContentRequest `json:"request"`
+}
+
+func pendingDropKey(author refs.FeedRef, seq uint) []byte {
+	return []byte(pendingDropPrefix + string(storedrefs.Feed(author)) + strconv.FormatUint(uint64(seq), 10))
+}
+
+// request stores the request before it is queued, so that it isn't lost if the trigger is closed before it is done
+func (dct *dropContentTrigger) request(author refs.FeedRef, dcr ssb.DropContentRequest, rxBound int64) error {
+	data, err := json.Marshal(pendingDrop{Author: author.String(), Request: dcr})
+	if err != nil {
+		return err
+	}
+	err = dct.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(pendingDropKey(author, dcr.Sequence), data)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store pending request: %w", err)
+	}
+
+	dct.enqueue(&triggerEvent{author: author, dcr: dcr, rxBound: rxBound})
+	return nil
+}
+
+// pending returns the stored request for the message seq of author, nil if there is none
+func (dct *dropContentTrigger) pending(author refs.FeedRef, seq uint) (*ssb.DropContentRequest, error) {
+	var pd pendingDrop
+	err := dct.db.View(func(txn *badger.Txn) error {
+		it, err := txn.Get(pendingDropKey(author, seq))
+		if err != nil {
+			return err
+		}
+		return it.Value(func(val []byte) error {
+			return json.Unmarshal(val, &pd)
+		})
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending request: %w", err)
+	}
+	return &pd.Request, nil
+}
+
+// finish removes the stored request, unless it was replaced by another one for the same message in the meantime
+func (dct *dropContentTrigger) finish(author refs.FeedRef, dcr ssb.DropContentRequest) error {
+	key := pendingDropKey(author, dcr.Sequence)
+	err := dct.db.Update(func(txn *badger.Txn) error {
+		it, err := txn.Get(key)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var pd pendingDrop
+		err = it.Value(func(val []byte) error {
+			return json.Unmarshal(val, &pd)
+		})
+		if err != nil {
+			return err
+		}
+		if !pd.Request.Hash.Equal(dcr.Hash) {
+			return nil
+		}
+		return txn.Delete(key)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove pending request: %w", err)
+	}
+	return nil
+}
+
+// requeue queues the stored requests again, the ones a closed trigger didn't do and the ones that wait for their message
+func (dct *dropContentTrigger) requeue() error {
+	var evts []*triggerEvent
+	err := dct.db.View(func(txn *badger.Txn) error {
+		prefix := []byte(pendingDropPrefix)
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			var pd pendingDrop
+			err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &pd)
+			})
+			if err != nil {
+				return err
+			}
+			author, err := refs.ParseFeedRef(pd.Author)
+			if err != nil {
+				return err
+			}
+			evts = append(evts, &triggerEvent{author: author, dcr: pd.Request, rxBound: -1})
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load pending requests: %w", err)
+	}
+	for _, evt := range evts {
+		dct.enqueue(evt)
+	}
+	return nil
+}
+
+// enqueue never blocks, the index update calls it
+func (dct *dropContentTrigger) enqueue(evt *triggerEvent) {
+	dct.mu.Lock()
+	defer dct.mu.Unlock()
+	if dct.closed {
+		return
+	}
+	dct.queue = append(dct.queue, evt)
+	select {
+	case dct.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (dct *dropContentTrigger) next() (*triggerEvent, bool) {
+	for {
+		dct.mu.Lock()
+		if dct.closed {
+			dct.mu.Unlock()
+			return nil, false
+		}
+		if len(dct.queue) > 0 {
+			evt := dct.queue[0]
+			dct.queue[0] = nil
+			dct.queue = dct.queue[1:]
+			dct.mu.Unlock()
+			return evt, true
+		}
+		dct.mu.Unlock()
+		<-dct.wakeup
+	}
 }
 
 func (dct *dropContentTrigger) consume() {
+	defer close(dct.done)
 	evtLog := kitlog.With(dct.logger, "event", "null content trigger")
-	for evt := range dct.check {
+	for {
+		evt, ok := dct.next()
+		if !ok {
+			return
+		}
 
-		feed, err := dct.feeds.Get(storedrefs.Feed(evt.author))
+		err := dct.process(evt)
 		if err != nil {
-			level.Warn(evtLog).Log("msg", "no such feed?", "err", err)
-			continue
+			level.Error(evtLog).Log("author", evt.author.ShortSigil(), "seq", evt.dcr.Sequence, "err", err)
 		}
+	}
+}
 
-		if !evt.dcr.Valid(mutil.Indirect(dct.root, feed)) {
-			level.Warn(evtLog).Log("msg", "invalid request")
-			continue
+func (dct *dropContentTrigger) process(evt *triggerEvent) error {
+	evtLog := kitlog.With(dct.logger, "event", "null content trigger", "author", evt.author.ShortSigil(), "seq", evt.dcr.Sequence)
+
+	if evt.dcr.Sequence < 1 {
+		level.Warn(evtLog).Log("msg", "invalid request")
+		return dct.finish(evt.author, evt.dcr)
+	}
+
+	rxSeq, msg, received, err := dct.target(context.Background(), evt)
+	if err != nil {
+		return err
+	}
+	if !received {
+		// the index update queues it again once it is
+		level.Debug(evtLog).Log("msg", "waiting for the message")
+		return nil
+	}
+
+	switch {
+	case msg == nil:
+		level.Debug(evtLog).Log("msg", "message was nulled already")
+	case !evt.dcr.ValidFor(msg):
+		level.Warn(evtLog).Log("msg", "invalid request")
+	default:
+		// on an error the request stays stored and is tried again on the next start
+		err = dct.nuller.nullReceived(rxSeq)
+		if err != nil {
+			return err
 		}
+		level.Info(evtLog).Log("msg", "nulled successfully")
+	}
 
-		err = dct.nuller.NullContent(evt.author, evt.dcr.Sequence)
+	return dct.finish(evt.author, evt.dcr)
+}
+
+// target looks up the message the request asks for in the receive log.
+// received is false if it isn't there yet, msg is nil if the whole entry was nulled.
+func (dct *dropContentTrigger) target(ctx context.Context, evt *triggerEvent) (rxSeq int64, msg refs.Message, received bool, err error) {
+	seq := int64(evt.dcr.Sequence)
+
+	feed, err := dct.feeds.Get(storedrefs.Feed(evt.author))
+	if err != nil {
+		return -1, nil, false, fmt.Errorf("no such feed: %w", err)
+	}
+
+	if feed.Seq() >= seq-1 {
+		// internal data strucutres are 0-indexed
+		v, err := feed.Get(seq - 1)
 		if err != nil {
-			level.Error(evtLog).Log("err", err)
-			continue
+			return -1, nil, false, fmt.Errorf("failed to get message from the feed: %w", err)
+		}
+		rxSeq, ok := v.(int64)
+		if !ok {
+			return -1, nil, false, fmt.Errorf("not a sequence type: %T", v)
+		}
+
+		v, err = dct.root.Get(rxSeq)
+		if margaret.IsErrNulled(err) {
+			return rxSeq, nil, true, nil
+		}
+		if err != nil {
+			return -1, nil, false, fmt.Errorf("failed to get message in rootLog: %w", err)
+		}
+		msg, ok := v.(refs.Message)
+		if !ok {
+			return -1, nil, false, fmt.Errorf("unexpected message type %T", v)
 		}
+		return rxSeq, msg, true, nil
+	}
 
-		level.Info(evtLog).Log("msg", "nulled successfully", "author", evt.author.ShortSigil(), "seq", evt.dcr.Sequence)
+	// the feeds index is updated on its own and might not have it yet,
+	// the receive log has every message the trigger saw, from the newest back to the one of the request
+	bound := evt.rxBound
+	if bound < 0 {
+		bound = dct.root.Seq() + 1
+	}
+	src, err := dct.root.Query(margaret.Lt(bound), margaret.Reverse(true), margaret.SeqWrap(true))
+	if err != nil {
+		return -1, nil, false, fmt.Errorf("failed to query rootLog: %w", err)
+	}
+	for {
+		v, err := src.Next(ctx)
+		if luigi.IsEOS(err) {
+			return -1, nil, false, nil
+		}
+		if err != nil {
+			return -1, nil, false, fmt.Errorf("failed to read rootLog: %w", err)
+		}
+
+		sw, ok := v.(margaret.SeqWrapper)
+		if !ok {
+			return -1, nil, false, fmt.Errorf("expected a sequence wrapper: %T", v)
+		}
+		msg, ok := sw.Value().(refs.Message)
+		if !ok {
+			// nulled entries
+			continue
+		}
+		if !msg.Author().Equal(evt.author) || msg.Seq() > seq {
+			continue
+		}
+		if msg.Seq() < seq {
+			// older messages of the feed, the one of the request isn't there
+			return -1, nil, false, nil
+		}
+		return sw.Seq(), msg, true, nil
 	}
 }
 
 func (dct *dropContentTrigger) MakeSimpleIndex(db *badger.DB) (librarian.Index, librarian.SinkIndex, error) {
-
-	// TODO: currently the locking of margaret/offset doesn't allow us to get previous messages while being in an index update
-	// this is realized as an luigi.Broadcast and the current bases of the index update mechanism
-	dct.check = make(chan *triggerEvent, 10)
+	dct.wakeup = make(chan struct{}, 1)
+	dct.done = make(chan struct{})
+	dct.db = db
 
 	idx, snk, err := repo.OpenIndex(db, FolderNameDelete, dct.idxupdate)
 	if err != nil {
 		return nil, nil, fmt.Errorf("error getting dcr trigger index: %w", err)
 	}
+
+	err = dct.requeue()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting dcr trigger index: %w", err)
+	}
 	go dct.consume()
-	ws := &wrappedIndexSink{SinkIndex: snk, ch: dct.check}
+	ws := &wrappedIndexSink{SinkIndex: snk, trigger: dct}
 	return idx, ws, nil
 }
 
 type wrappedIndexSink struct {
 	librarian.SinkIndex
 
-	ch chan *triggerEvent
+	trigger *dropContentTrigger
 }
 
+// Close stops the trigger, requests that are still queued stay stored for the next start
 func (snk *wrappedIndexSink) Close() error {
-	close(snk.ch)
+	dct := snk.trigger
+	dct.mu.Lock()
+	dct.closed = true
+	if n := len(dct.queue); n > 0 {
+		level.Info(dct.logger).Log("event", "null content trigger closed", "postponed", n)
+	}
+	dct.queue = nil
+	dct.mu.Unlock()
+
+	select {
+	case dct.wakeup <- struct{}{}:
+	default:
+	}
+	<-dct.done
 	return snk.SinkIndex.Close()
 }
 
@@ -171,12 +461,25 @@ func (dct *dropContentTrigger) idxupdate(idx librarian.SeqSetterIndex) librarian
 			return nil
 		}
 
+		// a request that waited for this message
+		waiting, err := dct.pending(author, uint(msg.Seq()))
+		if err != nil {
+			return fmt.Errorf("index/dcrTigger: %w", err)
+		}
+		if waiting != nil {
+			dct.enqueue(&triggerEvent{
+				author:  author,
+				dcr:     *waiting,
+				rxBound: seq + 1,
+			})
+		}
+
 		var typed ssb.DropContentRequest
-		err := json.Unmarshal(msg.ContentBytes(), &typed)
+		err = json.Unmarshal(msg.ContentBytes(), &typed)
 		if err == nil && typed.Type == ssb.DropContentRequestType {
-			dct.check <- &triggerEvent{
-				author: author,
-				dcr:    typed,
+			err = dct.request(author, typed, seq)
+			if err != nil {
+				return fmt.Errorf("index/dcrTigger: %w", err)
 			}
 		}
 
@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"github.com/davecgh/go-spew/spew"
+	"github.com/dgraph-io/badger/v3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.cryptoscope.co/luigi"
@@ -31,9 +32,7 @@ import (
 	"go.cryptoscope.co/ssb/repo"
 )
 
-// TODO: disabled since the plugin is disabled in sbot/new.go
-
-func XTestNullContentRequest(t *testing.T) {
+func TestNullContentRequest(t *testing.T) {
 	defer leakcheck.Check(t)
 
 	r := require.New(t)
@@ -169,7 +168,15 @@ func XTestNullContentRequest(t *testing.T) {
 		_, err = json.Marshal(tmsg)
 		r.NoError(err)
 		a.Equal(c.okay, tmsg.Valid(bertLog), "%d: failed", ic)
+
+		// the same check on the message itself, as the trigger does it
+		if c.seq > 0 {
+			v, err := bertLog.Get(int64(c.seq - 1))
+			r.NoError(err)
+			a.Equal(c.okay, tmsg.ValidFor(v.(refs.Message)), "%d: failed for the message", ic)
+		}
 	}
+	a.False(ssb.NewDropContentRequest(1, msg.Key()).ValidFor(msg), "the message is not at that sequence")
 
 	dropContent := ssb.NewDropContentRequest(3, msg.Key())
 	v, err := json.Marshal(dropContent)
@@ -187,12 +194,13 @@ func XTestNullContentRequest(t *testing.T) {
 	t.Log("first, valid dcr request:", del.Key().String())
 	logger.Log("msg", "req published")
 
-	time.Sleep(1 * time.Second)
-	logger.Log("msg", "waited")
-
 	// aaand it's gone
-	msg, err = mainbot.Get(msg.Key())
-	r.NoError(err)
+	r.Eventually(func() bool {
+		msg, err = mainbot.Get(msg.Key())
+		r.NoError(err)
+		return msg.ContentBytes() == nil
+	}, 10*time.Second, 50*time.Millisecond)
+	logger.Log("msg", "waited")
 	nulledContent := msg.ContentBytes()
 	a.Nil(nulledContent, "content not nil")
 	a.NotEqual(origContent, nulledContent, "content still the same!")
@@ -219,6 +227,147 @@ func XTestNullContentRequest(t *testing.T) {
 	r.NoError(mainbot.Close())
 }
 
+func TestNullContentRequestPending(t *testing.T) {
+	defer leakcheck.Check(t)
+	r := require.New(t)
+
+	hk := make([]byte, 32)
+	n, err := rand.Read(hk)
+	r.Equal(32, n)
+
+	logger := testutils.NewRelativeTimeLogger(nil)
+
+	// bert publishes on the second bot
+	twoRepoPath := filepath.Join("testrun", t.Name(), "two")
+	os.RemoveAll(twoRepoPath)
+	kpBert, err := repo.NewKeyPair(repo.New(twoRepoPath), "bert", refs.RefAlgoFeedGabby)
+	r.NoError(err)
+
+	botTwo, err := New(
+		WithInfo(log.With(logger, "bot", "two")),
+		WithRepoPath(twoRepoPath),
+		WithHMACSigning(hk),
+		DisableNetworkNode(),
+	)
+	r.NoError(err)
+
+	var bertMsgs []refs.Message
+	for i := 1; i <= 3; i++ {
+		msg, err := botTwo.PublishAs("bert", map[string]interface{}{"type": "test", "i": i})
+		r.NoError(err)
+		bertMsgs = append(bertMsgs, msg)
+	}
+
+	mainRepoPath := filepath.Join("testrun", t.Name(), "main")
+	os.RemoveAll(mainRepoPath)
+	mainbot, err := New(
+		WithInfo(log.With(logger, "bot", "main")),
+		WithRepoPath(mainRepoPath),
+		WithHMACSigning(hk),
+		DisableNetworkNode(),
+	)
+	r.NoError(err)
+
+	// the main bot only has the first two messages
+	copyMsg := func(seq int64) {
+		v, err := botTwo.ReceiveLog.Get(seq)
+		r.NoError(err)
+		_, err = mainbot.ReceiveLog.Append(v)
+		r.NoError(err)
+	}
+	copyMsg(0)
+	copyMsg(1)
+	mainbot.WaitUntilIndexesAreSynced()
+
+	// the request for the third one has to wait for it
+	dropTarget := bertMsgs[2].Key()
+	r.NoError(mainbot.dcrTrigger.request(kpBert.ID(), *ssb.NewDropContentRequest(3, dropTarget), -1))
+
+	// it stays stored while the trigger looks for the message
+	time.Sleep(250 * time.Millisecond)
+	waiting, err := mainbot.dcrTrigger.pending(kpBert.ID(), 3)
+	r.NoError(err)
+	r.NotNil(waiting)
+	r.True(waiting.Hash.Equal(dropTarget))
+
+	copyMsg(2)
+	r.Eventually(func() bool {
+		msg, err := mainbot.Get(dropTarget)
+		r.NoError(err)
+		return msg.ContentBytes() == nil
+	}, 10*time.Second, 50*time.Millisecond)
+
+	r.Eventually(func() bool {
+		waiting, err := mainbot.dcrTrigger.pending(kpBert.ID(), 3)
+		r.NoError(err)
+		return waiting == nil
+	}, 10*time.Second, 50*time.Millisecond)
+
+	botTwo.Shutdown()
+	mainbot.Shutdown()
+	r.NoError(botTwo.Close())
+	r.NoError(mainbot.Close())
+}
+
+// TestNullContentRequestRestart a request that was stored but not done before the bot closed is done after the next start
+func TestNullContentRequestRestart(t *testing.T) {
+	defer leakcheck.Check(t)
+	r := require.New(t)
+
+	hk := make([]byte, 32)
+	n, err := rand.Read(hk)
+	r.Equal(32, n)
+
+	logger := testutils.NewRelativeTimeLogger(nil)
+
+	tRepoPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(tRepoPath)
+	kpBert, err := repo.NewKeyPair(repo.New(tRepoPath), "bert", refs.RefAlgoFeedGabby)
+	r.NoError(err)
+
+	open := func() *Sbot {
+		bot, err := New(
+			WithInfo(logger),
+			WithRepoPath(tRepoPath),
+			WithHMACSigning(hk),
+			DisableNetworkNode(),
+		)
+		r.NoError(err)
+		return bot
+	}
+
+	mainbot := open()
+	msg, err := mainbot.PublishAs("bert", map[string]interface{}{"type": "test", "i": 1})
+	r.NoError(err)
+	dropTarget := msg.Key()
+	mainbot.WaitUntilIndexesAreSynced()
+
+	// stored like the index update does it, but closed before it was queued
+	data, err := json.Marshal(pendingDrop{Author: kpBert.ID().String(), Request: *ssb.NewDropContentRequest(1, dropTarget)})
+	r.NoError(err)
+	err = mainbot.indexStore.Update(func(txn *badger.Txn) error {
+		return txn.Set(pendingDropKey(kpBert.ID(), 1), data)
+	})
+	r.NoError(err)
+
+	mainbot.Shutdown()
+	r.NoError(mainbot.Close())
+
+	mainbot = open()
+	r.Eventually(func() bool {
+		msg, err := mainbot.Get(dropTarget)
+		r.NoError(err)
+		return msg.ContentBytes() == nil
+	}, 10*time.Second, 50*time.Millisecond)
+
+	waiting, err := mainbot.dcrTrigger.pending(kpBert.ID(), 1)
+	r.NoError(err)
+	r.Nil(waiting, "the request is done")
+
+	mainbot.Shutdown()
+	r.NoError(mainbot.Close())
+}
+
 func XTestNullContentAndSync(t *testing.T) {
 	defer leakcheck.Check(t)
 	r := require.New(t)
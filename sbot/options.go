@@ -9,6 +9,7 @@ package sbot
 import (
 	"context"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"path/filepath"
@@ -50,6 +51,18 @@ func DisableLiveIndexMode() Option {
 	}
 }
 
+// WithIndexWorkers sets how many indexes process messages at the same time while they catch up with the receive log on startup.
+// The indexes share one read of the log, so a cold start decodes every message once. Zero uses the number of CPUs.
+func WithIndexWorkers(n int) Option {
+	return func(s *Sbot) error {
+		if n < 0 {
+			return fmt.Errorf("sbot: index workers can't be negative (%d)", n)
+		}
+		s.indexWorkers = n
+		return nil
+	}
+}
+
 // WithRepoPath changes where the replication database and blobs are stored.
 func WithRepoPath(path string) Option {
 	return func(s *Sbot) error {
@@ -355,6 +368,14 @@ func EnableAdvertismentDialing(do bool) Option {
 	}
 }
 
+// WithSearchIndex enables the full-text index over posts and abouts and its search.query source
+func WithSearchIndex(enable bool) Option {
+	return func(s *Sbot) error {
+		s.enableSearch = enable
+		return nil
+	}
+}
+
 // WithHMACSigning sets an HMAC signing key for messages.
 // Useful for testing, see https://github.com/ssb-js/ssb-validate#state--validateappendstate-hmac_key-msg for more.
 func WithHMACSigning(key []byte) Option {
@@ -427,3 +448,18 @@ func LateOption(o Option) Option {
 		return nil
 	}
 }
+
+// Service is an application that runs inside the bot process and uses its logs directly, instead of connecting over muxrpc.
+// Serve is called once New is done and must not block, Close is called by (*Sbot).Close before the databases are closed.
+type Service interface {
+	Serve(ctx context.Context, s *Sbot) error
+	io.Closer
+}
+
+// WithService starts svc with the bot, see Service.
+func WithService(svc Service) Option {
+	return func(s *Sbot) error {
+		s.services = append(s.services, svc)
+		return nil
+	}
+}
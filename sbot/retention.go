@@ -0,0 +1,395 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package sbot
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.cryptoscope.co/margaret"
+	kitlog "go.mindeco.de/log"
+	"go.mindeco.de/log/level"
+	refs "go.mindeco.de/ssb-refs"
+	"go.mindeco.de/ssb-refs/tfk"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/internal/storedrefs"
+	"go.cryptoscope.co/ssb/message/multimsg"
+)
+
+// how many decisions the retention keeps for the status, the oldest are dropped first
+const retentionMaxDecisions = 100
+
+// FeedQuota limits how much of a feed is kept, zero doesn't limit.
+type FeedQuota struct {
+	MaxMessages int64
+	MaxBytes    int64 // the size of the messages as they were received
+}
+
+// RetentionPolicy says which messages WithRetention nulls.
+type RetentionPolicy struct {
+	// Quota is the limit of all the feeds that don't have one in HopQuotas
+	Quota FeedQuota
+
+	// HopQuotas are the limits of the feeds that are that many hops away, feeds outside of the graph use Quota
+	HopQuotas map[int]FeedQuota
+
+	// MaxAge nulls the messages that were received longer ago, of the feeds that are more than MaxAgeBeyondHops away or outside of the graph
+	MaxAge           time.Duration
+	MaxAgeBeyondHops int
+
+	// Exempt feeds are never touched, the feed of the bot never is either
+	Exempt []refs.FeedRef
+
+	// Interval is the pause between two checks of all the feeds
+	Interval time.Duration
+}
+
+// WithRetention enforces policy in the background: the content of the oldest messages of a feed that is over its quota,
+// and of the messages that are older than the maximum age, is dropped.
+// Only gabby grove messages can lose their content and keep the signed metadata the feed is replicated and verified with,
+// the feeds of the other formats are kept whole and reported as skipped. The decisions are reported by Status().
+func WithRetention(policy RetentionPolicy) Option {
+	return func(s *Sbot) error {
+		if policy.Interval <= 0 {
+			return fmt.Errorf("sbot: retention interval needs to be positive")
+		}
+		if policy.MaxAge < 0 || policy.MaxAgeBeyondHops < 0 {
+			return fmt.Errorf("sbot: retention age and hops can't be negative")
+		}
+		if s.retention != nil {
+			return fmt.Errorf("sbot: retention already configured")
+		}
+
+		exempt := ssb.NewFeedSet(len(policy.Exempt))
+		for _, ref := range policy.Exempt {
+			if err := exempt.AddRef(ref); err != nil {
+				return fmt.Errorf("sbot: invalid retention exemption: %w", err)
+			}
+		}
+
+		s.retention = &retention{
+			policy: policy,
+			exempt: exempt,
+		}
+		s.services = append(s.services, s.retention)
+		return nil
+	}
+}
+
+type retention struct {
+	policy RetentionPolicy
+	exempt *ssb.StrFeedSet
+
+	bot    *Sbot
+	logger kitlog.Logger
+
+	mu    sync.Mutex
+	state ssb.RetentionStatus
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+var _ Service = (*retention)(nil)
+
+// Serve starts the enforcement
+func (rt *retention) Serve(ctx context.Context, s *Sbot) error {
+	rt.bot = s
+	rt.logger = kitlog.With(s.info, "unit", "retention")
+
+	ctx, rt.cancel = context.WithCancel(ctx)
+	rt.done = make(chan struct{})
+	go func() {
+		defer close(rt.done)
+		err := rt.run(ctx)
+		if err != nil && ctx.Err() == nil {
+			level.Error(rt.logger).Log("event", "retention stopped", "err", err)
+		}
+	}()
+	return nil
+}
+
+// Close stops the enforcement
+func (rt *retention) Close() error {
+	if rt.cancel == nil {
+		return nil
+	}
+	rt.cancel()
+	<-rt.done
+	return nil
+}
+
+func (rt *retention) status() ssb.RetentionStatus {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	st := rt.state
+	st.Decisions = make([]ssb.RetentionDecision, len(rt.state.Decisions))
+	copy(st.Decisions, rt.state.Decisions)
+	st.Skipped = append([]string(nil), rt.state.Skipped...)
+	return st
+}
+
+func (rt *retention) decided(d ssb.RetentionDecision) {
+	level.Info(rt.logger).Log("event", "nulled messages", "feed", d.Feed, "rule", d.Rule, "nulled", d.Nulled, "kept", d.Kept)
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	rt.state.Nulled += int64(d.Nulled)
+
+	decisions := rt.state.Decisions[:0]
+	for _, old := range rt.state.Decisions {
+		if old.Feed != d.Feed {
+			decisions = append(decisions, old)
+		}
+	}
+	decisions = append(decisions, d)
+	if len(decisions) > retentionMaxDecisions {
+		decisions = decisions[len(decisions)-retentionMaxDecisions:]
+	}
+	rt.state.Decisions = decisions
+}
+
+func (rt *retention) run(ctx context.Context) error {
+	// the feeds index has to know all the messages
+	synced := make(chan struct{})
+	go func() {
+		rt.bot.WaitUntilIndexesAreSynced()
+		close(synced)
+	}()
+	select {
+	case <-synced:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	for {
+		err := rt.enforce(ctx)
+		if err != nil {
+			return err
+		}
+
+		rt.mu.Lock()
+		rt.state.Runs++
+		rt.state.LastRun = time.Now()
+		rt.mu.Unlock()
+
+		if !sleepCtx(ctx, rt.policy.Interval) {
+			return ctx.Err()
+		}
+	}
+}
+
+// enforce checks all the feeds once
+func (rt *retention) enforce(ctx context.Context) error {
+	s := rt.bot
+
+	hops := rt.hopSets()
+
+	feeds, err := s.Users.List()
+	if err != nil {
+		return fmt.Errorf("retention: failed to list feeds: %w", err)
+	}
+
+	var skipped []string
+	for _, addr := range feeds {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var sr tfk.Feed
+		err := sr.UnmarshalBinary([]byte(addr))
+		if err != nil {
+			return fmt.Errorf("retention: failed to unpack feed %q: %w", addr, err)
+		}
+		feed, err := sr.Feed()
+		if err != nil {
+			return fmt.Errorf("retention: failed to unpack feed %q: %w", addr, err)
+		}
+
+		if feed.Equal(s.KeyPair.ID()) || rt.exempt.Has(feed) {
+			continue
+		}
+
+		dist := -1
+		for h, set := range hops {
+			if set != nil && set.Has(feed) {
+				dist = h
+				break
+			}
+		}
+
+		// without their signed metadata the feeds of the other formats can't be served and verified from the start anymore
+		if feed.Algo() != refs.RefAlgoFeedGabby {
+			if quota, maxAge := rt.limits(dist); quota.MaxMessages > 0 || quota.MaxBytes > 0 || maxAge > 0 {
+				skipped = append(skipped, feed.String())
+			}
+			continue
+		}
+
+		// one broken feed shouldn't keep the others from being checked
+		err = rt.enforceFeed(feed, dist)
+		if err != nil {
+			level.Warn(rt.logger).Log("event", "retention failed", "feed", feed.ShortSigil(), "err", err)
+		}
+	}
+	rt.skip(skipped)
+	return nil
+}
+
+// skip records the feeds the policy applies to but that are kept whole, the ones that weren't skipped before are logged
+func (rt *retention) skip(feeds []string) {
+	sort.Strings(feeds)
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	before := make(map[string]bool, len(rt.state.Skipped))
+	for _, f := range rt.state.Skipped {
+		before[f] = true
+	}
+	for _, f := range feeds {
+		if !before[f] {
+			level.Info(rt.logger).Log("event", "feed kept whole", "feed", f, "reason", "format can't drop the content alone")
+		}
+	}
+	rt.state.Skipped = feeds
+}
+
+// limits returns the quota and the maximum age of the feeds that are dist hops away, zero values don't limit
+func (rt *retention) limits(dist int) (FeedQuota, time.Duration) {
+	quota := rt.policy.Quota
+	if q, has := rt.policy.HopQuotas[dist]; has && dist >= 0 {
+		quota = q
+	}
+	maxAge := rt.policy.MaxAge
+	if dist >= 0 && dist <= rt.policy.MaxAgeBeyondHops {
+		maxAge = 0
+	}
+	return quota, maxAge
+}
+
+// hopSets returns the feeds that are up to so many hops away, as far as the policy needs to know
+func (rt *retention) hopSets() []*ssb.StrFeedSet {
+	s := rt.bot
+
+	max := rt.policy.MaxAgeBeyondHops
+	for h := range rt.policy.HopQuotas {
+		if h > max {
+			max = h
+		}
+	}
+	if h := int(s.hopCount); h > max {
+		max = h
+	}
+
+	sets := make([]*ssb.StrFeedSet, max+1)
+	for h := range sets {
+		sets[h] = s.GraphBuilder.Hops(s.KeyPair.ID(), h)
+	}
+	return sets
+}
+
+// enforceFeed nulls the content of the messages of feed that the policy doesn't keep, from the newest to the oldest.
+// Once a quota is used up, all the older messages are nulled.
+func (rt *retention) enforceFeed(feed refs.FeedRef, dist int) error {
+	s := rt.bot
+
+	quota, maxAge := rt.limits(dist)
+	if quota.MaxMessages <= 0 && quota.MaxBytes <= 0 && maxAge <= 0 {
+		return nil
+	}
+
+	userLog, err := s.Users.Get(storedrefs.Feed(feed))
+	if err != nil {
+		return fmt.Errorf("retention: failed to open sublog of %s: %w", feed.ShortSigil(), err)
+	}
+
+	head := userLog.Seq()
+	if head == margaret.SeqEmpty {
+		return nil
+	}
+
+	d := ssb.RetentionDecision{
+		Feed: feed.String(),
+		Hops: dist,
+	}
+
+	var full bool // a quota is used up
+	for i := head; i >= 0; i-- {
+		v, err := userLog.Get(i)
+		if err != nil {
+			return fmt.Errorf("retention: no entry for %s:%d: %w", feed.ShortSigil(), i+1, err)
+		}
+		rxSeq, ok := v.(int64)
+		if !ok {
+			return fmt.Errorf("retention: unexpected entry type %T", v)
+		}
+
+		mv, err := s.ReceiveLog.Get(rxSeq)
+		if err != nil {
+			if margaret.IsErrNulled(err) {
+				continue
+			}
+			return fmt.Errorf("retention: failed to load %s:%d: %w", feed.ShortSigil(), i+1, err)
+		}
+		if mm, ok := mv.(*multimsg.MultiMessage); ok {
+			if tr, ok := mm.AsGabby(); ok && tr.Content == nil {
+				continue
+			}
+		}
+		msg, raw, err := storedMessage(mv)
+		if err != nil {
+			return fmt.Errorf("retention: %s:%d: %w", feed.ShortSigil(), i+1, err)
+		}
+		size := int64(len(raw))
+
+		var rule string
+		switch {
+		case i == head: // needed to verify the next message
+		case full:
+			rule = d.Rule
+		case quota.MaxMessages > 0 && d.Kept >= quota.MaxMessages:
+			rule, full = "max-messages", true
+		case quota.MaxBytes > 0 && d.Bytes+size > quota.MaxBytes:
+			rule, full = "max-bytes", true
+		case maxAge > 0 && time.Since(msg.Received()) > maxAge:
+			rule = "max-age"
+		}
+		if rule != "" {
+			if d.Rule == "" {
+				d.Rule = rule
+			}
+			err = rt.null(feed, msg)
+			if err != nil {
+				return err
+			}
+			d.Nulled++
+			continue
+		}
+
+		d.Kept++
+		d.Bytes += size
+	}
+
+	if d.Nulled > 0 {
+		d.When = time.Now()
+		rt.decided(d)
+	}
+	return nil
+}
+
+// null drops the content of a gabby grove message, it keeps everything else
+func (rt *retention) null(feed refs.FeedRef, msg refs.Message) error {
+	err := rt.bot.NullContent(feed, uint(msg.Seq()))
+	if err != nil {
+		return fmt.Errorf("retention: failed to null %s:%d: %w", feed.ShortSigil(), msg.Seq(), err)
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package sbot
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/margaret"
+	"go.mindeco.de/log"
+	refs "go.mindeco.de/ssb-refs"
+	"golang.org/x/sync/errgroup"
+
+	"go.cryptoscope.co/ssb/internal/storedrefs"
+	"go.cryptoscope.co/ssb/internal/testutils"
+	"go.cryptoscope.co/ssb/message/multimsg"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+func TestRetention(t *testing.T) {
+	if testutils.SkipOnCI(t) {
+		return
+	}
+	r := require.New(t)
+
+	testPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(testPath)
+
+	theBot, botOptions := makeFSCKTestBot(t)
+
+	exempt, err := repo.NewKeyPair(repo.New(testPath), "three", refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	publish := func(nick string, n int) refs.FeedRef {
+		var author refs.FeedRef
+		for i := 0; i < n; i++ {
+			post := refs.NewPost(fmt.Sprintf("%s:%d", nick, i))
+			var (
+				msg refs.Message
+				err error
+			)
+			if nick == "" {
+				msg, err = theBot.PublishLog.Publish(post)
+			} else {
+				msg, err = theBot.PublishAs(nick, post)
+			}
+			r.NoError(err)
+			author = msg.Author()
+		}
+		return author
+	}
+	self := publish("", 6)
+	one := publish("one", 10)
+	two := publish("two", 5) // gabby grove
+	publish("three", 6)
+	theBot.Shutdown()
+	r.NoError(theBot.Close())
+
+	retentionOptions := append(botOptions, WithRetention(RetentionPolicy{
+		Quota:    FeedQuota{MaxMessages: 3},
+		Exempt:   []refs.FeedRef{exempt.ID()},
+		Interval: 10 * time.Millisecond,
+	}))
+	theBot, err = New(retentionOptions...)
+	r.NoError(err)
+
+	r.Eventually(func() bool {
+		return theBot.retention.status().Runs >= 2
+	}, 10*time.Second, 10*time.Millisecond)
+
+	// which messages of the feed can still be read, the feeds index keeps all of them
+	readable := func(feed refs.FeedRef, n int) []bool {
+		userLog, err := theBot.Users.Get(storedrefs.Feed(feed))
+		r.NoError(err)
+		r.EqualValues(n-1, userLog.Seq(), "feed %s lost entries", feed.ShortSigil())
+
+		var kept []bool
+		for i := 0; i < n; i++ {
+			rxSeq, err := userLog.Get(int64(i))
+			r.NoError(err)
+			v, err := theBot.ReceiveLog.Get(rxSeq.(int64))
+			if margaret.IsErrNulled(err) {
+				kept = append(kept, false)
+				continue
+			}
+			r.NoError(err)
+			if tr, ok := v.(*multimsg.MultiMessage).AsGabby(); ok {
+				kept = append(kept, tr.Content != nil)
+				continue
+			}
+			kept = append(kept, true)
+		}
+		return kept
+	}
+
+	r.Equal([]bool{true, true, true, true, true, true, true, true, true, true}, readable(one, 10), "legacy feeds are kept whole")
+	r.Equal([]bool{false, false, true, true, true}, readable(two, 5))
+	r.Equal([]bool{true, true, true, true, true, true}, readable(self, 6))
+	r.Equal([]bool{true, true, true, true, true, true}, readable(exempt.ID(), 6))
+
+	st, err := theBot.Status()
+	r.NoError(err)
+	r.NotNil(st.Retention)
+	r.EqualValues(2, st.Retention.Nulled, "later runs shouldn't null anything")
+	r.Equal([]string{one.String()}, st.Retention.Skipped)
+	r.Len(st.Retention.Decisions, 1)
+	for _, d := range st.Retention.Decisions {
+		r.Equal("max-messages", d.Rule)
+		r.EqualValues(3, d.Kept)
+		r.Equal(-1, d.Hops)
+	}
+
+	// the feeds can still grow
+	_, err = theBot.PublishAs("one", refs.NewPost("still here"))
+	r.NoError(err)
+
+	theBot.Shutdown()
+	r.NoError(theBot.Close())
+}
+
+// TestRetentionReplication a legacy feed over its quota is kept whole, a second bot still replicates and verifies it from the start
+func TestRetentionReplication(t *testing.T) {
+	if testutils.SkipOnCI(t) {
+		return
+	}
+	r := require.New(t)
+	ctx, cancel := ShutdownContext(context.TODO())
+	defer cancel()
+	botgroup, ctx := errgroup.WithContext(ctx)
+
+	testPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(testPath)
+
+	appKey := make([]byte, 32)
+	rand.Read(appKey)
+	hmacKey := make([]byte, 32)
+	rand.Read(hmacKey)
+	mainLog := testutils.NewRelativeTimeLogger(nil)
+	bs := newBotServer(ctx, mainLog)
+
+	aliPath := filepath.Join(testPath, "ali")
+	carl, err := repo.NewKeyPair(repo.New(aliPath), "carl", refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	ali, err := New(
+		WithAppKey(appKey),
+		WithHMACSigning(hmacKey),
+		WithContext(ctx),
+		WithInfo(log.With(mainLog, "unit", "ali")),
+		WithRepoPath(aliPath),
+		WithListenAddr(":0"),
+		DisableEBT(true),
+		WithRetention(RetentionPolicy{
+			Quota:    FeedQuota{MaxMessages: 3},
+			Interval: 10 * time.Millisecond,
+		}),
+	)
+	r.NoError(err)
+	botgroup.Go(bs.Serve(ali))
+
+	bob, err := New(
+		WithAppKey(appKey),
+		WithHMACSigning(hmacKey),
+		WithContext(ctx),
+		WithInfo(log.With(mainLog, "unit", "bob")),
+		WithRepoPath(filepath.Join(testPath, "bob")),
+		WithListenAddr(":0"),
+		DisableEBT(true),
+	)
+	r.NoError(err)
+	botgroup.Go(bs.Serve(bob))
+
+	const n = 8
+	for i := 0; i < n; i++ {
+		_, err := ali.PublishAs("carl", refs.NewPost(fmt.Sprintf("carl:%d", i)))
+		r.NoError(err)
+	}
+
+	// the retention ran over the feed and left it alone
+	r.Eventually(func() bool {
+		st := ali.retention.status()
+		return len(st.Skipped) == 1 && st.Skipped[0] == carl.ID().String()
+	}, 10*time.Second, 10*time.Millisecond)
+	r.EqualValues(0, ali.retention.status().Nulled)
+
+	ali.Replicate(bob.KeyPair.ID())
+	bob.Replicate(ali.KeyPair.ID())
+	bob.Replicate(carl.ID())
+
+	carlsLog, err := bob.Users.Get(storedrefs.Feed(carl.ID()))
+	r.NoError(err)
+	r.NoError(bob.Network.Connect(ctx, ali.Network.GetListenAddr()))
+	r.Eventually(func() bool {
+		return carlsLog.Seq() == n-1
+	}, 10*time.Second, 50*time.Millisecond, "bob didn't get the whole feed of carl")
+
+	bob.WaitUntilIndexesAreSynced()
+	r.NoError(bob.FSCK(FSCKWithMode(FSCKModeVerify)))
+
+	cancel()
+	ali.Shutdown()
+	bob.Shutdown()
+	r.NoError(ali.Close())
+	r.NoError(bob.Close())
+	r.NoError(botgroup.Wait())
+}
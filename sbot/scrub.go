@@ -0,0 +1,450 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package sbot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/sroar"
+	"go.cryptoscope.co/margaret"
+	librarian "go.cryptoscope.co/margaret/indexes"
+	kitlog "go.mindeco.de/log"
+	"go.mindeco.de/log/level"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/internal/storedrefs"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+// how many problems the scrubber keeps, the oldest are dropped first
+const scrubMaxProblems = 100
+
+// WithScrubber checks the receive log in the background while the bot is running, chunk entries at a time with a pause after each chunk.
+// Each message is verified again like FSCKModeVerify does and has to be in the feeds, get, msgTypes and timestamps indexes.
+// Once it reaches the end of the log it follows new messages, every repass it starts over from the first message (0 never starts over).
+// The position survives restarts and the problems it finds are reported by Status().
+func WithScrubber(chunk int, pause, repass time.Duration) Option {
+	return func(s *Sbot) error {
+		if chunk < 1 {
+			return fmt.Errorf("sbot: invalid scrubber chunk size: %d", chunk)
+		}
+		if pause <= 0 {
+			return fmt.Errorf("sbot: scrubber pause needs to be positive")
+		}
+		if s.scrubber != nil {
+			return fmt.Errorf("sbot: scrubber already configured")
+		}
+		s.scrubber = &scrubber{
+			chunk:  chunk,
+			pause:  pause,
+			repass: repass,
+		}
+		s.services = append(s.services, s.scrubber)
+		return nil
+	}
+}
+
+// scrubState is what the scrubber stores between restarts
+type scrubState struct {
+	Position    int64
+	Passes      int
+	PassStarted time.Time
+	PassDone    bool // the end of the log was reached in this pass
+	Problems    []ssb.ScrubProblem
+}
+
+type scrubber struct {
+	chunk  int
+	pause  time.Duration
+	repass time.Duration
+
+	bot       *Sbot
+	logger    kitlog.Logger
+	statePath string
+
+	mu    sync.Mutex
+	state scrubState
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+var _ Service = (*scrubber)(nil)
+
+// Serve loads the stored position and starts the scrubbing
+func (sc *scrubber) Serve(ctx context.Context, s *Sbot) error {
+	sc.bot = s
+	sc.logger = kitlog.With(s.info, "unit", "scrubber")
+	sc.statePath = repo.New(s.repoPath).GetPath("scrubber", "state.json")
+
+	err := sc.load()
+	if err != nil {
+		return err
+	}
+
+	ctx, sc.cancel = context.WithCancel(ctx)
+	sc.done = make(chan struct{})
+	go func() {
+		defer close(sc.done)
+		err := sc.run(ctx)
+		if err != nil && ctx.Err() == nil {
+			level.Error(sc.logger).Log("event", "scrubber stopped", "err", err)
+		}
+	}()
+	return nil
+}
+
+// Close stops the scrubbing and stores the position
+func (sc *scrubber) Close() error {
+	if sc.cancel == nil {
+		return nil
+	}
+	sc.cancel()
+	<-sc.done
+	return sc.save()
+}
+
+func (sc *scrubber) status() ssb.ScrubStatus {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	st := ssb.ScrubStatus{
+		Position: sc.state.Position,
+		Passes:   sc.state.Passes,
+		Problems: make([]ssb.ScrubProblem, len(sc.state.Problems)),
+	}
+	copy(st.Problems, sc.state.Problems)
+	return st
+}
+
+func (sc *scrubber) load() error {
+	f, err := os.Open(sc.statePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			sc.state.PassStarted = time.Now()
+			return nil
+		}
+		return fmt.Errorf("scrubber: failed to open state: %w", err)
+	}
+	defer f.Close()
+
+	err = json.NewDecoder(f).Decode(&sc.state)
+	if err != nil {
+		return fmt.Errorf("scrubber: failed to decode state: %w", err)
+	}
+	return nil
+}
+
+func (sc *scrubber) save() error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	err := os.MkdirAll(filepath.Dir(sc.statePath), 0700)
+	if err != nil {
+		return fmt.Errorf("scrubber: failed to create state folder: %w", err)
+	}
+
+	newStatePath := sc.statePath + ".new"
+	stateFile, err := os.OpenFile(newStatePath, os.O_TRUNC|os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	err = json.NewEncoder(stateFile).Encode(sc.state)
+	if err != nil {
+		stateFile.Close()
+		return err
+	}
+
+	// avoid weird behavior for renaming an open file.
+	if err := stateFile.Close(); err != nil {
+		return err
+	}
+
+	err = os.Rename(newStatePath, sc.statePath)
+	if err != nil {
+		return fmt.Errorf("failed to replace %s with %s: %w", sc.statePath, newStatePath, err)
+	}
+	return nil
+}
+
+func (sc *scrubber) report(seq int64, err error) {
+	level.Warn(sc.logger).Log("event", "scrub problem", "seq", seq, "err", err)
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	problems := sc.state.Problems[:0]
+	for _, p := range sc.state.Problems {
+		if p.Seq != seq {
+			problems = append(problems, p)
+		}
+	}
+	problems = append(problems, ssb.ScrubProblem{
+		Seq:   seq,
+		Found: time.Now(),
+		Err:   err.Error(),
+	})
+	if len(problems) > scrubMaxProblems {
+		problems = problems[len(problems)-scrubMaxProblems:]
+	}
+	sc.state.Problems = problems
+}
+
+func (sc *scrubber) run(ctx context.Context) error {
+	// the backlog of the indexes would look like missing entries
+	synced := make(chan struct{})
+	go func() {
+		sc.bot.WaitUntilIndexesAreSynced()
+		close(synced)
+	}()
+	select {
+	case <-synced:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	for {
+		sc.mu.Lock()
+		from := sc.state.Position
+		sc.mu.Unlock()
+
+		// only the messages the timestamps index has, the other indexes are re-checked before a problem is reported
+		head := sc.bot.SeqResolver.Seq()
+		if rxHead := sc.bot.ReceiveLog.Seq() + 1; rxHead < head {
+			head = rxHead
+		}
+
+		if from >= head {
+			if head > 0 && sc.endOfLog() {
+				continue
+			}
+			if !sleepCtx(ctx, sc.pause) {
+				return ctx.Err()
+			}
+			continue
+		}
+
+		to := from + int64(sc.chunk)
+		if to > head {
+			to = head
+		}
+
+		suspects, err := sc.checkChunk(ctx, from, to)
+		if err != nil {
+			return err
+		}
+
+		if !sleepCtx(ctx, sc.pause) {
+			return ctx.Err()
+		}
+
+		// the indexes might not have been updated yet
+		for seq := range suspects {
+			err := sc.check(ctx, seq, make(map[string]*sroar.Bitmap))
+			if err != nil {
+				sc.report(seq, err)
+			}
+		}
+
+		sc.mu.Lock()
+		sc.state.Position = to
+		sc.mu.Unlock()
+
+		err = sc.save()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// endOfLog finishes the pass by checking the feed lengths, the first time the scrubber reaches the end of the log.
+// It returns true if the next pass starts over from the first message.
+func (sc *scrubber) endOfLog() bool {
+	sc.mu.Lock()
+	finished := sc.state.PassDone
+	sc.mu.Unlock()
+
+	if !finished {
+		err := lengthFSCK(sc.bot.Users, sc.bot.ReceiveLog)
+		if err != nil {
+			sc.report(-1, err)
+		}
+
+		sc.mu.Lock()
+		sc.state.Passes++
+		sc.state.PassDone = true
+		level.Info(sc.logger).Log("event", "scrub pass done", "passes", sc.state.Passes)
+		sc.mu.Unlock()
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.repass == 0 || time.Since(sc.state.PassStarted) < sc.repass {
+		return false
+	}
+	sc.state.Position = 0
+	sc.state.PassStarted = time.Now()
+	sc.state.PassDone = false
+	return true
+}
+
+// checkChunk checks the entries from to to (exclusive) and returns the ones with problems
+func (sc *scrubber) checkChunk(ctx context.Context, from, to int64) (map[int64]error, error) {
+	suspects := make(map[int64]error)
+	// the msgTypes bitmaps of this chunk
+	byType := make(map[string]*sroar.Bitmap)
+	for seq := from; seq < to; seq++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		err := sc.check(ctx, seq, byType)
+		if err != nil {
+			suspects[seq] = err
+		}
+	}
+	return suspects, nil
+}
+
+// check verifies the message at rxSeq against the message before it and looks it up in the indexes
+func (sc *scrubber) check(ctx context.Context, rxSeq int64, byType map[string]*sroar.Bitmap) error {
+	s := sc.bot
+
+	v, err := s.ReceiveLog.Get(rxSeq)
+	if err != nil {
+		if margaret.IsErrNulled(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to load message: %w", err)
+	}
+
+	msg, raw, err := storedMessage(v)
+	if err != nil {
+		return err
+	}
+	author := msg.Author()
+
+	// feeds: the sublog of the author has to point to this message at its sequence
+	userLog, err := s.Users.Get(storedrefs.Feed(author))
+	if err != nil {
+		return fmt.Errorf("feeds index: failed to open sublog of %s: %w", author.ShortSigil(), err)
+	}
+	indexed, err := userLog.Get(msg.Seq() - 1)
+	if err != nil {
+		return fmt.Errorf("feeds index: no entry for %s:%d: %w", author.ShortSigil(), msg.Seq(), err)
+	}
+	if indexed != rxSeq {
+		return fmt.Errorf("feeds index: %s:%d points to %v", author.ShortSigil(), msg.Seq(), indexed)
+	}
+
+	// signature and previous hash
+	var previous refs.Message
+	if msg.Seq() > 1 {
+		prevSeq, err := userLog.Get(msg.Seq() - 2)
+		if err != nil {
+			return fmt.Errorf("feeds index: no entry for %s:%d: %w", author.ShortSigil(), msg.Seq()-1, err)
+		}
+		prevRxSeq, ok := prevSeq.(int64)
+		if !ok {
+			return fmt.Errorf("feeds index: unexpected entry type %T", prevSeq)
+		}
+		pv, err := s.ReceiveLog.Get(prevRxSeq)
+		if margaret.IsErrNulled(err) {
+			// only the previous link can't be checked
+			previous = nulledPrevious(msg)
+		} else if err != nil {
+			return fmt.Errorf("failed to load previous message: %w", err)
+		} else {
+			previous, _, err = storedMessage(pv)
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		var start refs.KeyValueRaw
+		start.Value.Author = author
+		previous = start
+	}
+	snk, err := message.NewVerifySink(author, previous, &fsckSaver{stored: msg}, s.signHMACsecret)
+	if err != nil {
+		return err
+	}
+	err = snk.Verify(raw)
+	if err != nil {
+		return err
+	}
+	if snk.Seq() != msg.Seq() {
+		return fmt.Errorf("sequence %d was already stored", msg.Seq())
+	}
+
+	// get
+	getIdx, ok := s.simpleIndex["get"]
+	if !ok {
+		return fmt.Errorf("get index disabled")
+	}
+	obs, err := getIdx.Get(ctx, storedrefs.Message(msg.Key()))
+	if err != nil {
+		return fmt.Errorf("get index: %w", err)
+	}
+	gotSeq, err := obs.Value()
+	if err != nil {
+		return fmt.Errorf("get index: %w", err)
+	}
+	if gotSeq != rxSeq {
+		return fmt.Errorf("get index: %s points to %v", msg.Key().ShortSigil(), gotSeq)
+	}
+
+	// timestamps
+	sorted, err := s.SeqResolver.SortAndFilter([]int64{rxSeq}, repo.SortByFeedSeq, func(int64) bool { return true }, false)
+	if err != nil {
+		return fmt.Errorf("timestamps index: %w", err)
+	}
+	if len(sorted) != 1 || sorted[0].By != msg.Seq() {
+		return fmt.Errorf("timestamps index: wrong sequence for %s", msg.Key().ShortSigil())
+	}
+
+	// msgTypes, like the combined index only for readable json objects with a type
+	content := msg.ContentBytes()
+	if len(content) == 0 || content[0] != '{' {
+		return nil
+	}
+	var typed struct {
+		Type string
+	}
+	if json.Unmarshal(content, &typed) != nil || typed.Type == "" {
+		return nil
+	}
+	bmap, has := byType[typed.Type]
+	if !has {
+		bmap, err = s.ByType.LoadInternalBitmap(librarian.Addr("string:" + typed.Type))
+		if err != nil {
+			return fmt.Errorf("msgTypes index: %w", err)
+		}
+		byType[typed.Type] = bmap
+	}
+	if !bmap.Contains(uint64(rxSeq)) {
+		return fmt.Errorf("msgTypes index: %s is not in %q", msg.Key().ShortSigil(), typed.Type)
+	}
+
+	return nil
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,150 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package sbot
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb/internal/testutils"
+	"go.cryptoscope.co/ssb/message/multimsg"
+)
+
+func TestScrubber(t *testing.T) {
+	if testutils.SkipOnCI(t) {
+		return
+	}
+	r := require.New(t)
+
+	testPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(testPath)
+
+	theBot, botOptions := makeFSCKTestBot(t)
+
+	const n = 10
+	for i := n; i > 0; i-- {
+		post := refs.NewPost(fmt.Sprintf("test:%d", i))
+		_, err := theBot.PublishLog.Publish(post)
+		r.NoError(err)
+	}
+	theBot.Shutdown()
+	r.NoError(theBot.Close())
+
+	// a clean pass over the log
+	scrubOptions := append(botOptions, WithScrubber(3, 10*time.Millisecond, 0))
+	theBot, err := New(scrubOptions...)
+	r.NoError(err)
+
+	r.Eventually(func() bool {
+		return theBot.scrubber.status().Passes == 1
+	}, 10*time.Second, 10*time.Millisecond)
+	st := theBot.scrubber.status()
+	r.EqualValues(n, st.Position)
+	r.Len(st.Problems, 0)
+
+	// tamper with the content of a message
+	const tampered = 4
+	v, err := theBot.ReceiveLog.Get(tampered)
+	r.NoError(err)
+	mm, ok := v.(*multimsg.MultiMessage)
+	r.True(ok, "wrong message type. got %T", v)
+	sm, ok := mm.AsLegacy()
+	r.True(ok)
+	sm.Raw_ = bytes.Replace(sm.Raw_, []byte("test:"), []byte("tset:"), 1)
+	changed, err := mm.MarshalBinary()
+	r.NoError(err)
+	r.NoError(theBot.ReceiveLog.Replace(tampered, changed))
+
+	// new messages are checked as they come in
+	post := refs.NewPost("one more")
+	_, err = theBot.PublishLog.Publish(post)
+	r.NoError(err)
+	r.Eventually(func() bool {
+		return theBot.scrubber.status().Position == n+1
+	}, 10*time.Second, 10*time.Millisecond)
+	r.Len(theBot.scrubber.status().Problems, 0, "the tampered message was checked before")
+
+	theBot.Shutdown()
+	r.NoError(theBot.Close())
+
+	// the position survives the restart, starting over finds the tampered message
+	scrubOptions = append(botOptions, WithScrubber(3, 10*time.Millisecond, time.Nanosecond))
+	theBot, err = New(scrubOptions...)
+	r.NoError(err)
+	r.GreaterOrEqual(theBot.scrubber.status().Passes, 1)
+
+	r.Eventually(func() bool {
+		st := theBot.scrubber.status()
+		return st.Passes > 1 && len(st.Problems) > 0
+	}, 10*time.Second, 10*time.Millisecond)
+	st = theBot.scrubber.status()
+	r.EqualValues(tampered, st.Problems[0].Seq)
+	r.Contains(st.Problems[0].Err, "verify failed")
+
+	theBot.Shutdown()
+	r.NoError(theBot.Close())
+}
+
+// TestScrubberAfterNulled the message after a nulled one is still verified, only its previous link isn't
+func TestScrubberAfterNulled(t *testing.T) {
+	if testutils.SkipOnCI(t) {
+		return
+	}
+	r := require.New(t)
+
+	testPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(testPath)
+
+	theBot, botOptions := makeFSCKTestBot(t)
+
+	const n = 6
+	for i := n; i > 0; i-- {
+		post := refs.NewPost(fmt.Sprintf("test:%d", i))
+		_, err := theBot.PublishLog.Publish(post)
+		r.NoError(err)
+	}
+
+	const nulled, tampered = 2, 3
+	r.NoError(theBot.ReceiveLog.Null(nulled))
+	v, err := theBot.ReceiveLog.Get(tampered)
+	r.NoError(err)
+	mm, ok := v.(*multimsg.MultiMessage)
+	r.True(ok, "wrong message type. got %T", v)
+	sm, ok := mm.AsLegacy()
+	r.True(ok)
+	sm.Raw_ = bytes.Replace(sm.Raw_, []byte("test:"), []byte("tset:"), 1)
+	changed, err := mm.MarshalBinary()
+	r.NoError(err)
+	r.NoError(theBot.ReceiveLog.Replace(tampered, changed))
+	theBot.Shutdown()
+	r.NoError(theBot.Close())
+
+	scrubOptions := append(botOptions, WithScrubber(3, 10*time.Millisecond, 0))
+	theBot, err = New(scrubOptions...)
+	r.NoError(err)
+
+	r.Eventually(func() bool {
+		return theBot.scrubber.status().Passes == 1
+	}, 10*time.Second, 10*time.Millisecond)
+	// the message after the tampered one fails its previous link as well
+	var found bool
+	for _, p := range theBot.scrubber.status().Problems {
+		if p.Seq == tampered {
+			r.Contains(p.Err, "verify failed")
+			found = true
+		}
+	}
+	r.True(found, "the tampered message was not reported")
+
+	theBot.Shutdown()
+	r.NoError(theBot.Close())
+}
@@ -0,0 +1,23 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package sbot
+
+import (
+	"fmt"
+
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb/message"
+)
+
+// Search returns the messages that contain all the terms of qry.Query, see the search.query source for the arguments.
+// Private messages are only returned if qry.Private is set, as they are stored (boxed).
+func (s *Sbot) Search(qry message.SearchArgs) ([]refs.Message, error) {
+	if s.searchIndex == nil {
+		return nil, fmt.Errorf("sbot: search index disabled")
+	}
+
+	return s.searchIndex.Find(s.ReceiveLog, s.SeqResolver, qry)
+}
@@ -0,0 +1,154 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package sbot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mindeco.de/log"
+
+	"go.cryptoscope.co/ssb/internal/leakcheck"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/plugins/search"
+	"go.cryptoscope.co/ssb/repo"
+	refs "go.mindeco.de/ssb-refs"
+)
+
+func TestSearch(t *testing.T) {
+	defer leakcheck.Check(t)
+	r := require.New(t)
+
+	tRepoPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(tRepoPath)
+
+	mainLog := log.NewNopLogger()
+	if testing.Verbose() {
+		mainLog = log.NewLogfmtLogger(os.Stderr)
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	bot, err := New(
+		WithContext(ctx),
+		WithInfo(mainLog),
+		WithRepoPath(tRepoPath),
+		WithListenAddr(":0"),
+		DisableEBT(true),
+		WithSearchIndex(true),
+	)
+	r.NoError(err)
+
+	hello, err := bot.PublishLog.Publish(refs.NewPost("Hello, searchable World!"))
+	r.NoError(err)
+	_, err = bot.PublishLog.Publish(refs.NewPost("another world"))
+	r.NoError(err)
+	_, err = bot.PublishLog.Publish(map[string]interface{}{"type": "test", "text": "not a post, world"})
+	r.NoError(err)
+	_, err = bot.PublishLog.Publish(map[string]interface{}{"type": "about", "about": bot.KeyPair.ID().String(), "name": "Searchable Sam"})
+	r.NoError(err)
+
+	cloaked, _, err := bot.Groups.Create("searchers")
+	r.NoError(err)
+	secret, err := bot.Groups.PublishPostTo(cloaked, "a secret world")
+	r.NoError(err)
+
+	bot.WaitUntilIndexesAreSynced()
+
+	keysOf := func(msgs []refs.Message) []string {
+		var keys []string
+		for _, m := range msgs {
+			keys = append(keys, m.Key().String())
+		}
+		return keys
+	}
+
+	// the private post is only found if asked for
+	found, err := bot.Search(message.SearchArgs{Query: "world"})
+	r.NoError(err)
+	r.Len(found, 2)
+	r.NotContains(keysOf(found), secret.String())
+
+	found, err = bot.Search(message.SearchArgs{Query: "WORLD", CommonArgs: message.CommonArgs{Private: true}})
+	r.NoError(err)
+	r.Len(found, 3)
+	r.Contains(keysOf(found), secret.String())
+
+	// all the terms have to match
+	found, err = bot.Search(message.SearchArgs{Query: "world hello"})
+	r.NoError(err)
+	r.Equal([]string{hello.Key().String()}, keysOf(found))
+
+	// posts and the names of abouts
+	found, err = bot.Search(message.SearchArgs{Query: "searchable"})
+	r.NoError(err)
+	r.Len(found, 2)
+
+	// one per page
+	found, err = bot.Search(message.SearchArgs{Query: "world", StreamArgs: message.StreamArgs{Limit: 1}})
+	r.NoError(err)
+	r.Len(found, 1)
+
+	_, err = bot.Search(message.SearchArgs{Query: "  ?! "})
+	r.ErrorIs(err, search.ErrEmptyQuery)
+
+	bot.Shutdown()
+	r.NoError(bot.Close())
+}
+
+// TestSearchDroppedContent messages whose content or entry was dropped after they were indexed are not found anymore,
+// and don't take the place of other matches on a page
+func TestSearchDroppedContent(t *testing.T) {
+	defer leakcheck.Check(t)
+	r := require.New(t)
+
+	tRepoPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(tRepoPath)
+
+	kpBert, err := repo.NewKeyPair(repo.New(tRepoPath), "bert", refs.RefAlgoFeedGabby)
+	r.NoError(err)
+
+	bot, err := New(
+		WithInfo(log.NewNopLogger()),
+		WithRepoPath(tRepoPath),
+		DisableNetworkNode(),
+		WithSearchIndex(true),
+	)
+	r.NoError(err)
+
+	kept, err := bot.PublishLog.Publish(refs.NewPost("kept world"))
+	r.NoError(err)
+	_, err = bot.PublishLog.Publish(refs.NewPost("nulled world"))
+	r.NoError(err)
+	nulledSeq := bot.ReceiveLog.Seq()
+	_, err = bot.PublishAs("bert", refs.NewPost("dropped world"))
+	r.NoError(err)
+	bot.WaitUntilIndexesAreSynced()
+
+	found, err := bot.Search(message.SearchArgs{Query: "world"})
+	r.NoError(err)
+	r.Len(found, 3)
+
+	// a drop-content-request and the retention of a whole entry
+	r.NoError(bot.NullContent(kpBert.ID(), 1))
+	r.NoError(bot.ReceiveLog.Null(nulledSeq))
+
+	found, err = bot.Search(message.SearchArgs{Query: "world"})
+	r.NoError(err)
+	r.Len(found, 1)
+	r.True(kept.Key().Equal(found[0].Key()))
+
+	found, err = bot.Search(message.SearchArgs{Query: "world", StreamArgs: message.StreamArgs{Limit: 1}})
+	r.NoError(err)
+	r.Len(found, 1, "the dropped messages are newer but left out before the page is cut")
+	r.True(kept.Key().Equal(found[0].Key()))
+
+	bot.Shutdown()
+	r.NoError(bot.Close())
+}
@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package sbot
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/margaret"
+
+	"go.cryptoscope.co/ssb/internal/leakcheck"
+	"go.cryptoscope.co/ssb/internal/testutils"
+)
+
+// countingService publishes one message when it is started and counts the messages of the receive log when it is closed
+type countingService struct {
+	bot     *Sbot
+	served  int
+	counted int
+}
+
+func (cs *countingService) Serve(ctx context.Context, s *Sbot) error {
+	cs.bot = s
+	cs.served++
+	_, err := s.PublishLog.Publish(map[string]interface{}{"type": "test", "served": cs.served})
+	return err
+}
+
+func (cs *countingService) Close() error {
+	src, err := cs.bot.ReceiveLog.Query(margaret.Gte(0))
+	if err != nil {
+		return err
+	}
+	for {
+		_, err := src.Next(context.TODO())
+		if luigi.IsEOS(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		cs.counted++
+	}
+}
+
+// failingService fails to close
+type failingService struct{}
+
+var errFailingService = errors.New("failing service")
+
+func (failingService) Serve(context.Context, *Sbot) error { return nil }
+func (failingService) Close() error                       { return errFailingService }
+
+func TestWithService(t *testing.T) {
+	defer leakcheck.Check(t)
+	r := require.New(t)
+
+	repoPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(repoPath)
+
+	svc := new(countingService)
+	bot, err := New(
+		WithInfo(testutils.NewRelativeTimeLogger(nil)),
+		WithRepoPath(repoPath),
+		DisableNetworkNode(),
+		WithService(svc),
+	)
+	r.NoError(err)
+	r.Equal(1, svc.served)
+
+	bot.Shutdown()
+	r.NoError(bot.Close())
+	r.Equal(1, svc.counted, "the service is closed before the receive log")
+}
+
+// TestServiceCloseError a service that fails to close doesn't keep the bot from closing the others and its databases
+func TestServiceCloseError(t *testing.T) {
+	defer leakcheck.Check(t)
+	r := require.New(t)
+
+	repoPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(repoPath)
+
+	svc := new(countingService)
+	bot, err := New(
+		WithInfo(testutils.NewRelativeTimeLogger(nil)),
+		WithRepoPath(repoPath),
+		DisableNetworkNode(),
+		WithService(failingService{}),
+		WithService(svc),
+	)
+	r.NoError(err)
+
+	bot.Shutdown()
+	err = bot.Close()
+	r.ErrorIs(err, errFailingService)
+	r.Equal(1, svc.counted, "the next service is closed as well")
+	r.Equal(err, bot.Close(), "closing again returns the same error")
+
+	// the databases were closed, the repo opens again
+	bot, err = New(
+		WithInfo(testutils.NewRelativeTimeLogger(nil)),
+		WithRepoPath(repoPath),
+		DisableNetworkNode(),
+	)
+	r.NoError(err)
+	bot.Shutdown()
+	r.NoError(bot.Close())
+}
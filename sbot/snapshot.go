@@ -0,0 +1,554 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package sbot
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/offset2"
+
+	"go.cryptoscope.co/ssb/message/multimsg"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+const (
+	snapshotVersion = 1
+
+	// the entries of a snapshot archive, the manifest is the last one
+	snapshotManifestName = "manifest.json"
+	snapshotLogName      = "receive-log"
+	snapshotIndexName    = "shared-badger.backup"
+	snapshotFilesPrefix  = "files/"
+
+	// snapshotImportSuffix is the folder next to the repo an import is unpacked and checked in
+	snapshotImportSuffix = ".snapshot-import"
+)
+
+// snapshotFiles are copied into a snapshot as they are, relative to the repo.
+// The other indexes that are kept in files are rebuilt from the receive log by the first New() after the import.
+var snapshotFiles = [][]string{
+	{"secret"},
+	{"secrets"},
+	{"blobs", "sha256"},
+	{"indexfeeds"},
+	{repo.PrefixMultiLog, indexVersionsName},
+}
+
+// SnapshotManifest describes the content of a snapshot archive
+type SnapshotManifest struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	Feed    string    `json:"feed"`
+
+	// LogSeq is the last entry of the receive log in the snapshot, the indexes don't know any later messages
+	LogSeq int64 `json:"log_seq"`
+
+	Entries []SnapshotEntry `json:"entries"`
+}
+
+// SnapshotEntry is a file of a snapshot archive
+type SnapshotEntry struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// ExportSnapshot writes a consistent copy of the repo of the running bot to w, as a tar archive.
+// It holds a backup of the shared index database, the receive log up to the last message the indexes can know,
+// the blobs and the keypairs of the bot, so keep it as safe as the repo itself. ImportSnapshot turns it back into a repo.
+func (s *Sbot) ExportSnapshot(ctx context.Context, w io.Writer) (*SnapshotManifest, error) {
+	manifest := &SnapshotManifest{
+		Version: snapshotVersion,
+		Created: time.Now(),
+		Feed:    s.KeyPair.ID().String(),
+	}
+	sw := snapshotWriter{
+		tw:       tar.NewWriter(w),
+		manifest: manifest,
+	}
+
+	// the indexes first, the messages they know are in the log before the position is taken
+	indexBackup, err := snapshotTempFile(s.repoPath, func(f *os.File) error {
+		_, err := s.indexStore.Backup(f, 0)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("snapshot: failed to back up the indexes: %w", err)
+	}
+	defer os.Remove(indexBackup)
+
+	manifest.LogSeq = s.ReceiveLog.Seq()
+
+	logStream, err := snapshotTempFile(s.repoPath, func(f *os.File) error {
+		return writeSnapshotLog(ctx, f, s.ReceiveLog, manifest.LogSeq)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("snapshot: failed to copy the receive log: %w", err)
+	}
+	defer os.Remove(logStream)
+
+	err = sw.addFile(snapshotLogName, logStream)
+	if err != nil {
+		return nil, err
+	}
+	err = sw.addFile(snapshotIndexName, indexBackup)
+	if err != nil {
+		return nil, err
+	}
+
+	r := repo.New(s.repoPath)
+	for _, rel := range snapshotFiles {
+		root := r.GetPath(rel...)
+		err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			name, err := filepath.Rel(s.repoPath, p)
+			if err != nil {
+				return err
+			}
+			return sw.addFile(snapshotFilesPrefix+filepath.ToSlash(name), p)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("snapshot: failed to copy %s: %w", filepath.Join(rel...), err)
+		}
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	err = sw.add(snapshotManifestName, int64(len(data)), bytes.NewReader(data), false)
+	if err != nil {
+		return nil, err
+	}
+
+	err = sw.tw.Close()
+	if err != nil {
+		return nil, fmt.Errorf("snapshot: failed to finish the archive: %w", err)
+	}
+	return manifest, nil
+}
+
+// ImportSnapshot turns a snapshot of ExportSnapshot into a new repo at repoPath, which must not exist or be empty.
+// The archive is unpacked next to repoPath and checked against the checksums of its manifest before the repo is put in place,
+// a broken or incomplete snapshot leaves nothing behind. The first New() with the repo catches up the indexes.
+func ImportSnapshot(ctx context.Context, r io.Reader, repoPath string) (*SnapshotManifest, error) {
+	entries, err := os.ReadDir(repoPath)
+	if err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("snapshot: %s is not empty", repoPath)
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("snapshot: failed to check %s: %w", repoPath, err)
+	}
+
+	staging := filepath.Clean(repoPath) + snapshotImportSuffix
+	err = os.RemoveAll(staging)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot: failed to remove an earlier import: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	archive := filepath.Join(staging, "archive")
+	manifest, err := unpackSnapshot(ctx, r, archive)
+	if err != nil {
+		return nil, err
+	}
+
+	imported := filepath.Join(staging, "repo")
+	ir := repo.New(imported)
+
+	n, err := readSnapshotLog(ctx, filepath.Join(archive, snapshotLogName), ir.GetPath("log"))
+	if err != nil {
+		return nil, fmt.Errorf("snapshot: failed to restore the receive log: %w", err)
+	}
+	if n != manifest.LogSeq+1 {
+		return nil, fmt.Errorf("snapshot: receive log has %d entries but the manifest claims %d", n, manifest.LogSeq+1)
+	}
+
+	err = loadSnapshotIndexes(filepath.Join(archive, snapshotIndexName), ir.GetPath(repo.PrefixMultiLog, "shared-badger"))
+	if err != nil {
+		return nil, fmt.Errorf("snapshot: failed to restore the indexes: %w", err)
+	}
+
+	for _, e := range manifest.Entries {
+		if !strings.HasPrefix(e.Name, snapshotFilesPrefix) {
+			continue
+		}
+		rel := filepath.FromSlash(strings.TrimPrefix(e.Name, snapshotFilesPrefix))
+		dst := filepath.Join(imported, rel)
+		err = os.MkdirAll(filepath.Dir(dst), 0700)
+		if err != nil {
+			return nil, fmt.Errorf("snapshot: %w", err)
+		}
+		err = os.Rename(filepath.Join(archive, filepath.FromSlash(e.Name)), dst)
+		if err != nil {
+			return nil, fmt.Errorf("snapshot: failed to restore %s: %w", rel, err)
+		}
+	}
+
+	// an empty folder was checked above
+	err = os.RemoveAll(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot: %w", err)
+	}
+	err = os.Rename(imported, repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot: failed to move the repo in place: %w", err)
+	}
+	return manifest, nil
+}
+
+type snapshotWriter struct {
+	tw       *tar.Writer
+	manifest *SnapshotManifest
+}
+
+func (sw *snapshotWriter) addFile(name, p string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return fmt.Errorf("snapshot: %w", err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("snapshot: %w", err)
+	}
+	return sw.add(name, fi.Size(), f, true)
+}
+
+// add writes an entry to the archive and records its checksum in the manifest, unless it is the manifest
+func (sw *snapshotWriter) add(name string, size int64, r io.Reader, record bool) error {
+	err := sw.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0600,
+		ModTime:  sw.manifest.Created,
+	})
+	if err != nil {
+		return fmt.Errorf("snapshot: failed to add %s: %w", name, err)
+	}
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(sw.tw, h), io.LimitReader(r, size))
+	if err != nil {
+		return fmt.Errorf("snapshot: failed to add %s: %w", name, err)
+	}
+	if n != size {
+		return fmt.Errorf("snapshot: %s changed while it was added", name)
+	}
+
+	if record {
+		sw.manifest.Entries = append(sw.manifest.Entries, SnapshotEntry{
+			Name:   name,
+			Size:   size,
+			SHA256: hex.EncodeToString(h.Sum(nil)),
+		})
+	}
+	return nil
+}
+
+// unpackSnapshot writes the entries of the archive to dir and checks them against the manifest
+func unpackSnapshot(ctx context.Context, r io.Reader, dir string) (*SnapshotManifest, error) {
+	var (
+		manifest *SnapshotManifest
+		unpacked = make(map[string]SnapshotEntry)
+	)
+
+	tr := tar.NewReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("snapshot: broken archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("snapshot: unexpected entry %s", hdr.Name)
+		}
+		if manifest != nil {
+			return nil, fmt.Errorf("snapshot: %s after the manifest", hdr.Name)
+		}
+
+		if hdr.Name == snapshotManifestName {
+			manifest = new(SnapshotManifest)
+			err = json.NewDecoder(io.LimitReader(tr, hdr.Size)).Decode(manifest)
+			if err != nil {
+				return nil, fmt.Errorf("snapshot: broken manifest: %w", err)
+			}
+			continue
+		}
+
+		// the names end up in the repo, nothing may point outside of it
+		name := path.Clean(hdr.Name)
+		if name != hdr.Name || path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, fmt.Errorf("snapshot: invalid entry name %q", hdr.Name)
+		}
+		if _, has := unpacked[name]; has {
+			return nil, fmt.Errorf("snapshot: %s is in the archive twice", name)
+		}
+
+		dst := filepath.Join(dir, filepath.FromSlash(name))
+		err = os.MkdirAll(filepath.Dir(dst), 0700)
+		if err != nil {
+			return nil, fmt.Errorf("snapshot: %w", err)
+		}
+		f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("snapshot: %w", err)
+		}
+		h := sha256.New()
+		n, err := io.Copy(io.MultiWriter(f, h), tr)
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("snapshot: failed to unpack %s: %w", name, err)
+		}
+		unpacked[name] = SnapshotEntry{
+			Name:   name,
+			Size:   n,
+			SHA256: hex.EncodeToString(h.Sum(nil)),
+		}
+	}
+
+	if manifest == nil {
+		return nil, fmt.Errorf("snapshot: the manifest is missing, the archive is incomplete")
+	}
+	if manifest.Version != snapshotVersion {
+		return nil, fmt.Errorf("snapshot: unsupported version %d", manifest.Version)
+	}
+
+	for _, e := range manifest.Entries {
+		got, has := unpacked[e.Name]
+		if !has {
+			return nil, fmt.Errorf("snapshot: %s is missing", e.Name)
+		}
+		if got != e {
+			return nil, fmt.Errorf("snapshot: checksum of %s doesn't match", e.Name)
+		}
+		delete(unpacked, e.Name)
+	}
+	if len(unpacked) > 0 {
+		var extra []string
+		for name := range unpacked {
+			extra = append(extra, name)
+		}
+		return nil, fmt.Errorf("snapshot: %s not in the manifest", strings.Join(extra, ", "))
+	}
+	for _, name := range []string{snapshotLogName, snapshotIndexName} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			return nil, fmt.Errorf("snapshot: %s is missing", name)
+		}
+	}
+	return manifest, nil
+}
+
+func snapshotTempFile(dir string, write func(f *os.File) error) (string, error) {
+	f, err := os.CreateTemp(dir, "snapshot-*")
+	if err != nil {
+		return "", err
+	}
+
+	err = write(f)
+	if cerr := f.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// writeSnapshotLog writes the entries of the receive log up to last as they are stored,
+// each with its length in front. Nulled entries have a length of zero, so the sequences stay the same.
+func writeSnapshotLog(ctx context.Context, w io.Writer, rxlog margaret.Log, last int64) error {
+	bw := bufio.NewWriter(w)
+	var length [4]byte
+	for seq := int64(0); seq <= last; seq++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var data []byte
+		v, err := rxlog.Get(seq)
+		if err == nil {
+			if verr, ok := v.(error); ok {
+				err = verr
+			}
+		}
+		if err != nil && !margaret.IsErrNulled(err) {
+			return fmt.Errorf("failed to get entry %d: %w", seq, err)
+		}
+		if err == nil {
+			mm, ok := v.(*multimsg.MultiMessage)
+			if !ok {
+				return fmt.Errorf("unexpected entry %d: %T", seq, v)
+			}
+			data, err = mm.MarshalBinary()
+			if err != nil {
+				return fmt.Errorf("failed to encode entry %d: %w", seq, err)
+			}
+		}
+
+		binary.BigEndian.PutUint32(length[:], uint32(len(data)))
+		if _, err := bw.Write(length[:]); err != nil {
+			return err
+		}
+		if _, err := bw.Write(data); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// readSnapshotLog appends the entries of a snapshot to a new receive log at logPath and returns how many there were
+func readSnapshotLog(ctx context.Context, streamPath, logPath string) (int64, error) {
+	f, err := os.Open(streamPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	// the entries are appended as they were stored, without decoding them
+	rxlog, err := offset2.Open(logPath, snapshotCodec{})
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		n      int64
+		length [4]byte
+		br     = bufio.NewReader(f)
+	)
+	for {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+
+		_, err = io.ReadFull(br, length[:])
+		if err == io.EOF {
+			err = nil
+			break
+		}
+		if err != nil {
+			break
+		}
+
+		data := make([]byte, binary.BigEndian.Uint32(length[:]))
+		_, err = io.ReadFull(br, data)
+		if err != nil {
+			break
+		}
+
+		nulled := len(data) == 0
+		if nulled {
+			data = []byte{0}
+		}
+		var seq int64
+		seq, err = rxlog.Append(data)
+		if err != nil {
+			break
+		}
+		if nulled {
+			err = rxlog.Null(seq)
+			if err != nil {
+				break
+			}
+		}
+		n++
+	}
+
+	if cerr := rxlog.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+func loadSnapshotIndexes(backupPath, dbPath string) error {
+	f, err := os.Open(backupPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	db, err := repo.OpenBadgerDB(dbPath)
+	if err != nil {
+		return err
+	}
+
+	err = db.Load(f, 256)
+	if cerr := db.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// snapshotCodec passes the entries of the receive log through as they were stored by multimsg.MargaretCodec
+type snapshotCodec struct{}
+
+func (snapshotCodec) Marshal(v interface{}) ([]byte, error) {
+	data, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("snapshotCodec: wrong type: %T", v)
+	}
+	return data, nil
+}
+
+func (snapshotCodec) Unmarshal(data []byte) (interface{}, error) { return data, nil }
+
+func (c snapshotCodec) NewEncoder(w io.Writer) margaret.Encoder { return snapshotEncoder{w: w} }
+func (c snapshotCodec) NewDecoder(r io.Reader) margaret.Decoder { return snapshotDecoder{r: r} }
+
+type snapshotEncoder struct{ w io.Writer }
+
+func (enc snapshotEncoder) Encode(v interface{}) error {
+	data, err := snapshotCodec{}.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = enc.w.Write(data)
+	return err
+}
+
+type snapshotDecoder struct{ r io.Reader }
+
+func (dec snapshotDecoder) Decode() (interface{}, error) {
+	return io.ReadAll(dec.r)
+}
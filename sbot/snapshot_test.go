@@ -0,0 +1,152 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package sbot
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/margaret"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb/internal/storedrefs"
+	"go.cryptoscope.co/ssb/internal/testutils"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+// tamperSnapshot flips a byte of the named entry of the archive
+func tamperSnapshot(t *testing.T, archive []byte, name string) []byte {
+	r := require.New(t)
+
+	var out bytes.Buffer
+	tr := tar.NewReader(bytes.NewReader(archive))
+	tw := tar.NewWriter(&out)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		r.NoError(err)
+		data, err := io.ReadAll(tr)
+		r.NoError(err)
+		if hdr.Name == name {
+			data[len(data)/2] ^= 0xff
+		}
+		r.NoError(tw.WriteHeader(hdr))
+		_, err = tw.Write(data)
+		r.NoError(err)
+	}
+	r.NoError(tw.Close())
+	return out.Bytes()
+}
+
+func TestSnapshot(t *testing.T) {
+	if testutils.SkipOnCI(t) {
+		return
+	}
+	r := require.New(t)
+
+	testPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(testPath)
+	importPath := filepath.Join("testrun", t.Name()+"-imported")
+	os.RemoveAll(importPath)
+
+	theBot, botOptions := makeFSCKTestBot(t)
+
+	var last refs.Message
+	for i := 0; i < 5; i++ {
+		var err error
+		last, err = theBot.PublishLog.Publish(refs.NewPost(fmt.Sprintf("self:%d", i)))
+		r.NoError(err)
+	}
+	for i := 0; i < 4; i++ {
+		_, err := theBot.PublishAs("one", refs.NewPost(fmt.Sprintf("one:%d", i)))
+		r.NoError(err)
+	}
+	for i := 0; i < 3; i++ {
+		_, err := theBot.PublishAs("two", refs.NewPost(fmt.Sprintf("two:%d", i)))
+		r.NoError(err)
+	}
+	blob, err := theBot.BlobStore.Put(strings.NewReader("a blob in the snapshot"))
+	r.NoError(err)
+
+	// the sequences of nulled entries are kept
+	one, err := repo.LoadKeyPair(repo.New(testPath), "one")
+	r.NoError(err)
+	oneLog, err := theBot.Users.Get(storedrefs.Feed(one.ID()))
+	r.NoError(err)
+	v, err := oneLog.Get(0)
+	r.NoError(err)
+	nulled := v.(int64)
+	r.NoError(theBot.ReceiveLog.Null(nulled))
+
+	theBot.WaitUntilIndexesAreSynced()
+
+	var archive bytes.Buffer
+	manifest, err := theBot.ExportSnapshot(context.TODO(), &archive)
+	r.NoError(err)
+	r.EqualValues(11, manifest.LogSeq)
+	r.Equal(theBot.KeyPair.ID().String(), manifest.Feed)
+
+	// not in the snapshot
+	_, err = theBot.PublishLog.Publish(refs.NewPost("after the snapshot"))
+	r.NoError(err)
+
+	theBot.Shutdown()
+	r.NoError(theBot.Close())
+
+	// broken archives are rejected and leave nothing behind
+	_, err = ImportSnapshot(context.TODO(), bytes.NewReader(tamperSnapshot(t, archive.Bytes(), snapshotLogName)), importPath)
+	r.Error(err)
+	r.Contains(err.Error(), "checksum")
+	_, err = ImportSnapshot(context.TODO(), bytes.NewReader(archive.Bytes()[:archive.Len()/2]), importPath)
+	r.Error(err)
+	r.False(pathExists(importPath))
+	r.False(pathExists(importPath + snapshotImportSuffix))
+
+	_, err = ImportSnapshot(context.TODO(), bytes.NewReader(archive.Bytes()), testPath)
+	r.Error(err, "the repo of the bot is not empty")
+
+	imported, err := ImportSnapshot(context.TODO(), bytes.NewReader(archive.Bytes()), importPath)
+	r.NoError(err)
+	r.Equal(manifest.LogSeq, imported.LogSeq)
+
+	importedBot, err := New(append(botOptions, WithRepoPath(importPath), DisableLiveIndexMode())...)
+	r.NoError(err)
+	importedBot.WaitUntilIndexesAreSynced()
+
+	r.True(importedBot.KeyPair.ID().Equal(theBot.KeyPair.ID()))
+	r.Equal(manifest.LogSeq, importedBot.ReceiveLog.Seq())
+	r.NoError(importedBot.FSCK())
+
+	_, err = importedBot.ReceiveLog.Get(nulled)
+	r.True(margaret.IsErrNulled(err), "got %v", err)
+
+	got, err := importedBot.Get(last.Key())
+	r.NoError(err)
+	r.Equal(last.Key().String(), got.Key().String())
+
+	br, err := importedBot.BlobStore.Get(blob)
+	r.NoError(err)
+	content, err := io.ReadAll(br)
+	r.NoError(err)
+	r.NoError(br.Close())
+	r.Equal("a blob in the snapshot", string(content))
+
+	// the other keypairs came along
+	_, err = importedBot.PublishAs("one", refs.NewPost("one:4"))
+	r.NoError(err)
+
+	importedBot.Shutdown()
+	r.NoError(importedBot.Close())
+}
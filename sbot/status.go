@@ -25,7 +25,11 @@ func (sbot *Sbot) Status() (ssb.Status, error) {
 		Blobs: sbot.WantManager.AllWants(),
 	}
 
-	edps := sbot.Network.GetAllEndpoints()
+	// bots without a network node have no peers
+	var edps []ssb.EndpointStat
+	if sbot.Network != nil {
+		edps = sbot.Network.GetAllEndpoints()
+	}
 
 	sort.Sort(byConnTime(edps))
 
@@ -56,6 +60,16 @@ func (sbot *Sbot) Status() (ssb.Status, error) {
 	sort.Sort(byName(idxState))
 	s.Indicies = idxState
 
+	if sbot.scrubber != nil {
+		scrub := sbot.scrubber.status()
+		s.Scrub = &scrub
+	}
+
+	if sbot.retention != nil {
+		ret := sbot.retention.status()
+		s.Retention = &ret
+	}
+
 	return s, nil
 }
 